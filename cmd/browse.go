@@ -0,0 +1,356 @@
+//go:build !auto
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/database"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/FranLegon/cloud-drives-sync/internal/task"
+	"github.com/spf13/cobra"
+)
+
+var (
+	browseOutput string
+	lsAll        bool
+	findName     string
+	findMinSize  string
+	findMaxSize  string
+	findNewer    string
+	findOlder    string
+	findStatus   string
+	duDepth      int
+)
+
+// The browsing commands only read the local metadata.db, so they work offline.
+var browseAnnotations = map[string]string{
+	"skipDB": "true",
+}
+
+var lsCmd = &cobra.Command{
+	Use:         "ls [path]",
+	Short:       "List the files and folders of the pool",
+	Long:        "List the logical files and folders directly inside path (default /) with their replica coverage per provider.",
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: browseAnnotations,
+	RunE:        runLs,
+}
+
+var findCmd = &cobra.Command{
+	Use:   "find [path]",
+	Short: "Search the pool for files",
+	Long: `Search the logical files below path (default /).
+
+--newer and --older accept a date (2006-01-02), an RFC 3339 timestamp or an age such as 36h or 7d.
+Sizes accept K, M, G and T suffixes (powers of 1024).`,
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: browseAnnotations,
+	RunE:        runFind,
+}
+
+var duCmd = &cobra.Command{
+	Use:         "du [path]",
+	Short:       "Show space used by the pool per folder and provider",
+	Long:        "Show the logical size of the active files below path (default /) and the bytes their replicas take on each provider.",
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: browseAnnotations,
+	RunE:        runDu,
+}
+
+var statCmd = &cobra.Command{
+	Use:         "stat <path>",
+	Short:       "Show everything recorded about a file or folder",
+	Long:        "Show every replica, fragment, owner and last-seen time recorded for a logical file or folder.",
+	Args:        cobra.ExactArgs(1),
+	Annotations: browseAnnotations,
+	RunE:        runStat,
+}
+
+func init() {
+	for _, c := range []*cobra.Command{lsCmd, findCmd, duCmd, statCmd} {
+		c.Flags().StringVarP(&browseOutput, "output", "o", "table", "Output format: table or json")
+		rootCmd.AddCommand(c)
+	}
+
+	lsCmd.Flags().BoolVarP(&lsAll, "all", "a", false, "Include soft-deleted and deleted entries")
+
+	findCmd.Flags().StringVar(&findName, "name", "", "Glob the file name must match (e.g. '*.pdf')")
+	findCmd.Flags().StringVar(&findMinSize, "min-size", "", "Minimum file size (e.g. 10M)")
+	findCmd.Flags().StringVar(&findMaxSize, "max-size", "", "Maximum file size (e.g. 1G)")
+	findCmd.Flags().StringVar(&findNewer, "newer", "", "Only files modified after this time or age")
+	findCmd.Flags().StringVar(&findOlder, "older", "", "Only files modified before this time or age")
+	findCmd.Flags().StringVar(&findStatus, "status", "active", "File status: active, soft-deleted, deleted or any")
+
+	duCmd.Flags().IntVarP(&duDepth, "depth", "d", 1, "Folder levels below path to report")
+}
+
+// openLocalDB opens the local metadata.db without contacting any provider.
+func openLocalDB() error {
+	if browseOutput != "table" && browseOutput != "json" {
+		return fmt.Errorf("invalid output format %q (use table or json)", browseOutput)
+	}
+	if !database.DBExists() {
+		return fmt.Errorf("no local metadata database - run 'sync --get-metadata' first")
+	}
+	var err error
+	db, err = database.Open(masterPassword)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	// Browsing runs without the run lock, so it must not migrate a DB a sync may be using
+	if err := db.CheckSchema(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func pathArg(args []string) string {
+	if len(args) == 0 {
+		return "/"
+	}
+	return args[0]
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+func providerHeader() string {
+	names := make([]string, len(task.PoolProviders))
+	for i, p := range task.PoolProviders {
+		names[i] = strings.ToUpper(string(p))
+	}
+	return strings.Join(names, "\t")
+}
+
+func coverageColumns(coverage map[model.Provider]int) string {
+	cols := make([]string, len(task.PoolProviders))
+	for i, p := range task.PoolProviders {
+		cols[i] = strconv.Itoa(coverage[p])
+	}
+	return strings.Join(cols, "\t")
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func formatUnix(sec int64) string {
+	if sec == 0 {
+		return "never"
+	}
+	return formatTime(time.Unix(sec, 0))
+}
+
+func printEntries(entries []*task.PoolEntry) error {
+	if browseOutput == "json" {
+		if entries == nil {
+			entries = []*task.PoolEntry{}
+		}
+		return printJSON(entries)
+	}
+	w := newTable()
+	fmt.Fprintf(w, "TYPE\tSIZE\tMODIFIED\tSTATUS\t%s\tPATH\n", providerHeader())
+	for _, e := range entries {
+		kind := "file"
+		if e.IsDir {
+			kind = fmt.Sprintf("dir(%d)", e.Files)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", kind, formatBytes(e.Size), formatTime(e.ModTime), e.Status, coverageColumns(e.Coverage), e.Path)
+	}
+	return w.Flush()
+}
+
+func runLs(cmd *cobra.Command, args []string) error {
+	if err := openLocalDB(); err != nil {
+		return err
+	}
+	entries, err := task.ListPoolDir(db, pathArg(args), lsAll)
+	if err != nil {
+		return err
+	}
+	return printEntries(entries)
+}
+
+func runFind(cmd *cobra.Command, args []string) error {
+	opts := task.FindOptions{Root: pathArg(args), Name: findName, Status: findStatus}
+	var err error
+	if opts.MinSize, err = parseSize(findMinSize); err != nil {
+		return fmt.Errorf("invalid --min-size: %w", err)
+	}
+	if opts.MaxSize, err = parseSize(findMaxSize); err != nil {
+		return fmt.Errorf("invalid --max-size: %w", err)
+	}
+	if opts.Newer, err = parseTimeOrAge(findNewer); err != nil {
+		return fmt.Errorf("invalid --newer: %w", err)
+	}
+	if opts.Older, err = parseTimeOrAge(findOlder); err != nil {
+		return fmt.Errorf("invalid --older: %w", err)
+	}
+
+	if err := openLocalDB(); err != nil {
+		return err
+	}
+	entries, err := task.FindPool(db, opts)
+	if err != nil {
+		return err
+	}
+	return printEntries(entries)
+}
+
+func runDu(cmd *cobra.Command, args []string) error {
+	if duDepth < 0 {
+		return fmt.Errorf("--depth must not be negative")
+	}
+	if err := openLocalDB(); err != nil {
+		return err
+	}
+	rows, err := task.PoolDiskUsage(db, pathArg(args), duDepth)
+	if err != nil {
+		return err
+	}
+	if browseOutput == "json" {
+		return printJSON(rows)
+	}
+
+	w := newTable()
+	fmt.Fprintf(w, "FILES\tSIZE\t%s\tPATH\n", providerHeader())
+	for _, u := range rows {
+		cols := make([]string, len(task.PoolProviders))
+		for i, p := range task.PoolProviders {
+			cols[i] = formatBytes(u.Providers[p])
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", u.Files, formatBytes(u.Size), strings.Join(cols, "\t"), u.Path)
+	}
+	return w.Flush()
+}
+
+func runStat(cmd *cobra.Command, args []string) error {
+	if err := openLocalDB(); err != nil {
+		return err
+	}
+	st, err := task.StatPool(db, args[0])
+	if err != nil {
+		return err
+	}
+	if browseOutput == "json" {
+		return printJSON(st)
+	}
+
+	if f := st.File; f != nil {
+		fmt.Printf("File:     %s\n", f.Path)
+		fmt.Printf("ID:       %s\n", f.ID)
+		fmt.Printf("Size:     %s (%d bytes)\n", formatBytes(f.Size), f.Size)
+		fmt.Printf("MD5:      %s\n", f.GoogleDriveMD5)
+		fmt.Printf("Modified: %s\n", formatTime(f.ModTime))
+		fmt.Printf("Status:   %s\n", f.Status)
+		fmt.Printf("Replicas: %d\n", len(f.Replicas))
+
+		w := newTable()
+		fmt.Fprintln(w, "  PROVIDER\tACCOUNT\tOWNER\tSTATUS\tNATIVE ID\tSIZE\tLAST SEEN")
+		for _, r := range f.Replicas {
+			status := r.Status
+			if r.Encrypted {
+				status += " (encrypted)"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Provider, r.AccountID, r.Owner, status, r.NativeID, formatBytes(r.Size), formatUnix(r.LastSeenAt))
+			for _, frag := range r.Fragments {
+				fmt.Fprintf(w, "    fragment %d/%d\t\t\t\t%s\t%s\t\n", frag.FragmentNumber, frag.FragmentsTotal, frag.NativeFragmentID, formatBytes(frag.Size))
+			}
+		}
+		if err := w.Flush(); err != nil || len(f.Shards) == 0 {
+			return err
+		}
+
+		fmt.Printf("Shards:   %d (%d data + %d parity)\n", len(f.Shards), f.Shards[0].DataShards, f.Shards[0].ParityShards)
+		w = newTable()
+		fmt.Fprintln(w, "  SHARD\tPROVIDER\tACCOUNT\tSTATUS\tNATIVE ID\tSIZE\tSHA-256")
+		for _, s := range f.Shards {
+			fmt.Fprintf(w, "  %d\t%s\t%s\t%s\t%s\t%s\t%s\n", s.ShardIndex, s.Provider, s.AccountID, s.Status, s.NativeID, formatBytes(s.Size), s.SHA256)
+			for _, frag := range s.Fragments {
+				fmt.Fprintf(w, "    fragment %d/%d\t\t\t\t%s\t%s\t\n", frag.FragmentNumber, frag.FragmentsTotal, frag.NativeFragmentID, formatBytes(frag.Size))
+			}
+		}
+		return w.Flush()
+	}
+
+	f := st.Folder
+	id := f.ID
+	if id == "" {
+		id = "(implicit)"
+	}
+	fmt.Printf("Folder:   %s\n", f.Path)
+	fmt.Printf("ID:       %s\n", id)
+	fmt.Printf("Status:   %s\n", f.Status)
+	fmt.Printf("Replicas: %d\n", len(f.Replicas))
+	if len(f.Replicas) == 0 {
+		return nil
+	}
+	w := newTable()
+	fmt.Fprintln(w, "  PROVIDER\tACCOUNT\tOWNER\tSTATUS\tNATIVE ID\tLAST SEEN")
+	for _, r := range f.Replicas {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\n", r.Provider, r.AccountID, r.Owner, r.Status, r.NativeFolderID, formatUnix(r.LastSeenAt))
+	}
+	return w.Flush()
+}
+
+// parseSize parses a byte count with an optional K, M, G or T suffix. An empty string is 0.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mult := int64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGT", s[n-1]); i >= 0 {
+			mult = int64(1) << (10 * (i + 1))
+			s = s[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%q is not a size", s)
+	}
+	return int64(v * float64(mult)), nil
+}
+
+// parseTimeOrAge parses a date, an RFC 3339 timestamp or an age ("36h", "7d") counted back from
+// now. An empty string is the zero time.
+func parseTimeOrAge(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date, timestamp or age", s)
+}
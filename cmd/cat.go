@@ -0,0 +1,42 @@
+//go:build !auto
+
+package cmd
+
+import (
+	"bufio"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var catRange string
+
+var catCmd = &cobra.Command{
+	Use:   "cat <logical-path>",
+	Short: "Write a pool file to stdout",
+	Long: `Write the content of a logical file to stdout, for scripting and media playback.
+
+--range selects an inclusive byte range: start-end, start- (to the end) or -n (the last n bytes).
+Only that range is fetched from Google Drive and OneDrive, and only the Telegram fragments that
+overlap it are read. Logs go to stderr.`,
+	Args: cobra.ExactArgs(1),
+	Annotations: map[string]string{
+		"skipPreFlight": "true",
+		"stdoutData":    "true",
+	},
+	RunE: runCat,
+}
+
+func init() {
+	catCmd.Flags().StringVar(&catRange, "range", "", "Byte range to output (start-end, start- or -n)")
+	rootCmd.AddCommand(catCmd)
+}
+
+func runCat(cmd *cobra.Command, args []string) error {
+	out := bufio.NewWriterSize(os.Stdout, 1<<20)
+	if err := sharedRunner.CatFromPool(args[0], catRange, out); err != nil {
+		out.Flush()
+		return err
+	}
+	return out.Flush()
+}
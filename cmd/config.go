@@ -14,6 +14,11 @@ var (
 	cfgRemoveAccount bool
 	cfgCheckTokens   bool
 	cfgReauth        bool
+	cfgAddS3Key      bool
+	cfgRemoveS3Key   bool
+	cfgSetEncryption bool
+
+	cfgEncryptProviders string
 )
 
 var configCmd = &cobra.Command{
@@ -26,7 +31,10 @@ Exactly one action flag must be provided:
   --add-account      Authorize and register a backup account
   --remove-account   Remove an account from the local configuration
   --check-tokens     Report which stored credentials still work
-  --reauth           Re-authenticate broken credentials (--all for every account)`,
+  --reauth           Re-authenticate broken credentials (--all for every account)
+  --add-s3-key       Generate an access key for the S3 gateway (serve s3)
+  --remove-s3-key    Revoke an S3 gateway access key
+  --set-encryption   Choose the providers whose new replicas are encrypted (--providers)`,
 	Annotations: map[string]string{
 		// config dispatches per-action setup itself.
 		"skipSetup": "true",
@@ -40,17 +48,21 @@ func init() {
 	configCmd.Flags().BoolVar(&cfgRemoveAccount, "remove-account", false, "Remove an account from the local configuration")
 	configCmd.Flags().BoolVar(&cfgCheckTokens, "check-tokens", false, "Report which stored credentials still work")
 	configCmd.Flags().BoolVar(&cfgReauth, "reauth", false, "Re-authenticate broken credentials")
+	configCmd.Flags().BoolVar(&cfgAddS3Key, "add-s3-key", false, "Generate an access key for the S3 gateway")
+	configCmd.Flags().BoolVar(&cfgRemoveS3Key, "remove-s3-key", false, "Revoke an S3 gateway access key")
+	configCmd.Flags().BoolVar(&cfgSetEncryption, "set-encryption", false, "Choose the providers whose new replicas are encrypted client-side")
 
 	// Sub-flags shared with the individual action handlers.
 	configCmd.Flags().BoolVarP(&reauthAll, "all", "a", false, "With --reauth: re-authenticate every account, not just broken ones")
 	configCmd.Flags().StringVarP(&jsonFlag, "json", "j", "", "With --init: JSON string containing client credentials")
 	configCmd.Flags().BoolVarP(&getJsonFlag, "getjson", "g", false, "With --init: output configuration as JSON string")
+	configCmd.Flags().StringVar(&cfgEncryptProviders, "providers", "", "With --set-encryption: comma-separated providers to encrypt (Microsoft, Telegram), or none")
 
 	rootCmd.AddCommand(configCmd)
 }
 
 func runConfig(cmd *cobra.Command, args []string) error {
-	actions := []bool{cfgInit, cfgAddAccount, cfgRemoveAccount, cfgCheckTokens, cfgReauth}
+	actions := []bool{cfgInit, cfgAddAccount, cfgRemoveAccount, cfgCheckTokens, cfgReauth, cfgAddS3Key, cfgRemoveS3Key, cfgSetEncryption}
 	count := 0
 	for _, a := range actions {
 		if a {
@@ -58,7 +70,7 @@ func runConfig(cmd *cobra.Command, args []string) error {
 		}
 	}
 	if count == 0 {
-		return fmt.Errorf("config requires exactly one action flag (--init, --add-account, --remove-account, --check-tokens, or --reauth)")
+		return fmt.Errorf("config requires exactly one action flag (--init, --add-account, --remove-account, --check-tokens, --reauth, --add-s3-key, --remove-s3-key, or --set-encryption)")
 	}
 	if count > 1 {
 		return fmt.Errorf("config action flags are mutually exclusive; provide exactly one")
@@ -91,6 +103,21 @@ func runConfig(cmd *cobra.Command, args []string) error {
 			return err
 		}
 		return runReauth(cmd, args)
+	case cfgAddS3Key:
+		if err := setupConfig(); err != nil {
+			return err
+		}
+		return runAddS3Key(cmd, args)
+	case cfgRemoveS3Key:
+		if err := setupConfig(); err != nil {
+			return err
+		}
+		return runRemoveS3Key(cmd, args)
+	case cfgSetEncryption:
+		if err := setupConfig(); err != nil {
+			return err
+		}
+		return runSetEncryption(cmd, args)
 	}
 	return nil
 }
@@ -0,0 +1,227 @@
+//go:build !auto
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/database"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/task"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dbListSnapshots   bool
+	dbRestoreSnapshot string
+	dbMigrate         bool
+	dbDryRun          bool
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Inspect and maintain the metadata database",
+	Long: `Inspect and maintain the metadata database.
+
+Exactly one action flag must be provided:
+  --list-snapshots         List the metadata.db snapshots kept in cloud-drives-sync-aux
+  --restore-snapshot <id>  Roll the metadata back to a snapshot on every account
+  --migrate                Apply pending schema migrations and upload the result
+
+--dry-run shows what an action would change without applying it.`,
+	Annotations: map[string]string{
+		// db manages the local DB and run lock itself.
+		"skipDB": "true",
+	},
+	RunE: runDB,
+}
+
+func init() {
+	dbCmd.Flags().BoolVar(&dbListSnapshots, "list-snapshots", false, "List the metadata.db snapshots kept in the cloud")
+	dbCmd.Flags().StringVar(&dbRestoreSnapshot, "restore-snapshot", "", "Restore the metadata.db snapshot with this ID")
+	dbCmd.Flags().BoolVar(&dbMigrate, "migrate", false, "Apply pending schema migrations to the metadata database")
+	dbCmd.Flags().BoolVar(&dbDryRun, "dry-run", false, "Show what would change without applying it")
+
+	rootCmd.AddCommand(dbCmd)
+}
+
+func runDB(cmd *cobra.Command, args []string) error {
+	actions := []bool{dbListSnapshots, dbRestoreSnapshot != "", dbMigrate}
+	count := 0
+	for _, a := range actions {
+		if a {
+			count++
+		}
+	}
+	if count == 0 {
+		return fmt.Errorf("db requires exactly one action flag (--list-snapshots, --restore-snapshot, or --migrate)")
+	}
+	if count > 1 {
+		return fmt.Errorf("db action flags are mutually exclusive; provide exactly one")
+	}
+
+	switch {
+	case dbListSnapshots:
+		return runListSnapshots(cmd, args)
+	case dbRestoreSnapshot != "":
+		return runRestoreSnapshot(cmd, args)
+	case dbMigrate:
+		return runMigrate(cmd, args)
+	}
+	return nil
+}
+
+func runListSnapshots(cmd *cobra.Command, args []string) error {
+	snapshots, source, err := task.ListMetadataSnapshots(cfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Metadata snapshots on %s (%s):\n", source.Provider, source.GetAccountID())
+	fmt.Println("--------------------------------")
+	if len(snapshots) == 0 {
+		fmt.Println("  (none)")
+		return nil
+	}
+	for _, s := range snapshots {
+		fmt.Printf("  %-6s %s  %-10s  from %s\n", s.ID, s.UploadedAt.Local().Format("2006-01-02 15:04:05"), formatBytes(s.Size), s.Hostname)
+		fmt.Printf("         sha256 %s\n", s.SHA256)
+	}
+	return nil
+}
+
+func runRestoreSnapshot(cmd *cobra.Command, args []string) error {
+	if !dbDryRun {
+		if err := acquireRunLock(cmd.CommandPath()); err != nil {
+			return err
+		}
+	}
+
+	// A dry run compares against the local copy as it is, since fetching a newer one would
+	// replace it.
+	dbPath := database.GetDBPath()
+	if dbDryRun {
+		logger.DryRun("Would fetch the newest metadata.db first; comparing against the local copy")
+	} else if err := task.DownloadMetadataDB(cfg, dbPath); err != nil {
+		return fmt.Errorf("failed to sync metadata: %w", err)
+	}
+
+	snapshotPath := dbPath + ".snapshot"
+	defer os.Remove(snapshotPath)
+	snap, err := task.DownloadMetadataSnapshot(cfg, dbRestoreSnapshot, snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	diff, err := diffLocalAgainst(snapshotPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restoring snapshot %s (uploaded %s by %s) changes the metadata as follows:\n",
+		snap.ID, snap.UploadedAt.Local().Format("2006-01-02 15:04:05"), snap.Hostname)
+	printDiffSummary(diff)
+
+	if dbDryRun {
+		logger.DryRun("Would restore snapshot %s", snap.ID)
+		return nil
+	}
+	if err := task.RestoreMetadataSnapshot(cfg, dbPath, snapshotPath); err != nil {
+		return err
+	}
+	logger.Info("Snapshot %s restored and uploaded to all accounts", snap.ID)
+	return nil
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	if !dbDryRun {
+		if err := acquireRunLock(cmd.CommandPath()); err != nil {
+			return err
+		}
+	}
+
+	dbPath := database.GetDBPath()
+	if err := task.DownloadMetadataDB(cfg, dbPath); err != nil {
+		return fmt.Errorf("failed to sync metadata: %w", err)
+	}
+
+	local, err := database.Open(masterPassword)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer local.Close()
+
+	current, err := local.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	pending, err := local.PendingMigrations()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version: %d (this binary: %d)\n", current, database.LatestSchemaVersion())
+	if len(pending) == 0 {
+		fmt.Println("No pending migrations.")
+		return nil
+	}
+	fmt.Println("Pending migrations:")
+	for _, m := range pending {
+		fmt.Printf("  %3d  %s\n", m.Version, m.Name)
+	}
+
+	if dbDryRun {
+		logger.DryRun("Would apply %d migration(s)", len(pending))
+		return nil
+	}
+	if err := local.Initialize(); err != nil {
+		return err
+	}
+	local.Close()
+
+	if err := task.UploadMetadataDB(cfg, dbPath); err != nil {
+		return fmt.Errorf("failed to upload metadata.db: %w", err)
+	}
+	logger.Info("Applied %d migration(s) and uploaded the migrated metadata", len(pending))
+	return nil
+}
+
+// diffLocalAgainst compares the local metadata.db with the DB at path.
+func diffLocalAgainst(path string) (*database.DiffSummary, error) {
+	current, err := database.Open(masterPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer current.Close()
+
+	target, err := database.OpenPath(path, masterPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer target.Close()
+
+	return current.DiffAgainst(target)
+}
+
+func printDiffSummary(d *database.DiffSummary) {
+	if d.Empty() {
+		fmt.Println("  No differences.")
+		return
+	}
+	printPaths := func(label string, paths []string) {
+		const maxShown = 20
+		fmt.Printf("  %s: %d\n", label, len(paths))
+		for i, p := range paths {
+			if i == maxShown {
+				fmt.Printf("    ... and %d more\n", len(paths)-maxShown)
+				break
+			}
+			fmt.Printf("    %s\n", p)
+		}
+	}
+	printPaths("Files added", d.FilesAdded)
+	printPaths("Files removed", d.FilesRemoved)
+	printPaths("Files changed", d.FilesChanged)
+	fmt.Printf("  Replicas: %d -> %d\n", d.ReplicasBefore, d.ReplicasAfter)
+	fmt.Printf("  Folders:  %d -> %d\n", d.FoldersBefore, d.FoldersAfter)
+}
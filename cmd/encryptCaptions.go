@@ -0,0 +1,12 @@
+package cmd
+
+import (
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+func runEncryptCaptions(cmd *cobra.Command, args []string) error {
+	n, err := sharedRunner.EncryptTelegramCaptions()
+	logger.Info("Encrypted %d Telegram caption(s)", n)
+	return err
+}
@@ -0,0 +1,57 @@
+//go:build !auto
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/config"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/spf13/cobra"
+)
+
+// parseEncryptedProviders parses a comma-separated list of the providers whose replicas are
+// encrypted. An empty list or "none" turns encryption off.
+func parseEncryptedProviders(list string) ([]model.Provider, error) {
+	var providers []model.Provider
+	for _, name := range strings.Split(list, ",") {
+		var provider model.Provider
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "", "none":
+			continue
+		case "microsoft", "onedrive":
+			provider = model.ProviderMicrosoft
+		case "telegram":
+			provider = model.ProviderTelegram
+		case "google":
+			return nil, fmt.Errorf("google replicas cannot be encrypted: their MD5 identifies every file")
+		default:
+			return nil, fmt.Errorf("unknown provider %q (use Microsoft, Telegram or none)", name)
+		}
+		if !slices.Contains(providers, provider) {
+			providers = append(providers, provider)
+		}
+	}
+	return providers, nil
+}
+
+func runSetEncryption(cmd *cobra.Command, args []string) error {
+	providers, err := parseEncryptedProviders(cfgEncryptProviders)
+	if err != nil {
+		return err
+	}
+	cfg.EncryptedProviders = providers
+	if err := config.SaveConfig(cfg, masterPassword); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	if len(providers) == 0 {
+		logger.Info("Client-side encryption disabled. Existing encrypted replicas stay readable with the master password.")
+		return nil
+	}
+	logger.Info("New replicas on %v will be encrypted with a key derived from the master password. Existing replicas are left as they are.", providers)
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build !auto
+
+package cmd
+
+import (
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+var getCmd = &cobra.Command{
+	Use:   "get <logical-path> [dest]",
+	Short: "Download a file or folder from the pool",
+	Long: `Download a logical file or a whole folder from the pool to local disk.
+
+Each file is read from the best available replica (Google Drive, then OneDrive, then the
+reassembled Telegram fragments), verified against its Google Drive MD5 and given back its
+modification time. A folder's contents are written below dest (default: the folder name).
+
+Files already present with the same size and modification time are skipped, so re-running
+an interrupted download resumes it.`,
+	Args: cobra.RangeArgs(1, 2),
+	Annotations: map[string]string{
+		"skipPreFlight": "true",
+	},
+	RunE: runGet,
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+}
+
+func runGet(cmd *cobra.Command, args []string) error {
+	dest := ""
+	if len(args) == 2 {
+		dest = args[1]
+	}
+	res, err := sharedRunner.GetFromPool(args[0], dest)
+	if res != nil {
+		logger.Info("Downloaded %d file(s) (%s), skipped %d already present, %d failed",
+			res.Downloaded, formatBytes(res.Bytes), res.Skipped, res.Failed)
+	}
+	return err
+}
@@ -139,6 +139,9 @@ func firstTimeInit() error {
 		return fmt.Errorf("failed to save configuration: %w", err)
 	}
 	logger.Info("Configuration saved successfully")
+	if err := setupDataKey(password); err != nil {
+		return err
+	}
 
 	// Create database
 	if err := database.CreateDB(password); err != nil {
@@ -178,6 +181,9 @@ func interactiveUpdate() error {
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
+	if err := setupDataKey(password); err != nil {
+		return err
+	}
 
 	prompt := promptui.Select{
 		Label: "Configuration already exists. What would you like to do?",
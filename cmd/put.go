@@ -0,0 +1,56 @@
+//go:build !auto
+
+package cmd
+
+import (
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/task"
+	"github.com/spf13/cobra"
+)
+
+var putErasure string
+
+var putCmd = &cobra.Command{
+	Use:   "put <local-path> <logical-path>",
+	Short: "Upload a local file or folder into the pool",
+	Long: `Upload a local file or a whole folder into the pool.
+
+Files go straight to the backup account with the most free quota on each provider (Google Drive,
+then OneDrive, then Telegram) and are recorded in the metadata database, so nothing has to pass
+through the main account. A folder is uploaded recursively below logical-path; a single file is
+stored at logical-path, or inside it when it is an existing pool folder or ends with "/".
+
+Files whose content already matches the pool are skipped; changed files replace the previous
+version. With --safe, only report what would be uploaded.
+
+With --erasure k+m (e.g. 4+2), each file is instead split into k data shards and m parity shards
+(Reed-Solomon), spread over the backup accounts of all providers so that no account holds more
+than m of them. Any k shards rebuild the file. 'sync --scrub-shards' verifies and heals them.`,
+	Args: cobra.ExactArgs(2),
+	Annotations: map[string]string{
+		"writesDB": "true",
+	},
+	RunE: runPut,
+}
+
+func init() {
+	putCmd.Flags().BoolVarP(&safeMode, "safe", "s", false, "Dry run mode - print what would be uploaded without touching the cloud")
+	putCmd.Flags().StringVar(&putErasure, "erasure", "", "Store files as data+parity Reed-Solomon shards (e.g. 4+2) instead of a full copy per provider")
+	rootCmd.AddCommand(putCmd)
+}
+
+func runPut(cmd *cobra.Command, args []string) error {
+	if putErasure != "" {
+		scheme, err := task.ParseErasureScheme(putErasure)
+		if err != nil {
+			return err
+		}
+		sharedRunner.SetErasure(scheme)
+	}
+	res, err := sharedRunner.PutToPool(args[0], args[1])
+	if res != nil {
+		logger.Info("Uploaded %d new and %d changed file(s) (%s), skipped %d unchanged, %d incomplete, %d failed",
+			res.Uploaded, res.Updated, formatBytes(res.Bytes), res.Skipped, res.Incomplete, res.Failed)
+	}
+	return err
+}
@@ -1,15 +1,21 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/FranLegon/cloud-drives-sync/internal/config"
 	"github.com/FranLegon/cloud-drives-sync/internal/database"
 	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/metrics"
 	"github.com/FranLegon/cloud-drives-sync/internal/model"
 	"github.com/FranLegon/cloud-drives-sync/internal/task"
+	"github.com/FranLegon/cloud-drives-sync/internal/telegram"
+	"github.com/FranLegon/cloud-drives-sync/internal/tracing"
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 )
@@ -20,8 +26,18 @@ var (
 	cfg            *model.Config
 	db             *database.DB
 	masterPassword string
+	dataKey        []byte
 	initialDBHash  string
 	sharedRunner   *task.Runner
+	breakLock      bool
+	runLock        *task.RunLock
+	metricsAddr    string
+	otlpEndpoint   string
+	logLevel       string
+	logFormat      string
+	spoolDir       string
+	spoolSize      string
+	tracingStop    func(context.Context) error
 )
 
 // rootCmd represents the base command
@@ -32,6 +48,10 @@ var rootCmd = &cobra.Command{
 across multiple cloud storage providers including Google Drive, Microsoft OneDrive for Business,
 and Telegram.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := setupLogging(); err != nil {
+			return err
+		}
+
 		// Gate commands based on build type
 		if AutoBuild {
 			if cmd.Annotations["autoBuildAllowed"] != "true" && cmd.Name() != "help" && cmd.Name() != "__complete" && cmd.Name() != "__completeNoDesc" {
@@ -43,6 +63,18 @@ and Telegram.`,
 			}
 		}
 
+		// Commands that write file content to stdout keep it clean by logging to stderr.
+		if cmd.Annotations["stdoutData"] == "true" {
+			logger.SetOutput(os.Stderr)
+		}
+
+		if metricsAddr != "" {
+			startMetricsServer(metricsAddr)
+		}
+		if err := setupTracing(); err != nil {
+			return err
+		}
+
 		// Commands that manage their own setup lifecycle (config dispatches per-action).
 		if cmd.Annotations["skipSetup"] == "true" || cmd.Name() == "help" || cmd.Name() == "__complete" || cmd.Name() == "__completeNoDesc" {
 			return nil
@@ -56,16 +88,28 @@ and Telegram.`,
 			return nil
 		}
 
+		// Mutating commands hold the pool-wide run lock from before the DB is fetched until
+		// after it has been uploaded again.
+		if cmd.Annotations["writesDB"] == "true" {
+			if err := acquireRunLock(cmd.CommandPath()); err != nil {
+				return err
+			}
+		}
+
 		preflight := cmd.Annotations["skipPreFlight"] != "true"
 		return setupDBAndRunner(preflight)
 	},
 	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		defer stopTracing()
+		defer releaseRunLock()
+
 		// Check if DB had changes before closing
 		dbHasChanges := true // Default to true if hash check fails
 		if db != nil {
 			if finalHash, err := db.GetMetadataHash(); err == nil && initialDBHash != "" {
 				dbHasChanges = finalHash != initialDBHash
 			}
+			metrics.SetDB(nil)
 			db.Close()
 		}
 
@@ -88,6 +132,13 @@ and Telegram.`,
 // Execute runs the root command
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
+		// PersistentPostRunE does not run when the command fails.
+		if db != nil {
+			metrics.SetDB(nil)
+			db.Close()
+		}
+		releaseRunLock()
+		stopTracing()
 		logger.Error("Command failed: %v", err)
 		os.Exit(1)
 	}
@@ -133,9 +184,91 @@ func setupConfig() error {
 		}
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
+	return setupDataKey(masterPassword)
+}
+
+// setupDataKey derives the key protecting pool data from password and hands the Telegram
+// caption key to the telegram package, which must happen before any sync channel is read.
+func setupDataKey(password string) error {
+	key, err := config.DataKey(password)
+	if err != nil {
+		return fmt.Errorf("failed to derive data key: %w", err)
+	}
+	dataKey = key
+	telegram.SetCaptionKey(config.CaptionKey(key))
+	return nil
+}
+
+// acquireRunLock takes the pool-wide run lock for a mutating command.
+func acquireRunLock(command string) error {
+	if runLock != nil {
+		return nil
+	}
+	lock, err := task.AcquireRunLock(cfg, database.GetDBPath(), command, breakLock)
+	if err != nil {
+		return fmt.Errorf("failed to acquire run lock: %w", err)
+	}
+	runLock = lock
+	return nil
+}
+
+// runLockErr returns an error once the run lock has been lost. Commands check it between steps
+// and return it, so they stop changing the pool another host may hold by now. The failed command
+// keeps its metadata DB locally without uploading it; the next run's scan picks up whatever this
+// one changed.
+func runLockErr() error {
+	if err := runLock.Err(); err != nil {
+		return fmt.Errorf("stopping: %w", err)
+	}
 	return nil
 }
 
+// releaseRunLock releases the run lock if this process holds it.
+func releaseRunLock() {
+	runLock.Release()
+	runLock = nil
+}
+
+// startMetricsServer serves /metrics on addr in the background for the life of the process.
+func startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 30 * time.Second}
+	go func() {
+		logger.Info("Serving metrics on http://%s/metrics", addr)
+		if err := srv.ListenAndServe(); err != nil {
+			logger.Error("Metrics server failed: %v", err)
+		}
+	}()
+}
+
+// setupTracing exports spans when --otlp-endpoint or the standard OTLP environment variables
+// name a collector.
+func setupTracing() error {
+	if otlpEndpoint == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil
+	}
+	stop, err := tracing.Setup(otlpEndpoint)
+	if err != nil {
+		return err
+	}
+	tracingStop = stop
+	return nil
+}
+
+// stopTracing flushes pending spans to the collector.
+func stopTracing() {
+	if tracingStop == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tracingStop(ctx); err != nil {
+		logger.Warning("Failed to flush traces: %v", err)
+	}
+	tracingStop = nil
+}
+
 // setupDBAndRunner downloads the freshest metadata database, opens it, initializes the
 // schema, builds the shared task runner and optionally runs pre-flight checks.
 func setupDBAndRunner(preflight bool) error {
@@ -157,7 +290,20 @@ func setupDBAndRunner(preflight bool) error {
 		initialDBHash = hash
 	}
 
+	metrics.SetDB(db)
 	sharedRunner = task.NewRunner(cfg, db, safeMode)
+	sharedRunner.SetContentKey(config.ContentKey(dataKey))
+	sharedRunner.SetRunLock(runLock)
+	if spoolDir != "" {
+		maxBytes, err := parseSize(spoolSize)
+		if err != nil {
+			return fmt.Errorf("invalid --spool-size: %w", err)
+		}
+		if err := os.MkdirAll(spoolDir, 0700); err != nil {
+			return fmt.Errorf("failed to create spool directory: %w", err)
+		}
+		sharedRunner.SetSpool(spoolDir, maxBytes)
+	}
 
 	if preflight {
 		logger.Info("Running pre-flight checks...")
@@ -172,4 +318,26 @@ func setupDBAndRunner(preflight bool) error {
 func init() {
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 	rootCmd.PersistentFlags().StringVarP(&passwordFlag, "password", "p", "", "Master password (non-interactive)")
+	rootCmd.PersistentFlags().StringVar(&metricsAddr, "metrics-addr", "", "Serve Prometheus metrics on this address (e.g. 127.0.0.1:9464) while the command runs")
+	rootCmd.PersistentFlags().StringVar(&otlpEndpoint, "otlp-endpoint", "", "Export OpenTelemetry traces over OTLP/HTTP to this collector (e.g. http://localhost:4318)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Minimum level to log: debug, info, warning or error")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Log line format: text or json (one JSON object per line)")
+	rootCmd.PersistentFlags().StringVar(&spoolDir, "spool-dir", "", "Stage copied files in this directory so a failed upload is retried without downloading again (empty streams them)")
+	rootCmd.PersistentFlags().StringVar(&spoolSize, "spool-size", "10G", "Maximum bytes staged in --spool-dir at once (e.g. 500M, 10G); larger files are streamed")
+	rootCmd.PersistentFlags().BoolVar(&breakLock, "break-lock", false, "Remove another host's run lock before starting (only if that run is no longer alive)")
+}
+
+// setupLogging applies the --log-level and --log-format flags.
+func setupLogging() error {
+	level, err := logger.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	format, err := logger.ParseFormat(logFormat)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(level)
+	logger.SetFormat(format)
+	return nil
 }
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+func runScrubShards(cmd *cobra.Command, args []string) error {
+	res, err := sharedRunner.ScrubShards()
+	if res != nil {
+		logger.Info("Scrubbed %d erasure-coded file(s): %d healthy, %d healed (%d shard(s) rebuilt), %d unrecoverable, %d failed",
+			res.Files, res.Healthy, res.Healed, res.ShardsRebuilt, res.Unrecoverable, res.Failed)
+	}
+	return err
+}
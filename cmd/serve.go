@@ -0,0 +1,310 @@
+//go:build !auto
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/auth"
+	"github.com/FranLegon/cloud-drives-sync/internal/database"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/metrics"
+	"github.com/FranLegon/cloud-drives-sync/internal/server"
+	"github.com/FranLegon/cloud-drives-sync/internal/task"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveAddr          string
+	serveS3Addr        string
+	serveAPIAddr       string
+	serveGenerateToken bool
+	serveTLSCert       string
+	serveTLSKey        string
+)
+
+// serveUploadInterval is how often 'serve webdav' and 'serve s3' upload the metadata database
+// when it changed, so changes are not held back until the server stops.
+const serveUploadInterval = 5 * time.Minute
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the pool over network protocols",
+}
+
+var serveWebDAVCmd = &cobra.Command{
+	Use:   "webdav",
+	Short: "Serve the pool over WebDAV",
+	Long: `Serve the logical tree of the pool over WebDAV, so it can be mounted by a file manager.
+
+Reads come from the best available replica and honour Range requests. Writes are applied the way
+sync would apply them: PUT uploads to every provider as put does, MKCOL creates the folder on every
+Google and OneDrive account, MOVE moves or renames every replica, and DELETE soft-deletes by moving
+files into the soft-deleted aux folder. The aux folder itself is not shown.
+
+Clients authenticate with HTTP basic auth (any user name). The password is the master password, or
+with --generate-token a random token printed at startup, so the master password never crosses the
+network. Use --tls-cert and --tls-key when listening beyond localhost.
+
+The server holds the run lock until it is stopped with Ctrl+C. The metadata database is uploaded
+every 5 minutes when it changed, and when the server stops.`,
+	Args: cobra.NoArgs,
+	Annotations: map[string]string{
+		"writesDB": "true",
+	},
+	RunE: runServeWebDAV,
+}
+
+var serveS3Cmd = &cobra.Command{
+	Use:   "s3",
+	Short: "Serve the pool over an S3-compatible API",
+	Long: `Serve the pool over a subset of the S3 API, so S3 backup tools (restic, rclone, duplicity)
+can use it as a destination.
+
+Buckets are the top-level folders of the pool and object keys are the paths below them; clients
+must use path-style addressing. Supported: ListBuckets, Create/Head/DeleteBucket,
+GetBucketLocation, ListObjects (v1 and v2), Get/Head/Put/Copy/DeleteObject, DeleteObjects and
+multipart uploads. DeleteObject soft-deletes, as in sync. Unfinished multipart uploads are kept
+in a temporary directory and discarded when the server stops.
+
+Requests must be signed (AWS Signature V4) with an access key created by 'config --add-s3-key';
+keys are stored encrypted in the configuration.
+
+The server holds the run lock until it is stopped with Ctrl+C. The metadata database is uploaded
+every 5 minutes when it changed, and when the server stops.`,
+	Args: cobra.NoArgs,
+	Annotations: map[string]string{
+		"writesDB": "true",
+	},
+	RunE: runServeS3,
+}
+
+var serveAPICmd = &cobra.Command{
+	Use:   "api",
+	Short: "Run a daemon with a local REST API",
+	Long: `Run a long-lived daemon that keeps the database and provider clients open and exposes a
+local HTTP/JSON API to trigger and monitor work:
+
+  GET  /api/v1/status             running job, queue and progress of the current sync
+  GET  /api/v1/runs               recent jobs and sync runs
+  POST /api/v1/runs               queue an action, e.g. {"action": "sync"}
+  GET  /api/v1/runs/{id}          one job
+  GET  /api/v1/runs/{id}/logs     log lines of one job
+  GET  /api/v1/files?path=&all=   list a pool folder
+  GET  /api/v1/stat?path=         replicas of a file or folder
+  GET  /api/v1/quota              quota per provider
+  GET  /api/v1/logs?since=        recent log lines
+  GET  /api/v1/logs/stream        live log lines (server-sent events)
+  GET  /metrics                   Prometheus metrics
+
+Actions are sync and the individual steps: share-with-main, get-metadata, free-main,
+sync-providers, balance-storage, sync-unsynced-files, upgrade-placeholders and scrub-shards. Jobs run one at a time in the order they
+were queued; triggering an action that is already queued returns the queued job. An interrupted
+sync is resumed by the next one, as with the sync command.
+
+Requests authenticate with a bearer token or HTTP basic auth, as for 'serve webdav'. The metadata
+database is uploaded after every job that changed it. The daemon holds the run lock until it is
+stopped with Ctrl+C, so other commands cannot run alongside it.`,
+	Args: cobra.NoArgs,
+	Annotations: map[string]string{
+		"writesDB": "true",
+	},
+	RunE: runServeAPI,
+}
+
+func init() {
+	serveWebDAVCmd.Flags().StringVar(&serveAddr, "addr", "127.0.0.1:8080", "Address to listen on")
+	serveWebDAVCmd.Flags().BoolVar(&serveGenerateToken, "generate-token", false, "Authenticate with a generated token instead of the master password")
+	serveWebDAVCmd.Flags().StringVar(&serveTLSCert, "tls-cert", "", "TLS certificate file")
+	serveWebDAVCmd.Flags().StringVar(&serveTLSKey, "tls-key", "", "TLS private key file")
+	serveS3Cmd.Flags().StringVar(&serveS3Addr, "addr", "127.0.0.1:9000", "Address to listen on")
+	serveS3Cmd.Flags().StringVar(&serveTLSCert, "tls-cert", "", "TLS certificate file")
+	serveS3Cmd.Flags().StringVar(&serveTLSKey, "tls-key", "", "TLS private key file")
+	serveAPICmd.Flags().StringVar(&serveAPIAddr, "addr", "127.0.0.1:8765", "Address to listen on")
+	serveAPICmd.Flags().BoolVar(&serveGenerateToken, "generate-token", false, "Authenticate with a generated token instead of the master password")
+	serveAPICmd.Flags().StringVar(&serveTLSCert, "tls-cert", "", "TLS certificate file")
+	serveAPICmd.Flags().StringVar(&serveTLSKey, "tls-key", "", "TLS private key file")
+	serveAPICmd.Flags().BoolVarP(&safeMode, "safe", "s", false, "Dry run mode - jobs print what would change without touching the cloud")
+	serveCmd.AddCommand(serveWebDAVCmd, serveS3Cmd, serveAPICmd)
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServeWebDAV(cmd *cobra.Command, args []string) error {
+	if (serveTLSCert == "") != (serveTLSKey == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be given together")
+	}
+
+	creds := server.NewCredentials(masterPassword)
+	if serveGenerateToken {
+		token := auth.GenerateStateToken()
+		creds = server.NewCredentials(token)
+		logger.Info("Access token: %s", token)
+	}
+	fs := server.NewPoolFS(sharedRunner, db)
+	srv := &http.Server{
+		Addr:              serveAddr,
+		Handler:           server.NewWebDAVHandler(fs, creds),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	return serveUntilSignal(srv, serveTLSCert, serveTLSKey, func() error { return fs.WhileIdle(uploadChangedMetadata) })
+}
+
+func runServeS3(cmd *cobra.Command, args []string) error {
+	if (serveTLSCert == "") != (serveTLSKey == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be given together")
+	}
+
+	fs := server.NewPoolFS(sharedRunner, db)
+	gateway, err := server.NewS3Gateway(fs, cfg.S3Keys)
+	if err != nil {
+		return err
+	}
+	defer gateway.Close()
+	srv := &http.Server{
+		Addr:              serveS3Addr,
+		Handler:           gateway,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	return serveUntilSignal(srv, serveTLSCert, serveTLSKey, func() error { return fs.WhileIdle(uploadChangedMetadata) })
+}
+
+func runServeAPI(cmd *cobra.Command, args []string) error {
+	if (serveTLSCert == "") != (serveTLSKey == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be given together")
+	}
+
+	creds := server.NewCredentials(masterPassword)
+	if serveGenerateToken {
+		token := auth.GenerateStateToken()
+		creds = server.NewCredentials(token)
+		logger.Info("Access token: %s", token)
+	}
+
+	logs := server.NewLogBuffer(5000)
+	removeSink := logger.AddSink(logs)
+	defer removeSink()
+
+	step := func(run func(*cobra.Command, []string) error) func() error {
+		return func() error { return run(cmd, nil) }
+	}
+	daemon := server.NewDaemon(server.DaemonOptions{
+		Runner:   sharedRunner,
+		DB:       db,
+		SafeMode: safeMode,
+		Actions: map[string]func() error{
+			"sync":                 func() error { return SyncAction(sharedRunner, safeMode) },
+			"share-with-main":      step(runShareWithMain),
+			"get-metadata":         step(runGetMetadata),
+			"free-main":            step(runFreeMain),
+			"sync-providers":       step(runSyncProviders),
+			"balance-storage":      step(runBalanceStorage),
+			"sync-unsynced-files":  step(runSyncUnsyncedFiles),
+			"upgrade-placeholders": step(runUpgradePlaceholders),
+			"scrub-shards":         step(runScrubShards),
+		},
+		AfterJob: uploadChangedMetadata,
+		Logs:     logs,
+	})
+	daemon.Start()
+	defer daemon.Stop()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/", daemon.Handler())
+	srv := &http.Server{
+		Addr:              serveAPIAddr,
+		Handler:           creds.Middleware("cloud-drives-sync", mux),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	return serveUntilSignal(srv, serveTLSCert, serveTLSKey, nil)
+}
+
+// uploadChangedMetadata uploads the metadata database if it changed since it was last uploaded,
+// so a long-running daemon does not hold changes back until it exits.
+func uploadChangedMetadata() error {
+	hash, err := db.GetMetadataHash()
+	if err != nil {
+		return fmt.Errorf("failed to hash metadata: %w", err)
+	}
+	if hash == initialDBHash {
+		return nil
+	}
+	if err := db.Checkpoint(); err != nil {
+		return err
+	}
+	if err := task.UploadMetadataDB(cfg, database.GetDBPath()); err != nil {
+		return fmt.Errorf("failed to upload metadata.db: %w", err)
+	}
+	initialDBHash = hash
+	logger.Info("Metadata upload complete.")
+	return nil
+}
+
+// serveUntilSignal runs srv until SIGINT or SIGTERM, then shuts it down gracefully so in-flight
+// writes reach the DB before it is uploaded. Unless upload is nil, it is called every
+// serveUploadInterval to upload the DB if it changed. When the run lock is lost the server is
+// shut down the same way and the loss is returned.
+func serveUntilSignal(srv *http.Server, certFile, keyFile string, upload func() error) error {
+	errCh := make(chan error, 1)
+	go func() {
+		scheme := "http"
+		var err error
+		if certFile != "" {
+			scheme = "https"
+			logger.Info("Listening on %s://%s", scheme, srv.Addr)
+			err = srv.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			logger.Info("Listening on %s://%s", scheme, srv.Addr)
+			err = srv.ListenAndServe()
+		}
+		errCh <- err
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	var tick <-chan time.Time
+	if upload != nil {
+		ticker := time.NewTicker(serveUploadInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var stopErr error
+wait:
+	for {
+		select {
+		case err := <-errCh:
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return fmt.Errorf("server failed: %w", err)
+		case <-tick:
+			if err := upload(); err != nil {
+				logger.Warning("Periodic metadata upload failed: %v", err)
+			}
+		case <-runLock.Lost():
+			stopErr = runLockErr()
+			logger.Error("Shutting down: %v", stopErr)
+			break wait
+		case <-sigCh:
+			logger.Info("Shutting down...")
+			break wait
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+	return stopErr
+}
@@ -1,9 +1,19 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/database"
 	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/metrics"
 	"github.com/FranLegon/cloud-drives-sync/internal/task"
+	"github.com/FranLegon/cloud-drives-sync/internal/tracing"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var syncCmd = &cobra.Command{
@@ -38,7 +48,11 @@ func runSync(cmd *cobra.Command, args []string) error {
 }
 
 // SyncAction runs the full synchronization pipeline
-func SyncAction(runner *task.Runner, isSafeMode bool) error {
+func SyncAction(runner *task.Runner, isSafeMode bool) (retErr error) {
+	ctx, span := tracing.Start(nil, "sync", attribute.Bool("safe_mode", isSafeMode))
+	defer func() { tracing.End(span, retErr) }()
+	defer tracing.SetCurrent(ctx)()
+
 	// Check for an interrupted previous run to resume
 	startStep := 1
 	var syncRunID int64
@@ -58,11 +72,13 @@ func SyncAction(runner *task.Runner, isSafeMode bool) error {
 			return err
 		}
 	}
+	span.SetAttributes(attribute.Int64("sync_run_id", syncRunID))
+	defer startRunLog(syncRunID)()
 
 	// 1. Sync unsynced files (pull Google backup root files into the fence)
 	if startStep <= 1 {
 		logger.Info("[Step 1/6] Moving unsynced files from backup roots...")
-		if err := runner.MoveUnsyncedFiles(); err != nil {
+		if err := runStep("sync-unsynced-files", runner.MoveUnsyncedFiles); err != nil {
 			return err
 		}
 		if err := db.MarkStepCompleted(syncRunID, 1); err != nil {
@@ -75,7 +91,7 @@ func SyncAction(runner *task.Runner, isSafeMode bool) error {
 	// 2. Quota
 	if startStep <= 2 {
 		logger.Info("[Step 2/6] Checking Quota...")
-		if err := QuotaAction(runner, true); err != nil {
+		if err := runStep("quota", func() error { return QuotaAction(runner, true) }); err != nil {
 			return err
 		}
 		if err := db.MarkStepCompleted(syncRunID, 2); err != nil {
@@ -88,7 +104,10 @@ func SyncAction(runner *task.Runner, isSafeMode bool) error {
 	// 3. Free Main
 	if startStep <= 3 {
 		logger.Info("[Step 3/6] Freeing Main Account...")
-		_, err := runner.FreeMain(syncRunID)
+		err := runStep("free-main", func() error {
+			_, err := runner.FreeMain(syncRunID)
+			return err
+		})
 		if err != nil {
 			return err
 		}
@@ -112,7 +131,7 @@ func SyncAction(runner *task.Runner, isSafeMode bool) error {
 	// 5. Sync Providers
 	if startStep <= 5 {
 		logger.Info("[Step 5/6] Syncing Providers...")
-		if err := SyncProvidersAction(runner, true, syncRunID); err != nil {
+		if err := runStep("sync-providers", func() error { return SyncProvidersAction(runner, true, syncRunID) }); err != nil {
 			return err
 		}
 		if err := db.MarkStepCompleted(syncRunID, 5); err != nil {
@@ -125,7 +144,7 @@ func SyncAction(runner *task.Runner, isSafeMode bool) error {
 	// 6. Balance Storage
 	if startStep <= 6 {
 		logger.Info("[Step 6/6] Balancing Storage...")
-		if err := runner.BalanceStorage(syncRunID); err != nil {
+		if err := runStep("balance-storage", func() error { return runner.BalanceStorage(syncRunID) }); err != nil {
 			return err
 		}
 		if err := db.MarkStepCompleted(syncRunID, 6); err != nil {
@@ -139,11 +158,115 @@ func SyncAction(runner *task.Runner, isSafeMode bool) error {
 	if err := db.CompleteSyncRun(syncRunID); err != nil {
 		logger.Warning("Failed to mark sync run as completed: %v", err)
 	}
+	logCopyStats(syncRunID)
 
 	// Housekeeping: remove old completed sync runs
 	if err := db.CleanupOldSyncRuns(5); err != nil {
 		logger.Warning("Failed to cleanup old sync runs: %v", err)
+	} else {
+		pruneRunLogs()
 	}
 
 	return nil
 }
+
+// logCopyStats reports how the run's file copies moved their content and what server-side copies saved.
+func logCopyStats(runID int64) {
+	stats, err := db.GetSyncRunCopyStats(runID)
+	if err != nil {
+		logger.Warning("Failed to load copy stats for sync run #%d: %v", runID, err)
+		return
+	}
+	if stats.ServerCopies == 0 && stats.StreamedCopies == 0 {
+		return
+	}
+	logger.Info("Copies: %d server-side (%s not transferred, ~%s saved), %d streamed (%s)",
+		stats.ServerCopies, formatBytes(stats.ServerCopyBytes), stats.ServerCopySavedTime().Round(time.Second),
+		stats.StreamedCopies, formatBytes(stats.StreamedBytes))
+}
+
+const (
+	runLogMaxSize    = 10 << 20
+	runLogMaxBackups = 3
+)
+
+// runLogDir is where per-run log files are kept, next to the database.
+func runLogDir() string {
+	return filepath.Join(filepath.Dir(database.GetDBPath()), "logs")
+}
+
+// startRunLog copies the log of sync run runID to its own rotating file, recorded on the
+// run's row, and tags JSON log lines with the run ID. The returned function stops both.
+func startRunLog(runID int64) (stop func()) {
+	logger.SetField("sync_run_id", runID)
+	path := filepath.Join(runLogDir(), fmt.Sprintf("sync-run-%d.log", runID))
+	f, err := logger.OpenRotatingFile(path, runLogMaxSize, runLogMaxBackups)
+	if err != nil {
+		logger.Warning("Failed to open log file for sync run #%d: %v", runID, err)
+		return func() { logger.SetField("sync_run_id", nil) }
+	}
+	remove := logger.AddSink(f)
+	if err := db.SetSyncRunLogFile(runID, path); err != nil {
+		logger.Warning("Failed to record log file for sync run #%d: %v", runID, err)
+	}
+	return func() {
+		remove()
+		f.Close()
+		logger.SetField("sync_run_id", nil)
+	}
+}
+
+// pruneRunLogs removes the log files of sync runs that are no longer in the database.
+func pruneRunLogs() {
+	runs, err := db.ListSyncRuns(-1)
+	if err != nil {
+		logger.Warning("Failed to list sync runs for log cleanup: %v", err)
+		return
+	}
+	keep := make(map[string]bool, len(runs))
+	for _, run := range runs {
+		if run.LogFile != "" {
+			keep[filepath.Base(run.LogFile)] = true
+		}
+	}
+	entries, err := os.ReadDir(runLogDir())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning("Failed to read log directory: %v", err)
+		}
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "sync-run-") {
+			continue
+		}
+		// Rotated backups (sync-run-7.log.1) belong to the same run as their log.
+		base := name
+		if i := strings.Index(name, ".log"); i >= 0 {
+			base = name[:i+len(".log")]
+		}
+		if keep[base] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(runLogDir(), name)); err != nil {
+			logger.Warning("Failed to remove old log file %s: %v", name, err)
+		}
+	}
+}
+
+// runStep runs one step of the sync pipeline in its own span and records its duration. It fails
+// without running the step once the run lock has been lost.
+func runStep(name string, step func() error) error {
+	if err := runLockErr(); err != nil {
+		return err
+	}
+	ctx, span := tracing.Start(nil, "sync step "+name, attribute.String("step", name))
+	restore := tracing.SetCurrent(ctx)
+	start := time.Now()
+	err := step()
+	metrics.ObserveSyncStep(name, time.Since(start), err)
+	restore()
+	tracing.End(span, err)
+	return err
+}
@@ -9,13 +9,16 @@ import (
 )
 
 var (
-	syncShareWithMain  bool
-	syncGetMetadata    bool
-	syncQuota          bool
-	syncFreeMain       bool
-	syncBalanceStorage bool
-	syncSyncProviders  bool
-	syncUnsyncedFiles  bool
+	syncShareWithMain       bool
+	syncGetMetadata         bool
+	syncQuota               bool
+	syncFreeMain            bool
+	syncBalanceStorage      bool
+	syncSyncProviders       bool
+	syncUnsyncedFiles       bool
+	syncUpgradePlaceholders bool
+	syncScrubShards         bool
+	syncEncryptCaptions     bool
 )
 
 // registerSyncActionFlags registers the mutually-exclusive sync action flags and the
@@ -30,6 +33,9 @@ func registerSyncActionFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolVar(&syncBalanceStorage, "balance-storage", false, "Rebalance nearly-full backup accounts within a provider")
 	cmd.Flags().BoolVar(&syncSyncProviders, "sync-providers", false, "Apply all synchronization rules across providers")
 	cmd.Flags().BoolVar(&syncUnsyncedFiles, "sync-unsynced-files", false, "Move Google backup root files into cloud-drives-sync-aux/unsynced-from-backups")
+	cmd.Flags().BoolVar(&syncUpgradePlaceholders, "upgrade-placeholders", false, "Replace OneDrive placeholder files with native shortcuts where sharing allows")
+	cmd.Flags().BoolVar(&syncScrubShards, "scrub-shards", false, "Verify every shard of erasure-coded files and rebuild missing or corrupt ones")
+	cmd.Flags().BoolVar(&syncEncryptCaptions, "encrypt-captions", false, "Re-encrypt plaintext Telegram caption metadata with the master password")
 }
 
 // dispatchSyncAction runs the single selected sync action flag. It returns handled=true
@@ -48,6 +54,9 @@ func dispatchSyncAction(cmd *cobra.Command) (bool, error) {
 		{syncBalanceStorage, runBalanceStorage},
 		{syncSyncProviders, runSyncProviders},
 		{syncUnsyncedFiles, runSyncUnsyncedFiles},
+		{syncUpgradePlaceholders, runUpgradePlaceholders},
+		{syncScrubShards, runScrubShards},
+		{syncEncryptCaptions, runEncryptCaptions},
 	}
 
 	var selected func(*cobra.Command, []string) error
@@ -2484,7 +2484,7 @@ func cleanupCloudFiles(r *task.Runner) error {
 
 		switch u.Provider {
 		case model.ProviderTelegram:
-			if tgClient, ok := client.(*telegram.Client); ok {
+			if tgClient, ok := api.Unwrap(client).(*telegram.Client); ok {
 				logger.Info("Cleaning Telegram messages for %s...", u.Email)
 				if err := client.PreFlightCheck(); err != nil {
 					logger.Warning("PreFlight failed for cleaning Telegram: %v", err)
@@ -2494,14 +2494,14 @@ func cleanupCloudFiles(r *task.Runner) error {
 				}
 			}
 		case model.ProviderGoogle:
-			if gClient, ok := client.(*google.Client); ok {
+			if gClient, ok := api.Unwrap(client).(*google.Client); ok {
 				if err := gClient.EmptySyncFolder(); err != nil {
 					logger.Warning("Failed to empty Google folder for %s: %v", u.Email, err)
 				}
 				deleteAuxFolder(client, u)
 			}
 		case model.ProviderMicrosoft:
-			if mClient, ok := client.(*microsoft.Client); ok {
+			if mClient, ok := api.Unwrap(client).(*microsoft.Client); ok {
 				logger.Info("Cleaning Microsoft folder for %s...", u.Email)
 				if err := mClient.EmptySyncFolder(); err != nil {
 					logger.Warning("Failed to empty Microsoft folder for %s: %v", u.Email, err)
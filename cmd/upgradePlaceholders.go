@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+func runUpgradePlaceholders(cmd *cobra.Command, args []string) error {
+	logger.Info("Updating metadata...")
+	if err := sharedRunner.GetMetadata(); err != nil {
+		return err
+	}
+	_, err := sharedRunner.UpgradePlaceholders()
+	return err
+}
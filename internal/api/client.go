@@ -2,6 +2,7 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/FranLegon/cloud-drives-sync/internal/model"
@@ -10,6 +11,9 @@ import (
 var (
 	// ErrOwnershipTransferPending indicates that ownership transfer requires acceptance
 	ErrOwnershipTransferPending = errors.New("ownership transfer pending acceptance")
+	// ErrServerCopyUnsupported indicates that the provider cannot copy between the two accounts
+	// server-side, so the content has to be streamed
+	ErrServerCopyUnsupported = errors.New("server-side copy not supported between these accounts")
 )
 
 // QuotaInfo represents storage quota information
@@ -57,6 +61,70 @@ type CloudClient interface {
 	GetUserIdentifier() string
 }
 
+// RangeDownloader is implemented by clients that can read part of a file without downloading
+// all of it.
+type RangeDownloader interface {
+	// DownloadFileRange writes length bytes of the file starting at offset to writer. A
+	// negative length reads to the end of the file.
+	DownloadFileRange(fileID string, offset, length int64, writer io.Writer) error
+}
+
+// ServerCopier is implemented by clients that can copy a file from another account of the same
+// provider without its content passing through this host.
+type ServerCopier interface {
+	// CopyFrom copies replica, held by source, into folderID of this client's account as name.
+	// It returns ErrServerCopyUnsupported when the two accounts cannot copy server-side.
+	CopyFrom(source CloudClient, replica *model.Replica, folderID, name string) (*model.File, error)
+}
+
+// Renamer is implemented by clients that can rename a file or folder in place.
+type Renamer interface {
+	RenameFile(fileID, newName string) error
+}
+
+// Unwrapper is implemented by clients that decorate another client, e.g. to trace its calls.
+type Unwrapper interface {
+	Unwrap() CloudClient
+}
+
+// Unwrap returns the provider client underneath any decorators, for type assertions on
+// provider-specific methods.
+func Unwrap(client CloudClient) CloudClient {
+	for {
+		u, ok := client.(Unwrapper)
+		if !ok {
+			return client
+		}
+		client = u.Unwrap()
+	}
+}
+
+// RangeHeader returns the HTTP Range header value for offset and length (negative length reads
+// to the end).
+func RangeHeader(offset, length int64) string {
+	if length < 0 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
+
+// CopyRange copies length bytes starting at offset from r to w, discarding what comes before.
+// It is used when a server answers a range request with the whole file. A negative length
+// copies to the end.
+func CopyRange(w io.Writer, r io.Reader, offset, length int64) error {
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, r, offset); err != nil {
+			return fmt.Errorf("failed to skip to offset %d: %w", offset, err)
+		}
+	}
+	if length < 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	_, err := io.CopyN(w, r, length)
+	return err
+}
+
 // FileHasher defines methods for file hashing
 type FileHasher interface {
 	GetNativeHash(fileID string) (string, string, error) // returns hash, algorithm, error
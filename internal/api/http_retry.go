@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/FranLegon/cloud-drives-sync/internal/metrics"
 	"github.com/cenkalti/backoff/v4"
 )
 
@@ -61,8 +62,10 @@ func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 
 		resp, err := t.Base.RoundTrip(req)
 		if err != nil {
+			metrics.ObserveHTTPRequest(req.URL.Host, "error")
 			return nil, err
 		}
+		metrics.ObserveHTTPRequest(req.URL.Host, strconv.Itoa(resp.StatusCode))
 
 		// Check for rate limit or server errors
 		if isRetriableStatusCode(resp.StatusCode) {
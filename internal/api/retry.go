@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/FranLegon/cloud-drives-sync/internal/metrics"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/gotd/td/tgerr"
 	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
@@ -126,17 +127,20 @@ func WithRetry(operation func() error) error {
 		if IsRetriableError(err) {
 			// Respect Retry-After header if the server told us how long to wait.
 			var wait time.Duration
+			waitKind := ""
 			var httpErr HTTPError
 			if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
-				wait = httpErr.RetryAfter
+				wait, waitKind = httpErr.RetryAfter, "retry_after"
 			} else if d, ok := tgerr.AsFloodWait(err); ok {
-				wait = d
+				wait, waitKind = d, "flood_wait"
 			}
+			metrics.ObserveRetry(retryReason(err))
 
 			if wait > 0 {
 				if wait > 2*time.Minute {
 					wait = 2 * time.Minute
 				}
+				metrics.ObserveRateLimitWait(waitKind, wait)
 				time.Sleep(wait)
 			}
 			// Use retryTrigger to hide any wrapped PermanentError from backoff.Retry
@@ -153,11 +157,34 @@ func WithRetry(operation func() error) error {
 	}, b)
 
 	if trigger, ok := err.(retryTrigger); ok {
-		return trigger.err
+		err = trigger.err
 	}
+	metrics.ObserveAPICall(err)
 	return err
 }
 
+// retryReason classifies a retriable error for the retry metrics.
+func retryReason(err error) string {
+	if _, ok := tgerr.AsFloodWait(err); ok {
+		return "flood_wait"
+	}
+	var httpErr HTTPError
+	if errors.As(err, &httpErr) {
+		if httpErr.Code == http.StatusTooManyRequests {
+			return "rate_limited"
+		}
+		return "server_error"
+	}
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		if gErr.Code == http.StatusTooManyRequests {
+			return "rate_limited"
+		}
+		return "server_error"
+	}
+	return "transient"
+}
+
 // WithRetryT executes the given operation returning T and error with exponential backoff.
 func WithRetryT[T any](operation func() (T, error)) (T, error) {
 	var result T
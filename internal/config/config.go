@@ -50,21 +50,22 @@ func GetSaltPath() string {
 	return filepath.Join(filepath.Dir(execPath), SaltFileName)
 }
 
-// LoadConfig loads and decrypts the configuration file
-func LoadConfig(masterPassword string) (*model.Config, error) {
-	// Load salt (prefer embedded data)
-	var salt []byte
+// loadSalt returns the salt of the configuration, preferring embedded data
+func loadSalt() ([]byte, error) {
 	if embeddedSaltData != nil {
 		if len(embeddedSaltData) != 32 {
 			return nil, errors.New("invalid embedded salt size")
 		}
-		salt = embeddedSaltData
-	} else {
-		var err error
-		salt, err = crypto.LoadSalt(GetSaltPath())
-		if err != nil {
-			return nil, err
-		}
+		return embeddedSaltData, nil
+	}
+	return crypto.LoadSalt(GetSaltPath())
+}
+
+// LoadConfig loads and decrypts the configuration file
+func LoadConfig(masterPassword string) (*model.Config, error) {
+	salt, err := loadSalt()
+	if err != nil {
+		return nil, err
 	}
 
 	// Derive key
@@ -75,7 +76,6 @@ func LoadConfig(masterPassword string) (*model.Config, error) {
 	if embeddedConfigData != nil {
 		encryptedData = embeddedConfigData
 	} else {
-		var err error
 		encryptedData, err = os.ReadFile(GetConfigPath())
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -144,6 +144,26 @@ func SaveConfig(cfg *model.Config, masterPassword string) error {
 	return nil
 }
 
+// DataKey derives the key protecting pool data from the master password. It stays the same
+// wherever the configuration is used; ContentKey and CaptionKey derive the keys for each use.
+func DataKey(masterPassword string) ([]byte, error) {
+	salt, err := loadSalt()
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DeriveKey(masterPassword, salt), nil
+}
+
+// ContentKey returns the key that wraps the per-file keys of encrypted replicas.
+func ContentKey(dataKey []byte) []byte {
+	return crypto.SubKey(dataKey, "replica-content")
+}
+
+// CaptionKey returns the key that encrypts the metadata in Telegram captions.
+func CaptionKey(dataKey []byte) []byte {
+	return crypto.SubKey(dataKey, "telegram-caption")
+}
+
 // ConfigExists checks if the config file exists
 func ConfigExists() bool {
 	if embeddedConfigData != nil {
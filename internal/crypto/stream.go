@@ -0,0 +1,357 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// An encrypted stream starts with a header holding a random per-file key wrapped with the
+// caller's key, followed by the content sealed with AES-256-GCM in chunks of streamChunkSize
+// bytes. Each chunk's nonce is the header's random prefix, the chunk index and a flag marking the
+// final chunk, so chunks cannot be reordered, dropped or truncated without failing to open.
+
+const (
+	streamMagic     = "CDSE"
+	streamVersion   = 1
+	streamChunkSize = 64 << 10
+	tagSize         = 16
+	noncePrefixSize = nonceSize - 5
+	wrappedKeySize  = nonceSize + keySize + tagSize
+
+	// StreamHeaderSize is the length of the header that starts every encrypted stream.
+	StreamHeaderSize = 4 + 1 + wrappedKeySize + noncePrefixSize // magic, version, wrapped key, nonce prefix
+
+	sealedChunkSize = streamChunkSize + tagSize
+)
+
+var (
+	// ErrStreamCorrupt is returned when an encrypted stream fails to open: it was damaged,
+	// truncated or encrypted with another key.
+	ErrStreamCorrupt = errors.New("encrypted stream is corrupt or was encrypted with another key")
+
+	errStreamHeader = errors.New("not an encrypted stream")
+)
+
+// SubKey derives an independent key for purpose from a master key, so a single password-derived
+// key can protect several kinds of data.
+func SubKey(master []byte, purpose string) []byte {
+	h := hmac.New(sha256.New, master)
+	h.Write([]byte(purpose))
+	return h.Sum(nil)
+}
+
+// chunkCount returns the number of chunks of a stream holding plainSize bytes. An empty stream
+// still has one (empty) final chunk.
+func chunkCount(plainSize int64) int64 {
+	if plainSize == 0 {
+		return 1
+	}
+	return (plainSize + streamChunkSize - 1) / streamChunkSize
+}
+
+// EncryptedSize returns the size of the encrypted stream of plainSize bytes.
+func EncryptedSize(plainSize int64) int64 {
+	return StreamHeaderSize + plainSize + chunkCount(plainSize)*tagSize
+}
+
+// PlaintextSize returns the number of bytes held by an encrypted stream of cipherSize bytes.
+func PlaintextSize(cipherSize int64) (int64, error) {
+	body := cipherSize - StreamHeaderSize
+	if body < tagSize {
+		return 0, ErrStreamCorrupt
+	}
+	full, rest := body/sealedChunkSize, body%sealedChunkSize
+	if rest == 0 {
+		return full * streamChunkSize, nil
+	}
+	if rest < tagSize {
+		return 0, ErrStreamCorrupt
+	}
+	return full*streamChunkSize + rest - tagSize, nil
+}
+
+// StreamRange returns the byte range of an encrypted stream holding plainSize bytes that covers
+// the length plaintext bytes starting at offset. The range excludes the header, which
+// NewRangeDecryptWriter needs as well.
+func StreamRange(plainSize, offset, length int64) (cipherOffset, cipherLength int64) {
+	first := offset / streamChunkSize
+	last := first
+	if length > 0 {
+		last = (offset + length - 1) / streamChunkSize
+	}
+	cipherOffset = StreamHeaderSize + first*sealedChunkSize
+	end := min(StreamHeaderSize+(last+1)*sealedChunkSize, EncryptedSize(plainSize))
+	return cipherOffset, end - cipherOffset
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce of chunk index of a stream.
+func chunkNonce(dst, prefix []byte, index uint32, last bool) []byte {
+	dst = append(dst[:0], prefix...)
+	dst = binary.BigEndian.AppendUint32(dst, index)
+	if last {
+		return append(dst, 1)
+	}
+	return append(dst, 0)
+}
+
+// newStreamHeader generates a per-file key and returns the header wrapping it with key, along
+// with the cipher sealing the chunks and the nonce prefix.
+func newStreamHeader(key []byte) ([]byte, cipher.AEAD, []byte, error) {
+	kek, err := newGCM(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	fileKey := make([]byte, keySize)
+	wrapNonce := make([]byte, nonceSize)
+	prefix := make([]byte, noncePrefixSize)
+	for _, b := range [][]byte{fileKey, wrapNonce, prefix} {
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	header := make([]byte, 0, StreamHeaderSize)
+	header = append(header, streamMagic...)
+	header = append(header, streamVersion)
+	aad := header[:len(header):len(header)]
+	header = append(header, wrapNonce...)
+	header = kek.Seal(header, wrapNonce, fileKey, aad)
+	header = append(header, prefix...)
+
+	aead, err := newGCM(fileKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return header, aead, prefix, nil
+}
+
+// openStreamHeader unwraps the per-file key of header with key and returns the cipher opening
+// the chunks and the nonce prefix.
+func openStreamHeader(key, header []byte) (cipher.AEAD, []byte, error) {
+	if len(header) != StreamHeaderSize || string(header[:len(streamMagic)]) != streamMagic {
+		return nil, nil, errStreamHeader
+	}
+	if header[len(streamMagic)] != streamVersion {
+		return nil, nil, errors.New("unsupported encrypted stream version")
+	}
+	kek, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aad := header[:len(streamMagic)+1]
+	wrapped := header[len(aad) : len(aad)+wrappedKeySize]
+	fileKey, err := kek.Open(nil, wrapped[:nonceSize], wrapped[nonceSize:], aad)
+	if err != nil {
+		return nil, nil, ErrStreamCorrupt
+	}
+	aead, err := newGCM(fileKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, header[len(aad)+wrappedKeySize:], nil
+}
+
+// encryptReader encrypts the content read from src into a stream.
+type encryptReader struct {
+	src    io.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	nonce  []byte
+	plain  []byte // the next chunk, plus one byte read ahead to find the final chunk
+	have   int    // bytes of plain already read
+	out    []byte // sealed bytes not yet returned
+	done   bool
+}
+
+// NewEncryptReader returns a reader yielding the encrypted stream of the content of src under a
+// new per-file key wrapped with key. The stream is EncryptedSize of the content long.
+func NewEncryptReader(key []byte, src io.Reader) (io.Reader, error) {
+	header, aead, prefix, err := newStreamHeader(key)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptReader{
+		src:    src,
+		aead:   aead,
+		prefix: prefix,
+		plain:  make([]byte, streamChunkSize+1),
+		out:    header,
+	}, nil
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.sealNext(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// sealNext reads and seals the next chunk.
+func (e *encryptReader) sealNext() error {
+	n, err := io.ReadFull(e.src, e.plain[e.have:])
+	e.have += n
+	last := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		return err
+	}
+	if !last && e.index == ^uint32(0) {
+		return errors.New("content too large for an encrypted stream")
+	}
+
+	size := min(e.have, streamChunkSize)
+	e.nonce = chunkNonce(e.nonce, e.prefix, e.index, last)
+	e.out = e.aead.Seal(e.out[:0], e.nonce, e.plain[:size], nil)
+	e.index++
+	if last {
+		e.done = true
+		return nil
+	}
+	// Keep the byte read ahead as the start of the next chunk
+	e.plain[0] = e.plain[streamChunkSize]
+	e.have = 1
+	return nil
+}
+
+// decryptWriter decrypts an encrypted stream, or part of one, written to it.
+type decryptWriter struct {
+	key       []byte
+	w         io.Writer
+	aead      cipher.AEAD
+	prefix    []byte
+	header    []byte
+	buf       []byte // sealed bytes of the current chunk
+	plain     []byte
+	nonce     []byte
+	index     uint32
+	lastIndex int64 // index of the final chunk, -1 when it is the last one written
+	skip      int64 // plaintext bytes to drop before writing
+	remain    int64 // plaintext bytes left to write, -1 for all
+	err       error
+}
+
+// NewDecryptWriter returns a writer that decrypts an encrypted stream written to it into w. Close
+// must be called once the whole stream is written; it fails when the stream was truncated.
+func NewDecryptWriter(key []byte, w io.Writer) io.WriteCloser {
+	return &decryptWriter{key: key, w: w, lastIndex: -1, remain: -1}
+}
+
+// NewRangeDecryptWriter returns a writer that decrypts the part of an encrypted stream selected by
+// StreamRange(plainSize, offset, length) into the length plaintext bytes starting at offset.
+// header is the first StreamHeaderSize bytes of the stream.
+func NewRangeDecryptWriter(key, header []byte, plainSize, offset, length int64, w io.Writer) (io.WriteCloser, error) {
+	aead, prefix, err := openStreamHeader(key, header)
+	if err != nil {
+		return nil, err
+	}
+	first := offset / streamChunkSize
+	return &decryptWriter{
+		w:         w,
+		aead:      aead,
+		prefix:    prefix,
+		index:     uint32(first),
+		lastIndex: chunkCount(plainSize) - 1,
+		skip:      offset - first*streamChunkSize,
+		remain:    length,
+	}, nil
+}
+
+func (d *decryptWriter) Write(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	n := len(p)
+	if d.aead == nil {
+		k := min(len(p), StreamHeaderSize-len(d.header))
+		d.header = append(d.header, p[:k]...)
+		p = p[k:]
+		if len(d.header) < StreamHeaderSize {
+			return n, nil
+		}
+		if d.aead, d.prefix, d.err = openStreamHeader(d.key, d.header); d.err != nil {
+			return 0, d.err
+		}
+	}
+	for len(p) > 0 {
+		// A full chunk followed by more data is not the final one
+		if len(d.buf) == sealedChunkSize {
+			if d.err = d.openChunk(false); d.err != nil {
+				return 0, d.err
+			}
+		}
+		k := min(len(p), sealedChunkSize-len(d.buf))
+		d.buf = append(d.buf, p[:k]...)
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// Close decrypts the final chunk written and checks that nothing is missing.
+func (d *decryptWriter) Close() error {
+	if d.err != nil {
+		return d.err
+	}
+	if d.aead == nil {
+		return ErrStreamCorrupt
+	}
+	return d.openChunk(true)
+}
+
+// openChunk decrypts the buffered chunk and writes its plaintext. final reports that no more
+// data follows it.
+func (d *decryptWriter) openChunk(final bool) error {
+	last := final
+	if d.lastIndex >= 0 {
+		if int64(d.index) > d.lastIndex {
+			return ErrStreamCorrupt
+		}
+		last = int64(d.index) == d.lastIndex
+	}
+	d.nonce = chunkNonce(d.nonce, d.prefix, d.index, last)
+	plain, err := d.aead.Open(d.plain[:0], d.nonce, d.buf, nil)
+	if err != nil {
+		return ErrStreamCorrupt
+	}
+	d.plain = plain
+	d.buf = d.buf[:0]
+	d.index++
+
+	if d.skip > 0 {
+		k := min(int64(len(plain)), d.skip)
+		plain = plain[k:]
+		d.skip -= k
+	}
+	if d.remain >= 0 {
+		plain = plain[:min(int64(len(plain)), d.remain)]
+		d.remain -= int64(len(plain))
+	}
+	if len(plain) == 0 {
+		return nil
+	}
+	_, err = d.w.Write(plain)
+	return err
+}
@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func encryptStream(t *testing.T, key, plain []byte) []byte {
+	t.Helper()
+	r, err := NewEncryptReader(key, bytes.NewReader(plain))
+	if err != nil {
+		t.Fatalf("NewEncryptReader: %v", err)
+	}
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	return sealed
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key := SubKey(make([]byte, keySize), "content")
+	for _, size := range []int{0, 1, streamChunkSize - 1, streamChunkSize, streamChunkSize + 1, 3*streamChunkSize + 17} {
+		plain := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(plain)
+
+		sealed := encryptStream(t, key, plain)
+		if int64(len(sealed)) != EncryptedSize(int64(size)) {
+			t.Fatalf("size %d: expected %d encrypted bytes, got %d", size, EncryptedSize(int64(size)), len(sealed))
+		}
+		if got, err := PlaintextSize(int64(len(sealed))); err != nil || got != int64(size) {
+			t.Fatalf("size %d: PlaintextSize returned %d (%v)", size, got, err)
+		}
+
+		var out bytes.Buffer
+		w := NewDecryptWriter(key, &out)
+		// Write in odd pieces to cross chunk boundaries
+		for rest := sealed; len(rest) > 0; {
+			n := min(len(rest), 1000)
+			if _, err := w.Write(rest[:n]); err != nil {
+				t.Fatalf("size %d: Write: %v", size, err)
+			}
+			rest = rest[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("size %d: Close: %v", size, err)
+		}
+		if !bytes.Equal(out.Bytes(), plain) {
+			t.Fatalf("size %d: decrypted content differs", size)
+		}
+	}
+}
+
+func TestStreamRejectsTamperingAndWrongKey(t *testing.T) {
+	key := SubKey(make([]byte, keySize), "content")
+	plain := bytes.Repeat([]byte("secret"), streamChunkSize/2)
+	sealed := encryptStream(t, key, plain)
+
+	open := func(key, data []byte) error {
+		w := NewDecryptWriter(key, io.Discard)
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+
+	if err := open(SubKey(make([]byte, keySize), "other"), sealed); !errors.Is(err, ErrStreamCorrupt) {
+		t.Fatalf("expected wrong key to fail, got %v", err)
+	}
+	flipped := bytes.Clone(sealed)
+	flipped[StreamHeaderSize+10] ^= 1
+	if err := open(key, flipped); !errors.Is(err, ErrStreamCorrupt) {
+		t.Fatalf("expected a modified chunk to fail, got %v", err)
+	}
+	// Dropping the final chunk leaves a stream that ends on a full, non-final chunk
+	if err := open(key, sealed[:StreamHeaderSize+sealedChunkSize]); !errors.Is(err, ErrStreamCorrupt) {
+		t.Fatalf("expected a truncated stream to fail, got %v", err)
+	}
+}
+
+func TestStreamRangeDecrypt(t *testing.T) {
+	key := SubKey(make([]byte, keySize), "content")
+	plain := make([]byte, 4*streamChunkSize+100)
+	rand.New(rand.NewSource(7)).Read(plain)
+	sealed := encryptStream(t, key, plain)
+	size := int64(len(plain))
+
+	for _, tc := range []struct{ offset, length int64 }{
+		{0, 10},
+		{streamChunkSize - 5, 10},
+		{streamChunkSize, streamChunkSize},
+		{2*streamChunkSize + 3, 2*streamChunkSize + 97},
+		{size - 1, 1},
+	} {
+		off, n := StreamRange(size, tc.offset, tc.length)
+		var out bytes.Buffer
+		w, err := NewRangeDecryptWriter(key, sealed[:StreamHeaderSize], size, tc.offset, tc.length, &out)
+		if err != nil {
+			t.Fatalf("NewRangeDecryptWriter: %v", err)
+		}
+		if _, err := w.Write(sealed[off : off+n]); err != nil {
+			t.Fatalf("range %d+%d: Write: %v", tc.offset, tc.length, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("range %d+%d: Close: %v", tc.offset, tc.length, err)
+		}
+		if !bytes.Equal(out.Bytes(), plain[tc.offset:tc.offset+tc.length]) {
+			t.Fatalf("range %d+%d: decrypted bytes differ", tc.offset, tc.length)
+		}
+	}
+}
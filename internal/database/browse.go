@@ -0,0 +1,90 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// ReplicaCoverage summarizes the active replicas of a file on one provider.
+type ReplicaCoverage struct {
+	Count int   `json:"count"`
+	Size  int64 `json:"size"`
+}
+
+// FileSummary is a logical file together with its active replica coverage per provider.
+type FileSummary struct {
+	ID             string
+	Path           string
+	Name           string
+	Size           int64
+	GoogleDriveMD5 string
+	ModTime        time.Time
+	Status         string
+	Coverage       map[model.Provider]ReplicaCoverage
+}
+
+// GetFileSummaries returns every logical file at or below dir ("/" for the whole pool), ordered
+// by path. It is the read path of the pool browsing commands and only reads the local DB.
+func (db *DB) GetFileSummaries(dir string) ([]*FileSummary, error) {
+	prefix := strings.TrimSuffix(model.NormalizePath(dir), "/") + "/"
+	rows, err := db.query(`
+		SELECT f.id, f.path, f.name, f.size, f.google_drive_md5, f.mod_time, f.status,
+			r.provider, COUNT(r.id), COALESCE(SUM(r.size), 0)
+		FROM files f
+		LEFT JOIN replicas r ON r.file_id = f.id AND r.status = 'active'
+		WHERE ? = '/' OR substr(f.path, 1, ?) = ?
+		GROUP BY f.id, r.provider
+		ORDER BY f.path, f.id`, prefix, utf8.RuneCountInString(prefix), prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []*FileSummary
+	var current *FileSummary
+	for rows.Next() {
+		var (
+			f        FileSummary
+			modTime  int64
+			provider sql.NullString
+			count    int
+			size     int64
+		)
+		if err := rows.Scan(&f.ID, &f.Path, &f.Name, &f.Size, &f.GoogleDriveMD5, &modTime, &f.Status, &provider, &count, &size); err != nil {
+			return nil, err
+		}
+		if current == nil || current.ID != f.ID {
+			f.ModTime = time.Unix(modTime, 0)
+			f.Coverage = make(map[model.Provider]ReplicaCoverage)
+			current = &f
+			files = append(files, current)
+		}
+		if provider.Valid && count > 0 {
+			current.Coverage[model.Provider(provider.String)] = ReplicaCoverage{Count: count, Size: size}
+		}
+	}
+	return files, rows.Err()
+}
+
+// GetLogicalFolderByPath returns the logical_folder at path, preferring a live one, or nil.
+func (db *DB) GetLogicalFolderByPath(path string) (*model.LogicalFolder, error) {
+	row := db.queryRow(`
+		SELECT id, path, name, parent_logical_folder_id, status FROM logical_folders WHERE path = ?
+		ORDER BY CASE status WHEN 'active' THEN 0 WHEN 'soft-deleted' THEN 1 ELSE 2 END, id
+		LIMIT 1`, path)
+	f := &model.LogicalFolder{}
+	var parent sql.NullString
+	if err := row.Scan(&f.ID, &f.Path, &f.Name, &parent, &f.Status); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	f.ParentLogicalFolderID = parent.String
+	return f, nil
+}
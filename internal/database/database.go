@@ -38,6 +38,7 @@ func SetAuxFolderName(name string) {
 // DB represents the database connection
 type DB struct {
 	conn      *sql.DB
+	path      string
 	stmtCache map[string]*sql.Stmt
 	stmtMutex sync.RWMutex
 }
@@ -53,8 +54,12 @@ func GetDBPath() string {
 
 // Open opens a connection to the encrypted SQLite database
 func Open(masterPassword string) (*DB, error) {
-	dbPath := GetDBPath()
+	return OpenPath(GetDBPath(), masterPassword)
+}
 
+// OpenPath opens an encrypted metadata database stored at dbPath, such as a downloaded
+// snapshot, instead of the default location.
+func OpenPath(dbPath, masterPassword string) (*DB, error) {
 	// SQLCipher connection string with _pragma_key parameter
 	// This is the proper way to set the encryption key for go-sqlcipher
 	// _pragma_key is used instead of _key to ensure the key is set via PRAGMA before any DB access
@@ -80,7 +85,7 @@ func Open(masterPassword string) (*DB, error) {
 		return nil, err
 	}
 
-	db := &DB{conn: conn}
+	db := &DB{conn: conn, path: dbPath}
 	return db, nil
 }
 
@@ -166,10 +171,11 @@ func (db *DB) queryRow(query string, args ...interface{}) *sql.Row {
 func (db *DB) Reset() error {
 	return db.WithTx(func(tx *sql.Tx) error {
 		tables := []string{
+			"shard_fragments",
+			"file_shards",
 			"replica_fragments",
 			"replicas",
 			"files",
-			"folders",
 			"folder_replicas",
 			"logical_folders",
 			"sync_copy_log",
@@ -222,7 +228,8 @@ func (db *DB) buildContentChecksumInput() (string, error) {
 		"files",
 		"replicas",
 		"replica_fragments",
-		"folders",
+		"file_shards",
+		"shard_fragments",
 		"logical_folders",
 		"folder_replicas",
 	}
@@ -307,9 +314,6 @@ func shouldExcludeChecksumColumn(table, column, columnType string, pk int) bool
 	if column == "last_seen_at" {
 		return true
 	}
-	if table == "folders" && column == "user_email" {
-		return true
-	}
 	if column == "id" && pk > 0 && isIntegerColumnType(columnType) {
 		return true
 	}
@@ -391,186 +395,6 @@ func (db *DB) Close() error {
 	return nil
 }
 
-// Initialize creates the database schema
-func (db *DB) Initialize() error {
-	return db.WithTx(func(tx *sql.Tx) error {
-		schema := `
-		CREATE TABLE IF NOT EXISTS files (
-			id TEXT PRIMARY KEY,
-			path TEXT NOT NULL,
-			name TEXT NOT NULL,
-			size INTEGER NOT NULL,
-			google_drive_md5 TEXT NOT NULL DEFAULT '',
-			mod_time INTEGER NOT NULL,
-			status TEXT NOT NULL
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_files_path ON files(path);
-		CREATE INDEX IF NOT EXISTS idx_files_google_drive_md5 ON files(google_drive_md5);
-		CREATE INDEX IF NOT EXISTS idx_files_status ON files(status);
-
-		CREATE TABLE IF NOT EXISTS replicas (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			file_id TEXT,
-			path TEXT NOT NULL,
-			name TEXT NOT NULL,
-			size INTEGER NOT NULL,
-			provider TEXT NOT NULL,
-			account_id TEXT NOT NULL,
-			native_id TEXT NOT NULL,
-			native_hash TEXT,
-			mod_time INTEGER NOT NULL,
-			status TEXT NOT NULL,
-			fragmented BOOLEAN NOT NULL DEFAULT 0,
-			last_seen_at INTEGER NOT NULL DEFAULT 0,
-			FOREIGN KEY(file_id) REFERENCES files(id) ON DELETE CASCADE
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_replicas_file_id ON replicas(file_id);
-		CREATE INDEX IF NOT EXISTS idx_replicas_provider ON replicas(provider);
-		CREATE INDEX IF NOT EXISTS idx_replicas_account_id ON replicas(account_id);
-		CREATE INDEX IF NOT EXISTS idx_replicas_native_id_old ON replicas(native_id);
-		CREATE INDEX IF NOT EXISTS idx_replicas_status ON replicas(status);
-		CREATE UNIQUE INDEX IF NOT EXISTS idx_replicas_unique ON replicas(provider, account_id, native_id);
-
-		CREATE INDEX IF NOT EXISTS idx_replicas_native_id ON replicas(provider, native_id);
-		CREATE INDEX IF NOT EXISTS idx_replicas_provider_status ON replicas(provider, status);
-		CREATE INDEX IF NOT EXISTS idx_replicas_last_seen ON replicas(last_seen_at);
-
-		CREATE TABLE IF NOT EXISTS replica_fragments (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			replica_id INTEGER NOT NULL,
-			fragment_number INTEGER NOT NULL,
-			fragments_total INTEGER NOT NULL,
-			size INTEGER NOT NULL,
-			native_fragment_id TEXT NOT NULL,
-			FOREIGN KEY(replica_id) REFERENCES replicas(id) ON DELETE CASCADE
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_replica_fragments_replica_id ON replica_fragments(replica_id);
-		CREATE INDEX IF NOT EXISTS idx_replica_fragments_native_id ON replica_fragments(native_fragment_id);
-
-		CREATE TABLE IF NOT EXISTS folders (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL,
-			path TEXT NOT NULL,
-			provider TEXT NOT NULL,
-			user_email TEXT,
-			user_phone TEXT,
-			parent_folder_id TEXT,
-			owner_email TEXT
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_folders_provider ON folders(provider);
-		CREATE INDEX IF NOT EXISTS idx_folders_path ON folders(path);
-
-		-- New-model folder tables (SPEC): a provider-agnostic logical_folder with one
-		-- folder_replica per provider/account. Populated by the Phase 2 folder sync logic.
-		CREATE TABLE IF NOT EXISTS logical_folders (
-			id TEXT PRIMARY KEY,
-			path TEXT NOT NULL,
-			name TEXT NOT NULL,
-			parent_logical_folder_id TEXT,
-			status TEXT NOT NULL DEFAULT 'active'
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_logical_folders_path ON logical_folders(path);
-		CREATE INDEX IF NOT EXISTS idx_logical_folders_parent ON logical_folders(parent_logical_folder_id);
-		CREATE INDEX IF NOT EXISTS idx_logical_folders_status ON logical_folders(status);
-
-		CREATE TABLE IF NOT EXISTS folder_replicas (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			logical_folder_id TEXT NOT NULL,
-			provider TEXT NOT NULL,
-			account_id TEXT NOT NULL,
-			native_folder_id TEXT NOT NULL,
-			owner TEXT DEFAULT '',
-			last_seen_at INTEGER NOT NULL DEFAULT 0,
-			FOREIGN KEY(logical_folder_id) REFERENCES logical_folders(id) ON DELETE CASCADE
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_folder_replicas_logical_folder_id ON folder_replicas(logical_folder_id);
-		CREATE INDEX IF NOT EXISTS idx_folder_replicas_provider ON folder_replicas(provider);
-		CREATE INDEX IF NOT EXISTS idx_folder_replicas_account_id ON folder_replicas(account_id);
-		CREATE UNIQUE INDEX IF NOT EXISTS idx_folder_replicas_unique ON folder_replicas(provider, account_id, native_folder_id);
-
-		CREATE TABLE IF NOT EXISTS sync_runs (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			started_at INTEGER NOT NULL,
-			completed_at INTEGER,
-			last_completed_step INTEGER NOT NULL DEFAULT 0,
-			safe_mode BOOLEAN NOT NULL DEFAULT 0
-		);
-
-		CREATE TABLE IF NOT EXISTS sync_copy_log (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			sync_run_id INTEGER NOT NULL,
-			file_id TEXT NOT NULL,
-			target_provider TEXT NOT NULL,
-			created_at INTEGER NOT NULL,
-			FOREIGN KEY(sync_run_id) REFERENCES sync_runs(id) ON DELETE CASCADE
-		);
-
-		CREATE UNIQUE INDEX IF NOT EXISTS idx_sync_copy_log_unique ON sync_copy_log(sync_run_id, file_id, target_provider);
-
-		CREATE TABLE IF NOT EXISTS _db_version (version INTEGER);
-		INSERT INTO _db_version (version) SELECT 0 WHERE NOT EXISTS (SELECT 1 FROM _db_version);
-
-		CREATE TRIGGER IF NOT EXISTS files_ai AFTER INSERT ON files BEGIN UPDATE _db_version SET version = version + 1; END;
-		CREATE TRIGGER IF NOT EXISTS files_au AFTER UPDATE ON files
-		WHEN OLD.path IS NOT NEW.path OR OLD.name IS NOT NEW.name OR OLD.size IS NOT NEW.size OR OLD.google_drive_md5 IS NOT NEW.google_drive_md5 OR OLD.mod_time IS NOT NEW.mod_time OR OLD.status IS NOT NEW.status
-		BEGIN UPDATE _db_version SET version = version + 1; END;
-		CREATE TRIGGER IF NOT EXISTS files_ad AFTER DELETE ON files BEGIN UPDATE _db_version SET version = version + 1; END;
-
-		CREATE TRIGGER IF NOT EXISTS replicas_ai AFTER INSERT ON replicas BEGIN UPDATE _db_version SET version = version + 1; END;
-		CREATE TRIGGER IF NOT EXISTS replicas_au AFTER UPDATE ON replicas 
-		WHEN OLD.file_id IS NOT NEW.file_id OR OLD.path IS NOT NEW.path OR OLD.name IS NOT NEW.name OR OLD.size IS NOT NEW.size OR OLD.provider IS NOT NEW.provider OR OLD.account_id IS NOT NEW.account_id OR OLD.native_id IS NOT NEW.native_id OR OLD.native_hash IS NOT NEW.native_hash OR OLD.mod_time IS NOT NEW.mod_time OR OLD.status IS NOT NEW.status OR OLD.fragmented IS NOT NEW.fragmented OR OLD.owner IS NOT NEW.owner
-		BEGIN UPDATE _db_version SET version = version + 1; END;
-		CREATE TRIGGER IF NOT EXISTS replicas_ad AFTER DELETE ON replicas BEGIN UPDATE _db_version SET version = version + 1; END;
-
-		CREATE TRIGGER IF NOT EXISTS folders_ai AFTER INSERT ON folders BEGIN UPDATE _db_version SET version = version + 1; END;
-		CREATE TRIGGER IF NOT EXISTS folders_au AFTER UPDATE ON folders
-		WHEN OLD.name IS NOT NEW.name OR OLD.path IS NOT NEW.path OR OLD.provider IS NOT NEW.provider OR OLD.parent_folder_id IS NOT NEW.parent_folder_id OR OLD.owner_email IS NOT NEW.owner_email
-		BEGIN UPDATE _db_version SET version = version + 1; END;
-		CREATE TRIGGER IF NOT EXISTS folders_ad AFTER DELETE ON folders BEGIN UPDATE _db_version SET version = version + 1; END;
-
-		CREATE TRIGGER IF NOT EXISTS logical_folders_ai AFTER INSERT ON logical_folders BEGIN UPDATE _db_version SET version = version + 1; END;
-		CREATE TRIGGER IF NOT EXISTS logical_folders_au AFTER UPDATE ON logical_folders
-		WHEN OLD.path IS NOT NEW.path OR OLD.name IS NOT NEW.name OR OLD.parent_logical_folder_id IS NOT NEW.parent_logical_folder_id OR OLD.status IS NOT NEW.status
-		BEGIN UPDATE _db_version SET version = version + 1; END;
-		CREATE TRIGGER IF NOT EXISTS logical_folders_ad AFTER DELETE ON logical_folders BEGIN UPDATE _db_version SET version = version + 1; END;
-
-		CREATE TRIGGER IF NOT EXISTS folder_replicas_ai AFTER INSERT ON folder_replicas BEGIN UPDATE _db_version SET version = version + 1; END;
-		CREATE TRIGGER IF NOT EXISTS folder_replicas_au AFTER UPDATE ON folder_replicas
-		WHEN OLD.logical_folder_id IS NOT NEW.logical_folder_id OR OLD.provider IS NOT NEW.provider OR OLD.account_id IS NOT NEW.account_id OR OLD.native_folder_id IS NOT NEW.native_folder_id OR OLD.owner IS NOT NEW.owner
-		BEGIN UPDATE _db_version SET version = version + 1; END;
-		CREATE TRIGGER IF NOT EXISTS folder_replicas_ad AFTER DELETE ON folder_replicas BEGIN UPDATE _db_version SET version = version + 1; END;
-		`
-
-		if _, err := tx.Exec(schema); err != nil {
-			return fmt.Errorf("failed to create schema: %w", err)
-		}
-
-		// Migrations
-		_, _ = tx.Exec("ALTER TABLE replicas ADD COLUMN last_seen_at INTEGER DEFAULT 0")
-		_, _ = tx.Exec("ALTER TABLE replicas ADD COLUMN owner TEXT DEFAULT ''")
-
-		// Rebuild folders_au trigger to add WHEN clause (idempotent: drop then create)
-		_, _ = tx.Exec("DROP TRIGGER IF EXISTS folders_au")
-		_, _ = tx.Exec(`CREATE TRIGGER IF NOT EXISTS folders_au AFTER UPDATE ON folders
-		WHEN OLD.name IS NOT NEW.name OR OLD.path IS NOT NEW.path OR OLD.provider IS NOT NEW.provider OR OLD.parent_folder_id IS NOT NEW.parent_folder_id OR OLD.owner_email IS NOT NEW.owner_email
-		BEGIN UPDATE _db_version SET version = version + 1; END`)
-
-		// Rebuild files_au trigger to add WHEN clause (idempotent: drop then create)
-		_, _ = tx.Exec("DROP TRIGGER IF EXISTS files_au")
-		_, _ = tx.Exec(`CREATE TRIGGER IF NOT EXISTS files_au AFTER UPDATE ON files
-		WHEN OLD.path IS NOT NEW.path OR OLD.name IS NOT NEW.name OR OLD.size IS NOT NEW.size OR OLD.google_drive_md5 IS NOT NEW.google_drive_md5 OR OLD.mod_time IS NOT NEW.mod_time OR OLD.status IS NOT NEW.status
-		BEGIN UPDATE _db_version SET version = version + 1; END`)
-
-		return nil
-	})
-}
-
 // InsertFile inserts a file record into the database
 func normalizeReplicaOwner(replica *model.Replica) string {
 	if replica == nil {
@@ -607,8 +431,8 @@ func (db *DB) InsertFile(file *model.File) error {
 		if len(file.Replicas) > 0 {
 			replicaQuery := `
 			INSERT OR REPLACE INTO replicas (
-				file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, owner
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, encrypted, ciphertext_sha256, owner
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 			`
 			replicaStmt, err := db.txStmt(tx, replicaQuery)
 			if err != nil {
@@ -621,7 +445,7 @@ func (db *DB) InsertFile(file *model.File) error {
 				if _, err := replicaStmt.Exec(
 					file.ID, replica.Path, replica.Name, replica.Size,
 					string(replica.Provider), replica.AccountID, replica.NativeID, replica.NativeHash,
-					replica.ModTime.Unix(), replica.Status, replica.Fragmented, replica.Owner); err != nil {
+					replica.ModTime.Unix(), replica.Status, replica.Fragmented, replica.Encrypted, replica.CiphertextSHA256, replica.Owner); err != nil {
 					return fmt.Errorf("failed to insert replica: %w", err)
 				}
 			}
@@ -812,8 +636,8 @@ func (db *DB) InsertReplica(replica *model.Replica) error {
 	return db.WithTx(func(tx *sql.Tx) error {
 		query := `
 		INSERT INTO replicas (
-			file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, owner
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, encrypted, ciphertext_sha256, owner
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		`
 		stmt, err := db.txStmt(tx, query)
 		if err != nil {
@@ -824,7 +648,7 @@ func (db *DB) InsertReplica(replica *model.Replica) error {
 		res, err := stmt.Exec(
 			replica.FileID, replica.Path, replica.Name, replica.Size,
 			string(replica.Provider), replica.AccountID, replica.NativeID, replica.NativeHash,
-			replica.ModTime.Unix(), replica.Status, replica.Fragmented, replica.Owner)
+			replica.ModTime.Unix(), replica.Status, replica.Fragmented, replica.Encrypted, replica.CiphertextSHA256, replica.Owner)
 		if err != nil {
 			return fmt.Errorf("failed to insert replica: %w", err)
 		}
@@ -866,70 +690,93 @@ func (db *DB) InsertReplica(replica *model.Replica) error {
 
 // UpsertReplicaByNativeID inserts or updates a replica keyed by provider/account/native_id.
 func (db *DB) UpsertReplicaByNativeID(replica *model.Replica, lastSeenAt int64) error {
-	replica.Owner = normalizeReplicaOwner(replica)
 	return db.WithTx(func(tx *sql.Tx) error {
-		query := `
-		INSERT INTO replicas (
-			file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, owner, last_seen_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(provider, account_id, native_id) DO UPDATE SET
-			file_id=CASE WHEN excluded.file_id != '' THEN excluded.file_id ELSE replicas.file_id END,
-			path=excluded.path,
-			name=excluded.name,
-			size=excluded.size,
-			native_hash=excluded.native_hash,
-			mod_time=excluded.mod_time,
-			status=excluded.status,
-			fragmented=excluded.fragmented,
-			owner=excluded.owner,
-			last_seen_at=excluded.last_seen_at
-		`
-		stmt, err := db.txStmt(tx, query)
+		return db.upsertReplicaByNativeIDTx(tx, replica, lastSeenAt)
+	})
+}
+
+// ReplacePlaceholderReplica records the native shortcut that replaced a Microsoft placeholder and
+// marks the placeholder deleted in one transaction, so the file is never left without a replica
+// in the account or with both.
+func (db *DB) ReplacePlaceholderReplica(placeholder, shortcut *model.Replica, lastSeenAt int64) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		stmt, err := db.txStmt(tx, `UPDATE replicas SET status = 'deleted', mod_time = ? WHERE id = ?`)
 		if err != nil {
-			return fmt.Errorf("failed to prepare upsert statement: %w", err)
+			return fmt.Errorf("failed to prepare statement: %w", err)
 		}
 		defer stmt.Close()
-
-		if _, err := stmt.Exec(
-			replica.FileID, replica.Path, replica.Name, replica.Size,
-			string(replica.Provider), replica.AccountID, replica.NativeID, replica.NativeHash,
-			replica.ModTime.Unix(), replica.Status, replica.Fragmented, replica.Owner, lastSeenAt,
-		); err != nil {
-			return fmt.Errorf("failed to upsert replica by native id: %w", err)
+		if _, err := stmt.Exec(time.Now().Unix(), placeholder.ID); err != nil {
+			return fmt.Errorf("failed to retire placeholder replica: %w", err)
 		}
+		return db.upsertReplicaByNativeIDTx(tx, shortcut, lastSeenAt)
+	})
+}
 
-		idStmt, err := db.txStmt(tx, `SELECT id FROM replicas WHERE provider = ? AND account_id = ? AND native_id = ?`)
+func (db *DB) upsertReplicaByNativeIDTx(tx *sql.Tx, replica *model.Replica, lastSeenAt int64) error {
+	replica.Owner = normalizeReplicaOwner(replica)
+	query := `
+	INSERT INTO replicas (
+		file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, encrypted, ciphertext_sha256, owner, last_seen_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(provider, account_id, native_id) DO UPDATE SET
+		file_id=CASE WHEN excluded.file_id != '' THEN excluded.file_id ELSE replicas.file_id END,
+		path=excluded.path,
+		name=excluded.name,
+		size=excluded.size,
+		native_hash=excluded.native_hash,
+		mod_time=excluded.mod_time,
+		status=excluded.status,
+		fragmented=excluded.fragmented,
+		encrypted=CASE WHEN excluded.encrypted THEN 1 ELSE replicas.encrypted END,
+		ciphertext_sha256=CASE WHEN excluded.ciphertext_sha256 != '' THEN excluded.ciphertext_sha256 ELSE replicas.ciphertext_sha256 END,
+		owner=excluded.owner,
+		last_seen_at=excluded.last_seen_at
+	`
+	stmt, err := db.txStmt(tx, query)
+	if err != nil {
+		return fmt.Errorf("failed to prepare upsert statement: %w", err)
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(
+		replica.FileID, replica.Path, replica.Name, replica.Size,
+		string(replica.Provider), replica.AccountID, replica.NativeID, replica.NativeHash,
+		replica.ModTime.Unix(), replica.Status, replica.Fragmented, replica.Encrypted, replica.CiphertextSHA256, replica.Owner, lastSeenAt,
+	); err != nil {
+		return fmt.Errorf("failed to upsert replica by native id: %w", err)
+	}
+
+	idStmt, err := db.txStmt(tx, `SELECT id FROM replicas WHERE provider = ? AND account_id = ? AND native_id = ?`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare replica id lookup: %w", err)
+	}
+	defer idStmt.Close()
+	if err := idStmt.QueryRow(string(replica.Provider), replica.AccountID, replica.NativeID).Scan(&replica.ID); err != nil {
+		return fmt.Errorf("failed to load upserted replica id: %w", err)
+	}
+
+	if replica.Provider == model.ProviderMicrosoft && replica.Status == "active" && replica.NativeHash == model.NativeHashShortcut && replica.FileID != "" {
+		cleanupStmt, err := db.txStmt(tx, `
+			UPDATE replicas
+			SET status = 'deleted'
+			WHERE provider = ?
+			  AND account_id = ?
+			  AND file_id = ?
+			  AND native_hash = ?
+			  AND status = 'active'
+			  AND native_id != ?
+			  AND size = 0
+			  AND path != ?
+		`)
 		if err != nil {
-			return fmt.Errorf("failed to prepare replica id lookup: %w", err)
+			return fmt.Errorf("failed to prepare microsoft shortcut cleanup statement: %w", err)
 		}
-		defer idStmt.Close()
-		if err := idStmt.QueryRow(string(replica.Provider), replica.AccountID, replica.NativeID).Scan(&replica.ID); err != nil {
-			return fmt.Errorf("failed to load upserted replica id: %w", err)
-		}
-
-		if replica.Provider == model.ProviderMicrosoft && replica.Status == "active" && replica.NativeHash == model.NativeHashShortcut && replica.FileID != "" {
-			cleanupStmt, err := db.txStmt(tx, `
-				UPDATE replicas
-				SET status = 'deleted'
-				WHERE provider = ?
-				  AND account_id = ?
-				  AND file_id = ?
-				  AND native_hash = ?
-				  AND status = 'active'
-				  AND native_id != ?
-				  AND size = 0
-				  AND path != ?
-			`)
-			if err != nil {
-				return fmt.Errorf("failed to prepare microsoft shortcut cleanup statement: %w", err)
-			}
-			defer cleanupStmt.Close()
-			if _, err := cleanupStmt.Exec(string(replica.Provider), replica.AccountID, replica.FileID, model.NativeHashShortcut, replica.NativeID, replica.Path); err != nil {
-				return fmt.Errorf("failed to cleanup stale microsoft shortcut replicas: %w", err)
-			}
+		defer cleanupStmt.Close()
+		if _, err := cleanupStmt.Exec(string(replica.Provider), replica.AccountID, replica.FileID, model.NativeHashShortcut, replica.NativeID, replica.Path); err != nil {
+			return fmt.Errorf("failed to cleanup stale microsoft shortcut replicas: %w", err)
 		}
-		return nil
-	})
+	}
+	return nil
 }
 
 // UpsertReplica inserts or updates a replica record
@@ -938,8 +785,8 @@ func (db *DB) UpsertReplica(replica *model.Replica) error {
 	return db.WithTx(func(tx *sql.Tx) error {
 		query := `
 		INSERT OR REPLACE INTO replicas (
-			id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, owner
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, encrypted, ciphertext_sha256, owner
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		`
 		stmt, err := db.txStmt(tx, query)
 		if err != nil {
@@ -950,7 +797,7 @@ func (db *DB) UpsertReplica(replica *model.Replica) error {
 		_, err = stmt.Exec(
 			replica.ID, replica.FileID, replica.Path, replica.Name, replica.Size,
 			string(replica.Provider), replica.AccountID, replica.NativeID, replica.NativeHash,
-			replica.ModTime.Unix(), replica.Status, replica.Fragmented, replica.Owner)
+			replica.ModTime.Unix(), replica.Status, replica.Fragmented, replica.Encrypted, replica.CiphertextSHA256, replica.Owner)
 		if err != nil {
 			return fmt.Errorf("failed to upsert replica: %w", err)
 		}
@@ -987,132 +834,6 @@ func (db *DB) InsertReplicaFragment(fragment *model.ReplicaFragment) error {
 	})
 }
 
-// InsertFolder inserts a folder record into the database
-func (db *DB) InsertFolder(folder *model.Folder) error {
-	return db.WithTx(func(tx *sql.Tx) error {
-		query := `
-		INSERT INTO folders (
-			id, name, path, provider, user_email, user_phone, parent_folder_id, owner_email
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(id) DO UPDATE SET
-			name=excluded.name,
-			path=excluded.path,
-			provider=excluded.provider,
-			user_email=excluded.user_email,
-			user_phone=excluded.user_phone,
-			parent_folder_id=excluded.parent_folder_id,
-			owner_email=excluded.owner_email
-		WHERE folders.name != excluded.name
-		   OR folders.path != excluded.path
-		   OR folders.provider != excluded.provider
-		   OR COALESCE(folders.user_email, '') != COALESCE(excluded.user_email, '')
-		   OR COALESCE(folders.user_phone, '') != COALESCE(excluded.user_phone, '')
-		   OR COALESCE(folders.parent_folder_id, '') != COALESCE(excluded.parent_folder_id, '')
-		   OR COALESCE(folders.owner_email, '') != COALESCE(excluded.owner_email, '')
-		`
-
-		stmt, err := db.txStmt(tx, query)
-		if err != nil {
-			return fmt.Errorf("failed to prepare folder statement: %w", err)
-		}
-		defer stmt.Close()
-
-		_, err = stmt.Exec(
-			folder.ID, folder.Name, folder.Path, string(folder.Provider),
-			folder.UserEmail, folder.UserPhone, folder.ParentFolderID, folder.OwnerEmail,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to insert folder: %w", err)
-		}
-		return nil
-	})
-}
-
-// BatchInsertFolders inserts multiple folders in a single transaction
-func (db *DB) BatchInsertFolders(folders []*model.Folder) error {
-	return db.WithTx(func(tx *sql.Tx) error {
-		stmt, err := db.txStmt(tx, `
-		INSERT INTO folders (
-			id, name, path, provider, user_email, user_phone, parent_folder_id, owner_email
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(id) DO UPDATE SET
-			name=excluded.name,
-			path=excluded.path,
-			provider=excluded.provider,
-			user_email=excluded.user_email,
-			user_phone=excluded.user_phone,
-			parent_folder_id=excluded.parent_folder_id,
-			owner_email=excluded.owner_email
-		WHERE folders.name != excluded.name
-		   OR folders.path != excluded.path
-		   OR folders.provider != excluded.provider
-		   OR COALESCE(folders.user_email, '') != COALESCE(excluded.user_email, '')
-		   OR COALESCE(folders.user_phone, '') != COALESCE(excluded.user_phone, '')
-		   OR COALESCE(folders.parent_folder_id, '') != COALESCE(excluded.parent_folder_id, '')
-		   OR COALESCE(folders.owner_email, '') != COALESCE(excluded.owner_email, '')
-		`)
-		if err != nil {
-			return err
-		}
-		defer stmt.Close()
-
-		for _, folder := range folders {
-			_, err := stmt.Exec(
-				folder.ID, folder.Name, folder.Path, string(folder.Provider),
-				folder.UserEmail, folder.UserPhone, folder.ParentFolderID, folder.OwnerEmail,
-			)
-			if err != nil {
-				return err
-			}
-		}
-
-		return nil
-	})
-}
-
-// GetAllFolders returns all folders from DB
-func (db *DB) GetAllFolders() ([]*model.Folder, error) {
-	rows, err := db.query("SELECT id, name, path, provider, user_email, user_phone, parent_folder_id, owner_email FROM folders")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var folders []*model.Folder
-	for rows.Next() {
-		var f model.Folder
-		var provider string
-		if err := rows.Scan(&f.ID, &f.Name, &f.Path, &provider, &f.UserEmail, &f.UserPhone, &f.ParentFolderID, &f.OwnerEmail); err != nil {
-			return nil, err
-		}
-		f.Provider = model.Provider(provider)
-		folders = append(folders, &f)
-	}
-	return folders, nil
-}
-
-// GetFolderByPathAndAccount retrieves a folder by its path, provider, and account identifier
-func (db *DB) GetFolderByPathAndAccount(path string, provider model.Provider, accountID string) (*model.Folder, error) {
-	query := `
-	SELECT id, name, path, provider, user_email, user_phone, parent_folder_id, owner_email
-	FROM folders
-	WHERE path = ? AND provider = ? AND (user_email = ? OR user_phone = ?)
-	`
-	row := db.queryRow(query, path, string(provider), accountID, accountID)
-
-	var f model.Folder
-	var prov string
-	err := row.Scan(&f.ID, &f.Name, &f.Path, &prov, &f.UserEmail, &f.UserPhone, &f.ParentFolderID, &f.OwnerEmail)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil // not found
-		}
-		return nil, err
-	}
-	f.Provider = model.Provider(prov)
-	return &f, nil
-}
-
 // --- New-model folder tables (SPEC): logical_folders + folder_replicas ---
 // These are populated by the Phase 2 folder sync logic.
 
@@ -1166,16 +887,16 @@ func (db *DB) GetAllLogicalFolders() ([]*model.LogicalFolder, error) {
 	return folders, rows.Err()
 }
 
-// InsertFolderReplica inserts or updates a folder_replica record idempotently.
+// InsertFolderReplica inserts or updates a folder_replica record idempotently and marks it active.
 func (db *DB) InsertFolderReplica(r *model.FolderReplica) error {
 	return db.WithTx(func(tx *sql.Tx) error {
 		_, err := tx.Exec(
 			`INSERT INTO folder_replicas
-			 (logical_folder_id, provider, account_id, native_folder_id, owner, last_seen_at)
-			 VALUES (?, ?, ?, ?, ?, ?)
-			 ON CONFLICT(provider, account_id, native_folder_id) DO UPDATE SET
-				logical_folder_id=excluded.logical_folder_id,
+			 (logical_folder_id, provider, account_id, native_folder_id, owner, status, last_seen_at)
+			 VALUES (?, ?, ?, ?, ?, 'active', ?)
+			 ON CONFLICT(logical_folder_id, provider, account_id, native_folder_id) DO UPDATE SET
 				owner=excluded.owner,
+				status='active',
 				last_seen_at=excluded.last_seen_at`,
 			r.LogicalFolderID, string(r.Provider), r.AccountID, r.NativeFolderID, r.Owner, r.LastSeenAt)
 		if err != nil {
@@ -1188,7 +909,7 @@ func (db *DB) InsertFolderReplica(r *model.FolderReplica) error {
 // GetFolderReplicas returns all folder_replica records for a logical_folder.
 func (db *DB) GetFolderReplicas(logicalFolderID string) ([]*model.FolderReplica, error) {
 	rows, err := db.query(
-		`SELECT id, logical_folder_id, provider, account_id, native_folder_id, owner, last_seen_at
+		`SELECT id, logical_folder_id, provider, account_id, native_folder_id, owner, status, last_seen_at
 		 FROM folder_replicas WHERE logical_folder_id = ?`, logicalFolderID)
 	if err != nil {
 		return nil, err
@@ -1197,29 +918,53 @@ func (db *DB) GetFolderReplicas(logicalFolderID string) ([]*model.FolderReplica,
 
 	var replicas []*model.FolderReplica
 	for rows.Next() {
-		r := &model.FolderReplica{}
-		var prov string
-		var owner sql.NullString
-		if err := rows.Scan(&r.ID, &r.LogicalFolderID, &prov, &r.AccountID, &r.NativeFolderID, &owner, &r.LastSeenAt); err != nil {
+		r, err := scanFolderReplica(rows)
+		if err != nil {
 			return nil, err
 		}
-		r.Provider = model.Provider(prov)
-		if owner.Valid {
-			r.Owner = owner.String
-		}
 		replicas = append(replicas, r)
 	}
 	return replicas, rows.Err()
 }
 
+// GetFolderReplicaByPath returns the active folder_replica of the folder at path on one account,
+// or nil when the account holds no live copy of it.
+func (db *DB) GetFolderReplicaByPath(path string, provider model.Provider, accountID string) (*model.FolderReplica, error) {
+	row := db.queryRow(`
+		SELECT fr.id, fr.logical_folder_id, fr.provider, fr.account_id, fr.native_folder_id, fr.owner, fr.status, fr.last_seen_at
+		FROM folder_replicas fr
+		JOIN logical_folders lf ON lf.id = fr.logical_folder_id
+		WHERE lf.path = ? AND lf.status != 'deleted' AND fr.provider = ? AND fr.account_id = ? AND fr.status = 'active'
+		LIMIT 1`, path, string(provider), accountID)
+	r, err := scanFolderReplica(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+func scanFolderReplica(row interface{ Scan(...interface{}) error }) (*model.FolderReplica, error) {
+	r := &model.FolderReplica{}
+	var prov string
+	var owner sql.NullString
+	if err := row.Scan(&r.ID, &r.LogicalFolderID, &prov, &r.AccountID, &r.NativeFolderID, &owner, &r.Status, &r.LastSeenAt); err != nil {
+		return nil, err
+	}
+	r.Provider = model.Provider(prov)
+	if owner.Valid {
+		r.Owner = owner.String
+	}
+	return r, nil
+}
+
 // GetAllFolderReplicaViews returns cache-ready folder rows resolved from logical_folders joined with
-// folder_replicas. This is the runtime read path for folder convergence.
+// their active folder_replicas. This is the runtime read path for folder convergence.
 func (db *DB) GetAllFolderReplicaViews() ([]*model.Folder, error) {
 	rows, err := db.query(`
 		SELECT fr.native_folder_id, lf.name, lf.path, fr.provider, fr.account_id, lf.parent_logical_folder_id, fr.owner
 		FROM logical_folders lf
 		JOIN folder_replicas fr ON fr.logical_folder_id = lf.id
-		WHERE lf.status != 'deleted'
+		WHERE lf.status != 'deleted' AND fr.status = 'active'
 	`)
 	if err != nil {
 		return nil, err
@@ -1251,60 +996,247 @@ func (db *DB) GetAllFolderReplicaViews() ([]*model.Folder, error) {
 	return folders, rows.Err()
 }
 
-// SyncLogicalFoldersFromFolders projects discovered provider folders from the legacy folders table
-// into logical_folders and folder_replicas so empty-folder convergence can operate on them.
-func (db *DB) SyncLogicalFoldersFromFolders() error {
-	folders, err := db.GetAllFolders()
-	if err != nil {
-		return fmt.Errorf("failed to load folders for logical sync: %w", err)
+// resolveLogicalFolderID returns the ID of the logical_folder at path, preferring a live one, or
+// the ID a new logical_folder at that path gets. The root has no logical_folder.
+func resolveLogicalFolderID(tx *sql.Tx, path string) (string, error) {
+	if path == "" || path == "/" || path == "." {
+		return "", nil
 	}
+	var id string
+	err := tx.QueryRow(`
+		SELECT id FROM logical_folders WHERE path = ?
+		ORDER BY CASE status WHEN 'active' THEN 0 WHEN 'soft-deleted' THEN 1 ELSE 2 END, id
+		LIMIT 1`, path).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "lf:path:" + path, nil
+	}
+	return id, err
+}
+
+// UpsertFolder records one provider folder, see BatchUpsertFolders.
+func (db *DB) UpsertFolder(folder *model.Folder, seenAt int64) error {
+	return db.BatchUpsertFolders([]*model.Folder{folder}, seenAt)
+}
 
+// BatchUpsertFolders records provider folders as active folder_replicas of the logical_folder at
+// their path, creating logical_folders as needed. Folder status is settled separately by
+// UpdateLogicalFolderStatus once a scan completes.
+func (db *DB) BatchUpsertFolders(folders []*model.Folder, seenAt int64) error {
 	return db.WithTx(func(tx *sql.Tx) error {
+		lfStmt, err := db.txStmt(tx, `
+		INSERT INTO logical_folders (id, path, name, parent_logical_folder_id, status)
+		VALUES (?, ?, ?, ?, 'active')
+		ON CONFLICT(id) DO UPDATE SET
+			path=excluded.path,
+			name=excluded.name,
+			parent_logical_folder_id=excluded.parent_logical_folder_id
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare logical folder statement: %w", err)
+		}
+		defer lfStmt.Close()
+
+		frStmt, err := db.txStmt(tx, `
+		INSERT INTO folder_replicas
+		(logical_folder_id, provider, account_id, native_folder_id, owner, status, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, 'active', ?)
+		ON CONFLICT(logical_folder_id, provider, account_id, native_folder_id) DO UPDATE SET
+			owner=excluded.owner,
+			status='active',
+			last_seen_at=excluded.last_seen_at
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare folder replica statement: %w", err)
+		}
+		defer frStmt.Close()
+
 		for _, folder := range folders {
-			if folder == nil || folder.Path == "" || folder.Path == "/" {
+			if folder == nil || folder.ID == "" {
 				continue
 			}
-
-			logicalFolderID := "lf:path:" + folder.Path
-			parentPath := filepath.Dir(folder.Path)
-			parentLogicalFolderID := ""
-			if parentPath != "." && parentPath != "/" && parentPath != "" {
-				parentLogicalFolderID = "lf:path:" + strings.ReplaceAll(parentPath, "\\", "/")
+			path := model.NormalizePath(folder.Path)
+			logicalFolderID, err := resolveLogicalFolderID(tx, path)
+			if err != nil {
+				return fmt.Errorf("failed to resolve logical folder for %s: %w", path, err)
+			}
+			if logicalFolderID == "" {
+				continue
+			}
+			parentLogicalFolderID, err := resolveLogicalFolderID(tx, model.NormalizePath(filepath.Dir(path)))
+			if err != nil {
+				return fmt.Errorf("failed to resolve parent logical folder for %s: %w", path, err)
 			}
-
-			status := "active"
 			var parent interface{}
 			if parentLogicalFolderID != "" {
 				parent = parentLogicalFolderID
 			}
-			if _, err := tx.Exec(
-				`INSERT INTO logical_folders (id, path, name, parent_logical_folder_id, status)
-				 VALUES (?, ?, ?, ?, ?)
-				 ON CONFLICT(id) DO UPDATE SET
-					path=excluded.path,
-					name=excluded.name,
-					parent_logical_folder_id=excluded.parent_logical_folder_id,
-					status=excluded.status`,
-				logicalFolderID, folder.Path, folder.Name, parent, status,
-			); err != nil {
-				return fmt.Errorf("failed to upsert logical folder for %s: %w", folder.Path, err)
+			if _, err := lfStmt.Exec(logicalFolderID, path, folder.Name, parent); err != nil {
+				return fmt.Errorf("failed to upsert logical folder for %s: %w", path, err)
 			}
 
 			accountID := folder.UserEmail
 			if folder.Provider == model.ProviderTelegram {
 				accountID = folder.UserPhone
 			}
-			if _, err := tx.Exec(
-				`INSERT INTO folder_replicas
-				 (logical_folder_id, provider, account_id, native_folder_id, owner, last_seen_at)
-				 VALUES (?, ?, ?, ?, ?, ?)
-				 ON CONFLICT(provider, account_id, native_folder_id) DO UPDATE SET
-					logical_folder_id=excluded.logical_folder_id,
-					owner=excluded.owner,
-					last_seen_at=excluded.last_seen_at`,
-				logicalFolderID, string(folder.Provider), accountID, folder.ID, folder.OwnerEmail, time.Now().Unix(),
-			); err != nil {
-				return fmt.Errorf("failed to upsert folder replica for %s: %w", folder.Path, err)
+			if _, err := frStmt.Exec(logicalFolderID, string(folder.Provider), accountID, folder.ID, folder.OwnerEmail, seenAt); err != nil {
+				return fmt.Errorf("failed to upsert folder replica for %s: %w", path, err)
+			}
+		}
+		return nil
+	})
+}
+
+// MarkFolderReplicaDeleted marks every folder_replica of a native folder on one account deleted,
+// after the folder was removed from the provider.
+func (db *DB) MarkFolderReplicaDeleted(provider model.Provider, accountID, nativeFolderID string) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		UPDATE folder_replicas SET status = 'deleted'
+		WHERE provider = ? AND account_id = ? AND native_folder_id = ? AND status != 'deleted'`,
+			string(provider), accountID, nativeFolderID)
+		if err != nil {
+			return fmt.Errorf("failed to mark folder replica deleted: %w", err)
+		}
+		return nil
+	})
+}
+
+// MarkDeletedFolderReplicas marks folder replicas as deleted if they weren't seen since the given time
+func (db *DB) MarkDeletedFolderReplicas(startTime time.Time) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		UPDATE folder_replicas SET status = 'deleted'
+		WHERE last_seen_at < ? AND status != 'deleted'`, startTime.Unix())
+		if err != nil {
+			return fmt.Errorf("failed to mark deleted folder replicas: %w", err)
+		}
+		return nil
+	})
+}
+
+// UpdateLogicalFolderStatus settles the lifecycle of every logical_folder from its replicas the
+// same way UpdateSoftDeletedFileStatus does for files: an active Google replica keeps a folder
+// active; otherwise a folder whose copy was moved into the aux soft-deleted (or hard-deleted)
+// tree becomes soft-deleted (or deleted); a folder with any other active replica stays active;
+// and a folder with no active replica left is deleted. Folders inside the soft-deleted tree are
+// soft-deleted while any copy of them exists.
+func (db *DB) UpdateLogicalFolderStatus() error {
+	softDeletedPrefix := "/" + auxFolderName + "/soft-deleted/"
+	hardDeletedPrefix := "/" + auxFolderName + "/hard-deleted/"
+
+	type folderRow struct {
+		id, path, status string
+	}
+	type replicaRow struct {
+		logicalFolderID, provider, nativeID, status string
+	}
+
+	var folders []folderRow
+	rows, err := db.query(`SELECT id, path, status FROM logical_folders`)
+	if err != nil {
+		return fmt.Errorf("failed to load logical folders: %w", err)
+	}
+	for rows.Next() {
+		var f folderRow
+		if err := rows.Scan(&f.id, &f.path, &f.status); err != nil {
+			rows.Close()
+			return err
+		}
+		folders = append(folders, f)
+	}
+	rows.Close()
+
+	var replicas []replicaRow
+	rows, err = db.query(`SELECT logical_folder_id, provider, native_folder_id, status FROM folder_replicas`)
+	if err != nil {
+		return fmt.Errorf("failed to load folder replicas: %w", err)
+	}
+	for rows.Next() {
+		var r replicaRow
+		if err := rows.Scan(&r.logicalFolderID, &r.provider, &r.nativeID, &r.status); err != nil {
+			rows.Close()
+			return err
+		}
+		replicas = append(replicas, r)
+	}
+	rows.Close()
+
+	pathByID := make(map[string]string, len(folders))
+	for _, f := range folders {
+		pathByID[f.id] = f.path
+	}
+
+	// Where each native folder lives now, if it was moved into one of the deleted trees.
+	movedTo := make(map[string]string)
+	for _, r := range replicas {
+		if r.status != "active" {
+			continue
+		}
+		p := pathByID[r.logicalFolderID]
+		switch {
+		case strings.HasPrefix(p, softDeletedPrefix):
+			movedTo[r.provider+"\x00"+r.nativeID] = "soft-deleted"
+		case strings.HasPrefix(p, hardDeletedPrefix):
+			movedTo[r.provider+"\x00"+r.nativeID] = "deleted"
+		}
+	}
+
+	type agg struct {
+		activeGoogle, activeAny   int
+		googleMovedTo, anyMovedTo string
+	}
+	aggs := make(map[string]*agg, len(folders))
+	for _, r := range replicas {
+		a := aggs[r.logicalFolderID]
+		if a == nil {
+			a = &agg{}
+			aggs[r.logicalFolderID] = a
+		}
+		isGoogle := strings.EqualFold(r.provider, string(model.ProviderGoogle))
+		if r.status == "active" {
+			a.activeAny++
+			if isGoogle {
+				a.activeGoogle++
+			}
+			continue
+		}
+		if dest := movedTo[r.provider+"\x00"+r.nativeID]; dest != "" {
+			a.anyMovedTo = dest
+			if isGoogle {
+				a.googleMovedTo = dest
+			}
+		}
+	}
+
+	return db.WithTx(func(tx *sql.Tx) error {
+		stmt, err := db.txStmt(tx, `UPDATE logical_folders SET status = ? WHERE id = ? AND status != ?`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, f := range folders {
+			a := aggs[f.id]
+			if a == nil {
+				a = &agg{}
+			}
+			status := "deleted"
+			switch {
+			case strings.HasPrefix(f.path, softDeletedPrefix):
+				if a.activeAny > 0 {
+					status = "soft-deleted"
+				}
+			case a.activeGoogle > 0:
+				status = "active"
+			case a.googleMovedTo != "":
+				status = a.googleMovedTo
+			case a.activeAny > 0:
+				status = "active"
+			case a.anyMovedTo != "":
+				status = a.anyMovedTo
+			}
+			if _, err := stmt.Exec(status, f.id, status); err != nil {
+				return fmt.Errorf("failed to update logical folder status: %w", err)
 			}
 		}
 		return nil
@@ -1407,7 +1339,7 @@ func (db *DB) GetAllFiles() ([]*model.File, error) {
 // getAllReplicas loads all replicas from the database in one query
 func (db *DB) getAllReplicas() ([]*model.Replica, error) {
 	query := `
-	SELECT id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, owner
+	SELECT id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, encrypted, ciphertext_sha256, owner
 	FROM replicas
 	WHERE file_id IS NOT NULL
 	`
@@ -1424,7 +1356,7 @@ func (db *DB) getAllReplicas() ([]*model.Replica, error) {
 		var modTime int64
 		var owner sql.NullString
 		err := rows.Scan(&r.ID, &r.FileID, &r.Path, &r.Name, &r.Size,
-			&providerStr, &r.AccountID, &r.NativeID, &r.NativeHash, &modTime, &r.Status, &r.Fragmented, &owner)
+			&providerStr, &r.AccountID, &r.NativeID, &r.NativeHash, &modTime, &r.Status, &r.Fragmented, &r.Encrypted, &r.CiphertextSHA256, &owner)
 		if err != nil {
 			return nil, err
 		}
@@ -1552,7 +1484,7 @@ func (db *DB) GetActiveFilesByPathPrefix(prefix string) ([]*model.File, error) {
 		args[i] = f.ID
 	}
 	repQuery := `
-	SELECT id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, owner
+	SELECT id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, encrypted, ciphertext_sha256, owner
 	FROM replicas
 	WHERE file_id IN (` + strings.Join(placeholders, ",") + `)`
 
@@ -1567,7 +1499,7 @@ func (db *DB) GetActiveFilesByPathPrefix(prefix string) ([]*model.File, error) {
 		var rSize, rModTime int64
 		var rFragmented bool
 		var rOwner sql.NullString
-		if err := repRows.Scan(&r.ID, &rFileID, &rPath, &rName, &rSize, &rProvider, &rAccountID, &rNativeID, &rNativeHash, &rModTime, &rStatus, &rFragmented, &rOwner); err != nil {
+		if err := repRows.Scan(&r.ID, &rFileID, &rPath, &rName, &rSize, &rProvider, &rAccountID, &rNativeID, &rNativeHash, &rModTime, &rStatus, &rFragmented, &r.Encrypted, &r.CiphertextSHA256, &rOwner); err != nil {
 			return nil, err
 		}
 		r.FileID = rFileID
@@ -1630,7 +1562,7 @@ func (db *DB) GetFilesByStatus(status string) ([]*model.File, error) {
 	var allReplicas []*model.Replica
 
 	queryReplicas := `
-	SELECT r.id, r.file_id, r.path, r.name, r.size, r.provider, r.account_id, r.native_id, r.native_hash, r.mod_time, r.status, r.fragmented, r.owner
+	SELECT r.id, r.file_id, r.path, r.name, r.size, r.provider, r.account_id, r.native_id, r.native_hash, r.mod_time, r.status, r.fragmented, r.encrypted, r.ciphertext_sha256, r.owner
 	FROM replicas r
 	JOIN files f ON r.file_id = f.id
 	WHERE f.status = ?
@@ -1648,7 +1580,7 @@ func (db *DB) GetFilesByStatus(status string) ([]*model.File, error) {
 		var rOwner sql.NullString
 
 		if err := repRows.Scan(
-			&r.ID, &rFileID, &rPath, &rName, &rSize, &rProvider, &rAccountID, &rNativeID, &rNativeHash, &rModTime, &rStatus, &rFragmented, &rOwner,
+			&r.ID, &rFileID, &rPath, &rName, &rSize, &rProvider, &rAccountID, &rNativeID, &rNativeHash, &rModTime, &rStatus, &rFragmented, &r.Encrypted, &r.CiphertextSHA256, &rOwner,
 		); err != nil {
 			repRows.Close()
 			return nil, err
@@ -1724,7 +1656,7 @@ func (db *DB) GetAllFilesAcrossProviders() ([]*model.File, error) {
 		fileMap[file.ID] = file
 		files = append(files, file)
 		if isCase25InnerPath(file.Path) {
-			logger.Info("DEBUG case25 load-file id=%s path=%s name=%s md5=%s status=%s", file.ID, file.Path, file.Name, file.GoogleDriveMD5, file.Status)
+			logger.Debug("case25 load-file id=%s path=%s name=%s md5=%s status=%s", file.ID, file.Path, file.Name, file.GoogleDriveMD5, file.Status)
 		}
 	}
 
@@ -1739,7 +1671,7 @@ func (db *DB) GetAllFilesAcrossProviders() ([]*model.File, error) {
 	var allReplicas []*model.Replica
 
 	queryReplicas := `
-	SELECT r.id, r.file_id, r.path, r.name, r.size, r.provider, r.account_id, r.native_id, r.native_hash, r.mod_time, r.status, r.fragmented, r.owner
+	SELECT r.id, r.file_id, r.path, r.name, r.size, r.provider, r.account_id, r.native_id, r.native_hash, r.mod_time, r.status, r.fragmented, r.encrypted, r.ciphertext_sha256, r.owner
 	FROM replicas r
 	JOIN files f ON r.file_id = f.id
 	WHERE f.status = 'active' AND r.status = 'active'
@@ -1757,7 +1689,7 @@ func (db *DB) GetAllFilesAcrossProviders() ([]*model.File, error) {
 		var rOwner sql.NullString
 
 		if err := repRows.Scan(
-			&r.ID, &rFileID, &rPath, &rName, &rSize, &rProvider, &rAccountID, &rNativeID, &rNativeHash, &rModTime, &rStatus, &rFragmented, &rOwner,
+			&r.ID, &rFileID, &rPath, &rName, &rSize, &rProvider, &rAccountID, &rNativeID, &rNativeHash, &rModTime, &rStatus, &rFragmented, &r.Encrypted, &r.CiphertextSHA256, &rOwner,
 		); err != nil {
 			repRows.Close()
 			return nil, err
@@ -1778,17 +1710,17 @@ func (db *DB) GetAllFilesAcrossProviders() ([]*model.File, error) {
 			r.Owner = rOwner.String
 		}
 		if isCase25InnerPath(r.Path) {
-			logger.Info("DEBUG case25 load-replica id=%d file_id=%s provider=%s account=%s native_id=%s path=%s hash=%s status=%s", r.ID, r.FileID, r.Provider, r.AccountID, r.NativeID, r.Path, r.NativeHash, r.Status)
+			logger.Debug("case25 load-replica id=%d file_id=%s provider=%s account=%s native_id=%s path=%s hash=%s status=%s", r.ID, r.FileID, r.Provider, r.AccountID, r.NativeID, r.Path, r.NativeHash, r.Status)
 		}
 
 		if file, ok := fileMap[r.FileID]; ok {
 			file.Replicas = append(file.Replicas, r)
 			allReplicas = append(allReplicas, r)
 			if isCase25InnerPath(r.Path) {
-				logger.Info("DEBUG case25 attach-replica file_id=%s file_path=%s provider=%s replica_id=%d", file.ID, file.Path, r.Provider, r.ID)
+				logger.Debug("case25 attach-replica file_id=%s file_path=%s provider=%s replica_id=%d", file.ID, file.Path, r.Provider, r.ID)
 			}
 		} else if isCase25InnerPath(r.Path) {
-			logger.Info("DEBUG case25 missing-file-for-replica file_id=%s provider=%s replica_id=%d path=%s", r.FileID, r.Provider, r.ID, r.Path)
+			logger.Debug("case25 missing-file-for-replica file_id=%s provider=%s replica_id=%d path=%s", r.FileID, r.Provider, r.ID, r.Path)
 		}
 	}
 
@@ -1815,12 +1747,12 @@ func (db *DB) GetAllFilesAcrossProviders() ([]*model.File, error) {
 		if !isCase25InnerPath(file.Path) {
 			continue
 		}
-		logger.Info("DEBUG case25 final-file id=%s path=%s replicas=%d md5=%s", file.ID, file.Path, len(file.Replicas), file.GoogleDriveMD5)
+		logger.Debug("case25 final-file id=%s path=%s replicas=%d md5=%s", file.ID, file.Path, len(file.Replicas), file.GoogleDriveMD5)
 		for _, replica := range file.Replicas {
 			if replica == nil {
 				continue
 			}
-			logger.Info("DEBUG case25 final-file-replica file_id=%s replica_id=%d provider=%s account=%s native_id=%s path=%s status=%s", file.ID, replica.ID, replica.Provider, replica.AccountID, replica.NativeID, replica.Path, replica.Status)
+			logger.Debug("case25 final-file-replica file_id=%s replica_id=%d provider=%s account=%s native_id=%s path=%s status=%s", file.ID, replica.ID, replica.Provider, replica.AccountID, replica.NativeID, replica.Path, replica.Status)
 		}
 	}
 
@@ -1830,7 +1762,7 @@ func (db *DB) GetAllFilesAcrossProviders() ([]*model.File, error) {
 // GetReplicas returns all replicas for a file
 func (db *DB) GetReplicas(fileID string) ([]*model.Replica, error) {
 	query := `
-	SELECT id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, owner
+	SELECT id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, encrypted, ciphertext_sha256, owner, last_seen_at
 	FROM replicas
 	WHERE file_id = ?
 	`
@@ -1847,7 +1779,7 @@ func (db *DB) GetReplicas(fileID string) ([]*model.Replica, error) {
 		var modTime int64
 		var owner sql.NullString
 		err := rows.Scan(&r.ID, &r.FileID, &r.Path, &r.Name, &r.Size,
-			&providerStr, &r.AccountID, &r.NativeID, &r.NativeHash, &modTime, &r.Status, &r.Fragmented, &owner)
+			&providerStr, &r.AccountID, &r.NativeID, &r.NativeHash, &modTime, &r.Status, &r.Fragmented, &r.Encrypted, &r.CiphertextSHA256, &owner, &r.LastSeenAt)
 		if err != nil {
 			return nil, err
 		}
@@ -1904,7 +1836,7 @@ func (db *DB) GetReplicaFragments(replicaID int64) ([]*model.ReplicaFragment, er
 // GetReplicasByAccount returns all replicas for a specific account
 func (db *DB) GetReplicasByAccount(provider model.Provider, accountID string) ([]*model.Replica, error) {
 	query := `
-	SELECT id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, owner
+	SELECT id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, encrypted, ciphertext_sha256, owner
 	FROM replicas
 	WHERE provider = ? AND account_id = ?
 	`
@@ -1921,7 +1853,7 @@ func (db *DB) GetReplicasByAccount(provider model.Provider, accountID string) ([
 		var modTime int64
 		var owner sql.NullString
 		err := rows.Scan(&r.ID, &r.FileID, &r.Path, &r.Name, &r.Size,
-			&providerStr, &r.AccountID, &r.NativeID, &r.NativeHash, &modTime, &r.Status, &r.Fragmented, &owner)
+			&providerStr, &r.AccountID, &r.NativeID, &r.NativeHash, &modTime, &r.Status, &r.Fragmented, &r.Encrypted, &r.CiphertextSHA256, &owner)
 		if err != nil {
 			return nil, err
 		}
@@ -1939,7 +1871,7 @@ func (db *DB) GetReplicasByAccount(provider model.Provider, accountID string) ([
 // preferring active rows when historical deleted rows share the same native ID.
 func (db *DB) GetReplicaByNativeID(provider model.Provider, nativeID string) (*model.Replica, error) {
 	query := `
-	SELECT id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, owner
+	SELECT id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, encrypted, ciphertext_sha256, owner
 	FROM replicas
 	WHERE provider = ? AND native_id = ?
 	ORDER BY CASE status
@@ -1962,7 +1894,7 @@ func (db *DB) GetReplicaByNativeID(provider model.Provider, nativeID string) (*m
 	var owner sql.NullString
 	err := db.queryRow(query, string(provider), nativeID).Scan(
 		&r.ID, &r.FileID, &r.Path, &r.Name, &r.Size,
-		&providerStr, &r.AccountID, &r.NativeID, &r.NativeHash, &modTime, &r.Status, &r.Fragmented, &owner,
+		&providerStr, &r.AccountID, &r.NativeID, &r.NativeHash, &modTime, &r.Status, &r.Fragmented, &r.Encrypted, &r.CiphertextSHA256, &owner,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -1994,7 +1926,7 @@ func (db *DB) HasActiveReplicaByNativeID(provider model.Provider, nativeID strin
 func (db *DB) GetReplicaByNativeFragmentID(nativeFragmentID string) (*model.Replica, error) {
 	// Join with fragments
 	query := `
-	SELECT r.id, r.file_id, r.path, r.name, r.size, r.provider, r.account_id, r.native_id, r.native_hash, r.mod_time, r.status, r.fragmented, r.owner
+	SELECT r.id, r.file_id, r.path, r.name, r.size, r.provider, r.account_id, r.native_id, r.native_hash, r.mod_time, r.status, r.fragmented, r.encrypted, r.ciphertext_sha256, r.owner
 	FROM replicas r
 	JOIN replica_fragments f ON r.id = f.replica_id
 	WHERE f.native_fragment_id = ?
@@ -2005,7 +1937,7 @@ func (db *DB) GetReplicaByNativeFragmentID(nativeFragmentID string) (*model.Repl
 	var owner sql.NullString
 	err := db.queryRow(query, nativeFragmentID).Scan(
 		&r.ID, &r.FileID, &r.Path, &r.Name, &r.Size,
-		&providerStr, &r.AccountID, &r.NativeID, &r.NativeHash, &modTime, &r.Status, &r.Fragmented, &owner,
+		&providerStr, &r.AccountID, &r.NativeID, &r.NativeHash, &modTime, &r.Status, &r.Fragmented, &r.Encrypted, &r.CiphertextSHA256, &owner,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -2038,23 +1970,6 @@ func (db *DB) DeleteFile(id string) error {
 	})
 }
 
-// DeleteFolder deletes a folder from the database
-func (db *DB) DeleteFolder(id string) error {
-	return db.WithTx(func(tx *sql.Tx) error {
-		query := "DELETE FROM folders WHERE id = ?"
-		stmt, err := db.txStmt(tx, query)
-		if err != nil {
-			return fmt.Errorf("failed to prepare delete statement: %w", err)
-		}
-		defer stmt.Close()
-		_, err = stmt.Exec(id)
-		if err != nil {
-			return fmt.Errorf("failed to delete folder: %w", err)
-		}
-		return nil
-	})
-}
-
 // ClearProvider is removed/refactored.
 // If valid use case warrants clearing a provider:
 // we would delete replicas for that provider.
@@ -2341,7 +2256,7 @@ func (db *DB) UpdateReplica(replica *model.Replica) error {
 		UPDATE replicas SET
 			file_id = ?, path = ?, name = ?, size = ?,
 			provider = ?, account_id = ?, native_id = ?, native_hash = ?,
-			mod_time = ?, status = ?, fragmented = ?, owner = ?
+			mod_time = ?, status = ?, fragmented = ?, encrypted = ?, ciphertext_sha256 = ?, owner = ?
 		WHERE id = ?
 		`
 		stmt, err := db.txStmt(tx, query)
@@ -2352,12 +2267,12 @@ func (db *DB) UpdateReplica(replica *model.Replica) error {
 		_, err = stmt.Exec(
 			replica.FileID, replica.Path, replica.Name, replica.Size,
 			string(replica.Provider), replica.AccountID, replica.NativeID, replica.NativeHash,
-			replica.ModTime.Unix(), replica.Status, replica.Fragmented, replica.Owner, replica.ID)
+			replica.ModTime.Unix(), replica.Status, replica.Fragmented, replica.Encrypted, replica.CiphertextSHA256, replica.Owner, replica.ID)
 		if err != nil {
 			return fmt.Errorf("failed to update replica: %w", err)
 		}
 		if strings.Contains(replica.Path, "/test-case-id-25-inner/") && replica.Provider == model.ProviderGoogle {
-			logger.Info("DEBUG case25 update-replica id=%d file_id=%s account=%s native_id=%s path=%s hash=%s status=%s", replica.ID, replica.FileID, replica.AccountID, replica.NativeID, replica.Path, replica.NativeHash, replica.Status)
+			logger.Debug("case25 update-replica id=%d file_id=%s account=%s native_id=%s path=%s hash=%s status=%s", replica.ID, replica.FileID, replica.AccountID, replica.NativeID, replica.Path, replica.NativeHash, replica.Status)
 		}
 		return nil
 	})
@@ -2373,7 +2288,7 @@ func (db *DB) ReassignReplicaToFile(replicaID int64, fileID string) error {
 		if _, err := stmt.Exec(fileID, replicaID); err != nil {
 			return fmt.Errorf("failed to reassign replica: %w", err)
 		}
-		logger.Info("DEBUG case25 reassign-replica id=%d file_id=%s", replicaID, fileID)
+		logger.Debug("case25 reassign-replica id=%d file_id=%s", replicaID, fileID)
 		return nil
 	})
 }
@@ -2432,7 +2347,7 @@ func (db *DB) UpdateReplicaFileID(replicaID int64, fileID string) error {
 // GetReplicasWithNullFileID returns all replicas without a file_id
 func (db *DB) GetReplicasWithNullFileID() ([]*model.Replica, error) {
 	query := `
-	SELECT id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, owner
+	SELECT id, file_id, path, name, size, provider, account_id, native_id, native_hash, mod_time, status, fragmented, encrypted, ciphertext_sha256, owner
 	FROM replicas
 	WHERE file_id IS NULL
 	`
@@ -2450,7 +2365,7 @@ func (db *DB) GetReplicasWithNullFileID() ([]*model.Replica, error) {
 		var fileID sql.NullString
 		var owner sql.NullString
 		err := rows.Scan(&r.ID, &fileID, &r.Path, &r.Name, &r.Size,
-			&providerStr, &r.AccountID, &r.NativeID, &r.NativeHash, &modTime, &r.Status, &r.Fragmented, &owner)
+			&providerStr, &r.AccountID, &r.NativeID, &r.NativeHash, &modTime, &r.Status, &r.Fragmented, &r.Encrypted, &r.CiphertextSHA256, &owner)
 		if err != nil {
 			return nil, err
 		}
@@ -2590,12 +2505,13 @@ func (db *DB) PromoteOrphanedReplicasToFiles() error {
 // UpdateLogicalFilesFromReplicas refreshes logical file metadata from active replicas while keeping Google
 // Drive authoritative for canonical path/name and Google MD5. Placeholder replicas are ranked last so
 // zero-byte accounting entries cannot overwrite canonical logical metadata when a real replica exists.
+// Encrypted replicas never set the size, since they store the larger ciphertext.
 func (db *DB) UpdateLogicalFilesFromReplicas() error {
 	return db.WithTx(func(tx *sql.Tx) error {
 		query := `
 		WITH RankedReplicas AS (
 			SELECT r.file_id,
-				r.size,
+				CASE WHEN r.encrypted THEN NULL ELSE r.size END AS size,
 				r.mod_time,
 				r.name,
 				r.path,
@@ -2625,7 +2541,7 @@ func (db *DB) UpdateLogicalFilesFromReplicas() error {
 		)
 		UPDATE files
 		SET
-			size = cr.size,
+			size = COALESCE(cr.size, files.size),
 			mod_time = cr.mod_time,
 			name = cr.name,
 			path = cr.path,
@@ -2633,7 +2549,7 @@ func (db *DB) UpdateLogicalFilesFromReplicas() error {
 		FROM CanonicalReplicas cr
 		WHERE files.id = cr.file_id
 		AND (
-			files.size IS NOT cr.size OR
+			files.size IS NOT COALESCE(cr.size, files.size) OR
 			files.mod_time IS NOT cr.mod_time OR
 			files.name IS NOT cr.name OR
 			files.path IS NOT cr.path OR
@@ -2715,12 +2631,12 @@ func (db *DB) CreateSyncRun(safeMode bool) (int64, error) {
 // GetIncompleteSyncRun returns the most recent sync run that has not completed and was started within the last 24 hours, or nil
 func (db *DB) GetIncompleteSyncRun() (*model.SyncRun, error) {
 	twentyFourHoursAgo := time.Now().Add(-24 * time.Hour).Unix()
-	query := `SELECT id, started_at, last_completed_step, safe_mode FROM sync_runs WHERE completed_at IS NULL AND started_at > ? ORDER BY id DESC LIMIT 1`
+	query := `SELECT id, started_at, last_completed_step, safe_mode, log_file FROM sync_runs WHERE completed_at IS NULL AND started_at > ? ORDER BY id DESC LIMIT 1`
 	row := db.queryRow(query, twentyFourHoursAgo)
 
 	var run model.SyncRun
 	var startedAt int64
-	err := row.Scan(&run.ID, &startedAt, &run.LastCompletedStep, &run.SafeMode)
+	err := row.Scan(&run.ID, &startedAt, &run.LastCompletedStep, &run.SafeMode, &run.LogFile)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -2731,6 +2647,115 @@ func (db *DB) GetIncompleteSyncRun() (*model.SyncRun, error) {
 	return &run, nil
 }
 
+// ListSyncRuns returns the most recent sync runs, newest first. A negative limit returns all of them
+func (db *DB) ListSyncRuns(limit int) ([]*model.SyncRun, error) {
+	query := `SELECT id, started_at, completed_at, last_completed_step, safe_mode, log_file,
+		server_copies, server_copy_bytes, server_copy_ms, streamed_copies, streamed_bytes, streamed_ms
+		FROM sync_runs ORDER BY id DESC LIMIT ?`
+	rows, err := db.query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sync runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*model.SyncRun
+	for rows.Next() {
+		var run model.SyncRun
+		var startedAt int64
+		var completedAt sql.NullInt64
+		if err := rows.Scan(&run.ID, &startedAt, &completedAt, &run.LastCompletedStep, &run.SafeMode, &run.LogFile,
+			&run.ServerCopies, &run.ServerCopyBytes, &run.ServerCopyMillis, &run.StreamedCopies, &run.StreamedBytes, &run.StreamedMillis); err != nil {
+			return nil, fmt.Errorf("failed to scan sync run: %w", err)
+		}
+		run.StartedAt = time.Unix(startedAt, 0)
+		if completedAt.Valid {
+			t := time.Unix(completedAt.Int64, 0)
+			run.CompletedAt = &t
+		}
+		runs = append(runs, &run)
+	}
+	return runs, rows.Err()
+}
+
+// GetLastSuccessfulSyncTime returns when the most recent non-dry-run sync completed, or the zero
+// time if none has
+func (db *DB) GetLastSuccessfulSyncTime() (time.Time, error) {
+	query := `SELECT MAX(completed_at) FROM sync_runs WHERE completed_at IS NOT NULL AND safe_mode = 0`
+	var completedAt sql.NullInt64
+	if err := db.queryRow(query).Scan(&completedAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get last successful sync: %w", err)
+	}
+	if !completedAt.Valid {
+		return time.Time{}, nil
+	}
+	return time.Unix(completedAt.Int64, 0), nil
+}
+
+// CountFilesByStatus returns the number of logical files per status
+func (db *DB) CountFilesByStatus() (map[string]int64, error) {
+	rows, err := db.query(`SELECT status, COUNT(*) FROM files GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count files: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var status string
+		var n int64
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan file count: %w", err)
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// SetSyncRunLogFile records where the log of a sync run is written
+func (db *DB) SetSyncRunLogFile(runID int64, path string) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		stmt, err := db.txStmt(tx, `UPDATE sync_runs SET log_file = ? WHERE id = ?`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+		if _, err := stmt.Exec(path, runID); err != nil {
+			return fmt.Errorf("failed to set sync run log file: %w", err)
+		}
+		return nil
+	})
+}
+
+// AddSyncRunCopy counts one file copy of a sync run, server-side or streamed through this host
+func (db *DB) AddSyncRunCopy(runID int64, serverSide bool, size int64, elapsed time.Duration) error {
+	query := `UPDATE sync_runs SET streamed_copies = streamed_copies + 1, streamed_bytes = streamed_bytes + ?, streamed_ms = streamed_ms + ? WHERE id = ?`
+	if serverSide {
+		query = `UPDATE sync_runs SET server_copies = server_copies + 1, server_copy_bytes = server_copy_bytes + ?, server_copy_ms = server_copy_ms + ? WHERE id = ?`
+	}
+	return db.WithTx(func(tx *sql.Tx) error {
+		stmt, err := db.txStmt(tx, query)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+		if _, err := stmt.Exec(size, elapsed.Milliseconds(), runID); err != nil {
+			return fmt.Errorf("failed to record sync run copy: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetSyncRunCopyStats returns the copy counters of a sync run
+func (db *DB) GetSyncRunCopyStats(runID int64) (model.CopyStats, error) {
+	var stats model.CopyStats
+	err := db.queryRow(`SELECT server_copies, server_copy_bytes, server_copy_ms, streamed_copies, streamed_bytes, streamed_ms FROM sync_runs WHERE id = ?`, runID).
+		Scan(&stats.ServerCopies, &stats.ServerCopyBytes, &stats.ServerCopyMillis, &stats.StreamedCopies, &stats.StreamedBytes, &stats.StreamedMillis)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get sync run copy stats: %w", err)
+	}
+	return stats, nil
+}
+
 // MarkStepCompleted updates the last completed step for a sync run
 func (db *DB) MarkStepCompleted(runID int64, step int) error {
 	return db.WithTx(func(tx *sql.Tx) error {
@@ -113,7 +113,7 @@ func TestDatabaseOperationsWithEncryption(t *testing.T) {
 	
 	// Query to check if tables exist
 	var count int
-	err = db.conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name IN ('files', 'folders', 'replicas', 'replica_fragments')").Scan(&count)
+	err = db.conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name IN ('files', 'logical_folders', 'replicas', 'replica_fragments')").Scan(&count)
 	if err != nil {
 		t.Fatalf("Failed to query tables: %v", err)
 	}
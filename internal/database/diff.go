@@ -0,0 +1,103 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DiffSummary describes how the logical content of one metadata DB differs from another.
+// Paths are reported from the point of view of moving from the current DB to the target DB.
+type DiffSummary struct {
+	FilesAdded     []string
+	FilesRemoved   []string
+	FilesChanged   []string
+	ReplicasBefore int
+	ReplicasAfter  int
+	FoldersBefore  int
+	FoldersAfter   int
+}
+
+// Empty reports whether the two DBs hold the same logical files, replica count and folder count.
+func (d *DiffSummary) Empty() bool {
+	return len(d.FilesAdded) == 0 && len(d.FilesRemoved) == 0 && len(d.FilesChanged) == 0 &&
+		d.ReplicasBefore == d.ReplicasAfter && d.FoldersBefore == d.FoldersAfter
+}
+
+type fileFingerprint struct {
+	path   string
+	status string
+	md5    string
+	size   int64
+}
+
+func (db *DB) fileFingerprints() (map[string]fileFingerprint, error) {
+	rows, err := db.conn.Query("SELECT id, path, status, google_drive_md5, size FROM files")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query files: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]fileFingerprint)
+	for rows.Next() {
+		var id string
+		var fp fileFingerprint
+		if err := rows.Scan(&id, &fp.path, &fp.status, &fp.md5, &fp.size); err != nil {
+			return nil, fmt.Errorf("failed to scan file: %w", err)
+		}
+		out[id] = fp
+	}
+	return out, rows.Err()
+}
+
+func (db *DB) countRows(table string) (int, error) {
+	var n int
+	if err := db.conn.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", table, err)
+	}
+	return n, nil
+}
+
+// DiffAgainst summarizes what would change if db were replaced by target.
+func (db *DB) DiffAgainst(target *DB) (*DiffSummary, error) {
+	current, err := db.fileFingerprints()
+	if err != nil {
+		return nil, err
+	}
+	next, err := target.fileFingerprints()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DiffSummary{}
+	for id, fp := range next {
+		old, ok := current[id]
+		switch {
+		case !ok:
+			d.FilesAdded = append(d.FilesAdded, fp.path)
+		case old != fp:
+			d.FilesChanged = append(d.FilesChanged, fp.path)
+		}
+	}
+	for id, fp := range current {
+		if _, ok := next[id]; !ok {
+			d.FilesRemoved = append(d.FilesRemoved, fp.path)
+		}
+	}
+	sort.Strings(d.FilesAdded)
+	sort.Strings(d.FilesRemoved)
+	sort.Strings(d.FilesChanged)
+
+	if d.ReplicasBefore, err = db.countRows("replicas"); err != nil {
+		return nil, err
+	}
+	if d.ReplicasAfter, err = target.countRows("replicas"); err != nil {
+		return nil, err
+	}
+	if d.FoldersBefore, err = db.countRows("logical_folders"); err != nil {
+		return nil, err
+	}
+	if d.FoldersAfter, err = target.countRows("logical_folders"); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+func TestDiffAgainstReportsFileChanges(t *testing.T) {
+	password := "diffAgainstPass!23"
+	dir := t.TempDir()
+
+	open := func(name string) *DB {
+		db, err := OpenPath(filepath.Join(dir, name), password)
+		if err != nil {
+			t.Fatalf("OpenPath(%s): %v", name, err)
+		}
+		if err := db.Initialize(); err != nil {
+			t.Fatalf("Initialize(%s): %v", name, err)
+		}
+		return db
+	}
+	current := open("current.db")
+	defer current.Close()
+	target := open("target.db")
+	defer target.Close()
+
+	file := func(id, path, md5 string) *model.File {
+		return &model.File{ID: id, Path: path, Name: filepath.Base(path), Size: 1, GoogleDriveMD5: md5, ModTime: time.Unix(1000, 0), Status: "active"}
+	}
+	for _, f := range []*model.File{file("keep", "/keep.txt", "a"), file("change", "/change.txt", "b"), file("gone", "/gone.txt", "c")} {
+		if err := current.InsertFile(f); err != nil {
+			t.Fatalf("InsertFile: %v", err)
+		}
+	}
+	for _, f := range []*model.File{file("keep", "/keep.txt", "a"), file("change", "/change.txt", "B"), file("new", "/new.txt", "d")} {
+		if err := target.InsertFile(f); err != nil {
+			t.Fatalf("InsertFile: %v", err)
+		}
+	}
+
+	d, err := current.DiffAgainst(target)
+	if err != nil {
+		t.Fatalf("DiffAgainst: %v", err)
+	}
+	if len(d.FilesAdded) != 1 || d.FilesAdded[0] != "/new.txt" {
+		t.Fatalf("expected /new.txt added, got %v", d.FilesAdded)
+	}
+	if len(d.FilesRemoved) != 1 || d.FilesRemoved[0] != "/gone.txt" {
+		t.Fatalf("expected /gone.txt removed, got %v", d.FilesRemoved)
+	}
+	if len(d.FilesChanged) != 1 || d.FilesChanged[0] != "/change.txt" {
+		t.Fatalf("expected /change.txt changed, got %v", d.FilesChanged)
+	}
+	if d.Empty() {
+		t.Fatalf("expected non-empty diff")
+	}
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+func TestEncryptedReplicaSurvivesScanAndKeepsPlaintextSize(t *testing.T) {
+	db := openTestDB(t, "encrypted_replicas.db")
+	defer db.Close()
+
+	file := &model.File{ID: "file-1", Path: "/notes.txt", Name: "notes.txt", Size: 100, ModTime: time.Unix(1000, 0), Status: "active"}
+	if err := db.InsertFile(file); err != nil {
+		t.Fatalf("InsertFile: %v", err)
+	}
+	rep := &model.Replica{
+		FileID: file.ID, Path: file.Path, Name: file.Name, Size: 188, Provider: model.ProviderMicrosoft,
+		AccountID: "m@example.com", NativeID: "m1", NativeHash: "qx", ModTime: time.Unix(2000, 0), Status: "active",
+		Encrypted: true, CiphertextSHA256: "abc",
+	}
+	if err := db.InsertReplica(rep); err != nil {
+		t.Fatalf("InsertReplica: %v", err)
+	}
+
+	// A scan knows nothing about encryption; the recorded flag and hash must stay
+	scanned := &model.Replica{
+		Path: file.Path, Name: file.Name, Size: 188, Provider: model.ProviderMicrosoft,
+		AccountID: "m@example.com", NativeID: "m1", NativeHash: "qx", ModTime: time.Unix(3000, 0), Status: "active",
+	}
+	if err := db.UpsertReplicaByNativeID(scanned, 3000); err != nil {
+		t.Fatalf("UpsertReplicaByNativeID: %v", err)
+	}
+	if err := db.UpdateLogicalFilesFromReplicas(); err != nil {
+		t.Fatalf("UpdateLogicalFilesFromReplicas: %v", err)
+	}
+
+	replicas, err := db.GetReplicas(file.ID)
+	if err != nil {
+		t.Fatalf("GetReplicas: %v", err)
+	}
+	if len(replicas) != 1 || !replicas[0].Encrypted || replicas[0].CiphertextSHA256 != "abc" || replicas[0].Size != 188 {
+		t.Fatalf("expected the encrypted replica to survive the scan, got %+v", replicas)
+	}
+	got, err := db.GetFileByPath(file.Path)
+	if err != nil {
+		t.Fatalf("GetFileByPath: %v", err)
+	}
+	if got.Size != 100 {
+		t.Fatalf("expected the logical size to stay 100, got %d", got.Size)
+	}
+}
+
+func TestResealingReplicaChangesMetadataHash(t *testing.T) {
+	db := openTestDB(t, "encrypted_replicas_hash.db")
+	defer db.Close()
+
+	file := &model.File{ID: "file-1", Path: "/notes.txt", Name: "notes.txt", Size: 100, ModTime: time.Unix(1000, 0), Status: "active"}
+	if err := db.InsertFile(file); err != nil {
+		t.Fatalf("InsertFile: %v", err)
+	}
+	rep := &model.Replica{
+		FileID: file.ID, Path: file.Path, Name: file.Name, Size: 188, Provider: model.ProviderMicrosoft,
+		AccountID: "m@example.com", NativeID: "m1", NativeHash: "qx", ModTime: time.Unix(2000, 0), Status: "active",
+		Encrypted: true, CiphertextSHA256: "abc",
+	}
+	if err := db.InsertReplica(rep); err != nil {
+		t.Fatalf("InsertReplica: %v", err)
+	}
+	before, err := db.GetMetadataHash()
+	if err != nil {
+		t.Fatalf("GetMetadataHash: %v", err)
+	}
+
+	rep.CiphertextSHA256 = "def"
+	if err := db.UpdateReplica(rep); err != nil {
+		t.Fatalf("UpdateReplica: %v", err)
+	}
+	if after, err := db.GetMetadataHash(); err != nil || after == before {
+		t.Fatalf("expected re-sealing a replica to change the metadata hash, got %s (%v)", after, err)
+	}
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+func openTestDB(t *testing.T, name string) *DB {
+	t.Helper()
+	db, err := OpenPath(filepath.Join(t.TempDir(), name), "folderLifecyclePass!23")
+	if err != nil {
+		t.Fatalf("OpenPath: %v", err)
+	}
+	if err := db.Initialize(); err != nil {
+		db.Close()
+		t.Fatalf("Initialize: %v", err)
+	}
+	return db
+}
+
+func folderStatuses(t *testing.T, db *DB) map[string]string {
+	t.Helper()
+	folders, err := db.GetAllLogicalFolders()
+	if err != nil {
+		t.Fatalf("GetAllLogicalFolders: %v", err)
+	}
+	statuses := make(map[string]string, len(folders))
+	for _, f := range folders {
+		statuses[f.Path] = f.Status
+	}
+	return statuses
+}
+
+func TestUpdateLogicalFolderStatusFollowsReplicas(t *testing.T) {
+	db := openTestDB(t, "lifecycle.db")
+	defer db.Close()
+
+	google := func(id, path string) *model.Folder {
+		return &model.Folder{ID: id, Name: filepath.Base(path), Path: path, Provider: model.ProviderGoogle, UserEmail: "main@x.com", OwnerEmail: "main@x.com"}
+	}
+	onedrive := func(id, path string) *model.Folder {
+		return &model.Folder{ID: id, Name: filepath.Base(path), Path: path, Provider: model.ProviderMicrosoft, UserEmail: "backup@x.com", OwnerEmail: "backup@x.com"}
+	}
+	softDeleted := "/" + auxFolderName + "/soft-deleted"
+
+	// First scan: /moved and /gone exist everywhere.
+	if err := db.BatchUpsertFolders([]*model.Folder{
+		google("g-moved", "/moved"), onedrive("o-moved", "/moved"),
+		google("g-gone", "/gone"),
+	}, 100); err != nil {
+		t.Fatalf("BatchUpsertFolders (1): %v", err)
+	}
+
+	// Second scan: /moved was moved into soft-deleted on Google, /gone disappeared and /new was
+	// created on OneDrive only.
+	if err := db.BatchUpsertFolders([]*model.Folder{
+		google("g-moved", softDeleted+"/moved"), onedrive("o-moved", "/moved"),
+		onedrive("o-new", "/new"),
+	}, 200); err != nil {
+		t.Fatalf("BatchUpsertFolders (2): %v", err)
+	}
+	if err := db.MarkDeletedFolderReplicas(time.Unix(200, 0)); err != nil {
+		t.Fatalf("MarkDeletedFolderReplicas: %v", err)
+	}
+	if err := db.UpdateLogicalFolderStatus(); err != nil {
+		t.Fatalf("UpdateLogicalFolderStatus: %v", err)
+	}
+
+	statuses := folderStatuses(t, db)
+	want := map[string]string{
+		"/moved":               "soft-deleted",
+		softDeleted + "/moved": "soft-deleted",
+		"/gone":                "deleted",
+		"/new":                 "active",
+	}
+	for path, status := range want {
+		if statuses[path] != status {
+			t.Errorf("%s: expected status %q, got %q", path, status, statuses[path])
+		}
+	}
+
+	replica, err := db.GetFolderReplicaByPath("/moved", model.ProviderGoogle, "main@x.com")
+	if err != nil {
+		t.Fatalf("GetFolderReplicaByPath: %v", err)
+	}
+	if replica != nil {
+		t.Fatalf("expected no live Google replica at /moved, got %+v", replica)
+	}
+	replica, err = db.GetFolderReplicaByPath("/moved", model.ProviderMicrosoft, "backup@x.com")
+	if err != nil || replica == nil || replica.NativeFolderID != "o-moved" {
+		t.Fatalf("expected OneDrive replica o-moved at /moved, got %+v (%v)", replica, err)
+	}
+}
+
+func TestInitializeProjectsLegacyFolders(t *testing.T) {
+	db, err := OpenPath(filepath.Join(t.TempDir(), DBFileName), "legacyFoldersPass!23")
+	if err != nil {
+		t.Fatalf("OpenPath: %v", err)
+	}
+	defer db.Close()
+
+	// Bring the DB to the last version that still had the legacy folders table.
+	for _, m := range migrations[:3] {
+		if err := db.WithTx(m.up); err != nil {
+			t.Fatalf("migration %d: %v", m.Version, err)
+		}
+	}
+	if _, err := db.conn.Exec(`INSERT INTO folders (id, name, path, provider, user_email, user_phone, parent_folder_id, owner_email)
+		VALUES ('gid-b', 'b', '/a/b', 'Google', 'main@x.com', '', 'gid-a', 'main@x.com')`); err != nil {
+		t.Fatalf("insert legacy folder: %v", err)
+	}
+
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if exists, err := db.tableExists("folders"); err != nil || exists {
+		t.Fatalf("expected legacy folders table to be dropped (exists=%v, err=%v)", exists, err)
+	}
+
+	replica, err := db.GetFolderReplicaByPath("/a/b", model.ProviderGoogle, "main@x.com")
+	if err != nil || replica == nil {
+		t.Fatalf("expected projected folder replica, got %+v (%v)", replica, err)
+	}
+	if replica.NativeFolderID != "gid-b" || replica.LogicalFolderID != "lf:path:/a/b" || replica.Status != "active" {
+		t.Fatalf("unexpected projected replica: %+v", replica)
+	}
+}
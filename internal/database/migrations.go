@@ -0,0 +1,582 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+)
+
+// ErrSchemaTooNew is returned when the metadata DB was migrated by a newer binary than this one.
+// Opening it would risk writing rows the newer schema does not expect, so it is refused.
+var ErrSchemaTooNew = errors.New("metadata database schema is newer than this binary supports")
+
+// ErrSchemaOutdated is returned by CheckSchema when the metadata DB has migrations pending.
+var ErrSchemaOutdated = errors.New("metadata database schema is out of date")
+
+// Migration is one numbered schema change. Each migration runs in its own transaction together
+// with the schema_migrations row that records it, so a DB is never left half-migrated.
+type Migration struct {
+	Version int
+	Name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations lists every schema change in order. Versions must be consecutive starting at 1;
+// append new migrations at the end and never edit one that has shipped.
+var migrations = []Migration{
+	{Version: 1, Name: "baseline schema", up: execMigration(baselineSchema)},
+	{Version: 2, Name: "replica owner and last_seen_at columns", up: migrateReplicaOwnerLastSeen},
+	{Version: 3, Name: "change-tracking triggers ignore bookkeeping columns", up: execMigration(`
+		DROP TRIGGER IF EXISTS folders_au;
+		CREATE TRIGGER folders_au AFTER UPDATE ON folders
+		WHEN OLD.name IS NOT NEW.name OR OLD.path IS NOT NEW.path OR OLD.provider IS NOT NEW.provider OR OLD.parent_folder_id IS NOT NEW.parent_folder_id OR OLD.owner_email IS NOT NEW.owner_email
+		BEGIN UPDATE _db_version SET version = version + 1; END;
+
+		DROP TRIGGER IF EXISTS files_au;
+		CREATE TRIGGER files_au AFTER UPDATE ON files
+		WHEN OLD.path IS NOT NEW.path OR OLD.name IS NOT NEW.name OR OLD.size IS NOT NEW.size OR OLD.google_drive_md5 IS NOT NEW.google_drive_md5 OR OLD.mod_time IS NOT NEW.mod_time OR OLD.status IS NOT NEW.status
+		BEGIN UPDATE _db_version SET version = version + 1; END;
+	`)},
+	{Version: 4, Name: "folder replica lifecycle; drop legacy folders table", up: migrateLegacyFolders},
+	{Version: 5, Name: "sync run log file", up: execMigration(`ALTER TABLE sync_runs ADD COLUMN log_file TEXT NOT NULL DEFAULT ''`)},
+	{Version: 6, Name: "account shares", up: execMigration(`
+		CREATE TABLE account_shares (
+			provider TEXT NOT NULL,
+			source_account TEXT NOT NULL,
+			target_account TEXT NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			checked_at INTEGER NOT NULL,
+			PRIMARY KEY (provider, source_account, target_account)
+		);
+
+		CREATE TRIGGER account_shares_ai AFTER INSERT ON account_shares BEGIN UPDATE _db_version SET version = version + 1; END;
+		CREATE TRIGGER account_shares_au AFTER UPDATE ON account_shares
+		WHEN OLD.status IS NOT NEW.status OR OLD.error IS NOT NEW.error
+		BEGIN UPDATE _db_version SET version = version + 1; END;
+		CREATE TRIGGER account_shares_ad AFTER DELETE ON account_shares BEGIN UPDATE _db_version SET version = version + 1; END;
+	`)},
+	{Version: 7, Name: "pending ownership transfers", up: execMigration(`
+		CREATE TABLE pending_transfers (
+			provider TEXT NOT NULL,
+			native_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			source_account TEXT NOT NULL,
+			target_account TEXT NOT NULL,
+			requested_at INTEGER NOT NULL,
+			PRIMARY KEY (provider, native_id)
+		);
+
+		CREATE TRIGGER pending_transfers_ai AFTER INSERT ON pending_transfers BEGIN UPDATE _db_version SET version = version + 1; END;
+		CREATE TRIGGER pending_transfers_au AFTER UPDATE ON pending_transfers BEGIN UPDATE _db_version SET version = version + 1; END;
+		CREATE TRIGGER pending_transfers_ad AFTER DELETE ON pending_transfers BEGIN UPDATE _db_version SET version = version + 1; END;
+	`)},
+	{Version: 8, Name: "sync run copy stats", up: execMigration(`
+		ALTER TABLE sync_runs ADD COLUMN server_copies INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE sync_runs ADD COLUMN server_copy_bytes INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE sync_runs ADD COLUMN server_copy_ms INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE sync_runs ADD COLUMN streamed_copies INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE sync_runs ADD COLUMN streamed_bytes INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE sync_runs ADD COLUMN streamed_ms INTEGER NOT NULL DEFAULT 0;
+	`)},
+	{Version: 9, Name: "erasure-coded file shards", up: execMigration(`
+		CREATE TABLE file_shards (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			file_id TEXT NOT NULL,
+			shard_index INTEGER NOT NULL,
+			data_shards INTEGER NOT NULL,
+			parity_shards INTEGER NOT NULL,
+			size INTEGER NOT NULL,
+			sha256 TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			account_id TEXT NOT NULL,
+			native_id TEXT NOT NULL,
+			fragmented BOOLEAN NOT NULL DEFAULT 0,
+			status TEXT NOT NULL,
+			FOREIGN KEY(file_id) REFERENCES files(id) ON DELETE CASCADE
+		);
+		CREATE UNIQUE INDEX idx_file_shards_file_index ON file_shards(file_id, shard_index);
+
+		CREATE TABLE shard_fragments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			shard_id INTEGER NOT NULL,
+			fragment_number INTEGER NOT NULL,
+			fragments_total INTEGER NOT NULL,
+			size INTEGER NOT NULL,
+			native_fragment_id TEXT NOT NULL,
+			FOREIGN KEY(shard_id) REFERENCES file_shards(id) ON DELETE CASCADE
+		);
+		CREATE INDEX idx_shard_fragments_shard_id ON shard_fragments(shard_id);
+
+		CREATE TRIGGER file_shards_ai AFTER INSERT ON file_shards BEGIN UPDATE _db_version SET version = version + 1; END;
+		CREATE TRIGGER file_shards_au AFTER UPDATE ON file_shards BEGIN UPDATE _db_version SET version = version + 1; END;
+		CREATE TRIGGER file_shards_ad AFTER DELETE ON file_shards BEGIN UPDATE _db_version SET version = version + 1; END;
+	`)},
+	{Version: 10, Name: "encrypted replicas", up: execMigration(`
+		ALTER TABLE replicas ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT 0;
+		ALTER TABLE replicas ADD COLUMN ciphertext_sha256 TEXT NOT NULL DEFAULT '';
+
+		DROP TRIGGER IF EXISTS replicas_au;
+		CREATE TRIGGER replicas_au AFTER UPDATE ON replicas
+		WHEN OLD.file_id IS NOT NEW.file_id OR OLD.path IS NOT NEW.path OR OLD.name IS NOT NEW.name OR OLD.size IS NOT NEW.size OR OLD.provider IS NOT NEW.provider OR OLD.account_id IS NOT NEW.account_id OR OLD.native_id IS NOT NEW.native_id OR OLD.native_hash IS NOT NEW.native_hash OR OLD.mod_time IS NOT NEW.mod_time OR OLD.status IS NOT NEW.status OR OLD.fragmented IS NOT NEW.fragmented OR OLD.owner IS NOT NEW.owner OR OLD.encrypted IS NOT NEW.encrypted OR OLD.ciphertext_sha256 IS NOT NEW.ciphertext_sha256
+		BEGIN UPDATE _db_version SET version = version + 1; END;
+	`)},
+}
+
+// LatestSchemaVersion returns the schema version this binary migrates databases to.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func execMigration(stmts string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(stmts)
+		return err
+	}
+}
+
+// migrateReplicaOwnerLastSeen adds the replica columns introduced after the first release.
+// Databases created from the baseline schema already have last_seen_at.
+func migrateReplicaOwnerLastSeen(tx *sql.Tx) error {
+	for _, col := range []struct{ name, def string }{
+		{"last_seen_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"owner", "TEXT DEFAULT ''"},
+	} {
+		exists, err := columnExists(tx, "replicas", col.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE replicas ADD COLUMN %s %s", col.name, col.def)); err != nil {
+			return fmt.Errorf("failed to add replicas.%s: %w", col.name, err)
+		}
+	}
+	_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_replicas_last_seen ON replicas(last_seen_at)")
+	return err
+}
+
+// migrateLegacyFolders gives folder_replicas a status so folder lifecycle is tracked like file
+// replicas, lets one native folder back several logical_folders (its old and new path after a
+// move), and folds the legacy folders table into logical_folders/folder_replicas before dropping
+// it. Projected replicas get last_seen_at 0, so the next scan settles whether they still exist.
+func migrateLegacyFolders(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "folder_replicas", "status")
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := tx.Exec("ALTER TABLE folder_replicas ADD COLUMN status TEXT NOT NULL DEFAULT 'active'"); err != nil {
+			return fmt.Errorf("failed to add folder_replicas.status: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`
+		DROP INDEX IF EXISTS idx_folder_replicas_unique;
+		CREATE UNIQUE INDEX idx_folder_replicas_unique ON folder_replicas(logical_folder_id, provider, account_id, native_folder_id);
+		CREATE INDEX IF NOT EXISTS idx_folder_replicas_native ON folder_replicas(provider, native_folder_id);
+		CREATE INDEX IF NOT EXISTS idx_folder_replicas_status ON folder_replicas(status);
+
+		DROP TRIGGER IF EXISTS folder_replicas_au;
+		CREATE TRIGGER folder_replicas_au AFTER UPDATE ON folder_replicas
+		WHEN OLD.logical_folder_id IS NOT NEW.logical_folder_id OR OLD.provider IS NOT NEW.provider OR OLD.account_id IS NOT NEW.account_id OR OLD.native_folder_id IS NOT NEW.native_folder_id OR OLD.owner IS NOT NEW.owner OR OLD.status IS NOT NEW.status
+		BEGIN UPDATE _db_version SET version = version + 1; END;
+	`); err != nil {
+		return err
+	}
+
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'folders'").Scan(&n); err != nil {
+		return fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	type legacyFolder struct {
+		id, name, path, provider, accountID, owner string
+	}
+	rows, err := tx.Query(`SELECT id, name, path, provider, COALESCE(user_email, ''), COALESCE(user_phone, ''), COALESCE(owner_email, '') FROM folders`)
+	if err != nil {
+		return fmt.Errorf("failed to read legacy folders: %w", err)
+	}
+	var legacy []legacyFolder
+	for rows.Next() {
+		var f legacyFolder
+		var email, phone string
+		if err := rows.Scan(&f.id, &f.name, &f.path, &f.provider, &email, &phone, &f.owner); err != nil {
+			rows.Close()
+			return err
+		}
+		f.accountID = email
+		if f.provider == "Telegram" {
+			f.accountID = phone
+		}
+		f.path = strings.ReplaceAll(f.path, "\\", "/")
+		legacy = append(legacy, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, f := range legacy {
+		logicalFolderID, err := resolveLogicalFolderID(tx, f.path)
+		if err != nil {
+			return err
+		}
+		if logicalFolderID == "" {
+			continue
+		}
+		parentLogicalFolderID, err := resolveLogicalFolderID(tx, filepath.ToSlash(filepath.Dir(f.path)))
+		if err != nil {
+			return err
+		}
+		var parent interface{}
+		if parentLogicalFolderID != "" {
+			parent = parentLogicalFolderID
+		}
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO logical_folders (id, path, name, parent_logical_folder_id, status) VALUES (?, ?, ?, ?, 'active')`,
+			logicalFolderID, f.path, f.name, parent); err != nil {
+			return fmt.Errorf("failed to project legacy folder %s: %w", f.path, err)
+		}
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO folder_replicas (logical_folder_id, provider, account_id, native_folder_id, owner, status, last_seen_at) VALUES (?, ?, ?, ?, ?, 'active', 0)`,
+			logicalFolderID, f.provider, f.accountID, f.id, f.owner); err != nil {
+			return fmt.Errorf("failed to project legacy folder replica %s: %w", f.path, err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		DROP TRIGGER IF EXISTS folders_ai;
+		DROP TRIGGER IF EXISTS folders_au;
+		DROP TRIGGER IF EXISTS folders_ad;
+		DROP TABLE folders;
+	`)
+	return err
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			ctype   string
+			notNull int
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+func (db *DB) tableExists(name string) (bool, error) {
+	var n int
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	return n > 0, nil
+}
+
+// SchemaVersion returns the highest migration recorded in the database, or 0 for a database
+// that predates schema_migrations.
+func (db *DB) SchemaVersion() (int, error) {
+	exists, err := db.tableExists("schema_migrations")
+	if err != nil || !exists {
+		return 0, err
+	}
+	var version sql.NullInt64
+	if err := db.conn.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// PendingMigrations returns the migrations not yet applied to the database, or ErrSchemaTooNew
+// when the database is ahead of this binary. It does not modify the database.
+func (db *DB) PendingMigrations() ([]Migration, error) {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return nil, fmt.Errorf("%w: database is at version %d, this binary supports up to %d; upgrade cloud-drives-sync", ErrSchemaTooNew, current, latest)
+	}
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// CheckSchema verifies that the database is at the schema version of this binary without
+// migrating it, for read-only commands that must not change a DB another process may be using.
+func (db *DB) CheckSchema() error {
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		current, _ := db.SchemaVersion()
+		return fmt.Errorf("%w: database is at version %d, this binary expects %d; run 'db --migrate' first", ErrSchemaOutdated, current, LatestSchemaVersion())
+	}
+	return nil
+}
+
+// Initialize brings the database schema up to date. An existing database is backed up before
+// the first pending migration runs; see Backup.
+func (db *DB) Initialize() error {
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	hasData, err := db.tableExists("files")
+	if err != nil {
+		return err
+	}
+	if hasData {
+		current, _ := db.SchemaVersion()
+		backupPath, err := db.Backup(fmt.Sprintf(".pre-migration-v%d", current))
+		if err != nil {
+			return fmt.Errorf("failed to back up database before migrating: %w", err)
+		}
+		logger.Info("Backed up metadata database to %s before migrating", backupPath)
+	}
+
+	if _, err := db.conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	for _, m := range pending {
+		if hasData {
+			logger.Info("Applying schema migration %d: %s", m.Version, m.Name)
+		}
+		err := db.WithTx(func(tx *sql.Tx) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.Version, m.Name, time.Now().Unix())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("schema migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// Checkpoint folds the WAL into the main database file, so the file alone holds every
+// committed change (e.g. before it is uploaded while the DB stays open).
+func (db *DB) Checkpoint() error {
+	if _, err := db.conn.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("failed to checkpoint WAL: %w", err)
+	}
+	return nil
+}
+
+// Backup checkpoints the WAL and copies the database file next to itself with the given suffix,
+// returning the backup path. The copy stays encrypted with the same key.
+func (db *DB) Backup(suffix string) (string, error) {
+	if err := db.Checkpoint(); err != nil {
+		return "", err
+	}
+
+	src, err := os.Open(db.path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	backupPath := db.path + suffix
+	dst, err := os.OpenFile(backupPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", err
+	}
+	return backupPath, dst.Close()
+}
+
+// baselineSchema is the schema as it stood before versioned migrations were introduced. It uses
+// IF NOT EXISTS throughout so that it also applies cleanly to databases created back then.
+const baselineSchema = `
+
+	CREATE TABLE IF NOT EXISTS files (
+		id TEXT PRIMARY KEY,
+		path TEXT NOT NULL,
+		name TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		google_drive_md5 TEXT NOT NULL DEFAULT '',
+		mod_time INTEGER NOT NULL,
+		status TEXT NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_files_path ON files(path);
+	CREATE INDEX IF NOT EXISTS idx_files_google_drive_md5 ON files(google_drive_md5);
+	CREATE INDEX IF NOT EXISTS idx_files_status ON files(status);
+
+	CREATE TABLE IF NOT EXISTS replicas (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		file_id TEXT,
+		path TEXT NOT NULL,
+		name TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		account_id TEXT NOT NULL,
+		native_id TEXT NOT NULL,
+		native_hash TEXT,
+		mod_time INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		fragmented BOOLEAN NOT NULL DEFAULT 0,
+		last_seen_at INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY(file_id) REFERENCES files(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_replicas_file_id ON replicas(file_id);
+	CREATE INDEX IF NOT EXISTS idx_replicas_provider ON replicas(provider);
+	CREATE INDEX IF NOT EXISTS idx_replicas_account_id ON replicas(account_id);
+	CREATE INDEX IF NOT EXISTS idx_replicas_native_id_old ON replicas(native_id);
+	CREATE INDEX IF NOT EXISTS idx_replicas_status ON replicas(status);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_replicas_unique ON replicas(provider, account_id, native_id);
+
+	CREATE INDEX IF NOT EXISTS idx_replicas_native_id ON replicas(provider, native_id);
+	CREATE INDEX IF NOT EXISTS idx_replicas_provider_status ON replicas(provider, status);
+
+	CREATE TABLE IF NOT EXISTS replica_fragments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		replica_id INTEGER NOT NULL,
+		fragment_number INTEGER NOT NULL,
+		fragments_total INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		native_fragment_id TEXT NOT NULL,
+		FOREIGN KEY(replica_id) REFERENCES replicas(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_replica_fragments_replica_id ON replica_fragments(replica_id);
+	CREATE INDEX IF NOT EXISTS idx_replica_fragments_native_id ON replica_fragments(native_fragment_id);
+
+	CREATE TABLE IF NOT EXISTS folders (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		path TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		user_email TEXT,
+		user_phone TEXT,
+		parent_folder_id TEXT,
+		owner_email TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_folders_provider ON folders(provider);
+	CREATE INDEX IF NOT EXISTS idx_folders_path ON folders(path);
+
+	-- New-model folder tables (SPEC): a provider-agnostic logical_folder with one
+	-- folder_replica per provider/account. Populated by the Phase 2 folder sync logic.
+	CREATE TABLE IF NOT EXISTS logical_folders (
+		id TEXT PRIMARY KEY,
+		path TEXT NOT NULL,
+		name TEXT NOT NULL,
+		parent_logical_folder_id TEXT,
+		status TEXT NOT NULL DEFAULT 'active'
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_logical_folders_path ON logical_folders(path);
+	CREATE INDEX IF NOT EXISTS idx_logical_folders_parent ON logical_folders(parent_logical_folder_id);
+	CREATE INDEX IF NOT EXISTS idx_logical_folders_status ON logical_folders(status);
+
+	CREATE TABLE IF NOT EXISTS folder_replicas (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		logical_folder_id TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		account_id TEXT NOT NULL,
+		native_folder_id TEXT NOT NULL,
+		owner TEXT DEFAULT '',
+		last_seen_at INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY(logical_folder_id) REFERENCES logical_folders(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_folder_replicas_logical_folder_id ON folder_replicas(logical_folder_id);
+	CREATE INDEX IF NOT EXISTS idx_folder_replicas_provider ON folder_replicas(provider);
+	CREATE INDEX IF NOT EXISTS idx_folder_replicas_account_id ON folder_replicas(account_id);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_folder_replicas_unique ON folder_replicas(provider, account_id, native_folder_id);
+
+	CREATE TABLE IF NOT EXISTS sync_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		started_at INTEGER NOT NULL,
+		completed_at INTEGER,
+		last_completed_step INTEGER NOT NULL DEFAULT 0,
+		safe_mode BOOLEAN NOT NULL DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS sync_copy_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		sync_run_id INTEGER NOT NULL,
+		file_id TEXT NOT NULL,
+		target_provider TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		FOREIGN KEY(sync_run_id) REFERENCES sync_runs(id) ON DELETE CASCADE
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_sync_copy_log_unique ON sync_copy_log(sync_run_id, file_id, target_provider);
+
+	CREATE TABLE IF NOT EXISTS _db_version (version INTEGER);
+	INSERT INTO _db_version (version) SELECT 0 WHERE NOT EXISTS (SELECT 1 FROM _db_version);
+
+	CREATE TRIGGER IF NOT EXISTS files_ai AFTER INSERT ON files BEGIN UPDATE _db_version SET version = version + 1; END;
+	CREATE TRIGGER IF NOT EXISTS files_au AFTER UPDATE ON files
+	WHEN OLD.path IS NOT NEW.path OR OLD.name IS NOT NEW.name OR OLD.size IS NOT NEW.size OR OLD.google_drive_md5 IS NOT NEW.google_drive_md5 OR OLD.mod_time IS NOT NEW.mod_time OR OLD.status IS NOT NEW.status
+	BEGIN UPDATE _db_version SET version = version + 1; END;
+	CREATE TRIGGER IF NOT EXISTS files_ad AFTER DELETE ON files BEGIN UPDATE _db_version SET version = version + 1; END;
+
+	CREATE TRIGGER IF NOT EXISTS replicas_ai AFTER INSERT ON replicas BEGIN UPDATE _db_version SET version = version + 1; END;
+	CREATE TRIGGER IF NOT EXISTS replicas_au AFTER UPDATE ON replicas 
+	WHEN OLD.file_id IS NOT NEW.file_id OR OLD.path IS NOT NEW.path OR OLD.name IS NOT NEW.name OR OLD.size IS NOT NEW.size OR OLD.provider IS NOT NEW.provider OR OLD.account_id IS NOT NEW.account_id OR OLD.native_id IS NOT NEW.native_id OR OLD.native_hash IS NOT NEW.native_hash OR OLD.mod_time IS NOT NEW.mod_time OR OLD.status IS NOT NEW.status OR OLD.fragmented IS NOT NEW.fragmented OR OLD.owner IS NOT NEW.owner
+	BEGIN UPDATE _db_version SET version = version + 1; END;
+	CREATE TRIGGER IF NOT EXISTS replicas_ad AFTER DELETE ON replicas BEGIN UPDATE _db_version SET version = version + 1; END;
+
+	CREATE TRIGGER IF NOT EXISTS folders_ai AFTER INSERT ON folders BEGIN UPDATE _db_version SET version = version + 1; END;
+	CREATE TRIGGER IF NOT EXISTS folders_au AFTER UPDATE ON folders
+	WHEN OLD.name IS NOT NEW.name OR OLD.path IS NOT NEW.path OR OLD.provider IS NOT NEW.provider OR OLD.parent_folder_id IS NOT NEW.parent_folder_id OR OLD.owner_email IS NOT NEW.owner_email
+	BEGIN UPDATE _db_version SET version = version + 1; END;
+	CREATE TRIGGER IF NOT EXISTS folders_ad AFTER DELETE ON folders BEGIN UPDATE _db_version SET version = version + 1; END;
+
+	CREATE TRIGGER IF NOT EXISTS logical_folders_ai AFTER INSERT ON logical_folders BEGIN UPDATE _db_version SET version = version + 1; END;
+	CREATE TRIGGER IF NOT EXISTS logical_folders_au AFTER UPDATE ON logical_folders
+	WHEN OLD.path IS NOT NEW.path OR OLD.name IS NOT NEW.name OR OLD.parent_logical_folder_id IS NOT NEW.parent_logical_folder_id OR OLD.status IS NOT NEW.status
+	BEGIN UPDATE _db_version SET version = version + 1; END;
+	CREATE TRIGGER IF NOT EXISTS logical_folders_ad AFTER DELETE ON logical_folders BEGIN UPDATE _db_version SET version = version + 1; END;
+
+	CREATE TRIGGER IF NOT EXISTS folder_replicas_ai AFTER INSERT ON folder_replicas BEGIN UPDATE _db_version SET version = version + 1; END;
+	CREATE TRIGGER IF NOT EXISTS folder_replicas_au AFTER UPDATE ON folder_replicas
+	WHEN OLD.logical_folder_id IS NOT NEW.logical_folder_id OR OLD.provider IS NOT NEW.provider OR OLD.account_id IS NOT NEW.account_id OR OLD.native_folder_id IS NOT NEW.native_folder_id OR OLD.owner IS NOT NEW.owner
+	BEGIN UPDATE _db_version SET version = version + 1; END;
+	CREATE TRIGGER IF NOT EXISTS folder_replicas_ad AFTER DELETE ON folder_replicas BEGIN UPDATE _db_version SET version = version + 1; END;
+`
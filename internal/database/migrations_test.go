@@ -0,0 +1,120 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitializeRecordsMigrationsOnce(t *testing.T) {
+	password := "migrationsPass!23"
+	dbPath := filepath.Join(t.TempDir(), DBFileName)
+
+	db, err := OpenPath(dbPath, password)
+	if err != nil {
+		t.Fatalf("OpenPath: %v", err)
+	}
+	defer db.Close()
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if v, err := db.SchemaVersion(); err != nil || v != LatestSchemaVersion() {
+		t.Fatalf("expected schema version %d, got %d (%v)", LatestSchemaVersion(), v, err)
+	}
+
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("second Initialize: %v", err)
+	}
+	var rows int
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&rows); err != nil {
+		t.Fatalf("count schema_migrations: %v", err)
+	}
+	if rows != len(migrations) {
+		t.Fatalf("expected %d schema_migrations rows, got %d", len(migrations), rows)
+	}
+}
+
+func TestInitializeMigratesLegacyDatabaseWithBackup(t *testing.T) {
+	password := "migrationsLegacyPass!23"
+	dbPath := filepath.Join(t.TempDir(), DBFileName)
+
+	db, err := OpenPath(dbPath, password)
+	if err != nil {
+		t.Fatalf("OpenPath: %v", err)
+	}
+	defer db.Close()
+
+	// A database from before versioned migrations: no schema_migrations and no replicas.owner.
+	legacy := `
+	CREATE TABLE files (id TEXT PRIMARY KEY, path TEXT NOT NULL, name TEXT NOT NULL, size INTEGER NOT NULL,
+		google_drive_md5 TEXT NOT NULL DEFAULT '', mod_time INTEGER NOT NULL, status TEXT NOT NULL);
+	CREATE TABLE replicas (id INTEGER PRIMARY KEY AUTOINCREMENT, file_id TEXT, path TEXT NOT NULL, name TEXT NOT NULL,
+		size INTEGER NOT NULL, provider TEXT NOT NULL, account_id TEXT NOT NULL, native_id TEXT NOT NULL, native_hash TEXT,
+		mod_time INTEGER NOT NULL, status TEXT NOT NULL, fragmented BOOLEAN NOT NULL DEFAULT 0);`
+	if _, err := db.conn.Exec(legacy); err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if _, err := os.Stat(dbPath + ".pre-migration-v0"); err != nil {
+		t.Fatalf("expected pre-migration backup: %v", err)
+	}
+	if _, err := db.conn.Exec("UPDATE replicas SET owner = '', last_seen_at = 0"); err != nil {
+		t.Fatalf("expected migrated replica columns: %v", err)
+	}
+}
+
+func TestInitializeRefusesNewerSchema(t *testing.T) {
+	password := "migrationsNewerPass!23"
+	dbPath := filepath.Join(t.TempDir(), DBFileName)
+
+	db, err := OpenPath(dbPath, password)
+	if err != nil {
+		t.Fatalf("OpenPath: %v", err)
+	}
+	defer db.Close()
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if _, err := db.conn.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'from the future', 0)", LatestSchemaVersion()+1); err != nil {
+		t.Fatalf("insert future migration: %v", err)
+	}
+
+	if err := db.Initialize(); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+func TestCheckSchemaDoesNotMigrate(t *testing.T) {
+	password := "migrationsCheckPass!23"
+	dbPath := filepath.Join(t.TempDir(), DBFileName)
+
+	db, err := OpenPath(dbPath, password)
+	if err != nil {
+		t.Fatalf("OpenPath: %v", err)
+	}
+	defer db.Close()
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if err := db.CheckSchema(); err != nil {
+		t.Fatalf("expected an up-to-date schema to pass, got %v", err)
+	}
+
+	latest := LatestSchemaVersion()
+	if _, err := db.conn.Exec("DELETE FROM schema_migrations WHERE version = ?", latest); err != nil {
+		t.Fatalf("roll back schema_migrations: %v", err)
+	}
+	if err := db.CheckSchema(); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("expected ErrSchemaOutdated, got %v", err)
+	}
+	if v, err := db.SchemaVersion(); err != nil || v != latest-1 {
+		t.Fatalf("expected CheckSchema to leave the schema at %d, got %d (%v)", latest-1, v, err)
+	}
+	if matches, _ := filepath.Glob(dbPath + ".pre-migration-*"); len(matches) != 0 {
+		t.Fatalf("expected no backup, found %v", matches)
+	}
+}
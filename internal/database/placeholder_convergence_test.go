@@ -88,3 +88,68 @@ func TestUpdateLogicalFilesFromReplicasPrefersRealReplicaOverPlaceholder(t *test
 		t.Fatalf("logical GoogleDriveMD5 = %q", got.GoogleDriveMD5)
 	}
 }
+
+func TestReplacePlaceholderReplica(t *testing.T) {
+	db := openTestDB(t, "replace_placeholder.db")
+	defer db.Close()
+
+	placeholder := &model.Replica{
+		FileID:     "file-1",
+		Path:       "/docs/report.pdf",
+		Name:       "report.pdf",
+		Provider:   model.ProviderMicrosoft,
+		AccountID:  "b@example.com",
+		NativeID:   "placeholder-id",
+		NativeHash: model.NativeHashShortcut,
+		ModTime:    time.Unix(1000, 0),
+		Status:     "active",
+	}
+	f := &model.File{
+		ID:       "file-1",
+		Path:     "/docs/report.pdf",
+		Name:     "report.pdf",
+		Size:     123,
+		ModTime:  time.Unix(1000, 0),
+		Status:   "active",
+		Replicas: []*model.Replica{placeholder},
+	}
+	if err := db.InsertFile(f); err != nil {
+		t.Fatalf("InsertFile: %v", err)
+	}
+	replicas, err := db.GetReplicas("file-1")
+	if err != nil || len(replicas) != 1 {
+		t.Fatalf("GetReplicas: %v, %v", replicas, err)
+	}
+	placeholder = replicas[0]
+
+	shortcut := &model.Replica{
+		FileID:     "file-1",
+		Path:       "/docs/report.pdf",
+		Name:       "report.pdf",
+		Size:       123,
+		Provider:   model.ProviderMicrosoft,
+		AccountID:  "b@example.com",
+		NativeID:   "shortcut-id",
+		NativeHash: model.NativeHashShortcut,
+		ModTime:    time.Unix(2000, 0),
+		Status:     "active",
+	}
+	if err := db.ReplacePlaceholderReplica(placeholder, shortcut, 2000); err != nil {
+		t.Fatalf("ReplacePlaceholderReplica: %v", err)
+	}
+	if shortcut.ID == 0 {
+		t.Fatalf("expected the shortcut replica ID to be set")
+	}
+
+	replicas, err = db.GetReplicas("file-1")
+	if err != nil {
+		t.Fatalf("GetReplicas: %v", err)
+	}
+	statuses := make(map[string]string)
+	for _, r := range replicas {
+		statuses[r.NativeID] = r.Status
+	}
+	if statuses["placeholder-id"] != "deleted" || statuses["shortcut-id"] != "active" {
+		t.Fatalf("expected the placeholder retired and the shortcut active, got %v", statuses)
+	}
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// ReplaceFileShards records shards as the complete shard set of a file, replacing any shards
+// recorded for it before. The shards get their IDs assigned.
+func (db *DB) ReplaceFileShards(fileID string, shards []*model.Shard) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM shard_fragments WHERE shard_id IN (SELECT id FROM file_shards WHERE file_id = ?)`, fileID); err != nil {
+			return fmt.Errorf("failed to delete shard fragments: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM file_shards WHERE file_id = ?`, fileID); err != nil {
+			return fmt.Errorf("failed to delete shards: %w", err)
+		}
+
+		stmt, err := db.txStmt(tx, `
+			INSERT INTO file_shards (file_id, shard_index, data_shards, parity_shards, size, sha256, provider, account_id, native_id, fragmented, status)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+		for _, shard := range shards {
+			shard.FileID = fileID
+			res, err := stmt.Exec(fileID, shard.ShardIndex, shard.DataShards, shard.ParityShards, shard.Size, shard.SHA256,
+				string(shard.Provider), shard.AccountID, shard.NativeID, shard.Fragmented, shard.Status)
+			if err != nil {
+				return fmt.Errorf("failed to insert shard %d: %w", shard.ShardIndex, err)
+			}
+			if shard.ID, err = res.LastInsertId(); err != nil {
+				return fmt.Errorf("failed to get shard ID: %w", err)
+			}
+			if err := insertShardFragmentsTx(db, tx, shard); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateFileShard records a new location, checksum or status for a shard, replacing its
+// fragments.
+func (db *DB) UpdateFileShard(shard *model.Shard) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		stmt, err := db.txStmt(tx, `
+			UPDATE file_shards
+			SET size = ?, sha256 = ?, provider = ?, account_id = ?, native_id = ?, fragmented = ?, status = ?
+			WHERE id = ?`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+		if _, err := stmt.Exec(shard.Size, shard.SHA256, string(shard.Provider), shard.AccountID, shard.NativeID, shard.Fragmented, shard.Status, shard.ID); err != nil {
+			return fmt.Errorf("failed to update shard %d: %w", shard.ShardIndex, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM shard_fragments WHERE shard_id = ?`, shard.ID); err != nil {
+			return fmt.Errorf("failed to delete shard fragments: %w", err)
+		}
+		return insertShardFragmentsTx(db, tx, shard)
+	})
+}
+
+func insertShardFragmentsTx(db *DB, tx *sql.Tx, shard *model.Shard) error {
+	if len(shard.Fragments) == 0 {
+		return nil
+	}
+	stmt, err := db.txStmt(tx, `
+		INSERT INTO shard_fragments (shard_id, fragment_number, fragments_total, size, native_fragment_id)
+		VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+	for _, frag := range shard.Fragments {
+		if _, err := stmt.Exec(shard.ID, frag.FragmentNumber, frag.FragmentsTotal, frag.Size, frag.NativeFragmentID); err != nil {
+			return fmt.Errorf("failed to insert shard fragment: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetFileShards returns the shards of an erasure-coded file ordered by index, with their
+// fragments, or nil when the file is stored as full replicas.
+func (db *DB) GetFileShards(fileID string) ([]*model.Shard, error) {
+	rows, err := db.query(`
+		SELECT id, file_id, shard_index, data_shards, parity_shards, size, sha256, provider, account_id, native_id, fragmented, status
+		FROM file_shards WHERE file_id = ? ORDER BY shard_index`, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shards: %w", err)
+	}
+	defer rows.Close()
+
+	var shards []*model.Shard
+	byID := make(map[int64]*model.Shard)
+	for rows.Next() {
+		s := &model.Shard{}
+		if err := rows.Scan(&s.ID, &s.FileID, &s.ShardIndex, &s.DataShards, &s.ParityShards, &s.Size, &s.SHA256,
+			&s.Provider, &s.AccountID, &s.NativeID, &s.Fragmented, &s.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan shard: %w", err)
+		}
+		shards = append(shards, s)
+		byID[s.ID] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate shards: %w", err)
+	}
+	if len(shards) == 0 {
+		return nil, nil
+	}
+
+	fragRows, err := db.query(`
+		SELECT f.id, f.shard_id, f.fragment_number, f.fragments_total, f.size, f.native_fragment_id
+		FROM shard_fragments f JOIN file_shards s ON s.id = f.shard_id
+		WHERE s.file_id = ? ORDER BY f.shard_id, f.fragment_number`, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shard fragments: %w", err)
+	}
+	defer fragRows.Close()
+	for fragRows.Next() {
+		f := &model.ReplicaFragment{}
+		var shardID int64
+		if err := fragRows.Scan(&f.ID, &shardID, &f.FragmentNumber, &f.FragmentsTotal, &f.Size, &f.NativeFragmentID); err != nil {
+			return nil, fmt.Errorf("failed to scan shard fragment: %w", err)
+		}
+		if s, ok := byID[shardID]; ok {
+			s.Fragments = append(s.Fragments, f)
+		}
+	}
+	if err := fragRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate shard fragments: %w", err)
+	}
+	return shards, nil
+}
+
+// GetShardedFileIDs returns the IDs of the active erasure-coded files.
+func (db *DB) GetShardedFileIDs() ([]string, error) {
+	rows, err := db.query(`
+		SELECT DISTINCT s.file_id FROM file_shards s JOIN files f ON f.id = s.file_id
+		WHERE f.status = 'active' ORDER BY s.file_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sharded files: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan sharded file: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
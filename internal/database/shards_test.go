@@ -0,0 +1,71 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+func TestFileShards(t *testing.T) {
+	db := openTestDB(t, "file_shards.db")
+	defer db.Close()
+
+	file := &model.File{ID: "file-1", Path: "/archive.bin", Name: "archive.bin", Size: 100, ModTime: time.Unix(1000, 0), Status: "active"}
+	if err := db.InsertFile(file); err != nil {
+		t.Fatalf("InsertFile: %v", err)
+	}
+	if shards, err := db.GetFileShards(file.ID); err != nil || shards != nil {
+		t.Fatalf("expected no shards, got %v (%v)", shards, err)
+	}
+
+	shards := []*model.Shard{
+		{ShardIndex: 0, DataShards: 2, ParityShards: 1, Size: 50, SHA256: "a", Provider: model.ProviderGoogle, AccountID: "g@example.com", NativeID: "g1", Status: "active"},
+		{ShardIndex: 1, DataShards: 2, ParityShards: 1, Size: 50, SHA256: "b", Provider: model.ProviderMicrosoft, AccountID: "m@example.com", NativeID: "m1", Status: "active"},
+		{ShardIndex: 2, DataShards: 2, ParityShards: 1, Size: 50, SHA256: "c", Provider: model.ProviderTelegram, AccountID: "+100", Fragmented: true, Status: "active",
+			Fragments: []*model.ReplicaFragment{
+				{FragmentNumber: 1, FragmentsTotal: 2, Size: 25, NativeFragmentID: "t1"},
+				{FragmentNumber: 2, FragmentsTotal: 2, Size: 25, NativeFragmentID: "t2"},
+			}},
+	}
+	if err := db.ReplaceFileShards(file.ID, shards); err != nil {
+		t.Fatalf("ReplaceFileShards: %v", err)
+	}
+
+	got, err := db.GetFileShards(file.ID)
+	if err != nil {
+		t.Fatalf("GetFileShards: %v", err)
+	}
+	if len(got) != 3 || got[2].Provider != model.ProviderTelegram || len(got[2].Fragments) != 2 || got[2].Fragments[1].NativeFragmentID != "t2" {
+		t.Fatalf("unexpected shards: %+v", got)
+	}
+
+	got[1].Provider, got[1].AccountID, got[1].NativeID, got[1].Status = model.ProviderGoogle, "g2@example.com", "g2", "active"
+	if err := db.UpdateFileShard(got[1]); err != nil {
+		t.Fatalf("UpdateFileShard: %v", err)
+	}
+	got[2].Status = "missing"
+	got[2].Fragments = nil
+	if err := db.UpdateFileShard(got[2]); err != nil {
+		t.Fatalf("UpdateFileShard: %v", err)
+	}
+	got, err = db.GetFileShards(file.ID)
+	if err != nil {
+		t.Fatalf("GetFileShards: %v", err)
+	}
+	if got[1].AccountID != "g2@example.com" || got[2].Status != "missing" || len(got[2].Fragments) != 0 {
+		t.Fatalf("expected the updated shards, got %+v and %+v", got[1], got[2])
+	}
+
+	ids, err := db.GetShardedFileIDs()
+	if err != nil || len(ids) != 1 || ids[0] != file.ID {
+		t.Fatalf("expected the sharded file, got %v (%v)", ids, err)
+	}
+
+	if err := db.ReplaceFileShards(file.ID, nil); err != nil {
+		t.Fatalf("ReplaceFileShards: %v", err)
+	}
+	if ids, err := db.GetShardedFileIDs(); err != nil || len(ids) != 0 {
+		t.Fatalf("expected no sharded files, got %v (%v)", ids, err)
+	}
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// UpsertAccountShare records the latest known sharing state from one account to another
+func (db *DB) UpsertAccountShare(share *model.AccountShare) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		stmt, err := db.txStmt(tx, `
+			INSERT INTO account_shares (provider, source_account, target_account, status, error, checked_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(provider, source_account, target_account) DO UPDATE SET
+				status = excluded.status,
+				error = excluded.error,
+				checked_at = excluded.checked_at`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+		if _, err := stmt.Exec(string(share.Provider), share.SourceAccount, share.TargetAccount, share.Status, share.Error, share.CheckedAt.Unix()); err != nil {
+			return fmt.Errorf("failed to upsert account share: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetAccountShares returns every recorded share between accounts of provider
+func (db *DB) GetAccountShares(provider model.Provider) ([]*model.AccountShare, error) {
+	rows, err := db.query(`
+		SELECT provider, source_account, target_account, status, error, checked_at
+		FROM account_shares WHERE provider = ?
+		ORDER BY source_account, target_account`, string(provider))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query account shares: %w", err)
+	}
+	defer rows.Close()
+
+	var shares []*model.AccountShare
+	for rows.Next() {
+		var share model.AccountShare
+		var checkedAt int64
+		if err := rows.Scan(&share.Provider, &share.SourceAccount, &share.TargetAccount, &share.Status, &share.Error, &checkedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan account share: %w", err)
+		}
+		share.CheckedAt = time.Unix(checkedAt, 0)
+		shares = append(shares, &share)
+	}
+	return shares, rows.Err()
+}
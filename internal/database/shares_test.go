@@ -0,0 +1,87 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+func TestUpsertAccountShare(t *testing.T) {
+	db := openTestDB(t, "account_shares.db")
+	defer db.Close()
+
+	share := &model.AccountShare{
+		Provider:      model.ProviderMicrosoft,
+		SourceAccount: "a@example.com",
+		TargetAccount: "b@example.com",
+		Status:        model.ShareStatusFailed,
+		Error:         "There was a problem sharing",
+		CheckedAt:     time.Unix(1000, 0),
+	}
+	if err := db.UpsertAccountShare(share); err != nil {
+		t.Fatalf("UpsertAccountShare: %v", err)
+	}
+	share.Status, share.Error, share.CheckedAt = model.ShareStatusOK, "", time.Unix(2000, 0)
+	if err := db.UpsertAccountShare(share); err != nil {
+		t.Fatalf("UpsertAccountShare: %v", err)
+	}
+
+	shares, err := db.GetAccountShares(model.ProviderMicrosoft)
+	if err != nil {
+		t.Fatalf("GetAccountShares: %v", err)
+	}
+	if len(shares) != 1 || shares[0].Status != model.ShareStatusOK || shares[0].Error != "" || shares[0].CheckedAt.Unix() != 2000 {
+		t.Fatalf("expected the latest share state, got %+v", shares)
+	}
+	if shares, err := db.GetAccountShares(model.ProviderGoogle); err != nil || len(shares) != 0 {
+		t.Fatalf("expected no Google shares, got %v (%v)", shares, err)
+	}
+}
+
+func TestAccountShareChangesMetadataHash(t *testing.T) {
+	db := openTestDB(t, "account_shares_hash.db")
+	defer db.Close()
+
+	hash := func() string {
+		t.Helper()
+		h, err := db.GetMetadataHash()
+		if err != nil {
+			t.Fatalf("GetMetadataHash: %v", err)
+		}
+		return h
+	}
+
+	before := hash()
+	share := &model.AccountShare{
+		Provider:      model.ProviderMicrosoft,
+		SourceAccount: "a@example.com",
+		TargetAccount: "b@example.com",
+		Status:        model.ShareStatusOK,
+		CheckedAt:     time.Unix(1000, 0),
+	}
+	if err := db.UpsertAccountShare(share); err != nil {
+		t.Fatalf("UpsertAccountShare: %v", err)
+	}
+	recorded := hash()
+	if recorded == before {
+		t.Fatal("expected recording a share to change the metadata hash")
+	}
+
+	// Re-checking without a change in state is bookkeeping only
+	share.CheckedAt = time.Unix(2000, 0)
+	if err := db.UpsertAccountShare(share); err != nil {
+		t.Fatalf("UpsertAccountShare: %v", err)
+	}
+	if hash() != recorded {
+		t.Fatal("expected an unchanged share state to keep the metadata hash")
+	}
+
+	share.Status, share.Error = model.ShareStatusFailed, "denied"
+	if err := db.UpsertAccountShare(share); err != nil {
+		t.Fatalf("UpsertAccountShare: %v", err)
+	}
+	if hash() == recorded {
+		t.Fatal("expected a changed share state to change the metadata hash")
+	}
+}
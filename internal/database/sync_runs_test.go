@@ -0,0 +1,106 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListSyncRunsNewestFirst(t *testing.T) {
+	db := openTestDB(t, "sync_runs.db")
+	defer db.Close()
+
+	first, err := db.CreateSyncRun(false)
+	if err != nil {
+		t.Fatalf("CreateSyncRun: %v", err)
+	}
+	if err := db.CompleteSyncRun(first); err != nil {
+		t.Fatalf("CompleteSyncRun: %v", err)
+	}
+	second, err := db.CreateSyncRun(true)
+	if err != nil {
+		t.Fatalf("CreateSyncRun: %v", err)
+	}
+	if err := db.MarkStepCompleted(second, 3); err != nil {
+		t.Fatalf("MarkStepCompleted: %v", err)
+	}
+
+	runs, err := db.ListSyncRuns(10)
+	if err != nil {
+		t.Fatalf("ListSyncRuns: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != second || runs[1].ID != first {
+		t.Fatalf("expected runs %d then %d, got %+v", second, first, runs)
+	}
+	if runs[0].CompletedAt != nil || runs[0].LastCompletedStep != 3 || !runs[0].SafeMode {
+		t.Fatalf("unexpected in-progress run: %+v", runs[0])
+	}
+	if runs[1].CompletedAt == nil {
+		t.Fatalf("expected first run to be completed: %+v", runs[1])
+	}
+
+	if runs, err := db.ListSyncRuns(1); err != nil || len(runs) != 1 {
+		t.Fatalf("expected limit to apply, got %d runs, %v", len(runs), err)
+	}
+}
+
+func TestSetSyncRunLogFile(t *testing.T) {
+	db := openTestDB(t, "sync_run_log.db")
+	defer db.Close()
+
+	id, err := db.CreateSyncRun(false)
+	if err != nil {
+		t.Fatalf("CreateSyncRun: %v", err)
+	}
+	if err := db.SetSyncRunLogFile(id, "/var/logs/sync-run-1.log"); err != nil {
+		t.Fatalf("SetSyncRunLogFile: %v", err)
+	}
+
+	run, err := db.GetIncompleteSyncRun()
+	if err != nil || run == nil {
+		t.Fatalf("GetIncompleteSyncRun: %v, %v", run, err)
+	}
+	if run.LogFile != "/var/logs/sync-run-1.log" {
+		t.Fatalf("expected log file to be recorded, got %q", run.LogFile)
+	}
+	runs, err := db.ListSyncRuns(-1)
+	if err != nil || len(runs) != 1 || runs[0].LogFile != run.LogFile {
+		t.Fatalf("expected ListSyncRuns to return the log file, got %+v (%v)", runs, err)
+	}
+}
+
+func TestAddSyncRunCopy(t *testing.T) {
+	db := openTestDB(t, "sync_run_copies.db")
+	defer db.Close()
+
+	id, err := db.CreateSyncRun(false)
+	if err != nil {
+		t.Fatalf("CreateSyncRun: %v", err)
+	}
+	copies := []struct {
+		serverSide bool
+		size       int64
+		elapsed    time.Duration
+	}{
+		{true, 1000, 2 * time.Second},
+		{true, 3000, time.Second},
+		{false, 500, 5 * time.Second},
+	}
+	for _, c := range copies {
+		if err := db.AddSyncRunCopy(id, c.serverSide, c.size, c.elapsed); err != nil {
+			t.Fatalf("AddSyncRunCopy: %v", err)
+		}
+	}
+
+	stats, err := db.GetSyncRunCopyStats(id)
+	if err != nil {
+		t.Fatalf("GetSyncRunCopyStats: %v", err)
+	}
+	if stats.ServerCopies != 2 || stats.ServerCopyBytes != 4000 || stats.ServerCopyMillis != 3000 ||
+		stats.StreamedCopies != 1 || stats.StreamedBytes != 500 || stats.StreamedMillis != 5000 {
+		t.Fatalf("unexpected copy stats %+v", stats)
+	}
+	runs, err := db.ListSyncRuns(1)
+	if err != nil || len(runs) != 1 || runs[0].CopyStats != stats {
+		t.Fatalf("expected ListSyncRuns to return the copy stats, got %+v (%v)", runs, err)
+	}
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// RecordPendingTransfer records an ownership transfer awaiting acceptance. Recording the same file
+// again, e.g. re-requested for another target account, keeps the original requested_at so the
+// transfer still expires on schedule.
+func (db *DB) RecordPendingTransfer(transfer *model.PendingTransfer) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		stmt, err := db.txStmt(tx, `
+			INSERT INTO pending_transfers (provider, native_id, file_id, source_account, target_account, requested_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(provider, native_id) DO UPDATE SET
+				file_id = excluded.file_id,
+				source_account = excluded.source_account,
+				target_account = excluded.target_account`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+		if _, err := stmt.Exec(string(transfer.Provider), transfer.NativeID, transfer.FileID, transfer.SourceAccount, transfer.TargetAccount, transfer.RequestedAt.Unix()); err != nil {
+			return fmt.Errorf("failed to record pending transfer: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetPendingTransfer returns the pending ownership transfer of a file, or nil if there is none
+func (db *DB) GetPendingTransfer(provider model.Provider, nativeID string) (*model.PendingTransfer, error) {
+	row := db.queryRow(`
+		SELECT provider, native_id, file_id, source_account, target_account, requested_at
+		FROM pending_transfers WHERE provider = ? AND native_id = ?`, string(provider), nativeID)
+	var transfer model.PendingTransfer
+	var requestedAt int64
+	if err := row.Scan(&transfer.Provider, &transfer.NativeID, &transfer.FileID, &transfer.SourceAccount, &transfer.TargetAccount, &requestedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get pending transfer: %w", err)
+	}
+	transfer.RequestedAt = time.Unix(requestedAt, 0)
+	return &transfer, nil
+}
+
+// DeletePendingTransfer forgets the pending ownership transfer of a file once it was accepted or
+// replaced by a copy
+func (db *DB) DeletePendingTransfer(provider model.Provider, nativeID string) error {
+	return db.WithTx(func(tx *sql.Tx) error {
+		stmt, err := db.txStmt(tx, `DELETE FROM pending_transfers WHERE provider = ? AND native_id = ?`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+		if _, err := stmt.Exec(string(provider), nativeID); err != nil {
+			return fmt.Errorf("failed to delete pending transfer: %w", err)
+		}
+		return nil
+	})
+}
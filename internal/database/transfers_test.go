@@ -0,0 +1,86 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+func TestPendingTransfers(t *testing.T) {
+	db := openTestDB(t, "pending_transfers.db")
+	defer db.Close()
+
+	if transfer, err := db.GetPendingTransfer(model.ProviderGoogle, "native-1"); err != nil || transfer != nil {
+		t.Fatalf("expected no pending transfer, got %+v (%v)", transfer, err)
+	}
+
+	transfer := &model.PendingTransfer{
+		Provider:      model.ProviderGoogle,
+		NativeID:      "native-1",
+		FileID:        "file-1",
+		SourceAccount: "main@example.com",
+		TargetAccount: "a@example.com",
+		RequestedAt:   time.Unix(1000, 0),
+	}
+	if err := db.RecordPendingTransfer(transfer); err != nil {
+		t.Fatalf("RecordPendingTransfer: %v", err)
+	}
+	transfer.TargetAccount, transfer.RequestedAt = "b@example.com", time.Unix(2000, 0)
+	if err := db.RecordPendingTransfer(transfer); err != nil {
+		t.Fatalf("RecordPendingTransfer: %v", err)
+	}
+
+	got, err := db.GetPendingTransfer(model.ProviderGoogle, "native-1")
+	if err != nil {
+		t.Fatalf("GetPendingTransfer: %v", err)
+	}
+	if got == nil || got.TargetAccount != "b@example.com" || got.FileID != "file-1" || got.RequestedAt.Unix() != 1000 {
+		t.Fatalf("expected the new target with the original request time, got %+v", got)
+	}
+
+	if err := db.DeletePendingTransfer(model.ProviderGoogle, "native-1"); err != nil {
+		t.Fatalf("DeletePendingTransfer: %v", err)
+	}
+	if got, err := db.GetPendingTransfer(model.ProviderGoogle, "native-1"); err != nil || got != nil {
+		t.Fatalf("expected the pending transfer to be gone, got %+v (%v)", got, err)
+	}
+}
+
+func TestPendingTransferChangesMetadataHash(t *testing.T) {
+	db := openTestDB(t, "pending_transfers_hash.db")
+	defer db.Close()
+
+	hash := func() string {
+		t.Helper()
+		h, err := db.GetMetadataHash()
+		if err != nil {
+			t.Fatalf("GetMetadataHash: %v", err)
+		}
+		return h
+	}
+
+	before := hash()
+	transfer := &model.PendingTransfer{
+		Provider:      model.ProviderGoogle,
+		NativeID:      "native-1",
+		FileID:        "file-1",
+		SourceAccount: "main@example.com",
+		TargetAccount: "a@example.com",
+		RequestedAt:   time.Unix(1000, 0),
+	}
+	if err := db.RecordPendingTransfer(transfer); err != nil {
+		t.Fatalf("RecordPendingTransfer: %v", err)
+	}
+	recorded := hash()
+	if recorded == before {
+		t.Fatal("expected recording a pending transfer to change the metadata hash")
+	}
+
+	if err := db.DeletePendingTransfer(model.ProviderGoogle, "native-1"); err != nil {
+		t.Fatalf("DeletePendingTransfer: %v", err)
+	}
+	if hash() == recorded {
+		t.Fatal("expected clearing a pending transfer to change the metadata hash")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"path"
 	"strings"
 	"sync"
@@ -15,6 +16,7 @@ import (
 	"github.com/FranLegon/cloud-drives-sync/internal/api"
 	"github.com/FranLegon/cloud-drives-sync/internal/auth"
 	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/metrics"
 	"github.com/FranLegon/cloud-drives-sync/internal/model"
 	drivefs "github.com/rclone/rclone/backend/drive"
 	"github.com/rclone/rclone/fs"
@@ -394,6 +396,7 @@ func (c *Client) ListFolders(parentID string) ([]*model.Folder, error) {
 // path (relative to the sync folder) is known, falling back to the direct
 // Drive API by ID otherwise.
 func (c *Client) DownloadFile(fileID string, writer io.Writer) error {
+	writer = metrics.CountingWriter(writer, string(model.ProviderGoogle), c.user.Email)
 	ctx := context.Background()
 
 	if f, err := c.ensureFs(ctx); err == nil {
@@ -426,10 +429,50 @@ func (c *Client) DownloadFile(fileID string, writer io.Writer) error {
 	return err
 }
 
+// DownloadFileRange writes length bytes of a file starting at offset (to the end when length is
+// negative), using the same rclone-then-API order as DownloadFile.
+func (c *Client) DownloadFileRange(fileID string, offset, length int64, writer io.Writer) error {
+	writer = metrics.CountingWriter(writer, string(model.ProviderGoogle), c.user.Email)
+	ctx := context.Background()
+
+	end := int64(-1)
+	if length >= 0 {
+		end = offset + length - 1
+	}
+	if f, err := c.ensureFs(ctx); err == nil {
+		if p, ok := c.getPath(fileID); ok {
+			if obj, oerr := f.NewObject(ctx, p); oerr == nil {
+				reader, rerr := obj.Open(ctx, &fs.RangeOption{Start: offset, End: end})
+				if rerr == nil {
+					defer reader.Close()
+					_, cerr := io.Copy(writer, reader)
+					return cerr
+				}
+			}
+		}
+	}
+
+	call := c.service.Files.Get(fileID)
+	call.Header().Set("Range", api.RangeHeader(offset, length))
+	resp, err := call.Download()
+	if err != nil {
+		return fmt.Errorf("failed to download file range: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusPartialContent {
+		_, err = io.Copy(writer, resp.Body)
+		return err
+	}
+	// The range was ignored and the whole file is being sent.
+	return api.CopyRange(writer, resp.Body, offset, length)
+}
+
 // UploadFile uploads a file. When the destination folder's path is known and
 // the rclone backend is available, the upload is streamed through rclone;
 // otherwise it falls back to the direct Drive API.
 func (c *Client) UploadFile(folderID, name string, reader io.Reader, size int64) (*model.File, error) {
+	reader = metrics.CountingReader(reader, string(model.ProviderGoogle), c.user.Email)
 	ctx := context.Background()
 
 	if f, err := c.ensureFs(ctx); err == nil {
@@ -533,8 +576,58 @@ func (c *Client) UploadFile(folderID, name string, reader io.Reader, size int64)
 	return result, nil
 }
 
+// CopyFrom copies a file another Google account holds with files.copy. The file must be visible
+// to this account, as everything under the shared sync folder is; the copy is owned by this
+// account and counts against its quota.
+func (c *Client) CopyFrom(source api.CloudClient, replica *model.Replica, folderID, name string) (*model.File, error) {
+	if _, ok := api.Unwrap(source).(*Client); !ok {
+		return nil, api.ErrServerCopyUnsupported
+	}
+
+	copied, err := c.service.Files.Copy(replica.NativeID, &drive.File{
+		Name:    name,
+		Parents: []string{folderID},
+	}).Fields("id, name, size, md5Checksum, modifiedTime, owners").Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	modTime := parseTime(copied.ModifiedTime)
+	owner := c.user.Email
+	if len(copied.Owners) > 0 {
+		owner = copied.Owners[0].EmailAddress
+	}
+
+	result := &model.File{
+		ID:             copied.Id, // Will be replaced with UUID in database layer
+		Name:           copied.Name,
+		Size:           copied.Size,
+		GoogleDriveMD5: copied.Md5Checksum,
+		ModTime:        modTime,
+		Status:         "active",
+		Replicas: []*model.Replica{{
+			Name:       copied.Name,
+			Size:       copied.Size,
+			Provider:   model.ProviderGoogle,
+			AccountID:  c.user.Email,
+			NativeID:   copied.Id,
+			NativeHash: copied.Md5Checksum,
+			ModTime:    modTime,
+			Status:     "active",
+			Owner:      owner,
+		}},
+	}
+
+	if parentPath, ok := c.getPath(folderID); ok {
+		c.setPath(copied.Id, joinPath(parentPath, copied.Name))
+	}
+
+	return result, nil
+}
+
 // UpdateFile updates file content
 func (c *Client) UpdateFile(fileID string, reader io.Reader, size int64) error {
+	reader = metrics.CountingReader(reader, string(model.ProviderGoogle), c.user.Email)
 	_, err := c.service.Files.Update(fileID, nil).Media(reader).Do()
 	if err != nil {
 		return fmt.Errorf("failed to update file content: %w", err)
@@ -587,6 +680,15 @@ func (c *Client) MoveFile(fileID, targetFolderID string) error {
 	return err
 }
 
+// RenameFile renames a file or folder in place.
+func (c *Client) RenameFile(fileID, newName string) error {
+	_, err := c.service.Files.Update(fileID, &drive.File{Name: newName}).SupportsAllDrives(true).Do()
+	if err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	return nil
+}
+
 // CreateFolder creates a new folder
 func (c *Client) CreateFolder(parentID, name string) (*model.Folder, error) {
 	folder := &drive.File{
@@ -1,34 +1,89 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type LogLevel int
 
 const (
-	LogLevelInfo LogLevel = iota
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
 	LogLevelWarning
 	LogLevelError
 )
 
+// Format selects how log lines are written.
+type Format int
+
+const (
+	// FormatText writes free-form lines such as "WARNING: [Google][a@b.com] message".
+	FormatText Format = iota
+	// FormatJSON writes one JSON object per line with the level, message and fields.
+	FormatJSON
+)
+
 var (
 	infoLogger    *log.Logger
 	warningLogger *log.Logger
 	errorLogger   *log.Logger
+	infoOut       = &teeWriter{w: os.Stdout}
+	warningOut    = &teeWriter{w: os.Stdout}
+	errorOut      = &teeWriter{w: os.Stderr}
 	currentLevel  = LogLevelInfo
+	currentFormat = FormatText
+	fields        = make(map[string]any) // guarded by mu
 	mu            sync.RWMutex
+
+	sinks   = make(map[*io.Writer]struct{})
+	sinksMu sync.RWMutex
+
+	traceIDFunc func() string // guarded by mu
 )
 
 func init() {
-	infoLogger = log.New(os.Stdout, "", 0)
-	warningLogger = log.New(os.Stdout, "", 0)
-	errorLogger = log.New(os.Stderr, "", 0)
+	infoLogger = log.New(infoOut, "", 0)
+	warningLogger = log.New(warningOut, "", 0)
+	errorLogger = log.New(errorOut, "", 0)
+}
+
+// teeWriter writes log lines to the configured output and to every sink.
+type teeWriter struct {
+	w io.Writer // guarded by mu
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	sinksMu.RLock()
+	for s := range sinks {
+		(*s).Write(p)
+	}
+	sinksMu.RUnlock()
+	return n, err
+}
+
+// AddSink copies every log line, whatever its level's output, to w until the returned
+// function is called. w must not block.
+func AddSink(w io.Writer) (remove func()) {
+	key := &w
+	sinksMu.Lock()
+	sinks[key] = struct{}{}
+	sinksMu.Unlock()
+	return func() {
+		sinksMu.Lock()
+		delete(sinks, key)
+		sinksMu.Unlock()
+	}
 }
 
 // SetLevel sets the minimum log level to display
@@ -38,15 +93,75 @@ func SetLevel(level LogLevel) {
 	mu.Unlock()
 }
 
+// ParseLevel parses a level name: debug, info, warning (or warn) or error.
+func ParseLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LogLevelDebug, nil
+	case "info":
+		return LogLevelInfo, nil
+	case "warning", "warn":
+		return LogLevelWarning, nil
+	case "error":
+		return LogLevelError, nil
+	}
+	return LogLevelInfo, fmt.Errorf("unknown log level %q (want debug, info, warning or error)", s)
+}
+
+// SetFormat sets how log lines are written
+func SetFormat(f Format) {
+	mu.Lock()
+	currentFormat = f
+	mu.Unlock()
+}
+
+// ParseFormat parses a format name: text or json.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return FormatText, fmt.Errorf("unknown log format %q (want text or json)", s)
+}
+
+// SetField adds a field to every JSON log line until it is set to nil, e.g. the ID of the
+// running sync.
+func SetField(key string, value any) {
+	mu.Lock()
+	if value == nil {
+		delete(fields, key)
+	} else {
+		fields[key] = value
+	}
+	mu.Unlock()
+}
+
 // SetOutput sets the output destination for the loggers
 func SetOutput(w io.Writer) {
 	mu.Lock()
-	infoLogger.SetOutput(w)
-	warningLogger.SetOutput(w)
-	errorLogger.SetOutput(w)
+	infoOut.w = w
+	warningOut.w = w
+	errorOut.w = w
+	mu.Unlock()
+}
+
+// SetTraceIDFunc starts every log line with the trace ID returned by f, when it returns one.
+func SetTraceIDFunc(f func() string) {
+	mu.Lock()
+	traceIDFunc = f
 	mu.Unlock()
 }
 
+// traceID returns the current trace ID, if any. Callers hold mu.
+func traceID() string {
+	if traceIDFunc == nil {
+		return ""
+	}
+	return traceIDFunc()
+}
+
 func formatTags(tags []string) string {
 	if len(tags) > 0 {
 		return fmt.Sprintf("[%s] ", strings.Join(tags, "]["))
@@ -54,12 +169,117 @@ func formatTags(tags []string) string {
 	return ""
 }
 
+// messageFieldRe matches the key=value pairs messages carry, e.g. path="/a b" native_id=123.
+var messageFieldRe = regexp.MustCompile(`(?:^|\s)([a-z][a-z0-9_]*)=("(?:[^"\\]|\\.)*"|[^\s,;]+)`)
+
+// reservedKeys cannot be overridden by fields parsed from a message.
+var reservedKeys = map[string]bool{"time": true, "level": true, "msg": true, "dry_run": true}
+
+// logLine writes one line at level. Callers hold mu.
+func logLine(l *log.Logger, level string, prefix string, dryRun bool, tags []string, format string, v []interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	if currentFormat == FormatText {
+		if id := traceID(); id != "" {
+			prefix += "[trace_id=" + id + "] "
+		}
+		l.Print(prefix + formatTags(tags) + msg)
+		return
+	}
+	l.Print(jsonLine(level, dryRun, tags, msg))
+}
+
+// jsonLine renders a JSON log line: time, level and msg first, then the fields in key order.
+// The first tag is the provider and the second the account, as in model.User.LogTags; fields
+// are also parsed from key=value pairs in the message. Callers hold mu.
+func jsonLine(level string, dryRun bool, tags []string, msg string) string {
+	extra := make(map[string]any, len(fields)+4)
+	for k, v := range fields {
+		extra[k] = v
+	}
+	if id := traceID(); id != "" {
+		extra["trace_id"] = id
+	}
+	if dryRun {
+		extra["dry_run"] = true
+	}
+	if len(tags) > 0 {
+		extra["provider"] = tags[0]
+	}
+	if len(tags) > 1 {
+		extra["account"] = tags[1]
+	}
+	if len(tags) > 2 {
+		extra["tags"] = tags[2:]
+	}
+	for _, m := range messageFieldRe.FindAllStringSubmatch(msg, -1) {
+		key, value := m[1], m[2]
+		if reservedKeys[key] {
+			continue
+		}
+		if _, ok := extra[key]; ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		extra[key] = value
+	}
+
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(`{"time":`)
+	writeJSONValue(&b, time.Now().UTC().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJSONValue(&b, level)
+	b.WriteString(`,"msg":`)
+	writeJSONValue(&b, msg)
+	for _, k := range keys {
+		b.WriteByte(',')
+		writeJSONValue(&b, k)
+		b.WriteByte(':')
+		writeJSONValue(&b, extra[k])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func writeJSONValue(b *strings.Builder, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
+
+// Debug logs a diagnostic message, shown only at the debug level
+func Debug(format string, v ...interface{}) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if currentLevel <= LogLevelDebug {
+		logLine(infoLogger, "debug", "DEBUG: ", false, nil, format, v)
+	}
+}
+
+// DebugTagged logs a diagnostic message with tags
+func DebugTagged(tags []string, format string, v ...interface{}) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if currentLevel <= LogLevelDebug {
+		logLine(infoLogger, "debug", "DEBUG: ", false, tags, format, v)
+	}
+}
+
 // Info logs an informational message
 func Info(format string, v ...interface{}) {
 	mu.RLock()
 	defer mu.RUnlock()
 	if currentLevel <= LogLevelInfo {
-		infoLogger.Printf(format, v...)
+		logLine(infoLogger, "info", "", false, nil, format, v)
 	}
 }
 
@@ -68,7 +288,7 @@ func InfoTagged(tags []string, format string, v ...interface{}) {
 	mu.RLock()
 	defer mu.RUnlock()
 	if currentLevel <= LogLevelInfo {
-		infoLogger.Printf(formatTags(tags)+format, v...)
+		logLine(infoLogger, "info", "", false, tags, format, v)
 	}
 }
 
@@ -77,7 +297,7 @@ func Warning(format string, v ...interface{}) {
 	mu.RLock()
 	defer mu.RUnlock()
 	if currentLevel <= LogLevelWarning {
-		warningLogger.Printf("WARNING: "+format, v...)
+		logLine(warningLogger, "warning", "WARNING: ", false, nil, format, v)
 	}
 }
 
@@ -86,7 +306,7 @@ func WarningTagged(tags []string, format string, v ...interface{}) {
 	mu.RLock()
 	defer mu.RUnlock()
 	if currentLevel <= LogLevelWarning {
-		warningLogger.Printf("WARNING: "+formatTags(tags)+format, v...)
+		logLine(warningLogger, "warning", "WARNING: ", false, tags, format, v)
 	}
 }
 
@@ -95,7 +315,7 @@ func Error(format string, v ...interface{}) {
 	mu.RLock()
 	defer mu.RUnlock()
 	if currentLevel <= LogLevelError {
-		errorLogger.Printf("ERROR: "+format, v...)
+		logLine(errorLogger, "error", "ERROR: ", false, nil, format, v)
 	}
 }
 
@@ -104,7 +324,7 @@ func ErrorTagged(tags []string, format string, v ...interface{}) {
 	mu.RLock()
 	defer mu.RUnlock()
 	if currentLevel <= LogLevelError {
-		errorLogger.Printf("ERROR: "+formatTags(tags)+format, v...)
+		logLine(errorLogger, "error", "ERROR: ", false, tags, format, v)
 	}
 }
 
@@ -112,12 +332,12 @@ func ErrorTagged(tags []string, format string, v ...interface{}) {
 func DryRun(format string, v ...interface{}) {
 	mu.RLock()
 	defer mu.RUnlock()
-	infoLogger.Printf("[DRY RUN] "+format, v...)
+	logLine(infoLogger, "info", "[DRY RUN] ", true, nil, format, v)
 }
 
 // DryRunTagged logs a dry run action with tags
 func DryRunTagged(tags []string, format string, v ...interface{}) {
 	mu.RLock()
 	defer mu.RUnlock()
-	infoLogger.Printf("[DRY RUN] "+formatTags(tags)+format, v...)
+	logLine(infoLogger, "info", "[DRY RUN] ", true, tags, format, v)
 }
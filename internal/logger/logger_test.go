@@ -2,8 +2,10 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -64,6 +66,119 @@ func TestLogLevel(t *testing.T) {
 	SetLevel(LogLevelInfo)
 }
 
+func TestAddSink(t *testing.T) {
+	var out, sink bytes.Buffer
+	prevInfo, prevWarning, prevError := infoOut.w, warningOut.w, errorOut.w
+	defer func() { infoOut.w, warningOut.w, errorOut.w = prevInfo, prevWarning, prevError }()
+	warningLogger = log.New(warningOut, "", 0)
+	SetOutput(&out)
+
+	remove := AddSink(&sink)
+	Warning("copied")
+	remove()
+	Warning("not copied")
+
+	if !strings.Contains(out.String(), "copied") || !strings.Contains(out.String(), "not copied") {
+		t.Errorf("Expected output to receive every line, got: %s", out.String())
+	}
+	if sink.String() != "WARNING: copied\n" {
+		t.Errorf("Expected sink to receive only the line logged while attached, got: %q", sink.String())
+	}
+}
+
+func TestTraceIDPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	errorLogger = log.New(&buf, "", 0)
+	SetTraceIDFunc(func() string { return "4bf92f3577b34da6a3ce929d0e0e4736" })
+	defer SetTraceIDFunc(nil)
+
+	Error("failed")
+	if buf.String() != "ERROR: [trace_id=4bf92f3577b34da6a3ce929d0e0e4736] failed\n" {
+		t.Errorf("Expected trace ID prefix, got: %q", buf.String())
+	}
+}
+
+func TestDebugLevel(t *testing.T) {
+	var buf bytes.Buffer
+	infoLogger = log.New(&buf, "", 0)
+
+	Debug("hidden")
+	if buf.Len() > 0 {
+		t.Errorf("Debug logged at the info level: %q", buf.String())
+	}
+
+	SetLevel(LogLevelDebug)
+	defer SetLevel(LogLevelInfo)
+	DebugTagged([]string{"Google"}, "shown")
+	if buf.String() != "DEBUG: [Google] shown\n" {
+		t.Errorf("Expected debug line, got: %q", buf.String())
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	warningLogger = log.New(&buf, "", 0)
+	SetFormat(FormatJSON)
+	defer SetFormat(FormatText)
+	SetField("sync_run_id", int64(7))
+	defer SetField("sync_run_id", nil)
+
+	WarningTagged([]string{"Microsoft", "a@example.com"}, `Failed to upload: path="/docs/a b.txt" size=12 level=x`)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"level":       "warning",
+		"msg":         `Failed to upload: path="/docs/a b.txt" size=12 level=x`,
+		"provider":    "Microsoft",
+		"account":     "a@example.com",
+		"path":        "/docs/a b.txt",
+		"size":        "12",
+		"sync_run_id": float64(7),
+	}
+	for k, v := range want {
+		if line[k] != v {
+			t.Errorf("Expected %s=%v, got %v", k, v, line[k])
+		}
+	}
+	if _, ok := line["time"]; !ok {
+		t.Error("Expected a time field")
+	}
+	if !strings.HasPrefix(buf.String(), `{"time":`) {
+		t.Errorf("Expected time to come first, got: %s", buf.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "run.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile: %v", err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	for name, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("ReadFile(%s): %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("Expected %s to hold %q, got %q", filepath.Base(name), want, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected at most 2 backups, got %s.3 (err=%v)", path, err)
+	}
+}
+
 func TestMain(m *testing.M) {
 	// Setup: redirect loggers for testing
 	code := m.Run()
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	filesDesc    = prometheus.NewDesc(namespace+"_files", "Logical files in the pool, by status.", []string{"status"}, nil)
+	lastSyncDesc = prometheus.NewDesc(namespace+"_last_successful_sync_timestamp_seconds",
+		"Unix time at which the last sync that was not a dry run completed.", nil, nil)
+)
+
+// dbCollector reads its metrics from the metadata database at scrape time, so they also reflect
+// runs made by other hosts.
+type dbCollector struct {
+	mu sync.Mutex
+	db *database.DB
+}
+
+var dbMetrics = &dbCollector{}
+
+func init() {
+	Registry.MustRegister(dbMetrics)
+}
+
+// SetDB sets the metadata database the file and sync run metrics are read from; nil disables
+// them.
+func SetDB(db *database.DB) {
+	dbMetrics.mu.Lock()
+	dbMetrics.db = db
+	dbMetrics.mu.Unlock()
+}
+
+func (c *dbCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- filesDesc
+	ch <- lastSyncDesc
+}
+
+func (c *dbCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		return
+	}
+	if counts, err := c.db.CountFilesByStatus(); err == nil {
+		for status, n := range counts {
+			ch <- prometheus.MustNewConstMetric(filesDesc, prometheus.GaugeValue, float64(n), status)
+		}
+	} else {
+		ch <- prometheus.NewInvalidMetric(filesDesc, err)
+	}
+	if t, err := c.db.GetLastSuccessfulSyncTime(); err == nil {
+		if !t.IsZero() {
+			ch <- prometheus.MustNewConstMetric(lastSyncDesc, prometheus.GaugeValue, float64(t.Unix()))
+		}
+	} else {
+		ch <- prometheus.NewInvalidMetric(lastSyncDesc, err)
+	}
+}
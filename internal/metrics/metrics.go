@@ -0,0 +1,170 @@
+// Package metrics holds the Prometheus metrics of the tool and serves them on /metrics.
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cloud_drives_sync"
+
+// Registry holds every metric of the tool, plus the Go runtime and process collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	transferredBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transferred_bytes_total",
+		Help:      "File content bytes uploaded to or downloaded from each account.",
+	}, []string{"provider", "account", "direction"})
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests sent through the retrying transport, by host and status code, including retries.",
+	}, []string{"host", "code"})
+
+	apiCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_calls_total",
+		Help:      "Provider operations run with retry, by final result.",
+	}, []string{"result"})
+
+	apiRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_retries_total",
+		Help:      "Retried provider operations, by reason.",
+	}, []string{"reason"})
+
+	rateLimitWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_wait_seconds",
+		Help:      "Time spent waiting on Telegram FLOOD_WAIT errors and HTTP Retry-After headers.",
+		Buckets:   []float64{1, 2, 5, 10, 30, 60, 120},
+	}, []string{"kind"})
+
+	quotaTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "quota_total_bytes",
+		Help:      "Storage capacity of each account; 0 when unlimited.",
+	}, []string{"provider", "account"})
+
+	quotaUsed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "quota_used_bytes",
+		Help:      "Storage used by each account, as last reported or estimated after uploads.",
+	}, []string{"provider", "account"})
+
+	quotaFree = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "quota_free_bytes",
+		Help:      "Storage left on each account with a limited quota.",
+	}, []string{"provider", "account"})
+
+	syncStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sync_step_duration_seconds",
+		Help:      "Duration of each step of the sync pipeline.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 9), // 1s to ~18h
+	}, []string{"step", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		transferredBytes, httpRequests, apiCalls, apiRetries, rateLimitWait,
+		quotaTotal, quotaUsed, quotaFree, syncStepDuration,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveHTTPRequest counts one HTTP attempt; code is the status code, or "error" when the
+// request failed without a response.
+func ObserveHTTPRequest(host, code string) {
+	httpRequests.WithLabelValues(host, code).Inc()
+}
+
+// ObserveAPICall counts one operation run with retry.
+func ObserveAPICall(err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	apiCalls.WithLabelValues(result).Inc()
+}
+
+// ObserveRetry counts one retry of an operation.
+func ObserveRetry(reason string) {
+	apiRetries.WithLabelValues(reason).Inc()
+}
+
+// ObserveRateLimitWait records a wait imposed by the provider; kind is "flood_wait" or
+// "retry_after".
+func ObserveRateLimitWait(kind string, d time.Duration) {
+	rateLimitWait.WithLabelValues(kind).Observe(d.Seconds())
+}
+
+// SetQuota records the quota of an account. A total of 0 or less means unlimited, in which case
+// the free gauge is not set.
+func SetQuota(provider, account string, total, used int64) {
+	if total < 0 {
+		total = 0
+	}
+	quotaTotal.WithLabelValues(provider, account).Set(float64(total))
+	quotaUsed.WithLabelValues(provider, account).Set(float64(used))
+	if total > 0 {
+		quotaFree.WithLabelValues(provider, account).Set(float64(total - used))
+	}
+}
+
+// ObserveSyncStep records how long one step of the sync pipeline took.
+func ObserveSyncStep(step string, d time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	syncStepDuration.WithLabelValues(step, result).Observe(d.Seconds())
+}
+
+// CountingReader returns r wrapped to count the bytes read from it as uploaded to the account.
+func CountingReader(r io.Reader, provider, account string) io.Reader {
+	return &countingReader{r: r, c: transferredBytes.WithLabelValues(provider, account, "upload")}
+}
+
+// CountingWriter returns w wrapped to count the bytes written to it as downloaded from the
+// account.
+func CountingWriter(w io.Writer, provider, account string) io.Writer {
+	return &countingWriter{w: w, c: transferredBytes.WithLabelValues(provider, account, "download")}
+}
+
+type countingReader struct {
+	r io.Reader
+	c prometheus.Counter
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.c.Add(float64(n))
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	c prometheus.Counter
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.c.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/database"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCountingReaderAndWriter(t *testing.T) {
+	up := transferredBytes.WithLabelValues("Google", "counting@example.com", "upload")
+	down := transferredBytes.WithLabelValues("Google", "counting@example.com", "download")
+	before := testutil.ToFloat64(up)
+
+	if _, err := io.Copy(io.Discard, CountingReader(strings.NewReader("hello"), "Google", "counting@example.com")); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(CountingWriter(&buf, "Google", "counting@example.com"), strings.NewReader("abc")); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+
+	if got := testutil.ToFloat64(up) - before; got != 5 {
+		t.Fatalf("expected 5 uploaded bytes, got %v", got)
+	}
+	if got := testutil.ToFloat64(down); got != 3 {
+		t.Fatalf("expected 3 downloaded bytes, got %v", got)
+	}
+}
+
+func TestSetQuotaUnlimited(t *testing.T) {
+	SetQuota("Telegram", "+100", -1, 42)
+	if got := testutil.ToFloat64(quotaUsed.WithLabelValues("Telegram", "+100")); got != 42 {
+		t.Fatalf("expected used 42, got %v", got)
+	}
+	if n := testutil.CollectAndCount(quotaFree, namespace+"_quota_free_bytes"); n != 0 {
+		t.Fatalf("expected no free gauge for an unlimited account, got %d series", n)
+	}
+}
+
+func TestDBCollector(t *testing.T) {
+	db, err := database.OpenPath(filepath.Join(t.TempDir(), "metrics.db"), "metricsPass!23")
+	if err != nil {
+		t.Fatalf("OpenPath: %v", err)
+	}
+	defer db.Close()
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	for i, status := range []string{"active", "active", "soft-deleted"} {
+		f := &model.File{ID: string(rune('a' + i)), Path: "/f" + string(rune('a'+i)), Name: "f", ModTime: time.Now(), Status: status}
+		if err := db.InsertFile(f); err != nil {
+			t.Fatalf("InsertFile: %v", err)
+		}
+	}
+	run, err := db.CreateSyncRun(false)
+	if err != nil {
+		t.Fatalf("CreateSyncRun: %v", err)
+	}
+	if err := db.CompleteSyncRun(run); err != nil {
+		t.Fatalf("CompleteSyncRun: %v", err)
+	}
+
+	SetDB(db)
+	defer SetDB(nil)
+	expected := `
+# HELP cloud_drives_sync_files Logical files in the pool, by status.
+# TYPE cloud_drives_sync_files gauge
+cloud_drives_sync_files{status="active"} 2
+cloud_drives_sync_files{status="soft-deleted"} 1
+`
+	if err := testutil.CollectAndCompare(dbMetrics, strings.NewReader(expected), namespace+"_files"); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(dbMetrics, namespace+"_last_successful_sync_timestamp_seconds"); n != 1 {
+		t.Fatalf("expected the last successful sync timestamp, got %d series", n)
+	}
+}
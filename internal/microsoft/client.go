@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"path"
 	"regexp"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/FranLegon/cloud-drives-sync/internal/api"
 	"github.com/FranLegon/cloud-drives-sync/internal/auth"
 	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/metrics"
 	"github.com/FranLegon/cloud-drives-sync/internal/model"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
 	msgraphgocore "github.com/microsoftgraph/msgraph-sdk-go-core"
@@ -49,6 +51,17 @@ func GetSyncFolderName() string {
 	return syncFolderPrefix
 }
 
+// graphBaseURL is the Graph endpoint for the requests the SDK cannot make, such as an async copy
+// whose monitor URL is only returned in a response header.
+var graphBaseURL = "https://graph.microsoft.com/v1.0"
+
+// copyPollInterval is the longest wait between two polls of an async copy's monitor URL, and
+// copyTimeout how long a copy may run before it is abandoned.
+var (
+	copyPollInterval = 10 * time.Second
+	copyTimeout      = 30 * time.Minute
+)
+
 var fakeShortcutRegex = regexp.MustCompile(`^(.*)\.md5-([A-Fa-f0-9]{32})` + regexp.QuoteMeta(FakeShortcutExtension) + `$`)
 
 func parseFakeShortcutName(name string) (originalName string, googleDriveMD5 string, ok bool) {
@@ -86,6 +99,11 @@ type Client struct {
 	// path-based rclone operations can be bridged from the ID-based interface.
 	idToPath   map[string]string
 	idToPathMu sync.Mutex
+
+	// tenantID is the Entra ID tenant of a business account, resolved on first use by CopyFrom.
+	tenantID   string
+	tenantErr  error
+	tenantOnce sync.Once
 }
 
 // NewClient creates a new Microsoft OneDrive client
@@ -391,6 +409,7 @@ func (c *Client) ListFiles(folderID string) ([]*model.File, error) {
 // It uses the rclone backend when the file's path is known, falling back to the
 // direct Graph API by ID otherwise.
 func (c *Client) DownloadFile(fileID string, writer io.Writer) error {
+	writer = metrics.CountingWriter(writer, string(model.ProviderMicrosoft), c.user.Email)
 	ctx := context.Background()
 
 	if f, ferr := c.ensureFs(ctx); ferr == nil {
@@ -447,8 +466,75 @@ func (c *Client) DownloadFile(fileID string, writer io.Writer) error {
 	return nil
 }
 
+// DownloadFileRange writes length bytes of a file starting at offset (to the end when length is
+// negative), using the same rclone-then-API order as DownloadFile.
+func (c *Client) DownloadFileRange(fileID string, offset, length int64, writer io.Writer) error {
+	writer = metrics.CountingWriter(writer, string(model.ProviderMicrosoft), c.user.Email)
+	ctx := context.Background()
+
+	end := int64(-1)
+	if length >= 0 {
+		end = offset + length - 1
+	}
+	if f, ferr := c.ensureFs(ctx); ferr == nil {
+		if p, ok := c.getPath(fileID); ok {
+			if obj, oerr := f.NewObject(ctx, p); oerr == nil {
+				reader, rerr := obj.Open(ctx, &fs.RangeOption{Start: offset, End: end})
+				if rerr == nil {
+					defer reader.Close()
+					if _, cerr := io.Copy(writer, reader); cerr != nil {
+						return fmt.Errorf("failed to stream download to writer: %w", cerr)
+					}
+					return nil
+				}
+			}
+		}
+	}
+
+	item, err := c.graphClient.Drives().ByDriveId(c.driveID).Items().ByDriveItemId(fileID).Get(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("microsoft get item failed: %w", err)
+	}
+	downloadURL, ok := item.GetAdditionalData()["@microsoft.graph.downloadUrl"]
+	if !ok {
+		return fmt.Errorf("no download URL available for item %s", fileID)
+	}
+	urlStr, ok := downloadURL.(*string)
+	if !ok || urlStr == nil {
+		return fmt.Errorf("invalid download URL type for item %s", fileID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, *urlStr, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create download request: %w", err)
+	}
+	req.Header.Set("Range", api.RangeHeader(offset, length))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("microsoft download request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		_, err = io.Copy(writer, resp.Body)
+	case http.StatusOK:
+		// The range was ignored and the whole file is being sent.
+		err = api.CopyRange(writer, resp.Body, offset, length)
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("microsoft download returned status %d: %s", resp.StatusCode, string(body))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stream download to writer: %w", err)
+	}
+	return nil
+}
+
 // UploadFile uploads a file
 func (c *Client) UploadFile(folderID, name string, reader io.Reader, size int64) (*model.File, error) {
+	reader = metrics.CountingReader(reader, string(model.ProviderMicrosoft), c.user.Email)
 	ctx := context.Background()
 
 	if f, ferr := c.ensureFs(ctx); ferr == nil {
@@ -649,6 +735,7 @@ func (c *Client) UploadFile(folderID, name string, reader io.Reader, size int64)
 
 // UpdateFile updates file content
 func (c *Client) UpdateFile(fileID string, reader io.Reader, size int64) error {
+	reader = metrics.CountingReader(reader, string(model.ProviderMicrosoft), c.user.Email)
 	ctx := context.Background()
 
 	// Use Upload Session for updates
@@ -721,6 +808,172 @@ func (c *Client) MoveFile(fileID, targetFolderID string) error {
 	return err
 }
 
+// RenameFile renames a file or folder in place.
+func (c *Client) RenameFile(fileID, newName string) error {
+	ctx := context.Background()
+	requestBody := models.NewDriveItem()
+	requestBody.SetName(&newName)
+
+	if _, err := c.graphClient.Drives().ByDriveId(c.driveID).Items().ByDriveItemId(fileID).Patch(ctx, requestBody, nil); err != nil {
+		return fmt.Errorf("failed to rename item: %w", err)
+	}
+	return nil
+}
+
+// CopyFrom copies a file from another OneDrive for Business account of the same tenant with the
+// Graph copy action, which runs asynchronously on the server. The file must be visible to this
+// account, as sync folders shared between Microsoft accounts are. Personal OneDrive cannot copy
+// between drives.
+func (c *Client) CopyFrom(source api.CloudClient, replica *model.Replica, folderID, name string) (*model.File, error) {
+	src, ok := api.Unwrap(source).(*Client)
+	if !ok || c.driveType != "business" || src.driveType != "business" {
+		return nil, api.ErrServerCopyUnsupported
+	}
+	tenant, err := c.tenant()
+	if err != nil {
+		return nil, err
+	}
+	srcTenant, err := src.tenant()
+	if err != nil {
+		return nil, err
+	}
+	if tenant == "" || tenant != srcTenant {
+		return nil, api.ErrServerCopyUnsupported
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), copyTimeout)
+	defer cancel()
+	body, err := json.Marshal(map[string]any{
+		"parentReference": map[string]string{"driveId": c.driveID, "id": folderID},
+		"name":            name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal copy request: %w", err)
+	}
+	url := fmt.Sprintf("%s/drives/%s/items/%s/copy?@microsoft.graph.conflictBehavior=fail", graphBaseURL, src.driveID, replica.NativeID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create copy request: %w", err)
+	}
+	token, err := c.tokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("microsoft copy request failed: %w", err)
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, fmt.Errorf("microsoft copy returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	monitorURL := resp.Header.Get("Location")
+	if monitorURL == "" {
+		return nil, errors.New("microsoft copy returned no monitor URL")
+	}
+
+	itemID, err := c.waitForCopy(ctx, monitorURL)
+	if err != nil {
+		return nil, err
+	}
+	file, err := c.GetFileMetadata(itemID)
+	if err != nil {
+		return nil, err
+	}
+	file.Replicas[0].Owner = c.user.Email
+	if parentPath, ok := c.getPath(folderID); ok {
+		c.setPath(itemID, joinRemotePath(parentPath, file.Name))
+	}
+	return file, nil
+}
+
+// waitForCopy polls the monitor URL of an async copy until it completes and returns the ID of
+// the new item. The monitor URL is pre-authenticated, so no token is sent.
+func (c *Client) waitForCopy(ctx context.Context, monitorURL string) (string, error) {
+	httpClient := *c.httpClient
+	httpClient.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	wait := min(time.Second, copyPollInterval)
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, monitorURL, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to create copy monitor request: %w", err)
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("copy monitor request failed: %w", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		// A finished copy may redirect to the new item instead of reporting its ID.
+		if resp.StatusCode == http.StatusSeeOther {
+			location := strings.TrimRight(resp.Header.Get("Location"), "/")
+			if i := strings.LastIndex(location, "/items/"); i >= 0 {
+				return location[i+len("/items/"):], nil
+			}
+			return "", fmt.Errorf("copy monitor redirected to an unexpected location: %s", location)
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+			return "", fmt.Errorf("copy monitor returned status %d: %s", resp.StatusCode, string(body))
+		}
+
+		var status struct {
+			Status     string `json:"status"`
+			ResourceID string `json:"resourceId"`
+			Error      *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(body, &status); err != nil {
+			return "", fmt.Errorf("failed to decode copy status: %w", err)
+		}
+		switch status.Status {
+		case "completed":
+			if status.ResourceID == "" {
+				return "", errors.New("copy completed without a resource ID")
+			}
+			return status.ResourceID, nil
+		case "failed", "cancelled":
+			if status.Error != nil && status.Error.Message != "" {
+				return "", fmt.Errorf("copy %s: %s", status.Status, status.Error.Message)
+			}
+			return "", fmt.Errorf("copy %s", status.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > copyPollInterval {
+			wait = copyPollInterval
+		}
+	}
+}
+
+// tenant returns the Entra ID tenant of the account, or "" for a personal account.
+func (c *Client) tenant() (string, error) {
+	c.tenantOnce.Do(func() {
+		if c.driveType != "business" {
+			return
+		}
+		orgs, err := c.graphClient.Organization().Get(context.Background(), nil)
+		if err != nil {
+			c.tenantErr = fmt.Errorf("failed to get organization: %w", err)
+			return
+		}
+		if values := orgs.GetValue(); len(values) > 0 && values[0].GetId() != nil {
+			c.tenantID = *values[0].GetId()
+		}
+	})
+	return c.tenantID, c.tenantErr
+}
+
 // ListFolders lists folders
 func (c *Client) ListFolders(parentID string) ([]*model.Folder, error) {
 	if parentID == "" {
@@ -970,6 +1223,68 @@ func (c *Client) ShareFolder(folderID, email string, role string) error {
 	return nil
 }
 
+// SharedWith returns the lower-cased emails of the users an item is shared with, directly or
+// through a pending invitation
+func (c *Client) SharedWith(itemID string) (map[string]bool, error) {
+	ctx := context.Background()
+	result, err := c.graphClient.Drives().ByDriveId(c.driveID).Items().ByDriveItemId(itemID).Permissions().Get(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list permissions: %w", err)
+	}
+
+	pageIterator, err := msgraphgocore.NewPageIterator[models.Permissionable](result, c.graphClient.GetAdapter(), models.CreatePermissionCollectionResponseFromDiscriminatorValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create page iterator: %w", err)
+	}
+
+	emails := make(map[string]bool)
+	err = pageIterator.Iterate(ctx, func(p models.Permissionable) bool {
+		for _, email := range permissionEmails(p) {
+			emails[email] = true
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pagination failed: %w", err)
+	}
+	return emails, nil
+}
+
+// permissionEmails extracts the grantee emails of a permission. OneDrive personal reports them
+// in the identities' additional data rather than in a typed field.
+func permissionEmails(p models.Permissionable) []string {
+	var emails []string
+	add := func(email *string) {
+		if email != nil && *email != "" {
+			emails = append(emails, strings.ToLower(*email))
+		}
+	}
+	addIdentity := func(identity models.Identityable) {
+		if identity == nil {
+			return
+		}
+		if email, ok := identity.GetAdditionalData()["email"].(*string); ok {
+			add(email)
+		}
+	}
+
+	if inv := p.GetInvitation(); inv != nil {
+		add(inv.GetEmail())
+	}
+	if set := p.GetGrantedTo(); set != nil {
+		addIdentity(set.GetUser())
+	}
+	if set := p.GetGrantedToV2(); set != nil {
+		addIdentity(set.GetUser())
+	}
+	for _, set := range p.GetGrantedToIdentitiesV2() {
+		if set != nil {
+			addIdentity(set.GetUser())
+		}
+	}
+	return emails
+}
+
 // VerifyPermissions verifies permissions
 func (c *Client) VerifyPermissions() error {
 	return nil
@@ -1252,3 +1567,18 @@ func (c *Client) CreateFakeShortcut(parentID, name string, size int64, googleDri
 
 	return uploadedFile, nil
 }
+
+// IsFakeShortcut reports whether an item is a placeholder created by CreateFakeShortcut rather
+// than a native shortcut or a copy
+func (c *Client) IsFakeShortcut(itemID string) (bool, error) {
+	ctx := context.Background()
+	item, err := c.graphClient.Drives().ByDriveId(c.driveID).Items().ByDriveItemId(itemID).Get(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get item: %w", err)
+	}
+	if item.GetName() == nil {
+		return false, nil
+	}
+	_, _, ok := parseFakeShortcutName(*item.GetName())
+	return ok, nil
+}
@@ -0,0 +1,46 @@
+package microsoft
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitForCopy(t *testing.T) {
+	defer func(d time.Duration) { copyPollInterval = d }(copyPollInterval)
+	copyPollInterval = time.Millisecond
+
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/status":
+			polls++
+			if polls < 3 {
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte(`{"status":"inProgress","percentageComplete":50}`))
+				return
+			}
+			w.Write([]byte(`{"status":"completed","resourceId":"NEW-ITEM"}`))
+		case "/redirect":
+			w.Header().Set("Location", "https://graph.microsoft.com/v1.0/drives/d1/items/REDIRECTED-ITEM")
+			w.WriteHeader(http.StatusSeeOther)
+		case "/failed":
+			w.Write([]byte(`{"status":"failed","error":{"message":"name already exists"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{httpClient: srv.Client()}
+	if id, err := c.waitForCopy(context.Background(), srv.URL+"/status"); err != nil || id != "NEW-ITEM" || polls != 3 {
+		t.Fatalf("expected NEW-ITEM after 3 polls, got %q after %d (%v)", id, polls, err)
+	}
+	if id, err := c.waitForCopy(context.Background(), srv.URL+"/redirect"); err != nil || id != "REDIRECTED-ITEM" {
+		t.Fatalf("expected the redirected item ID, got %q (%v)", id, err)
+	}
+	if _, err := c.waitForCopy(context.Background(), srv.URL+"/failed"); err == nil || !strings.Contains(err.Error(), "name already exists") {
+		t.Fatalf("expected the copy failure, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package microsoft
+
+import (
+	"testing"
+
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+)
+
+func TestPermissionEmails(t *testing.T) {
+	invited := "Pending@Example.com"
+	inv := models.NewSharingInvitation()
+	inv.SetEmail(&invited)
+
+	granted := "backup@example.com"
+	user := models.NewIdentity()
+	user.SetAdditionalData(map[string]any{"email": &granted})
+	set := models.NewSharePointIdentitySet()
+	set.SetUser(user)
+
+	p := models.NewPermission()
+	p.SetInvitation(inv)
+	p.SetGrantedToV2(set)
+
+	got := permissionEmails(p)
+	if len(got) != 2 || got[0] != "pending@example.com" || got[1] != "backup@example.com" {
+		t.Fatalf("permissionEmails = %v", got)
+	}
+
+	if got := permissionEmails(models.NewPermission()); len(got) != 0 {
+		t.Fatalf("expected no emails for an empty permission, got %v", got)
+	}
+}
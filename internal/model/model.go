@@ -83,15 +83,25 @@ type Config struct {
 	MicrosoftClient MicrosoftClient `json:"microsoft_client"`
 	TelegramClient  TelegramClient  `json:"telegram_client"`
 	Users           []User          `json:"users"`
+	S3Keys          []S3Key         `json:"s3_keys,omitempty"`
+	// EncryptedProviders lists the providers whose new replicas are encrypted client-side
+	EncryptedProviders []Provider `json:"encrypted_providers,omitempty"`
+}
+
+// S3Key is an access key accepted by the S3 gateway (serve s3)
+type S3Key struct {
+	AccessKeyID     string    `json:"access_key_id"`
+	SecretAccessKey string    `json:"secret_access_key"`
+	CreatedAt       time.Time `json:"created_at"`
 }
 
 // ProviderQuota represents aggregated quota for a provider
 type ProviderQuota struct {
-	Provider       Provider
-	Total          int64
-	Used           int64
-	Free           int64
-	SyncFolderUsed int64
+	Provider       Provider `json:"provider"`
+	Total          int64    `json:"total"`
+	Used           int64    `json:"used"`
+	Free           int64    `json:"free"`
+	SyncFolderUsed int64    `json:"sync_folder_used"`
 }
 
 // File represents a logical file
@@ -108,20 +118,23 @@ type File struct {
 
 // Replica represents a physical copy of a file on a cloud provider
 type Replica struct {
-	ID         int64              `json:"id"`
-	FileID     string             `json:"file_id"`
-	Path       string             `json:"path"`
-	Name       string             `json:"name"`
-	Size       int64              `json:"size"`
-	Provider   Provider           `json:"provider"`
-	AccountID  string             `json:"account_id"`
-	NativeID   string             `json:"native_id"`
-	NativeHash string             `json:"native_hash"`
-	ModTime    time.Time          `json:"mod_time"`
-	Status     string             `json:"status"`
-	Fragmented bool               `json:"fragmented"`
-	Owner      string             `json:"owner"`
-	Fragments  []*ReplicaFragment `json:"-"`
+	ID               int64              `json:"id"`
+	FileID           string             `json:"file_id"`
+	Path             string             `json:"path"`
+	Name             string             `json:"name"`
+	Size             int64              `json:"size"` // Stored bytes; the ciphertext size when Encrypted
+	Provider         Provider           `json:"provider"`
+	AccountID        string             `json:"account_id"`
+	NativeID         string             `json:"native_id"`
+	NativeHash       string             `json:"native_hash"`
+	ModTime          time.Time          `json:"mod_time"`
+	Status           string             `json:"status"`
+	Fragmented       bool               `json:"fragmented"`
+	Owner            string             `json:"owner"`
+	LastSeenAt       int64              `json:"last_seen_at"`
+	Encrypted        bool               `json:"encrypted"`         // Holds an encrypted stream of the content (see crypto.NewEncryptReader)
+	CiphertextSHA256 string             `json:"ciphertext_sha256"` // SHA-256 of the stored ciphertext when Encrypted
+	Fragments        []*ReplicaFragment `json:"-"`
 }
 
 // ReplicaFragment represents a part of a split file (Telegram)
@@ -134,6 +147,25 @@ type ReplicaFragment struct {
 	NativeFragmentID string `json:"native_fragment_id"`
 }
 
+// Shard is one Reed-Solomon shard of an erasure-coded file. Shards 0 to DataShards-1 hold the
+// file's bytes in order, the last one zero-padded; the rest hold parity. Any DataShards of the
+// DataShards+ParityShards shards rebuild the file.
+type Shard struct {
+	ID           int64              `json:"id"`
+	FileID       string             `json:"file_id"`
+	ShardIndex   int                `json:"shard_index"`
+	DataShards   int                `json:"data_shards"`
+	ParityShards int                `json:"parity_shards"`
+	Size         int64              `json:"size"`
+	SHA256       string             `json:"sha256"`
+	Provider     Provider           `json:"provider"`
+	AccountID    string             `json:"account_id"`
+	NativeID     string             `json:"native_id"`
+	Fragmented   bool               `json:"fragmented"`
+	Status       string             `json:"status"` // active, missing
+	Fragments    []*ReplicaFragment `json:"-"`
+}
+
 // Folder represents a folder in cloud storage
 type Folder struct {
 	ID             string
@@ -158,20 +190,73 @@ type LogicalFolder struct {
 // FolderReplica represents one physical copy of a logical_folder on a specific account.
 // Google: one replica owned by main and shared. OneDrive: one per backup account. Telegram: none.
 type FolderReplica struct {
-	ID              int64
-	LogicalFolderID string
-	Provider        Provider
-	AccountID       string
-	NativeFolderID  string // provider's stable folder ID
-	Owner           string // owner account
-	LastSeenAt      int64  // last time confirmed to still exist (unix)
+	ID              int64    `json:"id"`
+	LogicalFolderID string   `json:"logical_folder_id"`
+	Provider        Provider `json:"provider"`
+	AccountID       string   `json:"account_id"`
+	NativeFolderID  string   `json:"native_folder_id"` // provider's stable folder ID
+	Owner           string   `json:"owner"`            // owner account
+	Status          string   `json:"status"`           // active, deleted
+	LastSeenAt      int64    `json:"last_seen_at"`     // last time confirmed to still exist (unix)
+}
+
+// Share statuses recorded in AccountShare
+const (
+	ShareStatusOK     = "ok"
+	ShareStatusFailed = "failed"
+)
+
+// AccountShare records whether one account's sync folder is shared with another account of the
+// same provider, as last audited by sync --share-with-main or observed while creating shortcuts
+type AccountShare struct {
+	Provider      Provider  `json:"provider"`
+	SourceAccount string    `json:"source_account"`
+	TargetAccount string    `json:"target_account"`
+	Status        string    `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	CheckedAt     time.Time `json:"checked_at"`
+}
+
+// PendingTransfer records an ownership transfer the target account has not accepted yet, so later
+// runs retry the acceptance instead of re-uploading the file
+type PendingTransfer struct {
+	Provider      Provider  `json:"provider"`
+	NativeID      string    `json:"native_id"`
+	FileID        string    `json:"file_id"`
+	SourceAccount string    `json:"source_account"`
+	TargetAccount string    `json:"target_account"`
+	RequestedAt   time.Time `json:"requested_at"`
 }
 
 // SyncRun represents a tracked sync pipeline execution for crash recovery
 type SyncRun struct {
-	ID                int64
-	StartedAt         time.Time
-	CompletedAt       *time.Time
-	LastCompletedStep int
-	SafeMode          bool
+	ID                int64      `json:"id"`
+	StartedAt         time.Time  `json:"started_at"`
+	CompletedAt       *time.Time `json:"completed_at,omitempty"`
+	LastCompletedStep int        `json:"last_completed_step"`
+	SafeMode          bool       `json:"safe_mode"`
+	LogFile           string     `json:"log_file,omitempty"` // local to the host that ran it
+	CopyStats
+}
+
+// CopyStats counts how the file copies of a sync run moved their content: server-side, where the
+// provider copied between two of its accounts, or streamed through this host
+type CopyStats struct {
+	ServerCopies     int64 `json:"server_copies"`
+	ServerCopyBytes  int64 `json:"server_copy_bytes"`
+	ServerCopyMillis int64 `json:"server_copy_ms"`
+	StreamedCopies   int64 `json:"streamed_copies"`
+	StreamedBytes    int64 `json:"streamed_bytes"`
+	StreamedMillis   int64 `json:"streamed_ms"`
+}
+
+// ServerCopySavedTime estimates how much longer the server-side copies would have taken streamed,
+// at the throughput of the run's streamed copies. It is zero when nothing was streamed.
+func (s CopyStats) ServerCopySavedTime() time.Duration {
+	if s.StreamedBytes <= 0 {
+		return 0
+	}
+	streamedMillis := float64(s.ServerCopyBytes) * float64(s.StreamedMillis) / float64(s.StreamedBytes)
+	saved := time.Duration(streamedMillis-float64(s.ServerCopyMillis)) * time.Millisecond
+	return max(saved, 0)
 }
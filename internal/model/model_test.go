@@ -2,6 +2,7 @@ package model
 
 import (
 	"testing"
+	"time"
 )
 
 func TestProviderConstants(t *testing.T) {
@@ -97,3 +98,16 @@ func TestFolderModel(t *testing.T) {
 		t.Error("Folder name not set correctly")
 	}
 }
+
+func TestServerCopySavedTime(t *testing.T) {
+	// Streaming ran at 1 byte/ms, so 4000 server-copied bytes would have taken 4s instead of 1s.
+	stats := CopyStats{ServerCopyBytes: 4000, ServerCopyMillis: 1000, StreamedBytes: 500, StreamedMillis: 500}
+	if got := stats.ServerCopySavedTime(); got != 3*time.Second {
+		t.Errorf("Expected 3s saved, got %v", got)
+	}
+
+	stats.StreamedBytes, stats.StreamedMillis = 0, 0
+	if got := stats.ServerCopySavedTime(); got != 0 {
+		t.Errorf("Expected no estimate without streamed copies, got %v", got)
+	}
+}
@@ -0,0 +1,436 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/database"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/FranLegon/cloud-drives-sync/internal/task"
+	"github.com/FranLegon/cloud-drives-sync/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxJobHistory is how many finished jobs the daemon remembers.
+const maxJobHistory = 50
+
+// Job states.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is one triggered action. LogFrom and LogTo bound the Seq of the log lines it produced.
+type Job struct {
+	ID         int        `json:"id"`
+	Action     string     `json:"action"`
+	State      string     `json:"state"`
+	QueuedAt   time.Time  `json:"queued_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	LogFrom    int64      `json:"log_from,omitempty"`
+	LogTo      int64      `json:"log_to,omitempty"`
+}
+
+// DaemonOptions configures a Daemon.
+type DaemonOptions struct {
+	Runner   *task.Runner
+	DB       *database.DB
+	SafeMode bool
+	// Actions are the operations that can be triggered, by name.
+	Actions map[string]func() error
+	// AfterJob runs after every job, e.g. to upload the metadata DB if it changed.
+	AfterJob func() error
+	Logs     *LogBuffer
+}
+
+// Daemon runs triggered actions one at a time, in the order they were queued, and serves the
+// local REST API. Since a job runs to completion before the next starts, a sync that fails part
+// way leaves its sync_runs row incomplete and the next queued sync resumes it.
+type Daemon struct {
+	opts      DaemonOptions
+	startedAt time.Time
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	jobs    []*Job // every known job, oldest first
+	queue   []*Job
+	nextID  int
+	stopped bool
+	done    chan struct{}
+}
+
+// NewDaemon creates a daemon; call Start to begin processing jobs.
+func NewDaemon(opts DaemonOptions) *Daemon {
+	d := &Daemon{opts: opts, startedAt: time.Now(), nextID: 1, done: make(chan struct{})}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+// Start processes queued jobs in the background until Stop is called.
+func (d *Daemon) Start() {
+	go d.worker()
+}
+
+// Stop cancels queued jobs and waits for the running one to finish.
+func (d *Daemon) Stop() {
+	d.mu.Lock()
+	d.stopped = true
+	now := time.Now()
+	for _, j := range d.queue {
+		j.State = JobCancelled
+		j.FinishedAt = &now
+	}
+	d.queue = nil
+	running := d.currentLocked() != nil
+	d.cond.Broadcast()
+	d.mu.Unlock()
+	if running {
+		logger.Info("Waiting for the running job to finish...")
+	}
+	<-d.done
+}
+
+// Trigger queues action. If the same action is already queued, that job is returned instead.
+func (d *Daemon) Trigger(action string) (*Job, error) {
+	if _, ok := d.opts.Actions[action]; !ok {
+		return nil, fmt.Errorf("unknown action %q", action)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return nil, fmt.Errorf("daemon is shutting down")
+	}
+	for _, j := range d.queue {
+		if j.Action == action {
+			c := *j
+			return &c, nil
+		}
+	}
+	j := &Job{ID: d.nextID, Action: action, State: JobQueued, QueuedAt: time.Now()}
+	d.nextID++
+	d.jobs = append(d.jobs, j)
+	d.queue = append(d.queue, j)
+	d.pruneLocked()
+	d.cond.Signal()
+	c := *j
+	return &c, nil
+}
+
+// pruneLocked drops the oldest finished jobs beyond maxJobHistory.
+func (d *Daemon) pruneLocked() {
+	excess := len(d.jobs) - maxJobHistory
+	d.jobs = slices.DeleteFunc(d.jobs, func(j *Job) bool {
+		if excess > 0 && (j.State != JobQueued && j.State != JobRunning) {
+			excess--
+			return true
+		}
+		return false
+	})
+}
+
+func (d *Daemon) currentLocked() *Job {
+	for _, j := range d.jobs {
+		if j.State == JobRunning {
+			return j
+		}
+	}
+	return nil
+}
+
+func (d *Daemon) worker() {
+	defer close(d.done)
+	for {
+		d.mu.Lock()
+		for len(d.queue) == 0 && !d.stopped {
+			d.cond.Wait()
+		}
+		if d.stopped {
+			d.mu.Unlock()
+			return
+		}
+		j := d.queue[0]
+		d.queue = d.queue[1:]
+		now := time.Now()
+		j.State = JobRunning
+		j.StartedAt = &now
+		if d.opts.Logs != nil {
+			j.LogFrom = d.opts.Logs.NextSeq()
+		}
+		d.mu.Unlock()
+
+		ctx, span := tracing.Start(nil, "job "+j.Action, attribute.Int("job_id", j.ID))
+		restore := tracing.SetCurrent(ctx)
+		logger.Info("Job #%d: %s started", j.ID, j.Action)
+		err := d.opts.Actions[j.Action]()
+		if d.opts.AfterJob != nil {
+			if aerr := d.opts.AfterJob(); aerr != nil {
+				logger.Error("Job #%d: %v", j.ID, aerr)
+				if err == nil {
+					err = aerr
+				}
+			}
+		}
+		if err != nil {
+			logger.Error("Job #%d: %s failed: %v", j.ID, j.Action, err)
+		} else {
+			logger.Info("Job #%d: %s finished", j.ID, j.Action)
+		}
+		restore()
+		tracing.End(span, err)
+
+		d.mu.Lock()
+		finished := time.Now()
+		j.FinishedAt = &finished
+		j.State = JobSucceeded
+		if err != nil {
+			j.State = JobFailed
+			j.Error = err.Error()
+		}
+		if d.opts.Logs != nil {
+			j.LogTo = d.opts.Logs.NextSeq()
+		}
+		d.mu.Unlock()
+	}
+}
+
+// Jobs returns a snapshot of the known jobs, newest first.
+func (d *Daemon) Jobs() []Job {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	jobs := make([]Job, 0, len(d.jobs))
+	for i := len(d.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, *d.jobs[i])
+	}
+	return jobs
+}
+
+// Job returns a snapshot of one job.
+func (d *Daemon) Job(id int) (Job, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, j := range d.jobs {
+		if j.ID == id {
+			return *j, true
+		}
+	}
+	return Job{}, false
+}
+
+// Handler returns the REST API:
+//
+//	GET  /api/v1/status             daemon state, running job and sync progress
+//	GET  /api/v1/runs               jobs and recent sync_runs rows
+//	POST /api/v1/runs               queue an action: {"action": "sync"}
+//	GET  /api/v1/runs/{id}          one job
+//	GET  /api/v1/runs/{id}/logs     log lines of one job
+//	GET  /api/v1/files?path=&all=   list a pool folder
+//	GET  /api/v1/stat?path=         replicas of a file or folder
+//	GET  /api/v1/quota              quota per provider
+//	GET  /api/v1/logs?since=        buffered log lines
+//	GET  /api/v1/logs/stream        live log lines (server-sent events)
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/status", d.handleStatus)
+	mux.HandleFunc("GET /api/v1/runs", d.handleRuns)
+	mux.HandleFunc("POST /api/v1/runs", d.handleTrigger)
+	mux.HandleFunc("GET /api/v1/runs/{id}", d.handleJob)
+	mux.HandleFunc("GET /api/v1/runs/{id}/logs", d.handleJobLogs)
+	mux.HandleFunc("GET /api/v1/files", d.handleFiles)
+	mux.HandleFunc("GET /api/v1/stat", d.handleStat)
+	mux.HandleFunc("GET /api/v1/quota", d.handleQuota)
+	mux.HandleFunc("GET /api/v1/logs", d.handleLogs)
+	mux.HandleFunc("GET /api/v1/logs/stream", d.handleLogStream)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+type statusResponse struct {
+	StartedAt time.Time      `json:"started_at"`
+	SafeMode  bool           `json:"safe_mode"`
+	Actions   []string       `json:"actions"`
+	Running   *Job           `json:"running,omitempty"`
+	Queued    []Job          `json:"queued"`
+	SyncRun   *model.SyncRun `json:"sync_run,omitempty"`
+	SyncSteps int            `json:"sync_steps"`
+}
+
+func (d *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	res := statusResponse{StartedAt: d.startedAt, SafeMode: d.opts.SafeMode, Queued: []Job{}, SyncSteps: 6}
+	for name := range d.opts.Actions {
+		res.Actions = append(res.Actions, name)
+	}
+	sort.Strings(res.Actions)
+
+	d.mu.Lock()
+	if j := d.currentLocked(); j != nil {
+		c := *j
+		res.Running = &c
+	}
+	for _, j := range d.queue {
+		res.Queued = append(res.Queued, *j)
+	}
+	d.mu.Unlock()
+
+	// The incomplete sync_runs row tells how far the current (or last interrupted) sync got.
+	run, err := d.opts.DB.GetIncompleteSyncRun()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	res.SyncRun = run
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (d *Daemon) handleRuns(w http.ResponseWriter, r *http.Request) {
+	runs, err := d.opts.DB.ListSyncRuns(20)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if runs == nil {
+		runs = []*model.SyncRun{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": d.Jobs(), "sync_runs": runs})
+}
+
+func (d *Daemon) handleTrigger(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Action string `json:"action"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	j, err := d.Trigger(req.Action)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+func (d *Daemon) jobFromPath(w http.ResponseWriter, r *http.Request) (Job, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid job id %q", r.PathValue("id")))
+		return Job{}, false
+	}
+	j, ok := d.Job(id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("job %d not found", id))
+	}
+	return j, ok
+}
+
+func (d *Daemon) handleJob(w http.ResponseWriter, r *http.Request) {
+	if j, ok := d.jobFromPath(w, r); ok {
+		writeJSON(w, http.StatusOK, j)
+	}
+}
+
+func (d *Daemon) handleJobLogs(w http.ResponseWriter, r *http.Request) {
+	j, ok := d.jobFromPath(w, r)
+	if !ok {
+		return
+	}
+	if d.opts.Logs == nil || j.LogFrom == 0 {
+		writeJSON(w, http.StatusOK, []LogLine{})
+		return
+	}
+	writeJSON(w, http.StatusOK, d.opts.Logs.Range(j.LogFrom, j.LogTo))
+}
+
+func (d *Daemon) handleFiles(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		p = "/"
+	}
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	entries, err := task.ListPoolDir(d.opts.DB, p, all)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (d *Daemon) handleStat(w http.ResponseWriter, r *http.Request) {
+	st, err := task.StatPool(d.opts.DB, r.URL.Query().Get("path"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (d *Daemon) handleQuota(w http.ResponseWriter, r *http.Request) {
+	quotas, err := d.opts.Runner.GetProviderQuotasFromDB(false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, quotas)
+}
+
+func (d *Daemon) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if d.opts.Logs == nil {
+		writeJSON(w, http.StatusOK, []LogLine{})
+		return
+	}
+	since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	writeJSON(w, http.StatusOK, d.opts.Logs.Range(since, 0))
+}
+
+// handleLogStream sends each new log line as a server-sent event until the client disconnects.
+func (d *Daemon) handleLogStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || d.opts.Logs == nil {
+		writeJSONError(w, http.StatusNotImplemented, fmt.Errorf("log streaming is not available"))
+		return
+	}
+	lines, cancel := d.opts.Logs.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case line := <-lines:
+			data, _ := json.Marshal(line)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", line.Seq, data)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/FranLegon/cloud-drives-sync/internal/task"
+)
+
+func TestLogBuffer(t *testing.T) {
+	b := NewLogBuffer(3)
+	lines, cancel := b.Subscribe()
+	defer cancel()
+
+	fmt.Fprint(b, "one\ntw")
+	fmt.Fprint(b, "o\r\nthree\nfour\n")
+
+	got := b.Range(0, 0)
+	if len(got) != 3 || got[0].Text != "two" || got[2].Text != "four" || got[2].Seq != 4 {
+		t.Fatalf("expected the last 3 lines, got %+v", got)
+	}
+	if got := b.Range(3, 4); len(got) != 1 || got[0].Text != "three" {
+		t.Fatalf("expected only line 3, got %+v", got)
+	}
+	if b.NextSeq() != 5 {
+		t.Fatalf("expected next seq 5, got %d", b.NextSeq())
+	}
+	if first := <-lines; first.Text != "one" {
+		t.Fatalf("expected subscriber to receive the first line, got %+v", first)
+	}
+}
+
+func TestDaemonQueuesAndRunsJobs(t *testing.T) {
+	db := openServerTestDB(t)
+	logs := NewLogBuffer(100)
+	release := make(chan struct{})
+	ran := make(chan string, 10)
+	d := NewDaemon(DaemonOptions{
+		Runner: task.NewRunner(&model.Config{}, db, true),
+		DB:     db,
+		Actions: map[string]func() error{
+			"slow": func() error { <-release; ran <- "slow"; return nil },
+			"fail": func() error {
+				fmt.Fprintln(logs, "fail output")
+				ran <- "fail"
+				return fmt.Errorf("boom")
+			},
+		},
+		Logs: logs,
+	})
+	d.Start()
+	defer d.Stop()
+	srv := httptest.NewServer(d.Handler())
+	defer srv.Close()
+
+	trigger := func(action string) (int, Job) {
+		res, err := http.Post(srv.URL+"/api/v1/runs", "application/json", strings.NewReader(`{"action":"`+action+`"}`))
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		defer res.Body.Close()
+		var j Job
+		json.NewDecoder(res.Body).Decode(&j)
+		return res.StatusCode, j
+	}
+
+	if code, _ := trigger("nope"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown action, got %d", code)
+	}
+	_, slow := trigger("slow")
+	_, fail := trigger("fail")
+	code, again := trigger("fail")
+	if code != http.StatusAccepted || again.ID != fail.ID {
+		t.Fatalf("expected the queued job %d to be reused, got %d (%d)", fail.ID, again.ID, code)
+	}
+
+	close(release)
+	if first, second := <-ran, <-ran; first != "slow" || second != "fail" {
+		t.Fatalf("expected jobs to run in order, got %s, %s", first, second)
+	}
+
+	var j Job
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if j, _ = d.Job(fail.ID); j.State == JobFailed {
+			break
+		}
+	}
+	if j.State != JobFailed || j.Error != "boom" {
+		t.Fatalf("expected failed job, got %+v", j)
+	}
+	if s, _ := d.Job(slow.ID); s.State != JobSucceeded {
+		t.Fatalf("expected succeeded job, got %+v", s)
+	}
+
+	res, err := http.Get(fmt.Sprintf("%s/api/v1/runs/%d/logs", srv.URL, fail.ID))
+	if err != nil {
+		t.Fatalf("GET logs: %v", err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(string(body), "fail output") {
+		t.Fatalf("expected job logs to contain its output, got %s", body)
+	}
+}
+
+func TestDaemonFilesEndpoint(t *testing.T) {
+	db := openServerTestDB(t)
+	d := NewDaemon(DaemonOptions{Runner: task.NewRunner(&model.Config{}, db, true), DB: db})
+	h := NewCredentials("token").Middleware("test", d.Handler())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/files?path=/docs", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rec.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer token")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "a.txt") || strings.Contains(rec.Body.String(), "old.txt") {
+		t.Fatalf("unexpected listing %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/status", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"sync_steps": 6`) {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// LogLine is one captured log line. Seq increases by one per line.
+type LogLine struct {
+	Seq  int64     `json:"seq"`
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// LogBuffer keeps the most recent log lines in memory and fans them out to subscribers. It is
+// an io.Writer meant for logger.AddSink.
+type LogBuffer struct {
+	mu       sync.Mutex
+	lines    []LogLine // ring of the last cap(lines) lines
+	start    int       // index of the oldest line in lines
+	next     int64     // Seq of the next line
+	partial  []byte
+	subs     map[chan LogLine]struct{}
+	capacity int
+}
+
+// NewLogBuffer creates a buffer that keeps up to capacity lines.
+func NewLogBuffer(capacity int) *LogBuffer {
+	return &LogBuffer{capacity: capacity, subs: make(map[chan LogLine]struct{}), next: 1}
+}
+
+// Write splits p into lines and records each complete one. It never blocks on subscribers: a
+// subscriber that falls behind misses lines.
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data := append(b.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		b.add(string(bytes.TrimRight(data[:i], "\r")))
+		data = data[i+1:]
+	}
+	b.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+func (b *LogBuffer) add(text string) {
+	line := LogLine{Seq: b.next, Time: time.Now(), Text: text}
+	b.next++
+	if len(b.lines) < b.capacity {
+		b.lines = append(b.lines, line)
+	} else {
+		b.lines[b.start] = line
+		b.start = (b.start + 1) % b.capacity
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// NextSeq returns the Seq the next line will get.
+func (b *LogBuffer) NextSeq() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.next
+}
+
+// Range returns the buffered lines with from <= Seq < to; to <= 0 means no upper bound.
+func (b *LogBuffer) Range(from, to int64) []LogLine {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := make([]LogLine, 0)
+	for i := range b.lines {
+		line := b.lines[(b.start+i)%len(b.lines)]
+		if line.Seq >= from && (to <= 0 || line.Seq < to) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Subscribe returns a channel receiving every new line until cancel is called.
+func (b *LogBuffer) Subscribe() (<-chan LogLine, func()) {
+	ch := make(chan LogLine, 256)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
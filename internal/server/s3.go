@@ -0,0 +1,1003 @@
+package server
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/FranLegon/cloud-drives-sync/internal/task"
+	"github.com/google/uuid"
+)
+
+// S3 gateway: a path-style subset of the S3 API over the pool. Buckets are the top-level logical
+// folders and object keys are the paths below them. Writes go through the same PoolFS operations
+// as the WebDAV server, so DeleteObject soft-deletes.
+
+const (
+	s3Namespace     = "http://s3.amazonaws.com/doc/2006-03-01/"
+	s3TimeFormat    = "2006-01-02T15:04:05.000Z"
+	s3MaxKeys       = 1000
+	s3MaxPartNumber = 10000
+)
+
+// s3Error is an S3 error response.
+type s3Error struct {
+	Status  int    `xml:"-"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string { return e.Code + ": " + e.Message }
+
+func newS3Error(status int, code, format string, args ...any) *s3Error {
+	return &s3Error{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	errNoSuchBucket   = newS3Error(http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+	errNoSuchKey      = newS3Error(http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+	errNoSuchUpload   = newS3Error(http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist")
+	errInvalidKey     = newS3Error(http.StatusBadRequest, "InvalidArgument", "Object keys may not contain \".\" or \"..\" segments")
+	errMalformedXML   = newS3Error(http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed")
+	errNotImplemented = newS3Error(http.StatusNotImplemented, "NotImplemented", "This operation is not supported by the pool gateway")
+)
+
+// S3Gateway serves the pool over the S3 API.
+type S3Gateway struct {
+	pool      *PoolFS
+	secrets   map[string]string
+	uploadDir string
+	now       func() time.Time
+
+	mu      sync.Mutex
+	uploads map[string]*multipartUpload
+}
+
+// multipartUpload is an in-progress multipart upload. Parts are spooled to disk until the upload
+// is completed; uploads do not survive a restart of the server.
+type multipartUpload struct {
+	bucket, key string
+	dir         string
+	parts       map[int]s3Part
+}
+
+type s3Part struct {
+	etag string // hex MD5, unquoted
+	size int64
+}
+
+// NewS3Gateway creates a gateway serving fs that accepts requests signed with any of keys.
+func NewS3Gateway(fs *PoolFS, keys []model.S3Key) (*S3Gateway, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no S3 access keys configured (run 'config --add-s3-key')")
+	}
+	secrets := make(map[string]string, len(keys))
+	for _, k := range keys {
+		secrets[k.AccessKeyID] = k.SecretAccessKey
+	}
+	dir, err := os.MkdirTemp("", "cds-s3-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multipart spool dir: %w", err)
+	}
+	return &S3Gateway{
+		pool:      fs,
+		secrets:   secrets,
+		uploadDir: dir,
+		now:       time.Now,
+		uploads:   make(map[string]*multipartUpload),
+	}, nil
+}
+
+// Close discards unfinished multipart uploads.
+func (g *S3Gateway) Close() error {
+	return os.RemoveAll(g.uploadDir)
+}
+
+// ServeHTTP implements http.Handler.
+func (g *S3Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := verifySigV4(r, g.secrets, g.now())
+	if err != nil {
+		switch {
+		case errors.Is(err, errSignatureMismatch):
+			g.writeError(w, r, newS3Error(http.StatusForbidden, "SignatureDoesNotMatch", "%v", err))
+		default:
+			g.writeError(w, r, newS3Error(http.StatusForbidden, "AccessDenied", "%v", err))
+		}
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	q := r.URL.Query()
+	if bucket == "" {
+		if r.Method != http.MethodGet {
+			g.writeError(w, r, errNotImplemented)
+			return
+		}
+		err = g.listBuckets(w)
+	} else if key == "" {
+		err = g.serveBucket(w, r, bucket, q, body)
+	} else {
+		err = g.serveObject(w, r, bucket, key, q, body)
+	}
+	if err != nil {
+		g.writeError(w, r, err)
+	}
+}
+
+func (g *S3Gateway) serveBucket(w http.ResponseWriter, r *http.Request, bucket string, q url.Values, body io.Reader) error {
+	switch r.Method {
+	case http.MethodGet:
+		if err := g.requireBucket(bucket); err != nil {
+			return err
+		}
+		switch {
+		case q.Has("location"):
+			return writeXML(w, http.StatusOK, &locationConstraint{Xmlns: s3Namespace})
+		case q.Has("uploads"), q.Has("versioning"), q.Has("acl"), q.Has("policy"), q.Has("lifecycle"):
+			return errNotImplemented
+		}
+		return g.listObjects(w, bucket, q)
+	case http.MethodHead:
+		if err := g.requireBucket(bucket); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case http.MethodPut:
+		return g.createBucket(w, bucket)
+	case http.MethodDelete:
+		return g.deleteBucket(w, bucket)
+	case http.MethodPost:
+		if q.Has("delete") {
+			return g.deleteObjects(w, bucket, body)
+		}
+	}
+	return errNotImplemented
+}
+
+func (g *S3Gateway) serveObject(w http.ResponseWriter, r *http.Request, bucket, key string, q url.Values, body io.Reader) error {
+	if err := g.requireBucket(bucket); err != nil {
+		return err
+	}
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	uploadID := q.Get("uploadId")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if uploadID != "" {
+			return errNotImplemented
+		}
+		return g.getObject(w, r, bucket, key)
+	case http.MethodPut:
+		switch {
+		case uploadID != "" && r.Header.Get("X-Amz-Copy-Source") != "":
+			return errNotImplemented
+		case uploadID != "":
+			return g.uploadPart(w, uploadID, q.Get("partNumber"), body)
+		case r.Header.Get("X-Amz-Copy-Source") != "":
+			return g.copyObject(w, r, bucket, key)
+		}
+		return g.putObject(w, r, bucket, key, body)
+	case http.MethodPost:
+		switch {
+		case q.Has("uploads"):
+			return g.createMultipartUpload(w, bucket, key)
+		case uploadID != "":
+			return g.completeMultipartUpload(w, bucket, key, uploadID, body)
+		}
+	case http.MethodDelete:
+		if uploadID != "" {
+			return g.abortMultipartUpload(w, uploadID)
+		}
+		if err := g.deleteObject(bucket, key); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return errNotImplemented
+}
+
+// objectPath returns the logical path of an object. The key must have passed checkKey.
+func objectPath(bucket, key string) string {
+	return task.CleanPoolPath("/" + bucket + "/" + key)
+}
+
+// checkKey rejects keys with "." or ".." segments. objectPath cleans those away, which would
+// let a key name its own bucket or reach into another top-level folder.
+func checkKey(key string) error {
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "." || seg == ".." {
+			return errInvalidKey
+		}
+	}
+	return nil
+}
+
+// validBucket reports whether bucket can name a top-level pool folder: one plain path segment
+// that is not the aux folder.
+func validBucket(bucket string) bool {
+	if bucket == "" || bucket == "." || bucket == ".." || strings.Contains(bucket, "/") {
+		return false
+	}
+	p := "/" + bucket
+	return task.CleanPoolPath(p) == p && !hidden(p)
+}
+
+// requireBucket fails unless bucket is a top-level pool folder.
+func (g *S3Gateway) requireBucket(bucket string) error {
+	if !validBucket(bucket) {
+		return errNoSuchBucket
+	}
+	_, file, err := g.pool.resolve("/" + bucket)
+	if err != nil || file != nil {
+		return errNoSuchBucket
+	}
+	return nil
+}
+
+// activeFile returns the active file at p, or nil.
+func (g *S3Gateway) activeFile(p string) (*model.File, error) {
+	file, err := g.pool.db.GetFileByPath(p)
+	if err != nil || file == nil || file.Status != "active" {
+		return nil, err
+	}
+	return file, nil
+}
+
+type bucketInfo struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name     `xml:"ListAllMyBucketsResult"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Owner   s3Owner      `xml:"Owner"`
+	Buckets []bucketInfo `xml:"Buckets>Bucket"`
+}
+
+type s3Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+}
+
+func (g *S3Gateway) listBuckets(w http.ResponseWriter) error {
+	entries, err := task.ListPoolDir(g.pool.db, "/", false)
+	if err != nil {
+		return err
+	}
+	res := &listAllMyBucketsResult{Xmlns: s3Namespace, Owner: s3Owner{ID: "cloud-drives-sync", DisplayName: "cloud-drives-sync"}}
+	for _, e := range entries {
+		if e.IsDir && !hidden(e.Path) {
+			res.Buckets = append(res.Buckets, bucketInfo{Name: e.Name, CreationDate: e.ModTime.UTC().Format(s3TimeFormat)})
+		}
+	}
+	return writeXML(w, http.StatusOK, res)
+}
+
+func (g *S3Gateway) createBucket(w http.ResponseWriter, bucket string) error {
+	if !validBucket(bucket) {
+		return newS3Error(http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid")
+	}
+	if _, file, err := g.pool.resolve("/" + bucket); err == nil {
+		if file != nil {
+			return newS3Error(http.StatusConflict, "BucketAlreadyExists", "A file with this name exists at the pool root")
+		}
+		return newS3Error(http.StatusConflict, "BucketAlreadyOwnedByYou", "The bucket already exists")
+	}
+	g.pool.writeMu.Lock()
+	defer g.pool.writeMu.Unlock()
+	if err := g.pool.runner.MakePoolFolder("/" + bucket); err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (g *S3Gateway) deleteBucket(w http.ResponseWriter, bucket string) error {
+	if err := g.requireBucket(bucket); err != nil {
+		return err
+	}
+	files, err := g.pool.db.GetFileSummaries("/" + bucket)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.Status == "active" {
+			return newS3Error(http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty")
+		}
+	}
+	g.pool.writeMu.Lock()
+	defer g.pool.writeMu.Unlock()
+	if err := g.pool.runner.SoftDeletePoolFolder("/" + bucket); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// s3Object is one listable key.
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Marker                *string        `xml:"Marker,omitempty"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	KeyCount              *int           `xml:"KeyCount,omitempty"`
+	Contents              []s3Object     `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// listKeys pages through sorted objects (plus folder keys ending in "/", which only show up as
+// common prefixes) the way ListObjects does. It returns the page and the last key or prefix in
+// it when more remain.
+func listKeys(objects []s3Object, folders []string, prefix, delimiter, after string, maxKeys int) ([]s3Object, []string, string) {
+	type item struct {
+		key string
+		obj *s3Object
+	}
+	var items []item
+	for i := range objects {
+		items = append(items, item{key: objects[i].Key, obj: &objects[i]})
+	}
+	if delimiter != "" {
+		for _, f := range folders {
+			items = append(items, item{key: f})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+
+	var page []s3Object
+	var prefixes []string
+	seen := make(map[string]bool)
+	for _, it := range items {
+		if !strings.HasPrefix(it.key, prefix) {
+			continue
+		}
+		cp := ""
+		if delimiter != "" {
+			if i := strings.Index(it.key[len(prefix):], delimiter); i >= 0 {
+				cp = it.key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		switch {
+		case cp != "":
+			if seen[cp] || (after != "" && cp <= after) || strings.HasPrefix(after, cp) {
+				continue
+			}
+		case it.obj == nil || it.key <= after:
+			continue
+		}
+		if len(page)+len(prefixes) == maxKeys {
+			last := after
+			if len(prefixes) > 0 && prefixes[len(prefixes)-1] > last {
+				last = prefixes[len(prefixes)-1]
+			}
+			if len(page) > 0 && page[len(page)-1].Key > last {
+				last = page[len(page)-1].Key
+			}
+			return page, prefixes, last
+		}
+		if cp != "" {
+			seen[cp] = true
+			prefixes = append(prefixes, cp)
+		} else {
+			page = append(page, *it.obj)
+		}
+	}
+	return page, prefixes, ""
+}
+
+func (g *S3Gateway) listObjects(w http.ResponseWriter, bucket string, q url.Values) error {
+	root := "/" + bucket
+	files, err := g.pool.db.GetFileSummaries(root)
+	if err != nil {
+		return err
+	}
+	var objects []s3Object
+	for _, f := range files {
+		if f.Status != "active" {
+			continue
+		}
+		objects = append(objects, s3Object{
+			Key:          strings.TrimPrefix(f.Path, root+"/"),
+			LastModified: f.ModTime.UTC().Format(s3TimeFormat),
+			ETag:         `"` + f.GoogleDriveMD5 + `"`,
+			Size:         f.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	folders, err := g.pool.db.GetAllLogicalFolders()
+	if err != nil {
+		return err
+	}
+	var folderKeys []string
+	for _, lf := range folders {
+		if lf.Status == "active" && strings.HasPrefix(lf.Path, root+"/") {
+			folderKeys = append(folderKeys, strings.TrimPrefix(lf.Path, root+"/")+"/")
+		}
+	}
+
+	maxKeys := s3MaxKeys
+	if v := q.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return newS3Error(http.StatusBadRequest, "InvalidArgument", "Invalid max-keys %q", v)
+		}
+		maxKeys = min(n, s3MaxKeys)
+	}
+	res := &listBucketResult{
+		Xmlns:     s3Namespace,
+		Name:      bucket,
+		Prefix:    q.Get("prefix"),
+		Delimiter: q.Get("delimiter"),
+		MaxKeys:   maxKeys,
+	}
+
+	v2 := q.Get("list-type") == "2"
+	after := q.Get("marker")
+	if v2 {
+		res.StartAfter = q.Get("start-after")
+		res.ContinuationToken = q.Get("continuation-token")
+		after = res.StartAfter
+		if res.ContinuationToken != "" {
+			token, err := base64.RawURLEncoding.DecodeString(res.ContinuationToken)
+			if err != nil {
+				return newS3Error(http.StatusBadRequest, "InvalidArgument", "Invalid continuation token")
+			}
+			after = string(token)
+		}
+	} else {
+		res.Marker = &after
+	}
+
+	page, prefixes, next := listKeys(objects, folderKeys, res.Prefix, res.Delimiter, after, maxKeys)
+	res.Contents = page
+	for _, p := range prefixes {
+		res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: p})
+	}
+	res.IsTruncated = next != ""
+	if v2 {
+		count := len(page) + len(prefixes)
+		res.KeyCount = &count
+		if next != "" {
+			res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(next))
+		}
+	} else if res.Delimiter != "" {
+		res.NextMarker = next
+	}
+	return writeXML(w, http.StatusOK, res)
+}
+
+func (g *S3Gateway) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	p := objectPath(bucket, key)
+	if hidden(p) {
+		return errNoSuchKey
+	}
+	file, err := g.activeFile(p)
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		// A key ending in "/" names a folder marker.
+		if strings.HasSuffix(key, "/") {
+			if _, f, err := g.pool.resolve(p); err == nil && f == nil {
+				w.Header().Set("Content-Length", "0")
+				w.WriteHeader(http.StatusOK)
+				return nil
+			}
+		}
+		return errNoSuchKey
+	}
+
+	offset, length := int64(0), file.Size
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" && !strings.Contains(rng, ",") && file.Size > 0 {
+		offset, length, err = task.ParseByteRange(rng, file.Size)
+		if err != nil {
+			return newS3Error(http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "%v", err)
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, file.Size))
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(file.Name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.Header().Set("ETag", `"`+file.GoogleDriveMD5+`"`)
+	w.Header().Set("Last-Modified", file.ModTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	if err := g.pool.runner.ReadFileRange(file, offset, length, w); err != nil {
+		// The status line is already sent; the client sees a short body.
+		logger.Warning("S3 GET %s failed mid-stream: %v", p, err)
+	}
+	return nil
+}
+
+// spoolBody copies r to a new temporary file in dir and returns its path, size and hex MD5.
+func spoolBody(dir string, r io.Reader) (string, int64, string, error) {
+	f, err := os.CreateTemp(dir, "spool-*")
+	if err != nil {
+		return "", 0, "", fmt.Errorf("failed to create spool file: %w", err)
+	}
+	h := md5.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		if errors.Is(err, errPayloadMismatch) {
+			return "", 0, "", newS3Error(http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided x-amz-content-sha256 does not match the payload")
+		}
+		if errors.Is(err, errSignatureMismatch) {
+			return "", 0, "", newS3Error(http.StatusForbidden, "SignatureDoesNotMatch", "A chunk signature does not match")
+		}
+		return "", 0, "", err
+	}
+	return f.Name(), n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkContentMD5 compares a Content-MD5 header (base64) with the received body.
+func checkContentMD5(header, sum string) error {
+	if header == "" {
+		return nil
+	}
+	want, err := base64.StdEncoding.DecodeString(header)
+	if err != nil || hex.EncodeToString(want) != sum {
+		return newS3Error(http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what was received")
+	}
+	return nil
+}
+
+// store saves a spooled file as an object, removing the spool file.
+func (g *S3Gateway) store(spool, bucket, key string) error {
+	defer os.Remove(spool)
+	p := objectPath(bucket, key)
+	if hidden(p) {
+		return newS3Error(http.StatusForbidden, "AccessDenied", "The aux folder cannot be written")
+	}
+	if _, f, err := g.pool.resolve(p); err == nil && f == nil {
+		return newS3Error(http.StatusConflict, "InvalidRequest", "%s is a folder", p)
+	}
+	g.pool.writeMu.Lock()
+	defer g.pool.writeMu.Unlock()
+	return g.pool.runner.StorePoolFile(spool, p)
+}
+
+func (g *S3Gateway) putObject(w http.ResponseWriter, r *http.Request, bucket, key string, body io.Reader) error {
+	spool, size, sum, err := spoolBody(g.uploadDir, body)
+	if err != nil {
+		return err
+	}
+	if err := checkContentMD5(r.Header.Get("Content-MD5"), sum); err != nil {
+		os.Remove(spool)
+		return err
+	}
+
+	// A zero-byte key ending in "/" is a folder marker.
+	if strings.HasSuffix(key, "/") {
+		os.Remove(spool)
+		if size != 0 {
+			return newS3Error(http.StatusBadRequest, "InvalidRequest", "Keys ending in / name folders and cannot hold data")
+		}
+		g.pool.writeMu.Lock()
+		defer g.pool.writeMu.Unlock()
+		if err := g.pool.runner.MakePoolFolder(objectPath(bucket, key)); err != nil {
+			return err
+		}
+	} else if err := g.store(spool, bucket, key); err != nil {
+		return err
+	}
+	w.Header().Set("ETag", `"`+sum+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
+func (g *S3Gateway) copyObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	src, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return newS3Error(http.StatusBadRequest, "InvalidArgument", "Invalid x-amz-copy-source")
+	}
+	src, _, _ = strings.Cut(src, "?")
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+	if err := g.requireBucket(srcBucket); err != nil {
+		return err
+	}
+	if err := checkKey(srcKey); err != nil {
+		return err
+	}
+	srcPath := objectPath(srcBucket, srcKey)
+	if hidden(srcPath) {
+		return errNoSuchKey
+	}
+	file, err := g.activeFile(srcPath)
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		return errNoSuchKey
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(g.pool.runner.ReadFileRange(file, 0, -1, pw))
+	}()
+	spool, _, sum, err := spoolBody(g.uploadDir, pr)
+	pr.Close()
+	if err != nil {
+		return err
+	}
+	if file.GoogleDriveMD5 != "" && !strings.EqualFold(sum, file.GoogleDriveMD5) {
+		os.Remove(spool)
+		return fmt.Errorf("checksum mismatch reading %s: got %s, want %s", file.Path, sum, file.GoogleDriveMD5)
+	}
+	if err := g.store(spool, bucket, key); err != nil {
+		return err
+	}
+	return writeXML(w, http.StatusOK, &copyObjectResult{Xmlns: s3Namespace, LastModified: g.now().UTC().Format(s3TimeFormat), ETag: `"` + sum + `"`})
+}
+
+// deleteObject soft-deletes an object. Missing keys are not an error, as in S3. Deleting a
+// folder marker removes the folder only when nothing is left below it.
+func (g *S3Gateway) deleteObject(bucket, key string) error {
+	p := objectPath(bucket, key)
+	if hidden(p) {
+		return nil
+	}
+	lp, file, err := g.pool.resolve(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if lp == "/"+bucket {
+		return nil
+	}
+	g.pool.writeMu.Lock()
+	defer g.pool.writeMu.Unlock()
+	if file != nil {
+		return g.pool.runner.SoftDeletePoolFile(lp)
+	}
+	files, err := g.pool.db.GetFileSummaries(lp)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.Status == "active" {
+			return nil
+		}
+	}
+	return g.pool.runner.SoftDeletePoolFolder(lp)
+}
+
+type deleteRequest struct {
+	Quiet   bool `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deletedObject struct {
+	Key string `xml:"Key"`
+}
+
+type deleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name        `xml:"DeleteResult"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Deleted []deletedObject `xml:"Deleted"`
+	Errors  []deleteError   `xml:"Error"`
+}
+
+func (g *S3Gateway) deleteObjects(w http.ResponseWriter, bucket string, body io.Reader) error {
+	if err := g.requireBucket(bucket); err != nil {
+		return err
+	}
+	var req deleteRequest
+	if err := xml.NewDecoder(io.LimitReader(body, 2<<20)).Decode(&req); err != nil || len(req.Objects) > s3MaxKeys {
+		return errMalformedXML
+	}
+	res := &deleteResult{Xmlns: s3Namespace}
+	for _, obj := range req.Objects {
+		err := checkKey(obj.Key)
+		if err == nil {
+			err = g.deleteObject(bucket, obj.Key)
+		}
+		var s3err *s3Error
+		if errors.As(err, &s3err) {
+			res.Errors = append(res.Errors, deleteError{Key: obj.Key, Code: s3err.Code, Message: s3err.Message})
+		} else if err != nil {
+			res.Errors = append(res.Errors, deleteError{Key: obj.Key, Code: "InternalError", Message: err.Error()})
+		} else if !req.Quiet {
+			res.Deleted = append(res.Deleted, deletedObject{Key: obj.Key})
+		}
+	}
+	return writeXML(w, http.StatusOK, res)
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+func (g *S3Gateway) createMultipartUpload(w http.ResponseWriter, bucket, key string) error {
+	id := uuid.New().String()
+	dir := filepath.Join(g.uploadDir, id)
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create upload dir: %w", err)
+	}
+	g.mu.Lock()
+	g.uploads[id] = &multipartUpload{bucket: bucket, key: key, dir: dir, parts: make(map[int]s3Part)}
+	g.mu.Unlock()
+	return writeXML(w, http.StatusOK, &initiateMultipartUploadResult{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadID: id})
+}
+
+func (g *S3Gateway) upload(id string) (*multipartUpload, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	u, ok := g.uploads[id]
+	if !ok {
+		return nil, errNoSuchUpload
+	}
+	return u, nil
+}
+
+func (g *S3Gateway) uploadPart(w http.ResponseWriter, id, partNumber string, body io.Reader) error {
+	u, err := g.upload(id)
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(partNumber)
+	if err != nil || n < 1 || n > s3MaxPartNumber {
+		return newS3Error(http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and %d", s3MaxPartNumber)
+	}
+	spool, size, sum, err := spoolBody(u.dir, body)
+	if err != nil {
+		return err
+	}
+	partPath := filepath.Join(u.dir, fmt.Sprintf("part-%05d", n))
+	if err := os.Rename(spool, partPath); err != nil {
+		os.Remove(spool)
+		return err
+	}
+	g.mu.Lock()
+	u.parts[n] = s3Part{etag: sum, size: size}
+	g.mu.Unlock()
+	w.Header().Set("ETag", `"`+sum+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// completeMultipartUpload assembles the listed parts and stores the result. Storing can take
+// as long as uploading the whole object to every provider, so, like S3, the 200 status is sent
+// first and whitespace keeps the connection alive; a failure is reported in the body.
+func (g *S3Gateway) completeMultipartUpload(w http.ResponseWriter, bucket, key, id string, body io.Reader) error {
+	u, err := g.upload(id)
+	if err != nil {
+		return err
+	}
+	if u.bucket != bucket || u.key != key {
+		return errNoSuchUpload
+	}
+	var req completeMultipartUpload
+	if err := xml.NewDecoder(io.LimitReader(body, 2<<20)).Decode(&req); err != nil || len(req.Parts) == 0 {
+		return errMalformedXML
+	}
+
+	g.mu.Lock()
+	var files []string
+	etags := md5.New()
+	prev := 0
+	for _, p := range req.Parts {
+		part, ok := u.parts[p.PartNumber]
+		if p.PartNumber <= prev {
+			g.mu.Unlock()
+			return newS3Error(http.StatusBadRequest, "InvalidPartOrder", "Parts must be listed in ascending order")
+		}
+		if !ok || !strings.EqualFold(strings.Trim(p.ETag, `"`), part.etag) {
+			g.mu.Unlock()
+			return newS3Error(http.StatusBadRequest, "InvalidPart", "Part %d was not uploaded or its ETag does not match", p.PartNumber)
+		}
+		prev = p.PartNumber
+		sum, _ := hex.DecodeString(part.etag)
+		etags.Write(sum)
+		files = append(files, filepath.Join(u.dir, fmt.Sprintf("part-%05d", p.PartNumber)))
+	}
+	g.mu.Unlock()
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(etags.Sum(nil)), len(req.Parts))
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, xml.Header)
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	flush()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- g.assemble(files, bucket, key)
+	}()
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for waiting := true; waiting; {
+		select {
+		case <-ticker.C:
+			io.WriteString(w, " ")
+			flush()
+		case err = <-done:
+			waiting = false
+		}
+	}
+
+	enc := xml.NewEncoder(w)
+	if err != nil {
+		logger.Error("S3 multipart upload of %s failed: %v", objectPath(bucket, key), err)
+		return enc.Encode(&struct {
+			XMLName xml.Name `xml:"Error"`
+			*s3Error
+		}{s3Error: newS3Error(http.StatusInternalServerError, "InternalError", "%v", err)})
+	}
+	g.mu.Lock()
+	delete(g.uploads, id)
+	g.mu.Unlock()
+	os.RemoveAll(u.dir)
+	return enc.Encode(&completeMultipartUploadResult{Xmlns: s3Namespace, Location: "/" + bucket + "/" + key, Bucket: bucket, Key: key, ETag: etag})
+}
+
+// assemble concatenates part files into one spool file and stores it.
+func (g *S3Gateway) assemble(parts []string, bucket, key string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		for _, p := range parts {
+			f, err := os.Open(p)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			_, err = io.Copy(pw, f)
+			f.Close()
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+	spool, _, _, err := spoolBody(g.uploadDir, pr)
+	pr.Close()
+	if err != nil {
+		return err
+	}
+	return g.store(spool, bucket, key)
+}
+
+func (g *S3Gateway) abortMultipartUpload(w http.ResponseWriter, id string) error {
+	g.mu.Lock()
+	u, ok := g.uploads[id]
+	delete(g.uploads, id)
+	g.mu.Unlock()
+	if !ok {
+		return errNoSuchUpload
+	}
+	os.RemoveAll(u.dir)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) error {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func (g *S3Gateway) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var s3err *s3Error
+	if !errors.As(err, &s3err) {
+		switch {
+		case os.IsNotExist(err):
+			s3err = errNoSuchKey
+		default:
+			s3err = newS3Error(http.StatusInternalServerError, "InternalError", "%v", err)
+		}
+	}
+	if s3err.Status >= 500 {
+		logger.Warning("S3 %s %s: %v", r.Method, r.URL.Path, err)
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(s3err.Status)
+		return
+	}
+	writeXML(w, s3err.Status, &struct {
+		XMLName xml.Name `xml:"Error"`
+		*s3Error
+		Resource string `xml:"Resource"`
+	}{s3Error: s3err, Resource: r.URL.Path})
+}
@@ -0,0 +1,473 @@
+// Package server exposes the logical pool over network protocols.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/database"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/FranLegon/cloud-drives-sync/internal/task"
+	"golang.org/x/net/webdav"
+)
+
+// PoolFS presents the logical tree recorded in files and logical_folders as a
+// webdav.FileSystem. Reads stream from the best replica; writes are applied through the same
+// runner operations put and sync use, one at a time.
+type PoolFS struct {
+	runner *task.Runner
+	db     *database.DB
+	// writeMu serializes changes to the pool; the runner's placement and folder helpers assume
+	// a single writer.
+	writeMu sync.Mutex
+}
+
+// NewPoolFS creates a PoolFS over the runner's database.
+func NewPoolFS(runner *task.Runner, db *database.DB) *PoolFS {
+	return &PoolFS{runner: runner, db: db}
+}
+
+// WhileIdle runs fn with writes held back, e.g. to upload a consistent copy of the database.
+func (p *PoolFS) WhileIdle(fn func() error) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return fn()
+}
+
+// hidden reports whether p is inside the aux folder, which holds the tool's own state and is
+// not shown to clients.
+func hidden(p string) bool {
+	aux := "/" + task.AuxFolder
+	return p == aux || strings.HasPrefix(p, aux+"/")
+}
+
+// resolve returns the file at p, or nil when p is a folder, or os.ErrNotExist.
+func (p *PoolFS) resolve(name string) (string, *model.File, error) {
+	lp := task.CleanPoolPath(name)
+	if lp == "/" {
+		return lp, nil, nil
+	}
+	if hidden(lp) {
+		return lp, nil, os.ErrNotExist
+	}
+	file, err := p.db.GetFileByPath(lp)
+	if err != nil {
+		return lp, nil, err
+	}
+	if file != nil && file.Status == "active" {
+		return lp, file, nil
+	}
+	lf, err := p.db.GetLogicalFolderByPath(lp)
+	if err != nil {
+		return lp, nil, err
+	}
+	if lf != nil && lf.Status == "active" {
+		return lp, nil, nil
+	}
+	// Folders that only exist through the paths of their files (e.g. on Telegram).
+	files, err := p.db.GetFileSummaries(lp)
+	if err != nil {
+		return lp, nil, err
+	}
+	for _, f := range files {
+		if f.Status == "active" {
+			return lp, nil, nil
+		}
+	}
+	return lp, nil, os.ErrNotExist
+}
+
+// requireParent fails with os.ErrNotExist unless the parent of lp is a folder.
+func (p *PoolFS) requireParent(lp string) error {
+	_, file, err := p.resolve(path.Dir(lp))
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		return fmt.Errorf("%s is a file: %w", path.Dir(lp), os.ErrNotExist)
+	}
+	return nil
+}
+
+// Stat implements webdav.FileSystem.
+func (p *PoolFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	lp, file, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if file != nil {
+		return newFileInfo(file), nil
+	}
+	return &fileInfo{name: path.Base(lp), dir: true}, nil
+}
+
+// OpenFile implements webdav.FileSystem. Opening for writing always replaces the whole file, so
+// it requires O_CREATE or O_TRUNC.
+func (p *PoolFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return p.create(name, flag)
+	}
+	lp, file, err := p.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return &dirHandle{fs: p, path: lp}, nil
+	}
+	return &readHandle{fs: p, file: file}, nil
+}
+
+func (p *PoolFS) create(name string, flag int) (webdav.File, error) {
+	lp, file, err := p.resolve(name)
+	switch {
+	case err == nil && file == nil:
+		return nil, fmt.Errorf("%s is a folder: %w", lp, os.ErrInvalid)
+	case err == nil && flag&os.O_EXCL != 0:
+		return nil, os.ErrExist
+	case err == nil && flag&os.O_TRUNC == 0:
+		return nil, fmt.Errorf("%s: partial writes are not supported: %w", lp, os.ErrPermission)
+	case err != nil && (!os.IsNotExist(err) || flag&os.O_CREATE == 0):
+		return nil, err
+	case hidden(lp):
+		return nil, os.ErrPermission
+	}
+	if err := p.requireParent(lp); err != nil {
+		return nil, err
+	}
+	spool, err := os.CreateTemp("", "cds-webdav-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	return &writeHandle{fs: p, path: lp, spool: spool}, nil
+}
+
+// Mkdir implements webdav.FileSystem.
+func (p *PoolFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	lp, _, err := p.resolve(name)
+	if err == nil {
+		return os.ErrExist
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	if hidden(lp) {
+		return os.ErrPermission
+	}
+	if err := p.requireParent(lp); err != nil {
+		return err
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return p.runner.MakePoolFolder(lp)
+}
+
+// RemoveAll implements webdav.FileSystem. Files are soft-deleted, as sync does for files moved
+// into the soft-deleted folder on Google Drive.
+func (p *PoolFS) RemoveAll(ctx context.Context, name string) error {
+	lp, file, err := p.resolve(name)
+	if err != nil {
+		return err
+	}
+	if lp == "/" {
+		return os.ErrPermission
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	if file != nil {
+		return p.runner.SoftDeletePoolFile(lp)
+	}
+	return p.runner.SoftDeletePoolFolder(lp)
+}
+
+// Rename implements webdav.FileSystem. The handler removes an existing destination first when
+// the client asked to overwrite it.
+func (p *PoolFS) Rename(ctx context.Context, oldName, newName string) error {
+	oldPath, file, err := p.resolve(oldName)
+	if err != nil {
+		return err
+	}
+	newPath := task.CleanPoolPath(newName)
+	if oldPath == "/" || hidden(newPath) {
+		return os.ErrPermission
+	}
+	if _, _, err := p.resolve(newPath); err == nil {
+		return os.ErrExist
+	}
+	if err := p.requireParent(newPath); err != nil {
+		return err
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	if file != nil {
+		return p.runner.MovePoolFile(oldPath, newPath)
+	}
+	return p.runner.MovePoolFolder(oldPath, newPath)
+}
+
+// fileInfo describes a pool file or folder. It also provides the ETag and content type so the
+// WebDAV handler does not open files to compute them.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	md5     string
+}
+
+func newFileInfo(f *model.File) *fileInfo {
+	return &fileInfo{name: f.Name, size: f.Size, modTime: f.ModTime, md5: f.GoogleDriveMD5}
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() any           { return nil }
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// ETag implements webdav.ETager.
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.md5 != "" {
+		return `"` + fi.md5 + `"`, nil
+	}
+	return fmt.Sprintf(`"%x%x"`, fi.modTime.UnixNano(), fi.size), nil
+}
+
+// ContentType implements webdav.ContentTyper.
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if t := mime.TypeByExtension(path.Ext(fi.name)); t != "" {
+		return t, nil
+	}
+	return "application/octet-stream", nil
+}
+
+// dirHandle lists a pool folder.
+type dirHandle struct {
+	fs      *PoolFS
+	path    string
+	entries []fs.FileInfo
+	listed  bool
+}
+
+func (d *dirHandle) Readdir(count int) ([]fs.FileInfo, error) {
+	if !d.listed {
+		entries, err := task.ListPoolDir(d.fs.db, d.path, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if hidden(e.Path) {
+				continue
+			}
+			d.entries = append(d.entries, &fileInfo{name: e.Name, size: e.Size, modTime: e.ModTime, dir: e.IsDir, md5: e.GoogleDriveMD5})
+		}
+		d.listed = true
+	}
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+func (d *dirHandle) Stat() (fs.FileInfo, error) {
+	return &fileInfo{name: path.Base(d.path), dir: true}, nil
+}
+
+func (d *dirHandle) Read([]byte) (int, error)       { return 0, fmt.Errorf("%s is a folder", d.path) }
+func (d *dirHandle) Write([]byte) (int, error)      { return 0, fmt.Errorf("%s is a folder", d.path) }
+func (d *dirHandle) Seek(int64, int) (int64, error) { return 0, nil }
+func (d *dirHandle) Close() error                   { return nil }
+
+// readHandle streams a pool file. Each read position is served by one ReadFileRange call that
+// runs until the handle is closed or seeks elsewhere, so a ranged GET only fetches its range.
+type readHandle struct {
+	fs     *PoolFS
+	file   *model.File
+	offset int64
+	stream *io.PipeReader
+}
+
+func (h *readHandle) Read(b []byte) (int, error) {
+	if h.offset >= h.file.Size {
+		return 0, io.EOF
+	}
+	if h.stream == nil {
+		pr, pw := io.Pipe()
+		go func(offset int64) {
+			pw.CloseWithError(h.fs.runner.ReadFileRange(h.file, offset, -1, pw))
+		}(h.offset)
+		h.stream = pr
+	}
+	n, err := h.stream.Read(b)
+	h.offset += int64(n)
+	if err == io.EOF && h.offset < h.file.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (h *readHandle) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += h.offset
+	case io.SeekEnd:
+		offset += h.file.Size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative seek offset")
+	}
+	if offset != h.offset {
+		h.closeStream()
+		h.offset = offset
+	}
+	return offset, nil
+}
+
+func (h *readHandle) closeStream() {
+	if h.stream != nil {
+		h.stream.Close()
+		h.stream = nil
+	}
+}
+
+func (h *readHandle) Close() error {
+	h.closeStream()
+	return nil
+}
+
+func (h *readHandle) Stat() (fs.FileInfo, error) { return newFileInfo(h.file), nil }
+
+func (h *readHandle) Readdir(int) ([]fs.FileInfo, error) {
+	return nil, fmt.Errorf("%s is not a folder", h.file.Path)
+}
+
+func (h *readHandle) Write([]byte) (int, error) {
+	return 0, fmt.Errorf("%s is open for reading", h.file.Path)
+}
+
+// writeHandle spools an upload to a temporary file and stores it in the pool on Close.
+type writeHandle struct {
+	fs    *PoolFS
+	path  string
+	spool *os.File
+}
+
+func (h *writeHandle) Write(b []byte) (int, error) { return h.spool.Write(b) }
+
+func (h *writeHandle) Seek(offset int64, whence int) (int64, error) {
+	return h.spool.Seek(offset, whence)
+}
+
+func (h *writeHandle) Read([]byte) (int, error) {
+	return 0, fmt.Errorf("%s is open for writing", h.path)
+}
+
+func (h *writeHandle) Readdir(int) ([]fs.FileInfo, error) {
+	return nil, fmt.Errorf("%s is not a folder", h.path)
+}
+
+func (h *writeHandle) Stat() (fs.FileInfo, error) {
+	info, err := h.spool.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(h.path), size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+func (h *writeHandle) Close() error {
+	defer os.Remove(h.spool.Name())
+	if err := h.spool.Close(); err != nil {
+		return err
+	}
+	h.fs.writeMu.Lock()
+	defer h.fs.writeMu.Unlock()
+	if err := h.fs.runner.StorePoolFile(h.spool.Name(), h.path); err != nil {
+		return fmt.Errorf("failed to store %s: %w", h.path, err)
+	}
+	return nil
+}
+
+// Credentials checks HTTP basic auth passwords. Any user name is accepted.
+type Credentials struct {
+	secrets [][]byte
+}
+
+// NewCredentials accepts any of the given non-empty secrets as a password.
+func NewCredentials(secrets ...string) *Credentials {
+	c := &Credentials{}
+	for _, s := range secrets {
+		if s != "" {
+			c.secrets = append(c.secrets, []byte(s))
+		}
+	}
+	return c
+}
+
+// Valid reports whether password matches one of the secrets, in constant time per secret.
+func (c *Credentials) Valid(password string) bool {
+	ok := false
+	for _, s := range c.secrets {
+		if subtle.ConstantTimeCompare([]byte(password), s) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// Middleware rejects requests that carry neither a valid basic auth password nor a valid
+// bearer token.
+func (c *Credentials) Middleware(realm string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		password, ok := "", false
+		if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+			password, ok = token, true
+		} else {
+			_, password, ok = r.BasicAuth()
+		}
+		if !ok || !c.Valid(password) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewWebDAVHandler serves fs over WebDAV behind basic auth.
+func NewWebDAVHandler(fs *PoolFS, creds *Credentials) http.Handler {
+	h := &webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				logger.Warning("WebDAV %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	return creds.Middleware("cloud-drives-sync", h)
+}
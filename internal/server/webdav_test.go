@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/database"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/FranLegon/cloud-drives-sync/internal/task"
+)
+
+func openServerTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := database.OpenPath(filepath.Join(t.TempDir(), "server.db"), "poolServerPass!23")
+	if err != nil {
+		t.Fatalf("OpenPath: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	files := []*model.File{
+		{ID: "f-a", Path: "/docs/a.txt", Name: "a.txt", Size: 100, GoogleDriveMD5: "abc123", ModTime: modTime, Status: "active"},
+		{ID: "f-old", Path: "/docs/old.txt", Name: "old.txt", Size: 5, ModTime: modTime, Status: "soft-deleted"},
+		{ID: "f-aux", Path: "/" + task.AuxFolder + "/metadata.db", Name: "metadata.db", Size: 10, ModTime: modTime, Status: "active"},
+	}
+	for _, f := range files {
+		if err := db.InsertFile(f); err != nil {
+			t.Fatalf("InsertFile(%s): %v", f.Path, err)
+		}
+	}
+	return db
+}
+
+func TestPoolFSStat(t *testing.T) {
+	db := openServerTestDB(t)
+	fs := NewPoolFS(task.NewRunner(&model.Config{}, db, true), db)
+	ctx := context.Background()
+
+	fi, err := fs.Stat(ctx, "/docs/a.txt")
+	if err != nil {
+		t.Fatalf("Stat file: %v", err)
+	}
+	if fi.IsDir() || fi.Size() != 100 {
+		t.Fatalf("expected 100-byte file, got dir=%v size=%d", fi.IsDir(), fi.Size())
+	}
+	if etag, _ := fi.(*fileInfo).ETag(ctx); etag != `"abc123"` {
+		t.Fatalf("expected md5 etag, got %s", etag)
+	}
+
+	if fi, err := fs.Stat(ctx, "/docs/"); err != nil || !fi.IsDir() {
+		t.Fatalf("expected /docs to be a folder, got %v, %v", fi, err)
+	}
+	for _, name := range []string{"/docs/old.txt", "/missing", "/" + task.AuxFolder, "/" + task.AuxFolder + "/metadata.db"} {
+		if _, err := fs.Stat(ctx, name); !os.IsNotExist(err) {
+			t.Fatalf("Stat(%s): expected not-exist, got %v", name, err)
+		}
+	}
+}
+
+func TestPoolFSReaddirHidesAux(t *testing.T) {
+	db := openServerTestDB(t)
+	fs := NewPoolFS(task.NewRunner(&model.Config{}, db, true), db)
+
+	f, err := fs.OpenFile(context.Background(), "/", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	defer f.Close()
+	entries, err := f.Readdir(0)
+	if err != nil {
+		t.Fatalf("Readdir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "docs" || !entries[0].IsDir() {
+		t.Fatalf("expected only docs, got %v", entries)
+	}
+}
+
+func TestWebDAVHandlerAuth(t *testing.T) {
+	db := openServerTestDB(t)
+	h := NewWebDAVHandler(NewPoolFS(task.NewRunner(&model.Config{}, db, true), db), NewCredentials("s3cret"))
+
+	propfind := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PROPFIND", "/docs/", nil)
+		req.Header.Set("Depth", "1")
+		if password != "" {
+			req.SetBasicAuth("any", password)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := propfind(""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", rec.Code)
+	}
+	if rec := propfind("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with a wrong password, got %d", rec.Code)
+	}
+	rec := propfind("s3cret")
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("expected 207, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "/docs/a.txt") || strings.Contains(body, "old.txt") {
+		t.Fatalf("unexpected listing: %s", body)
+	}
+}
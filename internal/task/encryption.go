@@ -0,0 +1,183 @@
+package task
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/crypto"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/FranLegon/cloud-drives-sync/internal/telegram"
+)
+
+// errNoContentKey is returned when an encrypted replica is read or written without a content key.
+var errNoContentKey = errors.New("replica is encrypted but no content key is set")
+
+// SetContentKey sets the key wrapping the per-file keys of encrypted replicas (see
+// config.ContentKey). Without it, encrypted replicas cannot be read and no new replica is
+// encrypted.
+func (r *Runner) SetContentKey(key []byte) {
+	r.contentKey = key
+}
+
+// encrypts reports whether new replicas on provider are encrypted. Google replicas never are:
+// their MD5 is the identity of the logical file.
+func (r *Runner) encrypts(provider model.Provider) bool {
+	return provider != model.ProviderGoogle && r.contentKey != nil && slices.Contains(r.config.EncryptedProviders, provider)
+}
+
+// uploadSeal records the SHA-256 of the ciphertext of an encrypted upload as it is read.
+type uploadSeal struct {
+	h hash.Hash
+}
+
+// sealUpload returns the body to upload to provider for the size bytes of content read from src.
+// When provider stores encrypted replicas the body is encrypted under a new per-file key, its size
+// is the ciphertext size and seal is set; otherwise src is returned unchanged with a nil seal.
+func (r *Runner) sealUpload(provider model.Provider, src io.Reader, size int64) (io.Reader, int64, *uploadSeal, error) {
+	if !r.encrypts(provider) {
+		return src, size, nil, nil
+	}
+	enc, err := crypto.NewEncryptReader(r.contentKey, src)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to encrypt upload: %w", err)
+	}
+	seal := &uploadSeal{h: sha256.New()}
+	return io.TeeReader(enc, seal.h), crypto.EncryptedSize(size), seal, nil
+}
+
+// apply marks rep as the encrypted replica uploaded through the seal. A nil seal leaves it as is.
+func (s *uploadSeal) apply(rep *model.Replica) {
+	if s == nil {
+		return
+	}
+	rep.Encrypted = true
+	rep.CiphertextSHA256 = hex.EncodeToString(s.h.Sum(nil))
+}
+
+// applyToUpload marks the replica of an upload result as encrypted, for recordCopiedReplica.
+func (s *uploadSeal) applyToUpload(uploaded *model.File) {
+	if s == nil || uploaded == nil {
+		return
+	}
+	if len(uploaded.Replicas) == 0 {
+		uploaded.Replicas = []*model.Replica{{}}
+	}
+	s.apply(uploaded.Replicas[0])
+}
+
+// copySeal marks the replica of a server-side copy of source as encrypted when source is, since
+// the copy holds the same ciphertext.
+func copySeal(copied *model.File, source *model.Replica) {
+	if !source.Encrypted || copied == nil || len(copied.Replicas) == 0 {
+		return
+	}
+	copied.Replicas[0].Encrypted = true
+	copied.Replicas[0].CiphertextSHA256 = source.CiphertextSHA256
+}
+
+// plaintextSize returns the size of the content held by rep.
+func plaintextSize(rep *model.Replica) (int64, error) {
+	if !rep.Encrypted {
+		return rep.Size, nil
+	}
+	return crypto.PlaintextSize(rep.Size)
+}
+
+// downloadPlaintext writes the content of replica to w like downloadReplicaContent, decrypting an
+// encrypted replica with key.
+func downloadPlaintext(client api.CloudClient, replica *model.Replica, key []byte, w io.Writer) error {
+	if !replica.Encrypted {
+		return downloadReplicaContent(client, replica, w)
+	}
+	if key == nil {
+		return errNoContentKey
+	}
+	dw := crypto.NewDecryptWriter(key, w)
+	if err := downloadReplicaContent(client, replica, dw); err != nil {
+		return err
+	}
+	if err := dw.Close(); err != nil {
+		return fmt.Errorf("failed to decrypt replica: %w", err)
+	}
+	return nil
+}
+
+// readPlaintextRange writes length bytes of the content of rep starting at offset to w like
+// readReplicaRange. For an encrypted replica only the header and the chunks covering the range
+// are read and decrypted with key.
+func readPlaintextRange(client api.CloudClient, rep *model.Replica, key []byte, offset, length int64, w io.Writer) error {
+	if !rep.Encrypted {
+		return readReplicaRange(client, rep, offset, length, w)
+	}
+	if key == nil {
+		return errNoContentKey
+	}
+	size, err := crypto.PlaintextSize(rep.Size)
+	if err != nil {
+		return err
+	}
+
+	var header bytes.Buffer
+	if err := readReplicaRange(client, rep, 0, crypto.StreamHeaderSize, &header); err != nil {
+		return err
+	}
+	dw, err := crypto.NewRangeDecryptWriter(key, header.Bytes(), size, offset, length, w)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt replica: %w", err)
+	}
+	cipherOffset, cipherLength := crypto.StreamRange(size, offset, length)
+	if err := readReplicaRange(client, rep, cipherOffset, cipherLength, dw); err != nil {
+		return err
+	}
+	if err := dw.Close(); err != nil {
+		return fmt.Errorf("failed to decrypt replica: %w", err)
+	}
+	return nil
+}
+
+// EncryptTelegramCaptions rewrites the plaintext metadata captions of every Telegram account's
+// sync channel with the caption key set through telegram.SetCaptionKey. It returns the number of
+// captions rewritten; an account that fails is logged and the others are still migrated.
+func (r *Runner) EncryptTelegramCaptions() (int, error) {
+	total, failed := 0, 0
+	for i := range r.config.Users {
+		user := &r.config.Users[i]
+		if user.Provider != model.ProviderTelegram {
+			continue
+		}
+		client, err := r.GetOrCreateClient(user)
+		if err != nil {
+			logger.ErrorTagged(user.LogTags(), "Failed to create client: %v", err)
+			failed++
+			continue
+		}
+		tgClient, ok := api.Unwrap(client).(*telegram.Client)
+		if !ok {
+			continue
+		}
+		if r.safeMode {
+			logger.DryRunTagged(user.LogTags(), "Would encrypt plaintext captions of the sync channel")
+			continue
+		}
+		n, err := tgClient.EncryptCaptions()
+		total += n
+		if err != nil {
+			logger.ErrorTagged(user.LogTags(), "Failed to encrypt captions after %d: %v", n, err)
+			failed++
+			continue
+		}
+		logger.InfoTagged(user.LogTags(), "Encrypted %d caption(s)", n)
+	}
+	if failed > 0 {
+		return total, fmt.Errorf("failed to encrypt the captions of %d Telegram account(s)", failed)
+	}
+	return total, nil
+}
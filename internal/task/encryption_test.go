@@ -0,0 +1,78 @@
+package task
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/crypto"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+func TestEncryptedReplicaRoundTrip(t *testing.T) {
+	r := NewRunner(&model.Config{EncryptedProviders: []model.Provider{model.ProviderTelegram}}, nil, false)
+	r.SetContentKey(crypto.SubKey(make([]byte, 32), "replica-content"))
+
+	if _, _, seal, _ := r.sealUpload(model.ProviderGoogle, strings.NewReader("x"), 1); seal != nil {
+		t.Fatal("expected Google uploads to stay in plaintext")
+	}
+
+	content := make([]byte, 200_000)
+	rand.New(rand.NewSource(3)).Read(content)
+	body, size, seal, err := r.sealUpload(model.ProviderTelegram, bytes.NewReader(content), int64(len(content)))
+	if err != nil || seal == nil {
+		t.Fatalf("sealUpload: seal=%v err=%v", seal, err)
+	}
+	sealed, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if int64(len(sealed)) != size {
+		t.Fatalf("expected %d encrypted bytes, got %d", size, len(sealed))
+	}
+	if bytes.Contains(sealed, content[1000:1064]) {
+		t.Fatal("ciphertext contains plaintext")
+	}
+
+	// Store the ciphertext as Telegram fragments of uneven size
+	client := &rangeClient{contentClient: contentClient{content: make(map[string]string)}}
+	rep := &model.Replica{Provider: model.ProviderTelegram, Size: size, Fragmented: true}
+	for i, start := 0, 0; start < len(sealed); i++ {
+		end := min(start+70_001, len(sealed))
+		id := "frag-" + string(rune('a'+i))
+		client.content[id] = string(sealed[start:end])
+		rep.Fragments = append(rep.Fragments, &model.ReplicaFragment{FragmentNumber: i + 1, Size: int64(end - start), NativeFragmentID: id})
+		start = end
+	}
+	seal.apply(rep)
+	if sum := sha256.Sum256(sealed); !rep.Encrypted || rep.CiphertextSHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("expected the replica to record the ciphertext hash, got %+v", rep)
+	}
+	if got, err := plaintextSize(rep); err != nil || got != int64(len(content)) {
+		t.Fatalf("plaintextSize returned %d (%v)", got, err)
+	}
+
+	var out bytes.Buffer
+	if err := downloadPlaintext(client, rep, r.contentKey, &out); err != nil {
+		t.Fatalf("downloadPlaintext: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Fatal("decrypted download differs from the original content")
+	}
+
+	out.Reset()
+	if err := readPlaintextRange(client, rep, r.contentKey, 65_000, 70_000, &out); err != nil {
+		t.Fatalf("readPlaintextRange: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), content[65_000:135_000]) {
+		t.Fatal("decrypted range differs from the original content")
+	}
+
+	if err := downloadPlaintext(client, rep, nil, io.Discard); err != errNoContentKey {
+		t.Fatalf("expected errNoContentKey without a key, got %v", err)
+	}
+}
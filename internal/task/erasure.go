@@ -0,0 +1,793 @@
+package task
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/google/uuid"
+	"github.com/klauspost/reedsolomon"
+)
+
+const (
+	// ShardsFolder holds the shards of erasure-coded files under the aux folder.
+	ShardsFolder = "shards"
+
+	shardFilePrefix = "cloud-drives-sync-shard-"
+
+	// maxErasureShards bounds data plus parity shards; the Reed-Solomon code supports up to 256.
+	maxErasureShards = 256
+)
+
+// ErasureScheme is the number of data and parity shards an erasure-coded file is split into.
+// Any DataShards of the shards rebuild the file, so up to ParityShards of them can be lost.
+type ErasureScheme struct {
+	DataShards   int
+	ParityShards int
+}
+
+// ParseErasureScheme parses a scheme written as "k+m", e.g. "4+2".
+func ParseErasureScheme(s string) (*ErasureScheme, error) {
+	dataStr, parityStr, ok := strings.Cut(strings.TrimSpace(s), "+")
+	if !ok {
+		return nil, fmt.Errorf("invalid erasure scheme %q (use data+parity, e.g. 4+2)", s)
+	}
+	data, err := strconv.Atoi(strings.TrimSpace(dataStr))
+	if err != nil || data < 1 {
+		return nil, fmt.Errorf("invalid erasure scheme %q: data shards must be a positive number", s)
+	}
+	parity, err := strconv.Atoi(strings.TrimSpace(parityStr))
+	if err != nil || parity < 1 {
+		return nil, fmt.Errorf("invalid erasure scheme %q: parity shards must be a positive number", s)
+	}
+	if data+parity > maxErasureShards {
+		return nil, fmt.Errorf("invalid erasure scheme %q: at most %d shards in total", s, maxErasureShards)
+	}
+	return &ErasureScheme{DataShards: data, ParityShards: parity}, nil
+}
+
+func (s ErasureScheme) String() string {
+	return fmt.Sprintf("%d+%d", s.DataShards, s.ParityShards)
+}
+
+// SetErasure makes PutToPool store new files as erasure-coded shards instead of a full replica
+// per provider. nil restores full replicas.
+func (r *Runner) SetErasure(scheme *ErasureScheme) {
+	r.erasure = scheme
+}
+
+// isShardFile reports whether name is a shard of an erasure-coded file.
+func isShardFile(name string) bool {
+	return strings.HasPrefix(name, shardFilePrefix)
+}
+
+// shardFileName names a new upload of a shard. The random suffix keeps it apart from an older
+// object of the same shard, which is only deleted once the new one is recorded.
+func shardFileName(fileID string, index int) string {
+	return fmt.Sprintf("%s%s.%d.%s", shardFilePrefix, fileID, index, uuid.NewString()[:8])
+}
+
+// shardWorkDir creates a temporary directory for the shards of one file, in the spool when one
+// is configured.
+func (r *Runner) shardWorkDir() (string, error) {
+	r.spoolMu.Lock()
+	dir := r.spoolDir
+	r.spoolMu.Unlock()
+	return os.MkdirTemp(dir, "cds-shards-")
+}
+
+func shardPath(dir string, index int) string {
+	return filepath.Join(dir, strconv.Itoa(index))
+}
+
+// encodeShards splits the file at src (size bytes) into the data shards of scheme, computes the
+// parity shards, and writes them all to dir. It returns the shard size.
+func encodeShards(src string, size int64, scheme ErasureScheme, dir string) (int64, error) {
+	if size == 0 {
+		return 0, fmt.Errorf("an empty file cannot be erasure-coded")
+	}
+	enc, err := reedsolomon.NewStream(scheme.DataShards, scheme.ParityShards)
+	if err != nil {
+		return 0, err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	total := scheme.DataShards + scheme.ParityShards
+	files := make([]*os.File, total)
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}()
+	for i := range files {
+		if files[i], err = os.Create(shardPath(dir, i)); err != nil {
+			return 0, err
+		}
+	}
+
+	data := make([]io.Writer, scheme.DataShards)
+	for i := range data {
+		data[i] = files[i]
+	}
+	if err := enc.Split(in, data, size); err != nil {
+		return 0, fmt.Errorf("failed to split file into shards: %w", err)
+	}
+
+	readers := make([]io.Reader, scheme.DataShards)
+	for i := range readers {
+		if _, err := files[i].Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		readers[i] = files[i]
+	}
+	parity := make([]io.Writer, scheme.ParityShards)
+	for i := range parity {
+		parity[i] = files[scheme.DataShards+i]
+	}
+	if err := enc.Encode(readers, parity); err != nil {
+		return 0, fmt.Errorf("failed to compute parity shards: %w", err)
+	}
+
+	for i, f := range files {
+		files[i] = nil
+		if err := f.Close(); err != nil {
+			return 0, err
+		}
+	}
+	return (size + int64(scheme.DataShards) - 1) / int64(scheme.DataShards), nil
+}
+
+// rebuildShards recreates the shards listed in missing from the others in dir. Shards that are
+// neither present nor missing are left alone, so the caller only needs DataShards of them.
+func rebuildShards(dir string, scheme ErasureScheme, present, missing []int) error {
+	enc, err := reedsolomon.NewStream(scheme.DataShards, scheme.ParityShards)
+	if err != nil {
+		return err
+	}
+	total := scheme.DataShards + scheme.ParityShards
+	valid := make([]io.Reader, total)
+	fill := make([]io.Writer, total)
+	for _, i := range present {
+		f, err := os.Open(shardPath(dir, i))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		valid[i] = f
+	}
+	for _, i := range missing {
+		f, err := os.Create(shardPath(dir, i))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fill[i] = f
+	}
+	if err := enc.Reconstruct(valid, fill); err != nil {
+		return fmt.Errorf("failed to rebuild shards: %w", err)
+	}
+	for _, w := range fill {
+		if f, ok := w.(*os.File); ok {
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// joinShards writes the first size bytes held by the data shards in dir to out.
+func joinShards(dir string, scheme ErasureScheme, size int64, out io.Writer) error {
+	enc, err := reedsolomon.NewStream(scheme.DataShards, scheme.ParityShards)
+	if err != nil {
+		return err
+	}
+	readers := make([]io.Reader, scheme.DataShards)
+	for i := range readers {
+		f, err := os.Open(shardPath(dir, i))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers[i] = f
+	}
+	return enc.Join(out, readers, size)
+}
+
+// shardTarget is an account that can hold shards.
+type shardTarget struct {
+	user   *model.User
+	client api.CloudClient
+}
+
+func (t *shardTarget) key() string {
+	return string(t.user.Provider) + "\x00" + t.user.GetAccountID()
+}
+
+func shardKey(s *model.Shard) string {
+	return string(s.Provider) + "\x00" + s.AccountID
+}
+
+// shardAccounts returns the backup accounts with room for a shard of size bytes. Providers take
+// turns in PoolProviders order, and within a provider the accounts with the most free quota come
+// first, so consecutive shards land on different providers where possible.
+func (r *Runner) shardAccounts(size int64) []*shardTarget {
+	type candidate struct {
+		target *shardTarget
+		free   int64
+	}
+	byProvider := make(map[model.Provider][]candidate)
+	for i := range r.config.Users {
+		user := &r.config.Users[i]
+		if user.IsMain {
+			continue
+		}
+		client, err := r.GetOrCreateClient(user)
+		if err != nil {
+			logger.WarningTagged(user.LogTags(), "Skipping account for shard placement: %v", err)
+			continue
+		}
+		free := int64(1<<63 - 1)
+		if user.Provider != model.ProviderTelegram {
+			quota, err := r.getQuota(user, client)
+			if err != nil {
+				logger.WarningTagged(user.LogTags(), "Skipping account for shard placement: failed to get quota: %v", err)
+				continue
+			}
+			if quota.Total > 0 {
+				free = quota.Total - quota.Used
+			}
+		}
+		if free <= size {
+			continue
+		}
+		byProvider[user.Provider] = append(byProvider[user.Provider], candidate{&shardTarget{user: user, client: client}, free})
+	}
+
+	var lists [][]candidate
+	for _, p := range PoolProviders {
+		list := byProvider[p]
+		sort.SliceStable(list, func(i, j int) bool { return list[i].free > list[j].free })
+		if len(list) > 0 {
+			lists = append(lists, list)
+		}
+	}
+	var accounts []*shardTarget
+	for round := 0; ; round++ {
+		added := false
+		for _, list := range lists {
+			if round < len(list) {
+				accounts = append(accounts, list[round].target)
+				added = true
+			}
+		}
+		if !added {
+			return accounts
+		}
+	}
+}
+
+// placeShards picks an account for each of n shards, always the one holding the fewest shards of
+// the file so far (held, keyed by provider and account), in the order of accounts. No account
+// gets more than maxPerAccount shards, so losing any single account leaves the file readable.
+func placeShards(accounts []*shardTarget, n, maxPerAccount int, held map[string]int) ([]*shardTarget, error) {
+	counts := make(map[string]int, len(held))
+	for k, v := range held {
+		counts[k] = v
+	}
+	placed := make([]*shardTarget, 0, n)
+	for len(placed) < n {
+		var best *shardTarget
+		for _, a := range accounts {
+			if counts[a.key()] >= maxPerAccount {
+				continue
+			}
+			if best == nil || counts[a.key()] < counts[best.key()] {
+				best = a
+			}
+		}
+		if best == nil {
+			return nil, fmt.Errorf("not enough backup accounts with free space to place %d shard(s) with at most %d per account", n, maxPerAccount)
+		}
+		counts[best.key()]++
+		placed = append(placed, best)
+	}
+	return placed, nil
+}
+
+// shardFolderID returns the shard folder in the aux folder of an account, creating it if needed.
+func (r *Runner) shardFolderID(target *shardTarget) (string, error) {
+	cacheKey := "shards\x00" + target.key()
+	if id, ok := r.folderCache.Load(cacheKey); ok {
+		return id.(string), nil
+	}
+	rootID, err := target.client.GetSyncFolderID()
+	if err != nil {
+		return "", err
+	}
+	auxID, err := getAuxFolderID(target.client, target.user, rootID, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve aux folder: %w", err)
+	}
+	var folderID string
+	if target.user.Provider == model.ProviderTelegram {
+		folderID = auxID + "/" + ShardsFolder
+	} else if folderID, err = getOrCreateChildFolder(target.client, auxID, ShardsFolder); err != nil {
+		return "", fmt.Errorf("failed to ensure shard folder: %w", err)
+	}
+	r.folderCache.Store(cacheKey, folderID)
+	return folderID, nil
+}
+
+// uploadShard uploads the shard file at p to target and records where it went in shard.
+func (r *Runner) uploadShard(target *shardTarget, p string, shard *model.Shard) error {
+	folderID, err := r.shardFolderID(target)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	uploaded, err := api.WithRetryT(func() (*model.File, error) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return target.client.UploadFile(folderID, shardFileName(shard.FileID, shard.ShardIndex), f, shard.Size)
+	})
+	if err != nil {
+		return err
+	}
+	r.updateQuotaUsed(target.user, shard.Size)
+
+	shard.Provider = target.user.Provider
+	shard.AccountID = target.user.GetAccountID()
+	shard.NativeID = uploaded.ID
+	shard.Fragmented = false
+	shard.Fragments = nil
+	shard.Status = "active"
+	if len(uploaded.Replicas) > 0 {
+		up := uploaded.Replicas[0]
+		if up.NativeID != "" {
+			shard.NativeID = up.NativeID
+		}
+		shard.Fragmented = up.Fragmented
+		shard.Fragments = up.Fragments
+	}
+	return nil
+}
+
+// deleteShard removes the provider objects of a shard. Failures are logged and reported.
+func (r *Runner) deleteShard(shard *model.Shard) error {
+	user := r.getUser(shard.Provider, shard.AccountID)
+	if user == nil {
+		return fmt.Errorf("account %s not configured", shard.AccountID)
+	}
+	client, err := r.GetOrCreateClient(user)
+	if err != nil {
+		return err
+	}
+	ids := []string{shard.NativeID}
+	if shard.Fragmented {
+		ids = ids[:0]
+		for _, frag := range shard.Fragments {
+			ids = append(ids, frag.NativeFragmentID)
+		}
+	}
+	var lastErr error
+	for _, id := range ids {
+		if err := client.DeleteFile(id); err != nil {
+			logger.WarningTagged(user.LogTags(), "Failed to delete shard %d of file %s (native_id=%s): %v", shard.ShardIndex, shard.FileID, id, err)
+			lastErr = err
+		}
+	}
+	if lastErr == nil {
+		r.updateQuotaUsed(user, -shard.Size)
+	}
+	return lastErr
+}
+
+// storeShards erasure-codes the local file of item under fileID with scheme and uploads the
+// shards, spread over the backup accounts. Nothing is left behind in the cloud when it fails.
+func (r *Runner) storeShards(item putItem, fileID string, scheme ErasureScheme) ([]*model.Shard, error) {
+	dir, err := r.shardWorkDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create shard directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	shardSize, err := encodeShards(item.localPath, item.size, scheme, dir)
+	if err != nil {
+		return nil, err
+	}
+	total := scheme.DataShards + scheme.ParityShards
+	targets, err := placeShards(r.shardAccounts(shardSize), total, scheme.ParityShards, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	shards := make([]*model.Shard, 0, total)
+	for i, target := range targets {
+		sum, err := fileSHA256(shardPath(dir, i))
+		if err != nil {
+			return nil, err
+		}
+		shard := &model.Shard{
+			FileID:       fileID,
+			ShardIndex:   i,
+			DataShards:   scheme.DataShards,
+			ParityShards: scheme.ParityShards,
+			Size:         shardSize,
+			SHA256:       sum,
+		}
+		logger.InfoTagged(target.user.LogTags(), "Uploading shard %d/%d of path=%q (%d bytes)...", i+1, total, item.logicalPath, shardSize)
+		if err := r.uploadShard(target, shardPath(dir, i), shard); err != nil {
+			for _, s := range shards {
+				r.deleteShard(s)
+			}
+			return nil, fmt.Errorf("failed to upload shard %d to %s: %w", i, target.user.GetAccountID(), err)
+		}
+		shards = append(shards, shard)
+	}
+	return shards, nil
+}
+
+// retireShards deletes the shards of a file that is being replaced or removed, and forgets them.
+func (r *Runner) retireShards(fileID string) {
+	shards, err := r.db.GetFileShards(fileID)
+	if err != nil {
+		logger.Warning("Failed to load shards of file %s: %v", fileID, err)
+		return
+	}
+	for _, s := range shards {
+		if s.Status == "active" {
+			r.deleteShard(s)
+		}
+	}
+	if len(shards) > 0 {
+		if err := r.db.ReplaceFileShards(fileID, nil); err != nil {
+			logger.Warning("Failed to remove shard records of file %s: %v", fileID, err)
+		}
+	}
+}
+
+// errNotEnoughShards means fewer than DataShards shards of a file could be read.
+var errNotEnoughShards = errors.New("not enough intact shards to rebuild the file")
+
+// fetchShards downloads shards into dir, checking each against its size and SHA-256, and stops
+// once want of them are intact (all of them when want is zero). It returns the indexes of the
+// intact shards and of those that could not be read.
+func (r *Runner) fetchShards(file *model.File, shards []*model.Shard, dir string, want int) (good, bad []int) {
+	for _, s := range shards {
+		if want > 0 && len(good) >= want {
+			break
+		}
+		if s.Status != "active" {
+			bad = append(bad, s.ShardIndex)
+			continue
+		}
+		if err := r.fetchShard(s, shardPath(dir, s.ShardIndex)); err != nil {
+			logger.Warning("Shard %d of path=%q on %s/%s is unusable: %v", s.ShardIndex, file.Path, s.Provider, s.AccountID, err)
+			bad = append(bad, s.ShardIndex)
+			continue
+		}
+		good = append(good, s.ShardIndex)
+	}
+	return good, bad
+}
+
+// fetchShard downloads one shard to p and verifies it.
+func (r *Runner) fetchShard(s *model.Shard, p string) error {
+	user := r.getUser(s.Provider, s.AccountID)
+	if user == nil {
+		return fmt.Errorf("account %s not configured", s.AccountID)
+	}
+	client, err := r.GetOrCreateClient(user)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	var written int64
+	rep := &model.Replica{NativeID: s.NativeID, Fragmented: s.Fragmented, Fragments: s.Fragments}
+	err = api.WithRetry(func() error {
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := out.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		h.Reset()
+		cw := &countingWriter{w: io.MultiWriter(out, h)}
+		err := downloadReplicaContent(client, rep, cw)
+		written = cw.n
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if written != s.Size {
+		return fmt.Errorf("size mismatch: expected %d bytes, got %d", s.Size, written)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, s.SHA256) {
+		return fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", s.SHA256, sum)
+	}
+	return out.Close()
+}
+
+// shardScheme returns the scheme recorded on a file's shards.
+func shardScheme(shards []*model.Shard) ErasureScheme {
+	return ErasureScheme{DataShards: shards[0].DataShards, ParityShards: shards[0].ParityShards}
+}
+
+// downloadShardedFile rebuilds an erasure-coded file into partPath from the first DataShards
+// intact shards and checks it against the file's size and Google Drive MD5.
+func (r *Runner) downloadShardedFile(file *model.File, shards []*model.Shard, partPath string) error {
+	dir, err := r.shardWorkDir()
+	if err != nil {
+		return fmt.Errorf("failed to create shard directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	scheme := shardScheme(shards)
+	good, _ := r.fetchShards(file, shards, dir, scheme.DataShards)
+	if len(good) < scheme.DataShards {
+		return fmt.Errorf("%w: %d of %d needed", errNotEnoughShards, len(good), scheme.DataShards)
+	}
+	var missing []int
+	for i := 0; i < scheme.DataShards; i++ {
+		if !containsInt(good, i) {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) > 0 {
+		logger.Info("Rebuilding %d data shard(s) of path=%q from parity...", len(missing), file.Path)
+		if err := rebuildShards(dir, scheme, good, missing); err != nil {
+			return err
+		}
+	}
+
+	out, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	h := md5.New()
+	if err := joinShards(dir, scheme, file.Size, io.MultiWriter(out, h)); err != nil {
+		return fmt.Errorf("failed to join shards: %w", err)
+	}
+	if file.GoogleDriveMD5 != "" {
+		if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, file.GoogleDriveMD5) {
+			return fmt.Errorf("checksum mismatch: expected md5 %s, got %s", file.GoogleDriveMD5, sum)
+		}
+	}
+	return out.Close()
+}
+
+// readShardedRange writes length bytes of an erasure-coded file starting at offset to w. Data
+// shards hold the file in order, so the range is read straight from them; when one of them
+// fails, the whole file is rebuilt from any DataShards shards and the range copied from it.
+func (r *Runner) readShardedRange(file *model.File, shards []*model.Shard, offset, length int64, w io.Writer) error {
+	scheme := shardScheme(shards)
+	shardSize := shards[0].Size
+	cw := &countingWriter{w: w}
+	var err error
+	for _, s := range shards[:scheme.DataShards] {
+		start := int64(s.ShardIndex) * shardSize
+		end := start + shardSize
+		if end <= offset+cw.n || start >= offset+length {
+			continue
+		}
+		from := offset + cw.n - start
+		to := min(offset+length, end) - start
+		if err = r.readShardRange(s, from, to-from, cw); err != nil {
+			logger.Warning("Read of shard %d of path=%q failed, rebuilding the file: %v", s.ShardIndex, file.Path, err)
+			break
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	dir, err := r.shardWorkDir()
+	if err != nil {
+		return fmt.Errorf("failed to create shard directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	part := filepath.Join(dir, "file")
+	if err := r.downloadShardedFile(file, shards, part); err != nil {
+		return err
+	}
+	f, err := os.Open(part)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	done := cw.n
+	_, err = io.Copy(w, io.NewSectionReader(f, offset+done, length-done))
+	return err
+}
+
+func (r *Runner) readShardRange(s *model.Shard, offset, length int64, w io.Writer) error {
+	if s.Status != "active" {
+		return fmt.Errorf("shard is %s", s.Status)
+	}
+	user := r.getUser(s.Provider, s.AccountID)
+	if user == nil {
+		return fmt.Errorf("account %s not configured", s.AccountID)
+	}
+	client, err := r.GetOrCreateClient(user)
+	if err != nil {
+		return err
+	}
+	return readReplicaRange(client, &model.Replica{NativeID: s.NativeID, Fragmented: s.Fragmented, Fragments: s.Fragments}, offset, length, w)
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ScrubResult summarizes a ScrubShards run.
+type ScrubResult struct {
+	Files         int
+	Healthy       int
+	Healed        int
+	Unrecoverable int
+	Failed        int
+	ShardsRebuilt int
+}
+
+// ScrubShards downloads every shard of every erasure-coded file and checks it against its
+// recorded size and SHA-256. Missing or corrupt shards are rebuilt from the intact ones and
+// uploaded again, to the accounts holding the fewest shards of the file; the old objects are
+// removed. A file with fewer than DataShards intact shards is reported as unrecoverable.
+func (r *Runner) ScrubShards() (*ScrubResult, error) {
+	ids, err := r.db.GetShardedFileIDs()
+	if err != nil {
+		return nil, err
+	}
+	res := &ScrubResult{}
+	for i, id := range ids {
+		file, err := r.db.GetFileByID(id)
+		if err != nil {
+			return res, err
+		}
+		shards, err := r.db.GetFileShards(id)
+		if err != nil {
+			return res, err
+		}
+		if file == nil || len(shards) == 0 {
+			continue
+		}
+		res.Files++
+		logger.Info("[%d/%d] Scrubbing %d shard(s) of %s", i+1, len(ids), len(shards), file.Path)
+		if err := r.scrubFile(file, shards, res); err != nil {
+			logger.Error("Failed to heal path=%q: %v", file.Path, err)
+			res.Failed++
+		}
+	}
+	if res.Unrecoverable > 0 || res.Failed > 0 {
+		return res, fmt.Errorf("%d file(s) unrecoverable, %d could not be healed", res.Unrecoverable, res.Failed)
+	}
+	return res, nil
+}
+
+// scrubFile checks the shards of one file and heals the broken ones.
+func (r *Runner) scrubFile(file *model.File, shards []*model.Shard, res *ScrubResult) error {
+	dir, err := r.shardWorkDir()
+	if err != nil {
+		return fmt.Errorf("failed to create shard directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	scheme := shardScheme(shards)
+	good, bad := r.fetchShards(file, shards, dir, 0)
+	if len(bad) == 0 {
+		res.Healthy++
+		return nil
+	}
+	if len(good) < scheme.DataShards {
+		logger.Error("path=%q is unrecoverable: %d of %d shards intact, %d needed", file.Path, len(good), len(shards), scheme.DataShards)
+		res.Unrecoverable++
+		r.markShardsMissing(shards, bad)
+		return nil
+	}
+	if r.safeMode {
+		logger.DryRun("Would rebuild shard(s) %v of %s", bad, file.Path)
+		return nil
+	}
+
+	if err := rebuildShards(dir, scheme, good[:scheme.DataShards], bad); err != nil {
+		r.markShardsMissing(shards, bad)
+		return err
+	}
+
+	held := make(map[string]int)
+	byIndex := make(map[int]*model.Shard, len(shards))
+	for _, s := range shards {
+		byIndex[s.ShardIndex] = s
+		if containsInt(good, s.ShardIndex) {
+			held[shardKey(s)]++
+		}
+	}
+	targets, err := placeShards(r.shardAccounts(shards[0].Size), len(bad), scheme.ParityShards, held)
+	if err != nil {
+		r.markShardsMissing(shards, bad)
+		return err
+	}
+
+	var lastErr error
+	for i, index := range bad {
+		s := byIndex[index]
+		if sum, err := fileSHA256(shardPath(dir, index)); err != nil || !strings.EqualFold(sum, s.SHA256) {
+			lastErr = fmt.Errorf("rebuilt shard %d does not match its recorded checksum", index)
+			r.markShardsMissing(shards, []int{index})
+			continue
+		}
+		old := *s
+		logger.InfoTagged(targets[i].user.LogTags(), "Uploading rebuilt shard %d of path=%q (%d bytes)...", index, file.Path, s.Size)
+		if err := r.uploadShard(targets[i], shardPath(dir, index), s); err != nil {
+			lastErr = fmt.Errorf("failed to upload rebuilt shard %d: %w", index, err)
+			r.markShardsMissing(shards, []int{index})
+			continue
+		}
+		if err := r.db.UpdateFileShard(s); err != nil {
+			return err
+		}
+		if old.Status == "active" {
+			r.deleteShard(&old)
+		}
+		res.ShardsRebuilt++
+	}
+	if lastErr != nil {
+		return lastErr
+	}
+	res.Healed++
+	return nil
+}
+
+// markShardsMissing records the listed shards as missing so readers skip them until healed.
+func (r *Runner) markShardsMissing(shards []*model.Shard, indexes []int) {
+	if r.safeMode {
+		return
+	}
+	for _, s := range shards {
+		if !containsInt(indexes, s.ShardIndex) || s.Status == "missing" {
+			continue
+		}
+		s.Status = "missing"
+		if err := r.db.UpdateFileShard(s); err != nil {
+			logger.Warning("Failed to mark shard %d of file %s missing: %v", s.ShardIndex, s.FileID, err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package task
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+func TestParseErasureScheme(t *testing.T) {
+	scheme, err := ParseErasureScheme(" 4+2 ")
+	if err != nil || scheme.DataShards != 4 || scheme.ParityShards != 2 {
+		t.Fatalf("expected 4+2, got %+v (%v)", scheme, err)
+	}
+	for _, bad := range []string{"4", "0+2", "4+0", "a+b", "200+100"} {
+		if _, err := ParseErasureScheme(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+// writeShardedTestFile erasure-codes size random bytes with scheme into a new directory and
+// returns the content and the directory.
+func writeShardedTestFile(t *testing.T, size int, scheme ErasureScheme) ([]byte, string, int64) {
+	t.Helper()
+	content := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(content)
+	src := filepath.Join(t.TempDir(), "src.bin")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	dir := t.TempDir()
+	shardSize, err := encodeShards(src, int64(size), scheme, dir)
+	if err != nil {
+		t.Fatalf("encodeShards: %v", err)
+	}
+	return content, dir, shardSize
+}
+
+func TestEncodeRebuildAndJoinShards(t *testing.T) {
+	scheme := ErasureScheme{DataShards: 4, ParityShards: 2}
+	content, dir, shardSize := writeShardedTestFile(t, 10001, scheme)
+	if shardSize != 2501 {
+		t.Fatalf("expected shards of 2501 bytes, got %d", shardSize)
+	}
+
+	sums := make([]string, 6)
+	for i := range sums {
+		sum, err := fileSHA256(shardPath(dir, i))
+		if err != nil {
+			t.Fatalf("fileSHA256: %v", err)
+		}
+		sums[i] = sum
+	}
+
+	// Lose one data shard and one parity shard.
+	os.Remove(shardPath(dir, 1))
+	os.Remove(shardPath(dir, 4))
+	if err := rebuildShards(dir, scheme, []int{0, 2, 3, 5}, []int{1, 4}); err != nil {
+		t.Fatalf("rebuildShards: %v", err)
+	}
+	for _, i := range []int{1, 4} {
+		if sum, _ := fileSHA256(shardPath(dir, i)); sum != sums[i] {
+			t.Fatalf("rebuilt shard %d differs from the original", i)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := joinShards(dir, scheme, int64(len(content)), &out); err != nil {
+		t.Fatalf("joinShards: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Fatal("joined shards differ from the original content")
+	}
+}
+
+func TestPlaceShardsSpreadsAndCapsPerAccount(t *testing.T) {
+	target := func(p model.Provider, id string) *shardTarget {
+		u := &model.User{Provider: p, Email: id, Phone: id}
+		return &shardTarget{user: u}
+	}
+	g1, m1, t1, g2 := target(model.ProviderGoogle, "g1"), target(model.ProviderMicrosoft, "m1"), target(model.ProviderTelegram, "t1"), target(model.ProviderGoogle, "g2")
+	accounts := []*shardTarget{g1, m1, t1, g2}
+
+	placed, err := placeShards(accounts, 6, 2, nil)
+	if err != nil {
+		t.Fatalf("placeShards: %v", err)
+	}
+	var got []string
+	for _, a := range placed {
+		got = append(got, a.user.GetAccountID())
+	}
+	if want := "g1,m1,t1,g2,g1,m1"; strings.Join(got, ",") != want {
+		t.Fatalf("expected placement %s, got %s", want, strings.Join(got, ","))
+	}
+
+	held := map[string]int{g1.key(): 2, m1.key(): 2, t1.key(): 1}
+	placed, err = placeShards(accounts, 2, 2, held)
+	if err != nil {
+		t.Fatalf("placeShards with held shards: %v", err)
+	}
+	if placed[0] != g2 || placed[1] != t1 {
+		t.Fatalf("expected the rebuilt shards on g2 and t1, got %s and %s", placed[0].user.GetAccountID(), placed[1].user.GetAccountID())
+	}
+
+	if _, err := placeShards(accounts[:2], 6, 2, nil); err == nil {
+		t.Fatal("expected placement to fail with too few accounts")
+	}
+}
+
+func TestDownloadShardedFileRebuildsFromParity(t *testing.T) {
+	scheme := ErasureScheme{DataShards: 3, ParityShards: 2}
+	content, dir, shardSize := writeShardedTestFile(t, 7000, scheme)
+
+	user := model.User{Provider: model.ProviderMicrosoft, Email: "ms@example.com"}
+	r := NewRunner(&model.Config{Users: []model.User{user}}, nil, false)
+	r.SetSpool(t.TempDir(), 0)
+	client := &contentClient{content: make(map[string]string)}
+	r.clients[user.CacheKey()] = client
+
+	var shards []*model.Shard
+	for i := 0; i < 5; i++ {
+		data, err := os.ReadFile(shardPath(dir, i))
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		sum, _ := fileSHA256(shardPath(dir, i))
+		id := "shard-" + string(rune('0'+i))
+		client.content[id] = string(data)
+		shards = append(shards, &model.Shard{
+			ShardIndex: i, DataShards: 3, ParityShards: 2, Size: shardSize, SHA256: sum,
+			Provider: user.Provider, AccountID: user.Email, NativeID: id, Status: "active",
+		})
+	}
+	// Shard 0 is gone and shard 2 is corrupt; shards 1, 3 and 4 still rebuild the file.
+	delete(client.content, "shard-0")
+	client.content["shard-2"] = strings.Repeat("x", int(shardSize))
+
+	sum := md5.Sum(content)
+	file := &model.File{Path: "/archive.bin", Size: int64(len(content)), GoogleDriveMD5: hex.EncodeToString(sum[:])}
+	part := filepath.Join(t.TempDir(), "archive.bin"+partSuffix)
+	if err := r.downloadShardedFile(file, shards, part); err != nil {
+		t.Fatalf("downloadShardedFile: %v", err)
+	}
+	got, err := os.ReadFile(part)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatal("rebuilt file differs from the original content")
+	}
+
+	delete(client.content, "shard-3")
+	if err := r.downloadShardedFile(file, shards, part); err == nil || !strings.Contains(err.Error(), "not enough intact shards") {
+		t.Fatalf("expected not enough shards, got %v", err)
+	}
+}
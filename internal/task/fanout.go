@@ -0,0 +1,480 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/FranLegon/cloud-drives-sync/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// errNoLiveUpload stops a fan-out download once every upload reading from it has failed.
+var errNoLiveUpload = errors.New("every upload reading the download failed")
+
+// copyTarget is the destination of one copy in a fan-out: a folder in one account.
+type copyTarget struct {
+	provider model.Provider
+	user     *model.User
+	client   api.CloudClient
+	parentID string
+}
+
+// copyResult is the outcome of a copy to one copyTarget.
+type copyResult struct {
+	file *model.File
+	err  error
+}
+
+// SetSpool configures the on-disk spool used by fan-out copies. A download is staged in dir when
+// the files spooled at the same time stay within maxBytes, so each upload can be retried without
+// downloading again; larger files are streamed. An empty dir disables the spool.
+func (r *Runner) SetSpool(dir string, maxBytes int64) {
+	r.spoolMu.Lock()
+	defer r.spoolMu.Unlock()
+	r.spoolDir = dir
+	r.spoolMax = maxBytes
+}
+
+// reserveSpool reserves size bytes of the spool, reporting false when it is disabled or full.
+func (r *Runner) reserveSpool(size int64) bool {
+	r.spoolMu.Lock()
+	defer r.spoolMu.Unlock()
+	if r.spoolDir == "" || size > r.spoolMax-r.spoolUsed {
+		return false
+	}
+	r.spoolUsed += size
+	return true
+}
+
+// releaseSpool returns size bytes reserved by reserveSpool.
+func (r *Runner) releaseSpool(size int64) {
+	r.spoolMu.Lock()
+	defer r.spoolMu.Unlock()
+	r.spoolUsed -= size
+}
+
+// copyFileToProviders copies masterFile to one account of each of providers. A target first tries
+// a server-side copy from a replica of its own provider; the remaining targets share a single
+// download, taken from all replicas at once for a large file, and otherwise from one source
+// replica at a time until every target has a copy. It returns the error of each provider that
+// did not get one. syncRunID is used to checkpoint the copies for crash recovery; pass 0 to
+// disable.
+func (r *Runner) copyFileToProviders(masterFile *model.File, providers []model.Provider, targetName string, syncRunID int64) (errs map[model.Provider]error) {
+	providerNames := make([]string, len(providers))
+	for i, provider := range providers {
+		providerNames[i] = string(provider)
+	}
+	ctx, span := tracing.Start(nil, "copyFile", attribute.String("path", masterFile.Path), attribute.StringSlice("providers", providerNames), attribute.Int64("size", masterFile.Size))
+	errs = make(map[model.Provider]error)
+	defer func() {
+		var all []error
+		for _, err := range errs {
+			all = append(all, err)
+		}
+		tracing.End(span, errors.Join(all...))
+	}()
+
+	failAll := func(err error) map[model.Provider]error {
+		for _, provider := range providers {
+			errs[provider] = err
+		}
+		return errs
+	}
+
+	// 1. Filter viable replicas (ignore shortcuts and deleted replicas)
+	if len(masterFile.Replicas) == 0 {
+		return failAll(fmt.Errorf("file has no replicas"))
+	}
+	var viableReplicas []*model.Replica
+	for _, rep := range masterFile.Replicas {
+		if rep.NativeHash == model.NativeHashShortcut || rep.Status != "active" {
+			continue
+		}
+		viableReplicas = append(viableReplicas, rep)
+	}
+	if len(viableReplicas) == 0 {
+		return failAll(fmt.Errorf("file has no viable replicas (only shortcuts found)"))
+	}
+
+	finalName := masterFile.Name
+	if targetName != "" {
+		finalName = targetName
+	}
+
+	// 2. Resolve the destination account and folder of each provider
+	dir := model.NormalizePath(filepath.Dir(masterFile.Path))
+	var targets []*copyTarget
+	for _, provider := range providers {
+		destClient, destUser, err := r.getDestinationClient(provider, masterFile.Size)
+		if err != nil {
+			errs[provider] = fmt.Errorf("failed to get destination client: %w", err)
+			continue
+		}
+		destClient = tracing.Bind(destClient, ctx)
+
+		parentID, err := r.ensureFolderStructure(destClient, dir, provider)
+		if err != nil {
+			errs[provider] = fmt.Errorf("failed to ensure folder structure: %w", err)
+			continue
+		}
+		targets = append(targets, &copyTarget{provider: provider, user: destUser, client: destClient, parentID: parentID})
+	}
+
+	sourceClients := make(map[string]api.CloudClient)
+	sourceClient := func(replica *model.Replica) (api.CloudClient, error) {
+		key := string(replica.Provider) + ":" + replica.AccountID
+		if client, ok := sourceClients[key]; ok {
+			return client, nil
+		}
+		sourceUser := r.getUser(replica.Provider, replica.AccountID)
+		if sourceUser == nil {
+			return nil, fmt.Errorf("user not found for replica %s", replica.AccountID)
+		}
+		client, err := r.GetOrCreateClient(sourceUser)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get source client for replica %s: %w", replica.AccountID, err)
+		}
+		client = tracing.Bind(client, ctx)
+		sourceClients[key] = client
+		return client, nil
+	}
+
+	// 3. Copy server-side where a replica lives on the target's own provider
+	var pending []*copyTarget
+	for _, target := range targets {
+		copied := false
+		for _, replica := range viableReplicas {
+			// A server-side copy keeps the content as stored, encrypted or not
+			if replica.Provider != target.provider || replica.Encrypted != r.encrypts(target.provider) {
+				continue
+			}
+			client, err := sourceClient(replica)
+			if err != nil {
+				continue
+			}
+			start := time.Now()
+			if file, ok := r.serverCopy(target.client, client, replica, target.provider, target.parentID, finalName); ok {
+				copySeal(file, replica)
+				r.recordCopy(syncRunID, true, masterFile.Size, time.Since(start))
+				r.recordCopiedReplica(masterFile, target.provider, target.user, finalName, file, syncRunID)
+				copied = true
+				break
+			}
+		}
+		if !copied {
+			pending = append(pending, target)
+		}
+	}
+
+	// collect records the copies of a fan-out and returns the targets that still need one
+	collect := func(targets []*copyTarget, results map[*copyTarget]copyResult, elapsed time.Duration) []*copyTarget {
+		var failed []*copyTarget
+		for _, target := range targets {
+			result := results[target]
+			if result.err != nil {
+				errs[target.provider] = result.err
+				failed = append(failed, target)
+				continue
+			}
+			delete(errs, target.provider)
+			r.recordCopy(syncRunID, false, masterFile.Size, elapsed)
+			r.recordCopiedReplica(masterFile, target.provider, target.user, finalName, result.file, syncRunID)
+		}
+		return failed
+	}
+
+	// 4. Download a large file from all replicas at once
+	if len(pending) > 0 && masterFile.Size >= multiSourceMinSize {
+		if sources := r.rangeSources(masterFile, viableReplicas); useMultiSource(masterFile.Size, sources) {
+			start := time.Now()
+			if results := r.fanOutMultiSource(masterFile, sources, pending, finalName); results != nil {
+				pending = collect(pending, results, time.Since(start))
+			}
+		}
+	}
+
+	// 5. Download the file once per attempt and upload it to every remaining target
+	for i, replica := range viableReplicas {
+		if len(pending) == 0 {
+			break
+		}
+		logger.Info("Copying path=%q (as %s) from_provider=%s native_id=%s to %d account(s) (Replica %d/%d)...", masterFile.Path, finalName, replica.Provider, replica.NativeID, len(pending), i+1, len(viableReplicas))
+
+		client, err := sourceClient(replica)
+		if err != nil {
+			logger.Warning("Copy failed (source client) path=%q provider=%s account=%s: %v", masterFile.Path, replica.Provider, replica.AccountID, err)
+			for _, target := range pending {
+				errs[target.provider] = err
+			}
+			continue
+		}
+
+		start := time.Now()
+		results := r.fanOutReplica(client, replica, masterFile, pending, finalName)
+		pending = collect(pending, results, time.Since(start))
+	}
+
+	for _, target := range pending {
+		errs[target.provider] = fmt.Errorf("failed to copy file %s after %d attempts. Last error: %w", masterFile.Name, len(viableReplicas), errs[target.provider])
+	}
+	return errs
+}
+
+// fanOutReplica downloads replica once and uploads it as name to every target, through the spool
+// when it has room for the file and through a pipe per target otherwise.
+func (r *Runner) fanOutReplica(sourceClient api.CloudClient, replica *model.Replica, masterFile *model.File, targets []*copyTarget, name string) map[*copyTarget]copyResult {
+	results := make(map[*copyTarget]copyResult, len(targets))
+	fail := func(err error) map[*copyTarget]copyResult {
+		err = fmt.Errorf("download failed: %w", err)
+		logDownloadError(masterFile, replica, err)
+		for _, target := range targets {
+			results[target] = copyResult{err: err}
+		}
+		return results
+	}
+
+	if replica.Fragmented && len(replica.Fragments) == 0 {
+		return fail(fmt.Errorf("replica is fragmented but has no fragments"))
+	}
+
+	spoolPath, release, err := r.spoolReplica(sourceClient, replica, masterFile.Size)
+	if err != nil {
+		return fail(err)
+	}
+	if spoolPath != "" {
+		defer release()
+		r.uploadSpooled(spoolPath, masterFile, targets, name, results)
+		return results
+	}
+
+	source := fmt.Sprintf("from_provider=%s native_id=%s", replica.Provider, replica.NativeID)
+	err = r.tee(masterFile, targets, name, results, source, func(w io.Writer) error {
+		return downloadPlaintext(sourceClient, replica, r.contentKey, w)
+	})
+	if err != nil {
+		return fail(err)
+	}
+	return results
+}
+
+// fanOutMultiSource downloads masterFile from all of sources at once and uploads it as name to
+// every target, through the spool when it has room for the file and streaming the chunks in
+// order otherwise. It returns nil when the download failed, leaving the targets to be copied
+// from one replica at a time.
+func (r *Runner) fanOutMultiSource(masterFile *model.File, sources []*rangeSource, targets []*copyTarget, name string) map[*copyTarget]copyResult {
+	logger.Info("Downloading path=%q from %d source(s) in parallel...", masterFile.Path, len(sources))
+	results := make(map[*copyTarget]copyResult, len(targets))
+	spoolPath, release, err := r.spoolMultiSource(masterFile, sources)
+	if err == nil && spoolPath != "" {
+		defer release()
+		r.uploadSpooled(spoolPath, masterFile, targets, name, results)
+		return results
+	}
+	if err == nil {
+		err = r.tee(masterFile, targets, name, results, fmt.Sprintf("sources=%d", len(sources)), func(w io.Writer) error {
+			return streamMultiSource(masterFile, sources, 0, masterFile.Size, w, multiSourceStreamChunkSize)
+		})
+	}
+	if err != nil {
+		logger.Warning("Multi-source download failed path=%q, copying from one replica at a time: %v", masterFile.Path, err)
+		return nil
+	}
+	return results
+}
+
+// spoolReplica downloads replica into a new file of the spool directory and returns its path with
+// a func removing it. The path is empty when the spool is disabled or has no room for the file.
+func (r *Runner) spoolReplica(sourceClient api.CloudClient, replica *model.Replica, size int64) (string, func(), error) {
+	if !r.reserveSpool(size) {
+		return "", nil, nil
+	}
+	f, err := os.CreateTemp(r.spoolDir, "copy-*.spool")
+	if err != nil {
+		r.releaseSpool(size)
+		logger.Warning("Failed to create spool file in %s, streaming instead: %v", r.spoolDir, err)
+		return "", nil, nil
+	}
+	release := func() {
+		if err := os.Remove(f.Name()); err != nil {
+			logger.Warning("Failed to remove spool file %s: %v", f.Name(), err)
+		}
+		r.releaseSpool(size)
+	}
+
+	err = downloadPlaintext(sourceClient, replica, r.contentKey, f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write spool file: %w", closeErr)
+	}
+	if err != nil {
+		release()
+		return "", nil, err
+	}
+	return f.Name(), release, nil
+}
+
+// spoolMultiSource downloads masterFile from all of sources at once into a new file of the spool
+// directory and returns its path with a func removing it. The path is empty when the spool is
+// disabled or has no room for the file.
+func (r *Runner) spoolMultiSource(masterFile *model.File, sources []*rangeSource) (string, func(), error) {
+	if !r.reserveSpool(masterFile.Size) {
+		return "", nil, nil
+	}
+	release := func(path string) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Warning("Failed to remove spool file %s: %v", path, err)
+		}
+		r.releaseSpool(masterFile.Size)
+	}
+
+	f, err := os.CreateTemp(r.spoolDir, "copy-*.spool")
+	if err != nil {
+		r.releaseSpool(masterFile.Size)
+		logger.Warning("Failed to create spool file in %s, streaming instead: %v", r.spoolDir, err)
+		return "", nil, nil
+	}
+	err = downloadMultiSource(masterFile, sources, f, multiSourceChunkSize)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write spool file: %w", closeErr)
+	}
+	if err != nil {
+		release(f.Name())
+		return "", nil, err
+	}
+	return f.Name(), func() { release(f.Name()) }, nil
+}
+
+// uploadSpooled uploads the spooled file at path to every target concurrently, retrying each
+// upload from the spool. Uploads to a provider storing encrypted replicas are encrypted.
+func (r *Runner) uploadSpooled(path string, masterFile *model.File, targets []*copyTarget, name string, results map[*copyTarget]copyResult) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var seal *uploadSeal
+			file, err := api.WithRetryT(func() (*model.File, error) {
+				f, err := os.Open(path)
+				if err != nil {
+					return nil, fmt.Errorf("failed to open spool file: %w", err)
+				}
+				defer f.Close()
+				body, size, s, err := r.sealUpload(target.provider, f, masterFile.Size)
+				if err != nil {
+					return nil, err
+				}
+				seal = s
+				return target.client.UploadFile(target.parentID, name, body, size)
+			})
+			seal.applyToUpload(file)
+			if err != nil {
+				err = fmt.Errorf("upload failed: %w", err)
+				logger.Warning("Copy upload failed path=%q provider=%s: %v", masterFile.Path, target.provider, err)
+			}
+			mu.Lock()
+			results[target] = copyResult{file: file, err: err}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+// tee streams the output of download into the uploads of every target at once, one pipe per
+// target. An upload that fails is dropped without interrupting the others. source describes the
+// download in log lines. It returns the download error.
+func (r *Runner) tee(masterFile *model.File, targets []*copyTarget, name string, results map[*copyTarget]copyResult, source string, download func(io.Writer) error) (dlErr error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	writers := make([]*io.PipeWriter, len(targets))
+	for i, target := range targets {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var file *model.File
+			body, size, seal, err := r.sealUpload(target.provider, pr, masterFile.Size)
+			if err == nil {
+				file, err = target.client.UploadFile(target.parentID, name, body, size)
+				seal.applyToUpload(file)
+			}
+			// Close the reader so the download stops writing to an upload that returned early
+			_ = pr.Close()
+			if err != nil {
+				err = fmt.Errorf("upload failed: %w", err)
+				logger.Warning("Copy upload failed path=%q provider=%s %s: %v", masterFile.Path, target.provider, source, err)
+			}
+			mu.Lock()
+			results[target] = copyResult{file: file, err: err}
+			mu.Unlock()
+		}()
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Panic in download path=%q %s: %v", masterFile.Path, source, r)
+				dlErr = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		dlErr = download(&fanoutWriter{writers: writers, dropped: make([]bool, len(writers))})
+	}()
+	for _, pw := range writers {
+		if dlErr != nil {
+			pw.CloseWithError(dlErr)
+		} else {
+			pw.Close()
+		}
+	}
+	wg.Wait()
+
+	if errors.Is(dlErr, errNoLiveUpload) {
+		// Every upload already reported its own error
+		return nil
+	}
+	return dlErr
+}
+
+// fanoutWriter writes a download into the pipes of several uploads. An upload that stops reading
+// is dropped rather than failing the download for the others.
+type fanoutWriter struct {
+	writers []*io.PipeWriter
+	dropped []bool
+}
+
+func (w *fanoutWriter) Write(p []byte) (int, error) {
+	live := 0
+	for i, pw := range w.writers {
+		if w.dropped[i] {
+			continue
+		}
+		if _, err := pw.Write(p); err != nil {
+			w.dropped[i] = true
+			continue
+		}
+		live++
+	}
+	if live == 0 {
+		return 0, errNoLiveUpload
+	}
+	return len(p), nil
+}
+
+// logDownloadError logs a failed download of replica, quietly when the source is gone.
+func logDownloadError(masterFile *model.File, replica *model.Replica, err error) {
+	msg := err.Error()
+	if strings.Contains(msg, "404") || strings.Contains(msg, "not found") || strings.Contains(msg, "notFound") {
+		logger.Info("Download source skipped (404 Not Found) path=%q provider=%s native_id=%s: %v", masterFile.Path, replica.Provider, replica.NativeID, err)
+		return
+	}
+	logger.Warning("Copy download failed path=%q provider=%s native_id=%s: %v", masterFile.Path, replica.Provider, replica.NativeID, err)
+}
@@ -0,0 +1,139 @@
+package task
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// countingClient serves DownloadFile like contentClient and counts the downloads.
+type countingClient struct {
+	contentClient
+	mu        sync.Mutex
+	downloads int
+}
+
+func (c *countingClient) DownloadFile(fileID string, w io.Writer) error {
+	c.mu.Lock()
+	c.downloads++
+	c.mu.Unlock()
+	return c.contentClient.DownloadFile(fileID, w)
+}
+
+// uploadClient reads every upload to the end, failing the first failures of them with uploadErr;
+// other methods are not used.
+type uploadClient struct {
+	api.CloudClient
+	uploadErr error
+	failures  int
+	uploads   int
+	content   string
+}
+
+func (c *uploadClient) UploadFile(folderID, name string, reader io.Reader, size int64) (*model.File, error) {
+	c.uploads++
+	if c.failures > 0 {
+		c.failures--
+		io.CopyN(io.Discard, reader, 2)
+		return nil, c.uploadErr
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	c.content = string(data)
+	return &model.File{Name: name, Size: int64(len(data)), Replicas: []*model.Replica{{Name: name, NativeID: folderID + "/" + name}}}, nil
+}
+
+func TestFanOutReplicaDownloadsOnce(t *testing.T) {
+	r := NewRunner(&model.Config{}, nil, false)
+	source := &countingClient{contentClient: contentClient{content: map[string]string{"g1": "hello world"}}}
+	replica := &model.Replica{Provider: model.ProviderGoogle, NativeID: "g1"}
+	file := &model.File{Path: "/a.txt", Name: "a.txt", Size: 11}
+
+	ok := &copyTarget{provider: model.ProviderMicrosoft, client: &uploadClient{}}
+	broken := &copyTarget{provider: model.ProviderTelegram, client: &uploadClient{failures: 1, uploadErr: errors.New("upload refused")}}
+	results := r.fanOutReplica(source, replica, file, []*copyTarget{ok, broken}, "a.txt")
+
+	if results[ok].err != nil || ok.client.(*uploadClient).content != "hello world" {
+		t.Fatalf("expected the healthy upload to get the whole file, got %q (%v)", ok.client.(*uploadClient).content, results[ok].err)
+	}
+	if results[broken].err == nil {
+		t.Fatal("expected the failed upload to report its error")
+	}
+	if source.downloads != 1 {
+		t.Fatalf("expected 1 download, got %d", source.downloads)
+	}
+}
+
+func TestFanOutReplicaSpoolRetriesUpload(t *testing.T) {
+	r := NewRunner(&model.Config{}, nil, false)
+	r.SetSpool(t.TempDir(), 1<<20)
+	source := &countingClient{contentClient: contentClient{content: map[string]string{"g1": "hello world"}}}
+	replica := &model.Replica{Provider: model.ProviderGoogle, NativeID: "g1"}
+	file := &model.File{Path: "/a.txt", Name: "a.txt", Size: 11}
+
+	dest := &uploadClient{failures: 1, uploadErr: errors.New("503 Service Unavailable")}
+	target := &copyTarget{provider: model.ProviderMicrosoft, client: dest}
+	results := r.fanOutReplica(source, replica, file, []*copyTarget{target}, "a.txt")
+
+	if results[target].err != nil || dest.content != "hello world" {
+		t.Fatalf("expected the retried upload to get the whole file, got %q (%v)", dest.content, results[target].err)
+	}
+	if dest.uploads != 2 || source.downloads != 1 {
+		t.Fatalf("expected 2 uploads from 1 download, got %d uploads and %d downloads", dest.uploads, source.downloads)
+	}
+	if r.spoolUsed != 0 {
+		t.Fatalf("expected the spool to be released, %d bytes still reserved", r.spoolUsed)
+	}
+
+	// A file larger than the spool is streamed instead.
+	r.SetSpool(t.TempDir(), 4)
+	dest = &uploadClient{}
+	target = &copyTarget{provider: model.ProviderMicrosoft, client: dest}
+	if results := r.fanOutReplica(source, replica, file, []*copyTarget{target}, "a.txt"); results[target].err != nil || dest.content != "hello world" {
+		t.Fatalf("expected the streamed upload to get the whole file, got %q (%v)", dest.content, results[target].err)
+	}
+}
+
+func TestMergeCopyJobs(t *testing.T) {
+	a, b := &model.File{Path: "/a"}, &model.File{Path: "/b"}
+	jobs := mergeCopyJobs([]copyJob{
+		{masterFile: a, providers: []model.Provider{model.ProviderMicrosoft}},
+		{masterFile: b, providers: []model.Provider{model.ProviderMicrosoft}},
+		{masterFile: a, providers: []model.Provider{model.ProviderTelegram}},
+		{masterFile: a, providers: []model.Provider{model.ProviderTelegram}, targetName: "a_conflict"},
+	})
+	if len(jobs) != 3 || len(jobs[0].providers) != 2 || jobs[0].providers[1] != model.ProviderTelegram {
+		t.Fatalf("expected the copies of /a under the same name to merge, got %+v", jobs)
+	}
+}
+
+func TestFanOutMultiSourceStreamsWithoutSpool(t *testing.T) {
+	r := NewRunner(&model.Config{}, nil, false)
+	content := strings.Repeat("0123456789", 10)
+	file := multiSourceFile(content)
+	file.Name = "big.bin"
+	sources := []*rangeSource{
+		{replica: &model.Replica{Provider: model.ProviderGoogle, NativeID: "g1"}, client: &flakyRangeClient{content: map[string]string{"g1": content}}},
+		{replica: &model.Replica{Provider: model.ProviderMicrosoft, NativeID: "m1"}, client: &flakyRangeClient{content: map[string]string{"m1": content}}},
+	}
+
+	dest := &uploadClient{}
+	target := &copyTarget{provider: model.ProviderTelegram, client: dest}
+	results := r.fanOutMultiSource(file, sources, []*copyTarget{target}, "big.bin")
+	if results == nil || results[target].err != nil || dest.content != content {
+		t.Fatalf("expected the streamed upload to get the whole file, got %q (%v)", dest.content, results)
+	}
+
+	sources[0].client = &flakyRangeClient{failErr: errors.New("gone")}
+	sources[1].client = &flakyRangeClient{failErr: errors.New("gone")}
+	if results := r.fanOutMultiSource(file, sources, []*copyTarget{{provider: model.ProviderTelegram, client: &uploadClient{}}}, "big.bin"); results != nil {
+		t.Fatalf("expected a failed download to leave the copy to single replicas, got %v", results)
+	}
+}
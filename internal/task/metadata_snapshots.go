@@ -0,0 +1,292 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+const (
+	// MetadataSnapshotsFolder holds the last uploads of metadata.db under the aux folder.
+	MetadataSnapshotsFolder = "metadata-snapshots"
+
+	// MetadataSnapshotRetention is how many snapshots are kept per account.
+	MetadataSnapshotRetention = 10
+
+	metadataSnapshotPrefix    = "cloud-drives-sync-metadata-snapshot-"
+	metadataSnapshotIndexName = "cloud-drives-sync-metadata-snapshots.json"
+)
+
+// MetadataSnapshot describes one stored copy of metadata.db. The ID is the upload generation,
+// which is the same on every account.
+type MetadataSnapshot struct {
+	ID         string    `json:"id"`
+	FileName   string    `json:"file_name"`
+	Generation int64     `json:"generation"`
+	HostID     string    `json:"host_id"`
+	Hostname   string    `json:"hostname"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	SHA256     string    `json:"sha256"`
+	Size       int64     `json:"size"`
+}
+
+// isSnapshotFile reports whether name belongs to the metadata snapshot store.
+func isSnapshotFile(name string) bool {
+	return strings.HasPrefix(name, metadataSnapshotPrefix) || name == metadataSnapshotIndexName
+}
+
+func snapshotFileName(stamp *MetadataStamp) string {
+	return fmt.Sprintf("%sg%d-%s.db", metadataSnapshotPrefix, stamp.Generation, stamp.UploadedAt.UTC().Format("20060102T150405Z"))
+}
+
+// snapshotStore is the snapshot folder of one account together with its index.
+type snapshotStore struct {
+	client   api.CloudClient
+	user     *model.User
+	folderID string
+	files    map[string]string
+	index    []MetadataSnapshot
+}
+
+// openSnapshotStore resolves the snapshot folder under auxID and reads its index. When create is
+// false and the folder does not exist, an error is returned.
+func openSnapshotStore(client api.CloudClient, user *model.User, auxID string, create bool) (*snapshotStore, error) {
+	var folderID string
+	var err error
+	switch {
+	case user.Provider == model.ProviderTelegram:
+		folderID = auxID + "/" + MetadataSnapshotsFolder
+	case create:
+		folderID, err = getOrCreateChildFolder(client, auxID, MetadataSnapshotsFolder)
+	default:
+		folderID, err = findChildFolder(client, auxID, MetadataSnapshotsFolder)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &snapshotStore{client: client, user: user, folderID: folderID}
+	if s.files, err = listNamedFiles(client, user, folderID); err != nil {
+		return nil, err
+	}
+
+	if indexID, ok := s.files[metadataSnapshotIndexName]; ok {
+		var buf bytes.Buffer
+		if err := client.DownloadFile(indexID, &buf); err != nil {
+			return nil, fmt.Errorf("failed to download snapshot index: %w", err)
+		}
+		if err := json.Unmarshal(buf.Bytes(), &s.index); err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot index: %w", err)
+		}
+	}
+	sort.SliceStable(s.index, func(i, j int) bool { return s.index[i].Generation > s.index[j].Generation })
+	return s, nil
+}
+
+func (s *snapshotStore) find(id string) *MetadataSnapshot {
+	for i := range s.index {
+		if s.index[i].ID == id {
+			return &s.index[i]
+		}
+	}
+	return nil
+}
+
+// add uploads dbPath as the snapshot for stamp, prunes snapshots beyond the retention limit
+// and rewrites the index.
+func (s *snapshotStore) add(dbPath string, stamp *MetadataStamp, size int64) error {
+	snap := MetadataSnapshot{
+		ID:         strconv.FormatInt(stamp.Generation, 10),
+		FileName:   snapshotFileName(stamp),
+		Generation: stamp.Generation,
+		HostID:     stamp.HostID,
+		Hostname:   stamp.Hostname,
+		UploadedAt: stamp.UploadedAt,
+		SHA256:     stamp.SHA256,
+		Size:       size,
+	}
+	if s.find(snap.ID) != nil {
+		return nil
+	}
+
+	file, err := os.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	id, err := replaceNamedFile(s.client, s.user, s.folderID, "", snap.FileName, file, size)
+	if err != nil {
+		return fmt.Errorf("failed to upload snapshot: %w", err)
+	}
+	s.files[snap.FileName] = id
+	s.index = append([]MetadataSnapshot{snap}, s.index...)
+
+	for len(s.index) > MetadataSnapshotRetention {
+		old := s.index[len(s.index)-1]
+		if oldID, ok := s.files[old.FileName]; ok {
+			if err := s.client.DeleteFile(oldID); err != nil {
+				logger.WarningTagged(s.user.LogTags(), "Failed to prune metadata snapshot %s: %v", old.ID, err)
+				break
+			}
+			delete(s.files, old.FileName)
+		}
+		s.index = s.index[:len(s.index)-1]
+	}
+
+	data, err := json.MarshalIndent(s.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	s.files[metadataSnapshotIndexName], err = replaceNamedFile(s.client, s.user, s.folderID, s.files[metadataSnapshotIndexName], metadataSnapshotIndexName, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot index: %w", err)
+	}
+	return nil
+}
+
+// storeMetadataSnapshot records the just-uploaded metadata.db as a snapshot on one account.
+func storeMetadataSnapshot(client api.CloudClient, user *model.User, auxID, dbPath string, stamp *MetadataStamp, size int64) error {
+	store, err := openSnapshotStore(client, user, auxID, true)
+	if err != nil {
+		return err
+	}
+	return store.add(dbPath, stamp, size)
+}
+
+// snapshotSources returns the accounts to read snapshots from, main account first.
+func snapshotSources(cfg *model.Config) []*model.User {
+	users := make([]*model.User, 0, len(cfg.Users))
+	for i := range cfg.Users {
+		users = append(users, &cfg.Users[i])
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		return metadataSourcePriority(users[i]) < metadataSourcePriority(users[j])
+	})
+	return users
+}
+
+// ListMetadataSnapshots returns the snapshots held by the first reachable account, newest first.
+func ListMetadataSnapshots(cfg *model.Config) ([]MetadataSnapshot, *model.User, error) {
+	for _, user := range snapshotSources(cfg) {
+		var store *snapshotStore
+		err := api.WithRetry(func() error {
+			client, auxID, err := openAuxFolder(cfg, user, false)
+			if err != nil {
+				return err
+			}
+			store, err = openSnapshotStore(client, user, auxID, false)
+			return err
+		})
+		if err != nil {
+			logger.InfoTagged(user.LogTags(), "No metadata snapshots available: %v", err)
+			continue
+		}
+		return store.index, user, nil
+	}
+	return nil, nil, fmt.Errorf("no account holds metadata snapshots")
+}
+
+// DownloadMetadataSnapshot downloads snapshot id to destPath and verifies its checksum. Accounts
+// are tried in priority order until one holds an intact copy.
+func DownloadMetadataSnapshot(cfg *model.Config, id, destPath string) (*MetadataSnapshot, error) {
+	for _, user := range snapshotSources(cfg) {
+		client, auxID, err := openAuxFolder(cfg, user, false)
+		if err != nil {
+			logger.InfoTagged(user.LogTags(), "Skipping: %v", err)
+			continue
+		}
+		store, err := openSnapshotStore(client, user, auxID, false)
+		if err != nil {
+			logger.InfoTagged(user.LogTags(), "Skipping: %v", err)
+			continue
+		}
+		snap := store.find(id)
+		if snap == nil {
+			continue
+		}
+		fileID, ok := store.files[snap.FileName]
+		if !ok {
+			logger.WarningTagged(user.LogTags(), "Snapshot %s is indexed but its file is missing", id)
+			continue
+		}
+
+		err = api.WithRetry(func() error {
+			out, err := os.Create(destPath)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+			return client.DownloadFile(fileID, out)
+		})
+		if err == nil {
+			var sum string
+			if sum, err = fileSHA256(destPath); err == nil && sum != snap.SHA256 {
+				err = fmt.Errorf("checksum mismatch: index says %s, downloaded %s", snap.SHA256, sum)
+			}
+		}
+		if err != nil {
+			os.Remove(destPath)
+			logger.WarningTagged(user.LogTags(), "Failed to download snapshot %s: %v", id, err)
+			continue
+		}
+		logger.InfoTagged(user.LogTags(), "Downloaded snapshot %s (%s)", id, snap.FileName)
+		return snap, nil
+	}
+	return nil, fmt.Errorf("snapshot %s not found on any account", id)
+}
+
+// RestoreMetadataSnapshot installs a verified snapshot file as the local metadata.db and uploads
+// it as a new generation so every account rolls back. The replaced DB is kept as
+// "<db>.pre-restore".
+func RestoreMetadataSnapshot(cfg *model.Config, dbPath, snapshotPath string) error {
+	// The restored copy is deliberately older than what the accounts hold, so base it on the
+	// newest remote stamp to let UploadMetadataDB supersede it.
+	var newest *MetadataStamp
+	for _, rm := range fetchRemoteMetadata(cfg, false) {
+		if rm.stamp.generation() > newest.generation() {
+			newest = rm.stamp
+		}
+	}
+
+	// putBack moves the set-aside files into place again, so a failed install never leaves the
+	// host without a metadata.db.
+	var setAside []string
+	putBack := func() {
+		for _, suffix := range setAside {
+			if err := os.Rename(dbPath+".pre-restore"+suffix, dbPath+suffix); err != nil {
+				logger.Error("Failed to put back %s: %v", dbPath+suffix, err)
+			}
+		}
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			err := os.Rename(dbPath+suffix, dbPath+".pre-restore"+suffix)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				putBack()
+				return fmt.Errorf("failed to set aside local metadata.db: %w", err)
+			}
+			setAside = append(setAside, suffix)
+		}
+		logger.Info("Previous local metadata.db kept at %s", dbPath+".pre-restore")
+	}
+	if err := os.Rename(snapshotPath, dbPath); err != nil {
+		putBack()
+		return fmt.Errorf("failed to install snapshot: %w", err)
+	}
+	if err := writeLocalStamp(dbPath, newest); err != nil {
+		return err
+	}
+	return UploadMetadataDB(cfg, dbPath)
+}
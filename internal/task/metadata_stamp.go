@@ -0,0 +1,350 @@
+package task
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/google/uuid"
+)
+
+const (
+	// MetadataStampFileName is the sidecar uploaded next to metadata.db in every aux folder.
+	// It is small enough to be fetched from every account before deciding which DB copy to use.
+	MetadataStampFileName = "cloud-drives-sync-metadata.stamp.json"
+
+	hostIDFileName = "cloud-drives-sync-host.id"
+)
+
+// ErrRemoteMetadataNewer is returned by UploadMetadataDB when an account already holds a
+// metadata.db that was uploaded after the local copy was obtained.
+var ErrRemoteMetadataNewer = errors.New("a newer metadata.db exists in the cloud")
+
+// MetadataStamp identifies one upload of metadata.db. Generation increases by one on every
+// upload, so the copy with the highest generation is the freshest regardless of clock skew
+// between hosts.
+type MetadataStamp struct {
+	Generation int64     `json:"generation"`
+	HostID     string    `json:"host_id"`
+	Hostname   string    `json:"hostname"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	SHA256     string    `json:"sha256"`
+}
+
+// generation returns the stamp generation, treating a missing stamp as generation 0.
+func (s *MetadataStamp) generation() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.Generation
+}
+
+// describe renders the stamp for log and error messages.
+func (s *MetadataStamp) describe() string {
+	if s == nil {
+		return "generation 0 (unstamped)"
+	}
+	return fmt.Sprintf("generation %d uploaded by %s at %s", s.Generation, s.Hostname, s.UploadedAt.Local().Format(time.RFC3339))
+}
+
+// localStampPath returns the path of the stamp describing the cloud copy the local DB is based on.
+func localStampPath(dbPath string) string {
+	return dbPath + ".stamp.json"
+}
+
+// ReadLocalStamp returns the stamp of the cloud copy the local metadata.db was downloaded from
+// or last uploaded as. It returns nil without error when no stamp has been recorded yet.
+func ReadLocalStamp(dbPath string) (*MetadataStamp, error) {
+	data, err := os.ReadFile(localStampPath(dbPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read local metadata stamp: %w", err)
+	}
+	var stamp MetadataStamp
+	if err := json.Unmarshal(data, &stamp); err != nil {
+		return nil, fmt.Errorf("failed to parse local metadata stamp: %w", err)
+	}
+	return &stamp, nil
+}
+
+func writeLocalStamp(dbPath string, stamp *MetadataStamp) error {
+	if stamp == nil {
+		if err := os.Remove(localStampPath(dbPath)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(stamp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(localStampPath(dbPath), data, 0600)
+}
+
+// HostIdentity returns a stable identifier for this installation together with the machine
+// hostname. The identifier is generated once and kept next to the metadata DB so that two
+// machines sharing a hostname are still told apart.
+func HostIdentity(dbPath string) (string, string) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown-host"
+	}
+
+	idPath := filepath.Join(filepath.Dir(dbPath), hostIDFileName)
+	if data, err := os.ReadFile(idPath); err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, hostname
+		}
+	}
+
+	id := uuid.New().String()
+	if err := os.WriteFile(idPath, []byte(id+"\n"), 0600); err != nil {
+		logger.Warning("Failed to persist host ID: %v", err)
+	}
+	return id, hostname
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remoteMetadata describes the metadata.db copy held in one account's aux folder.
+type remoteMetadata struct {
+	user        *model.User
+	client      api.CloudClient
+	auxID       string
+	dbFileID    string
+	stampFileID string
+	stamp       *MetadataStamp // nil when the account holds an unstamped (legacy) DB
+}
+
+// metadataSourcePriority orders accounts holding the same generation, preferring the main
+// account as the original download logic did.
+func metadataSourcePriority(u *model.User) int {
+	switch {
+	case u.Provider == model.ProviderGoogle && u.IsMain:
+		return 0
+	case u.Provider == model.ProviderMicrosoft:
+		return 1
+	case u.Provider == model.ProviderTelegram:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// sortRemoteMetadata orders copies freshest first, breaking ties by source priority.
+func sortRemoteMetadata(remotes []*remoteMetadata) {
+	sort.SliceStable(remotes, func(i, j int) bool {
+		gi, gj := remotes[i].stamp.generation(), remotes[j].stamp.generation()
+		if gi != gj {
+			return gi > gj
+		}
+		return metadataSourcePriority(remotes[i].user) < metadataSourcePriority(remotes[j].user)
+	})
+}
+
+// listNamedFiles returns the IDs of every file directly in a housekeeping folder, keyed by name.
+func listNamedFiles(client api.CloudClient, user *model.User, folderID string) (map[string]string, error) {
+	files, err := client.ListFiles(folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]string)
+	for _, f := range files {
+		if user.Provider == model.ProviderTelegram {
+			// Telegram lists the whole channel; only accept files directly under the folder
+			// path and address them by message ID (NativeID), not the logical file UUID.
+			if path.Dir(f.Path) != folderID || len(f.Replicas) == 0 {
+				continue
+			}
+			found[f.Name] = f.Replicas[0].NativeID
+			continue
+		}
+		found[f.Name] = f.ID
+	}
+	return found, nil
+}
+
+// findNamedFiles returns the IDs of the named files in a housekeeping folder, keyed by name.
+// Files that do not exist are absent from the map.
+func findNamedFiles(client api.CloudClient, user *model.User, folderID string, names ...string) (map[string]string, error) {
+	all, err := listNamedFiles(client, user, folderID)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]string)
+	for _, n := range names {
+		if id, ok := all[n]; ok {
+			found[n] = id
+		}
+	}
+	return found, nil
+}
+
+// replaceNamedFile overwrites the housekeeping file identified by existingID, or uploads it to
+// folderID when it does not exist yet, returning the ID the file can be found under afterwards.
+func replaceNamedFile(client api.CloudClient, user *model.User, folderID, existingID, name string, reader io.Reader, size int64) (string, error) {
+	if existingID != "" && user.Provider != model.ProviderTelegram {
+		if err := client.UpdateFile(existingID, reader, size); err != nil {
+			return "", err
+		}
+		return existingID, nil
+	}
+
+	f, err := client.UploadFile(folderID, name, reader, size)
+	if err != nil {
+		return "", err
+	}
+	newID := f.ID
+	if user.Provider == model.ProviderTelegram && len(f.Replicas) > 0 {
+		newID = f.Replicas[0].NativeID
+	}
+
+	if existingID != "" {
+		// Telegram media cannot be replaced in place; the old message is deleted only once the
+		// new one is uploaded, so the account never lacks a copy. Listing prefers the newest
+		// message, so a copy left behind by a failed delete is harmless.
+		if err := client.DeleteFile(existingID); err != nil {
+			logger.WarningTagged(user.LogTags(), "Failed to delete previous %s (message %s): %v", name, existingID, err)
+		}
+	}
+	return newID, nil
+}
+
+// fetchRemoteMetadata inspects the aux folder of every account in parallel and returns the
+// metadata copies found. Accounts that cannot be reached are logged and left out. When create is
+// true the aux folder is created where missing, so every reachable account is returned.
+func fetchRemoteMetadata(cfg *model.Config, create bool) []*remoteMetadata {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		remotes []*remoteMetadata
+	)
+
+	for i := range cfg.Users {
+		user := &cfg.Users[i]
+		wg.Add(1)
+		go func(u *model.User) {
+			defer wg.Done()
+			rm := &remoteMetadata{user: u}
+			err := api.WithRetry(func() error {
+				client, auxID, err := openAuxFolder(cfg, u, create)
+				if err != nil {
+					return err
+				}
+				rm.client = client
+				rm.auxID = auxID
+
+				ids, err := findNamedFiles(client, u, auxID, MetadataFileName, MetadataStampFileName)
+				if err != nil {
+					return err
+				}
+				rm.dbFileID = ids[MetadataFileName]
+				rm.stampFileID = ids[MetadataStampFileName]
+				rm.stamp = nil
+				if rm.dbFileID == "" || rm.stampFileID == "" {
+					return nil
+				}
+
+				var buf strings.Builder
+				if err := client.DownloadFile(rm.stampFileID, &buf); err != nil {
+					return fmt.Errorf("failed to download metadata stamp: %w", err)
+				}
+				var stamp MetadataStamp
+				if err := json.Unmarshal([]byte(buf.String()), &stamp); err != nil {
+					logger.WarningTagged(u.LogTags(), "Ignoring unreadable metadata stamp: %v", err)
+					return nil
+				}
+				rm.stamp = &stamp
+				return nil
+			})
+			if err != nil {
+				if create {
+					logger.ErrorTagged(u.LogTags(), "Failed to inspect cloud metadata: %v", err)
+				} else {
+					logger.InfoTagged(u.LogTags(), "No cloud metadata available: %v", err)
+				}
+				return
+			}
+			mu.Lock()
+			remotes = append(remotes, rm)
+			mu.Unlock()
+		}(user)
+	}
+	wg.Wait()
+
+	sortRemoteMetadata(remotes)
+	return remotes
+}
+
+// downloadRemoteMetadata replaces the local metadata.db with the copy held by rm. The copy is
+// downloaded next to dbPath and verified before the swap; an existing local DB is kept as
+// "<db>.stale" so that unsynced local changes are never lost silently.
+func downloadRemoteMetadata(rm *remoteMetadata, dbPath string) error {
+	tmpPath := dbPath + ".download"
+	defer os.Remove(tmpPath)
+
+	logger.InfoTagged(rm.user.LogTags(), "Downloading metadata.db (%s)...", rm.stamp.describe())
+	err := api.WithRetry(func() error {
+		out, err := os.Create(tmpPath)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		return rm.client.DownloadFile(rm.dbFileID, out)
+	})
+	if err != nil {
+		return err
+	}
+
+	if rm.stamp != nil && rm.stamp.SHA256 != "" {
+		sum, err := fileSHA256(tmpPath)
+		if err != nil {
+			return err
+		}
+		if sum != rm.stamp.SHA256 {
+			return fmt.Errorf("checksum mismatch: stamp says %s, downloaded %s", rm.stamp.SHA256, sum)
+		}
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if err := os.Rename(dbPath+suffix, dbPath+".stale"+suffix); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to set aside local metadata.db: %w", err)
+			}
+		}
+		logger.Info("Previous local metadata.db kept at %s", dbPath+".stale")
+	}
+
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		return fmt.Errorf("failed to install downloaded metadata.db: %w", err)
+	}
+	return writeLocalStamp(dbPath, rm.stamp)
+}
@@ -0,0 +1,129 @@
+package task
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+func TestSortRemoteMetadataPrefersHighestGeneration(t *testing.T) {
+	main := &model.User{Provider: model.ProviderGoogle, Email: "main@x.com", IsMain: true}
+	ms := &model.User{Provider: model.ProviderMicrosoft, Email: "ms@x.com"}
+	tg := &model.User{Provider: model.ProviderTelegram, Phone: "+100"}
+
+	remotes := []*remoteMetadata{
+		{user: main, stamp: &MetadataStamp{Generation: 3}},
+		{user: tg, stamp: &MetadataStamp{Generation: 4}},
+		{user: ms, stamp: &MetadataStamp{Generation: 4}},
+		{user: ms, stamp: nil},
+	}
+	sortRemoteMetadata(remotes)
+
+	if remotes[0].user != ms || remotes[1].user != tg {
+		t.Fatalf("expected generation 4 copies first with OneDrive before Telegram, got %v then %v", remotes[0].user.Provider, remotes[1].user.Provider)
+	}
+	if remotes[2].user != main {
+		t.Fatalf("expected generation 3 copy third, got %v", remotes[2].user.Provider)
+	}
+	if remotes[3].stamp != nil {
+		t.Fatalf("expected unstamped copy last")
+	}
+}
+
+func TestLocalStampRoundTrip(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), MetadataFileName)
+
+	stamp, err := ReadLocalStamp(dbPath)
+	if err != nil || stamp != nil {
+		t.Fatalf("expected no stamp before first write, got %v, %v", stamp, err)
+	}
+
+	want := &MetadataStamp{Generation: 7, HostID: "host-a", Hostname: "a", UploadedAt: time.Unix(1700000000, 0).UTC(), SHA256: "abc"}
+	if err := writeLocalStamp(dbPath, want); err != nil {
+		t.Fatalf("writeLocalStamp: %v", err)
+	}
+	got, err := ReadLocalStamp(dbPath)
+	if err != nil {
+		t.Fatalf("ReadLocalStamp: %v", err)
+	}
+	if *got != *want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	if err := writeLocalStamp(dbPath, nil); err != nil {
+		t.Fatalf("writeLocalStamp(nil): %v", err)
+	}
+	if got, _ := ReadLocalStamp(dbPath); got != nil {
+		t.Fatalf("expected stamp to be removed, got %+v", got)
+	}
+}
+
+func TestHostIdentityIsStable(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), MetadataFileName)
+	id1, _ := HostIdentity(dbPath)
+	id2, _ := HostIdentity(dbPath)
+	if id1 == "" || id1 != id2 {
+		t.Fatalf("expected stable non-empty host ID, got %q and %q", id1, id2)
+	}
+}
+
+// replacingClient records deletes on top of uploadClient.
+type replacingClient struct {
+	uploadClient
+	deleted []string
+}
+
+func (c *replacingClient) DeleteFile(fileID string) error {
+	c.deleted = append(c.deleted, fileID)
+	return nil
+}
+
+func TestReplaceNamedFileOnTelegramKeepsOldCopyUntilUploaded(t *testing.T) {
+	user := &model.User{Provider: model.ProviderTelegram, Phone: "+100"}
+
+	failing := &replacingClient{uploadClient: uploadClient{failures: 1, uploadErr: errors.New("upload refused")}}
+	if _, err := replaceNamedFile(failing, user, "/aux", "41", MetadataFileName, strings.NewReader("db"), 2); err == nil {
+		t.Fatal("expected the failed upload to be returned")
+	}
+	if len(failing.deleted) != 0 {
+		t.Fatalf("expected the old copy to stay after a failed upload, deleted %v", failing.deleted)
+	}
+
+	client := &replacingClient{}
+	id, err := replaceNamedFile(client, user, "/aux", "41", MetadataFileName, strings.NewReader("db"), 2)
+	if err != nil {
+		t.Fatalf("replaceNamedFile: %v", err)
+	}
+	if id != "/aux/"+MetadataFileName || client.content != "db" || len(client.deleted) != 1 || client.deleted[0] != "41" {
+		t.Fatalf("expected the new copy uploaded and the old one deleted, got id=%q deleted=%v", id, client.deleted)
+	}
+}
+
+func TestRestoreMetadataSnapshotPutsBackLocalDBWhenInstallFails(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "metadata.db")
+	for _, suffix := range []string{"", "-wal"} {
+		if err := os.WriteFile(dbPath+suffix, []byte("live"+suffix), 0600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	err := RestoreMetadataSnapshot(&model.Config{}, dbPath, filepath.Join(dir, "missing.snapshot"))
+	if err == nil || !strings.Contains(err.Error(), "failed to install snapshot") {
+		t.Fatalf("expected the install to fail, got %v", err)
+	}
+	for _, suffix := range []string{"", "-wal"} {
+		data, err := os.ReadFile(dbPath + suffix)
+		if err != nil || string(data) != "live"+suffix {
+			t.Fatalf("expected metadata.db%s to be put back, got %q (%v)", suffix, data, err)
+		}
+	}
+	if _, err := os.Stat(dbPath + ".pre-restore"); !os.IsNotExist(err) {
+		t.Fatalf("expected no set-aside copy to remain, got %v", err)
+	}
+}
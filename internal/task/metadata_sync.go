@@ -1,11 +1,13 @@
 package task
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
-	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/FranLegon/cloud-drives-sync/internal/api"
 	"github.com/FranLegon/cloud-drives-sync/internal/auth"
@@ -30,6 +32,12 @@ func SetAuxFolder(name string) {
 	AuxFolder = name
 }
 
+// isHousekeepingFile reports whether name is one of the tool's own files kept in the aux
+// folder, which must never be tracked as synced content.
+func isHousekeepingFile(name string) bool {
+	return name == MetadataFileName || name == MetadataStampFileName || name == RunLockFileName || isSnapshotFile(name) || isShardFile(name)
+}
+
 func createClient(user *model.User, cfg *model.Config, runPreFlight bool) (api.CloudClient, error) {
 	// Re-use the same factory logic as Runner.GetOrCreateClient but without caching,
 	// since this is called during startup before a Runner is available.
@@ -128,107 +136,71 @@ func getAuxFolderID(client api.CloudClient, user *model.User, rootID string, cre
 	return "", fmt.Errorf("aux folder not found")
 }
 
-func getMetadataFileID(client api.CloudClient, user *model.User, auxID string) (string, error) {
-	files, err := client.ListFiles(auxID)
+// openAuxFolder creates a client for user and resolves the ID of its aux folder, creating the
+// folder when create is set.
+func openAuxFolder(cfg *model.Config, user *model.User, create bool) (api.CloudClient, string, error) {
+	client, err := createClient(user, cfg, true)
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
-	for _, f := range files {
-		match := false
-		if user.Provider == model.ProviderTelegram {
-			if f.Name == MetadataFileName && strings.Contains(f.Path, auxID) {
-				match = true
-			}
-		} else {
-			if f.Name == MetadataFileName {
-				match = true
-			}
-		}
-		if match {
-			// Telegram needs the numeric message ID (NativeID), not the logical file UUID
-			if user.Provider == model.ProviderTelegram && len(f.Replicas) > 0 {
-				return f.Replicas[0].NativeID, nil
-			}
-			return f.ID, nil
-		}
+	rootID, err := client.GetSyncFolderID()
+	if err != nil {
+		return nil, "", err
 	}
-	return "", fmt.Errorf("metadata.db not found in aux folder")
+	auxID, err := getAuxFolderID(client, user, rootID, create)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, auxID, nil
 }
 
-// DownloadMetadataDB attempts to download metadata.db from providers
+// DownloadMetadataDB makes sure the local metadata.db is the freshest copy available. The local
+// stamp is compared with the stamps in every account's aux folder and the local DB is replaced
+// when a newer generation exists in the cloud.
 func DownloadMetadataDB(cfg *model.Config, dbPath string) error {
-	// Check existence
+	localExists := false
 	if _, err := os.Stat(dbPath); err == nil {
-		logger.Info("Local metadata.db found.")
-		return nil
+		localExists = true
 	}
-
-	logger.Info("Local metadata.db missing. Attempting to download from cloud providers...")
-
-	tryDownload := func(user *model.User) error {
-		return api.WithRetry(func() error {
-			client, err := createClient(user, cfg, true)
-			if err != nil {
-				return err
-			}
-
-			rootID, err := client.GetSyncFolderID()
-			if err != nil {
-				return err
-			}
-
-			auxID, err := getAuxFolderID(client, user, rootID, false)
-			if err != nil {
-				return err
-			}
-
-			fileID, err := getMetadataFileID(client, user, auxID)
-			if err != nil {
-				return err
-			}
-
-			// Create file locally
-			out, err := os.Create(dbPath)
-			if err != nil {
-				return err
-			}
-			defer out.Close()
-
-			logger.Info("Downloading metadata.db from %s (%s)...", user.Provider, user.Email)
-			if err := client.DownloadFile(fileID, out); err != nil {
-				out.Close()
-				os.Remove(dbPath) // Clean up partial
-				return err
-			}
-			return nil
-		})
+	local, err := ReadLocalStamp(dbPath)
+	if err != nil {
+		logger.Warning("Ignoring local metadata stamp: %v", err)
 	}
 
-	priorities := []struct {
-		check func(u *model.User) bool
-		name  string
-	}{
-		{func(u *model.User) bool { return u.Provider == model.ProviderGoogle && u.IsMain }, "Google Main"},
-		{func(u *model.User) bool { return u.Provider == model.ProviderMicrosoft }, "OneDrive"},
-		{func(u *model.User) bool { return u.Provider == model.ProviderTelegram }, "Telegram"},
+	if localExists {
+		logger.Info("Local metadata.db found (%s). Checking cloud copies...", local.describe())
+	} else {
+		logger.Info("Local metadata.db missing. Attempting to download from cloud providers...")
 	}
 
-	for _, p := range priorities {
-		for i := range cfg.Users {
-			if p.check(&cfg.Users[i]) {
-				if err := tryDownload(&cfg.Users[i]); err == nil {
-					return nil
-				} else {
-					logger.Info("Failed to download from %s: %v", p.name, err)
-				}
-			}
+	for _, rm := range fetchRemoteMetadata(cfg, false) {
+		if rm.dbFileID == "" {
+			continue
+		}
+		if localExists && rm.stamp.generation() <= local.generation() {
+			break
 		}
+		if localExists {
+			logger.Warning("Local metadata.db (%s) is older than the copy on %s (%s) (%s). Replacing it.",
+				local.describe(), rm.user.Provider, rm.user.Email, rm.stamp.describe())
+		}
+		if err := downloadRemoteMetadata(rm, dbPath); err != nil {
+			logger.Info("Failed to download from %s (%s): %v", rm.user.Provider, rm.user.Email, err)
+			continue
+		}
+		return nil
 	}
 
+	if localExists {
+		logger.Info("Local metadata.db is the freshest copy.")
+		return nil
+	}
 	return fmt.Errorf("metadata.db not found locally or in any cloud provider")
 }
 
-// UploadMetadataDB uploads the local metadata.db to all providers
+// UploadMetadataDB uploads the local metadata.db to all providers. The upload is stamped with the
+// next generation and refused with ErrRemoteMetadataNewer if any account already holds a copy
+// newer than the one the local DB is based on.
 func UploadMetadataDB(cfg *model.Config, dbPath string) error {
 	stat, err := os.Stat(dbPath)
 	if err != nil {
@@ -236,34 +208,48 @@ func UploadMetadataDB(cfg *model.Config, dbPath string) error {
 	}
 	size := stat.Size()
 
-	logger.Info("Uploading metadata.db to cloud providers...")
-
-	uploadToUser := func(user *model.User) error {
-		return api.WithRetry(func() error {
-			client, err := createClient(user, cfg, true)
-			if err != nil {
-				return err
-			}
+	local, err := ReadLocalStamp(dbPath)
+	if err != nil {
+		return err
+	}
 
-			rootID, err := client.GetSyncFolderID()
-			if err != nil {
-				return err
-			}
+	remotes := fetchRemoteMetadata(cfg, true)
+	newest := local.generation()
+	for _, rm := range remotes {
+		if rm.dbFileID == "" {
+			continue
+		}
+		if rm.stamp.generation() > local.generation() {
+			return fmt.Errorf("%w: %s (%s) holds %s but the local copy is based on %s; re-run the command to pick up the newer copy",
+				ErrRemoteMetadataNewer, rm.user.Provider, rm.user.Email, rm.stamp.describe(), local.describe())
+		}
+		if g := rm.stamp.generation(); g > newest {
+			newest = g
+		}
+	}
 
-			// Find or Create Aux Folder
-			auxID, err := getAuxFolderID(client, user, rootID, true)
-			if err != nil {
-				return err
-			}
+	sum, err := fileSHA256(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash metadata.db: %w", err)
+	}
+	hostID, hostname := HostIdentity(dbPath)
+	stamp := &MetadataStamp{
+		Generation: newest + 1,
+		HostID:     hostID,
+		Hostname:   hostname,
+		UploadedAt: time.Now().UTC(),
+		SHA256:     sum,
+	}
+	stampData, err := json.MarshalIndent(stamp, "", "  ")
+	if err != nil {
+		return err
+	}
 
-			// Check for existing metadata.db to overwrite or Create
-			// We do this BEFORE ListFolders(auxID) so that if getMetadataFileID (which calls ListFiles)
-			// succeeds, it populates the folder cache and saves ListFolders an API call.
-			existingFileID, err := getMetadataFileID(client, user, auxID)
-			if err != nil && !strings.Contains(err.Error(), "not found in aux folder") {
-				return err
-			}
+	logger.Info("Uploading metadata.db (generation %d) to cloud providers...", stamp.Generation)
 
+	uploadToUser := func(rm *remoteMetadata) error {
+		client, user, auxID := rm.client, rm.user, rm.auxID
+		err := api.WithRetry(func() error {
 			// Ensure soft-deleted folder exists
 			if user.Provider == model.ProviderTelegram {
 				if _, err := client.CreateFolder(auxID, SoftDeletedFolder); err != nil {
@@ -294,38 +280,46 @@ func UploadMetadataDB(cfg *model.Config, dbPath string) error {
 			}
 			defer file.Close()
 
-			if existingFileID != "" {
+			if rm.dbFileID != "" {
 				logger.Info("Updating existing metadata.db on %s (%s)...", user.Provider, user.Email)
-				if err := client.UpdateFile(existingFileID, file, size); err != nil {
-					return fmt.Errorf("failed to update metadata.db: %w", err)
-				}
 			} else {
 				logger.Info("Uploading new metadata.db to %s (%s)...", user.Provider, user.Email)
-				if _, err := client.UploadFile(auxID, MetadataFileName, file, size); err != nil {
-					return fmt.Errorf("failed to upload metadata.db: %w", err)
-				}
+			}
+			rm.dbFileID, err = replaceNamedFile(client, user, auxID, rm.dbFileID, MetadataFileName, file, size)
+			if err != nil {
+				return fmt.Errorf("failed to upload metadata.db: %w", err)
 			}
 
+			// The stamp goes last so it never describes a DB that failed to upload.
+			rm.stampFileID, err = replaceNamedFile(client, user, auxID, rm.stampFileID, MetadataStampFileName, bytes.NewReader(stampData), int64(len(stampData)))
+			if err != nil {
+				return fmt.Errorf("failed to upload metadata stamp: %w", err)
+			}
 			return nil
 		})
-	}
+		if err != nil {
+			return err
+		}
 
-	// Standardize path separators for logs
-	// dbPath logic is already standard
+		// Snapshots are a safety net; failing to store one must not fail the upload.
+		if err := storeMetadataSnapshot(client, user, auxID, dbPath, stamp, size); err != nil {
+			logger.WarningTagged(user.LogTags(), "Failed to store metadata snapshot: %v", err)
+		}
+		return nil
+	}
 
 	var successCount int32
 	var wg sync.WaitGroup
-	for i := range cfg.Users {
-		user := &cfg.Users[i]
+	for _, rm := range remotes {
 		wg.Add(1)
-		go func(u *model.User) {
+		go func(rm *remoteMetadata) {
 			defer wg.Done()
-			if err := uploadToUser(u); err != nil {
-				logger.ErrorTagged(u.LogTags(), "Failed to sync metadata: %v", err)
+			if err := uploadToUser(rm); err != nil {
+				logger.ErrorTagged(rm.user.LogTags(), "Failed to sync metadata: %v", err)
 			} else {
 				atomic.AddInt32(&successCount, 1)
 			}
-		}(user)
+		}(rm)
 	}
 	wg.Wait()
 
@@ -333,5 +327,5 @@ func UploadMetadataDB(cfg *model.Config, dbPath string) error {
 		return fmt.Errorf("failed to upload metadata.db to any provider")
 	}
 
-	return nil
+	return writeLocalStamp(dbPath, stamp)
 }
@@ -0,0 +1,184 @@
+package task
+
+import (
+	"strings"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/microsoft"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+func msShareKey(sourceAccount, targetAccount string) string {
+	return sourceAccount + ":" + targetAccount
+}
+
+// loadMSSharesLocked loads the recorded Microsoft sharing state on first use, so a failure seen
+// in one run is not retried file by file in the next. Callers hold msSharesMu.
+func (r *Runner) loadMSSharesLocked() {
+	if r.msSharesLoaded || r.db == nil {
+		return
+	}
+	r.msSharesLoaded = true
+	shares, err := r.db.GetAccountShares(model.ProviderMicrosoft)
+	if err != nil {
+		logger.Warning("Failed to load recorded Microsoft shares: %v", err)
+		return
+	}
+	for _, share := range shares {
+		r.msShares[msShareKey(share.SourceAccount, share.TargetAccount)] = share.Status
+	}
+}
+
+// msShareStatus returns the recorded sharing state from one Microsoft account to another, or ""
+// if it was never checked.
+func (r *Runner) msShareStatus(sourceAccount, targetAccount string) string {
+	r.msSharesMu.Lock()
+	defer r.msSharesMu.Unlock()
+	r.loadMSSharesLocked()
+	return r.msShares[msShareKey(sourceAccount, targetAccount)]
+}
+
+// recordMSShare remembers the sharing state from one Microsoft account to another and persists it.
+func (r *Runner) recordMSShare(sourceAccount, targetAccount, status string, shareErr error) {
+	r.msSharesMu.Lock()
+	r.loadMSSharesLocked()
+	r.msShares[msShareKey(sourceAccount, targetAccount)] = status
+	r.msSharesMu.Unlock()
+
+	if r.db == nil {
+		return
+	}
+	share := &model.AccountShare{
+		Provider:      model.ProviderMicrosoft,
+		SourceAccount: sourceAccount,
+		TargetAccount: targetAccount,
+		Status:        status,
+		CheckedAt:     time.Now(),
+	}
+	if shareErr != nil {
+		share.Error = shareErr.Error()
+	}
+	if err := r.db.UpsertAccountShare(share); err != nil {
+		logger.Warning("Failed to record share source=%s target=%s: %v", sourceAccount, targetAccount, err)
+	}
+}
+
+// repairMicrosoftShares audits that every Microsoft account's sync folder is shared with every
+// other Microsoft account, which native OneDrive shortcuts between them rely on, and shares it
+// where it is not. Results are recorded in account_shares for distributeShortcuts.
+func (r *Runner) repairMicrosoftShares() {
+	var users []model.User
+	for _, u := range r.config.Users {
+		if u.Provider == model.ProviderMicrosoft {
+			users = append(users, u)
+		}
+	}
+	if len(users) < 2 {
+		return
+	}
+
+	var alreadyShared, repaired, failed int
+	for i := range users {
+		source := &users[i]
+		tags := source.LogTags()
+		client, err := r.GetOrCreateClient(source)
+		if err != nil {
+			logger.ErrorTagged(tags, "Failed to create client: %v", err)
+			continue
+		}
+		msClient, ok := api.Unwrap(client).(*microsoft.Client)
+		if !ok {
+			continue
+		}
+
+		folderID, err := api.WithRetryT(client.GetSyncFolderID)
+		if err != nil {
+			logger.ErrorTagged(tags, "Failed to get sync folder: %v", err)
+			continue
+		}
+		sharedWith, err := api.WithRetryT(func() (map[string]bool, error) {
+			return msClient.SharedWith(folderID)
+		})
+		if err != nil {
+			logger.WarningTagged(tags, "Failed to list sharing of the sync folder, re-sharing with every account: %v", err)
+		}
+
+		for _, target := range users {
+			if target.Email == source.Email {
+				continue
+			}
+			if sharedWith[strings.ToLower(target.Email)] {
+				alreadyShared++
+				r.recordMSShare(source.Email, target.Email, model.ShareStatusOK, nil)
+				continue
+			}
+			if r.safeMode {
+				logger.DryRunTagged(tags, "Would share sync folder with %s", target.Email)
+				continue
+			}
+			if err := api.WithRetry(func() error {
+				return client.ShareFolder(folderID, target.Email, "reader")
+			}); err != nil {
+				failed++
+				logger.WarningTagged(tags, "Failed to share sync folder with %s: %v", target.Email, err)
+				r.recordMSShare(source.Email, target.Email, model.ShareStatusFailed, err)
+				continue
+			}
+			repaired++
+			r.recordMSShare(source.Email, target.Email, model.ShareStatusOK, nil)
+		}
+	}
+	logger.Info("Microsoft sharing: %d already shared, %d repaired, %d failed", alreadyShared, repaired, failed)
+}
+
+// shortcutSourceReplica picks the replica a shortcut for targetAccount should point at: an
+// active copy of provider in another account, or failing that any active replica of provider.
+func shortcutSourceReplica(file *model.File, provider model.Provider, targetAccount string) *model.Replica {
+	var fallback *model.Replica
+	for _, replica := range file.Replicas {
+		if replica == nil || replica.Provider != provider || replica.Status != "active" {
+			continue
+		}
+		if replica.NativeHash != model.NativeHashShortcut && replica.AccountID != targetAccount {
+			return replica
+		}
+		if fallback == nil {
+			fallback = replica
+		}
+	}
+	return fallback
+}
+
+// upgradablePlaceholder returns the shortcut replica of file that accountID holds at path when
+// it may be a placeholder that a native shortcut can now replace, i.e. the account holding the
+// real copy is recorded as sharing with accountID. Whether it really is a placeholder is checked
+// against OneDrive when the shortcut is created.
+func (r *Runner) upgradablePlaceholder(file *model.File, accountID, path string) *model.Replica {
+	canonicalPath := model.NormalizePath(path)
+	var placeholder *model.Replica
+	for _, replica := range file.Replicas {
+		if replica == nil || replica.Status != "active" || replica.Provider != model.ProviderMicrosoft || replica.AccountID != accountID {
+			continue
+		}
+		if model.NormalizePath(replica.Path) != canonicalPath {
+			continue
+		}
+		if replica.NativeHash != model.NativeHashShortcut {
+			return nil
+		}
+		placeholder = replica
+	}
+	if placeholder == nil {
+		return nil
+	}
+	source := shortcutSourceReplica(file, model.ProviderMicrosoft, accountID)
+	if source == nil || source.NativeHash == model.NativeHashShortcut || source.AccountID == accountID {
+		return nil
+	}
+	if r.msShareStatus(source.AccountID, accountID) != model.ShareStatusOK {
+		return nil
+	}
+	return placeholder
+}
@@ -0,0 +1,348 @@
+package task
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+const (
+	// multiSourceMinSize is the smallest file downloaded from several sources at once; smaller
+	// files gain little over a single stream.
+	multiSourceMinSize = 256 << 20
+	// multiSourceChunkSize is the byte range fetched by one request of a multi-source download.
+	multiSourceChunkSize = 32 << 20
+	// multiSourceStreams is the number of ranges fetched at once from each source.
+	multiSourceStreams = 2
+	// multiSourceStreamChunkSize is the chunk size of a multi-source download streamed in order,
+	// whose chunks are held in memory until every chunk before them has been written.
+	multiSourceStreamChunkSize = 8 << 20
+)
+
+// errChunkDone aborts a range read once another source has finished the same chunk.
+var errChunkDone = errors.New("chunk already downloaded from another source")
+
+// rangeSource is a replica whose client can read byte ranges.
+type rangeSource struct {
+	replica *model.Replica
+	client  api.CloudClient
+	key     []byte // Decrypts an encrypted replica
+	tags    []string
+}
+
+// rangeSources returns the sources among candidates that can serve byte ranges of file, in the
+// order of candidates. Replicas whose account has no working client are left out.
+func (r *Runner) rangeSources(file *model.File, candidates []*model.Replica) []*rangeSource {
+	var sources []*rangeSource
+	for _, rep := range candidates {
+		if rep.Fragmented && len(rep.Fragments) == 0 {
+			continue
+		}
+		if size, err := plaintextSize(rep); err != nil || (!rep.Fragmented && rep.Size != 0 && size != file.Size) {
+			continue
+		}
+		user := r.getUser(rep.Provider, rep.AccountID)
+		if user == nil {
+			continue
+		}
+		client, err := r.GetOrCreateClient(user)
+		if err != nil {
+			logger.DebugTagged(user.LogTags(), "Skipping replica for multi-source download path=%q: %v", file.Path, err)
+			continue
+		}
+		if _, ok := api.Unwrap(client).(api.RangeDownloader); !ok {
+			continue
+		}
+		sources = append(sources, &rangeSource{replica: rep, client: client, key: r.contentKey, tags: user.LogTags()})
+	}
+	return sources
+}
+
+// useMultiSource reports whether a download of size bytes from sources is worth splitting: the
+// file is large and there is more than one replica, or a fragmented one.
+func useMultiSource(size int64, sources []*rangeSource) bool {
+	if size < multiSourceMinSize || len(sources) == 0 {
+		return false
+	}
+	return len(sources) > 1 || sources[0].replica.Fragmented
+}
+
+// downloadMultiSource downloads file into out from all sources at once, each fetching chunks of
+// chunkSize bytes in turn and writing them at their offset. Once no chunk is left unclaimed, an
+// idle stream also fetches the oldest chunk still in flight and whichever copy finishes first is
+// kept, so a slow source does not hold up the end of the download. A failing source is dropped
+// and its chunk handed to the others. out is then checked against the file's size and Google
+// Drive MD5.
+func downloadMultiSource(file *model.File, sources []*rangeSource, out *os.File, chunkSize int64) error {
+	if err := out.Truncate(file.Size); err != nil {
+		return fmt.Errorf("failed to allocate %s: %w", out.Name(), err)
+	}
+
+	s := newChunkScheduler(out, 0, file.Size, chunkSize, len(sources)*multiSourceStreams)
+	for _, src := range sources {
+		for i := 0; i < multiSourceStreams; i++ {
+			go s.run(file, src)
+		}
+	}
+	<-s.finished
+	if err := s.close(); err != nil {
+		return err
+	}
+
+	h := md5.New()
+	if _, err := io.Copy(h, io.NewSectionReader(out, 0, file.Size)); err != nil {
+		return fmt.Errorf("failed to read back %s: %w", out.Name(), err)
+	}
+	if file.GoogleDriveMD5 != "" {
+		if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, file.GoogleDriveMD5) {
+			return fmt.Errorf("checksum mismatch: expected md5 %s, got %s", file.GoogleDriveMD5, sum)
+		}
+	}
+	return nil
+}
+
+// streamMultiSource writes length bytes of file starting at offset to w, fetching them from all
+// sources at once like downloadMultiSource. Chunks are buffered in memory and written in order;
+// streams fetch at most two chunks each ahead of the last one written. A read of the whole file
+// is checked against its Google Drive MD5 once written, so an error after the last write means
+// w got corrupt data.
+func streamMultiSource(file *model.File, sources []*rangeSource, offset, length int64, w io.Writer, chunkSize int64) error {
+	streams := len(sources) * multiSourceStreams
+	s := newChunkScheduler(nil, offset, length, chunkSize, streams)
+	s.window = 2 * streams
+	for _, src := range sources {
+		for i := 0; i < multiSourceStreams; i++ {
+			go s.run(file, src)
+		}
+	}
+	defer s.close()
+
+	whole := offset == 0 && length == file.Size
+	h := md5.New()
+	for _, c := range s.chunks {
+		buf, err := s.wait(c)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		if whole {
+			h.Write(buf)
+		}
+		s.flush(c)
+	}
+	if whole && file.GoogleDriveMD5 != "" {
+		if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, file.GoogleDriveMD5) {
+			return fmt.Errorf("checksum mismatch: expected md5 %s, got %s", file.GoogleDriveMD5, sum)
+		}
+	}
+	return nil
+}
+
+// rangeChunk is one byte range of a multi-source download.
+type rangeChunk struct {
+	offset  int64
+	length  int64
+	done    bool
+	readers int
+	started time.Time
+	buf     []byte // Content of the chunk when streaming in order
+}
+
+// chunkScheduler hands the chunks of a multi-source download to its streams and writes what
+// they read into the output file, or into the chunks' buffers when out is nil.
+type chunkScheduler struct {
+	mu       sync.Mutex
+	changed  *sync.Cond // signalled when a chunk is released or the download ends
+	out      io.WriterAt
+	chunks   []*rangeChunk
+	pending  int // chunks not done yet
+	streams  int // streams still running
+	window   int // chunks past the last flushed one that may be fetched; 0 means no limit
+	flushed  int // chunks written out in order
+	closed   bool
+	lastErr  error
+	finished chan struct{}
+}
+
+func newChunkScheduler(out io.WriterAt, offset, length, chunkSize int64, streams int) *chunkScheduler {
+	s := &chunkScheduler{out: out, streams: streams, finished: make(chan struct{})}
+	s.changed = sync.NewCond(&s.mu)
+	for off := offset; off < offset+length; off += chunkSize {
+		s.chunks = append(s.chunks, &rangeChunk{offset: off, length: min(chunkSize, offset+length-off)})
+	}
+	s.pending = len(s.chunks)
+	if s.pending == 0 {
+		close(s.finished)
+	}
+	return s
+}
+
+// next claims the next chunk to fetch: the first one nobody is reading, else the oldest one read
+// by a single stream. While every chunk left is read by two streams it waits for one of them to
+// be released. It returns nil once the download is over.
+func (s *chunkScheduler) next() *rangeChunk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !s.closed && s.pending > 0 {
+		var hedge *rangeChunk
+		for i, c := range s.chunks {
+			if s.window > 0 && i >= s.flushed+s.window {
+				break
+			}
+			if c.done {
+				continue
+			}
+			if c.readers == 0 {
+				c.readers++
+				c.started = time.Now()
+				if s.out == nil && c.buf == nil {
+					c.buf = make([]byte, c.length)
+				}
+				return c
+			}
+			if c.readers == 1 && (hedge == nil || c.started.Before(hedge.started)) {
+				hedge = c
+			}
+		}
+		if hedge != nil {
+			hedge.readers++
+			return hedge
+		}
+		s.changed.Wait()
+	}
+	return nil
+}
+
+// writeAt writes p into c at off unless another stream has finished c or the download is over.
+func (s *chunkScheduler) writeAt(c *rangeChunk, p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.done || s.closed {
+		return 0, errChunkDone
+	}
+	if s.out == nil {
+		return copy(c.buf[off:], p), nil
+	}
+	return s.out.WriteAt(p, c.offset+off)
+}
+
+// wait blocks until c is done and returns its buffer, or returns the download error once no
+// stream is left to fetch it.
+func (s *chunkScheduler) wait(c *rangeChunk) ([]byte, error) {
+	s.mu.Lock()
+	for !c.done && !s.closed {
+		s.changed.Wait()
+	}
+	done := c.done
+	s.mu.Unlock()
+	if !done {
+		return nil, s.close()
+	}
+	return c.buf, nil
+}
+
+// flush records that c was written out, freeing its buffer and letting streams fetch further.
+func (s *chunkScheduler) flush(c *rangeChunk) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.buf = nil
+	s.flushed++
+	s.changed.Broadcast()
+}
+
+// finish releases c after a read, marking it done when err is nil. It reports whether err is a
+// real failure of the source rather than the read being overtaken by another stream.
+func (s *chunkScheduler) finish(c *rangeChunk, err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.readers--
+	defer s.changed.Broadcast()
+	if c.done || s.closed {
+		return false
+	}
+	if err != nil {
+		s.lastErr = err
+		return true
+	}
+	c.done = true
+	s.pending--
+	if s.pending == 0 {
+		close(s.finished)
+	}
+	return false
+}
+
+// exit records that a stream stopped, ending the download when it was the last one.
+func (s *chunkScheduler) exit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streams--
+	s.changed.Broadcast()
+	if s.streams == 0 && s.pending > 0 && !s.closed {
+		s.closed = true
+		close(s.finished)
+	}
+}
+
+// close stops every stream still reading and returns the download error, if any.
+func (s *chunkScheduler) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.changed.Broadcast()
+	if s.pending > 0 {
+		return fmt.Errorf("%d of %d chunks could not be downloaded: %w", s.pending, len(s.chunks), s.lastErr)
+	}
+	return nil
+}
+
+// run fetches chunks from src until none is left or src fails.
+func (s *chunkScheduler) run(file *model.File, src *rangeSource) {
+	defer s.exit()
+	for {
+		c := s.next()
+		if c == nil {
+			return
+		}
+		err := api.WithRetry(func() error {
+			cw := &chunkWriter{s: s, chunk: c}
+			err := readPlaintextRange(src.client, src.replica, src.key, c.offset, c.length, cw)
+			if err == nil && cw.n != c.length {
+				err = fmt.Errorf("short read: got %d of %d bytes", cw.n, c.length)
+			}
+			return err
+		})
+		if s.finish(c, err) {
+			logger.WarningTagged(src.tags, "Dropping source of multi-source download path=%q native_id=%s at offset %d: %v", file.Path, src.replica.NativeID, c.offset, err)
+			return
+		}
+	}
+}
+
+// chunkWriter writes a range read into its chunk of the output file.
+type chunkWriter struct {
+	s     *chunkScheduler
+	chunk *rangeChunk
+	n     int64
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	if w.n+int64(len(p)) > w.chunk.length {
+		return 0, fmt.Errorf("range read overran chunk: got more than %d bytes", w.chunk.length)
+	}
+	n, err := w.s.writeAt(w.chunk, p, w.n)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,164 @@
+package task
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// flakyRangeClient serves DownloadFileRange from an in-memory map, failing every read with
+// failErr or blocking until stall is closed when set. With a barrier, reads wait until every
+// source sharing it has started one; other methods are not used.
+type flakyRangeClient struct {
+	api.CloudClient
+	content map[string]string
+	failErr error
+	stall   chan struct{}
+	barrier *sync.WaitGroup
+	started sync.Once
+	reads   atomic.Int32
+}
+
+func (c *flakyRangeClient) DownloadFileRange(fileID string, offset, length int64, w io.Writer) error {
+	c.reads.Add(1)
+	if c.barrier != nil {
+		c.started.Do(c.barrier.Done)
+		c.barrier.Wait()
+	}
+	if c.failErr != nil {
+		return c.failErr
+	}
+	if c.stall != nil {
+		<-c.stall
+	}
+	data, ok := c.content[fileID]
+	if !ok || offset > int64(len(data)) {
+		return fmt.Errorf("file %s not found", fileID)
+	}
+	_, err := io.WriteString(w, data[offset:min(offset+length, int64(len(data)))])
+	return err
+}
+
+func multiSourceFile(content string) *model.File {
+	sum := md5.Sum([]byte(content))
+	return &model.File{Path: "/big.bin", Size: int64(len(content)), GoogleDriveMD5: hex.EncodeToString(sum[:])}
+}
+
+func downloadMultiSourceString(t *testing.T, file *model.File, sources []*rangeSource) (string, error) {
+	t.Helper()
+	out, err := os.Create(filepath.Join(t.TempDir(), "big.bin"+partSuffix))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer out.Close()
+	if err := downloadMultiSource(file, sources, out, 4); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	return string(data), nil
+}
+
+func TestDownloadMultiSource(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	file := multiSourceFile(content)
+
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	google := &flakyRangeClient{content: map[string]string{"g1": content}, barrier: &barrier}
+	telegram := &flakyRangeClient{content: map[string]string{"f1": content[:60], "f2": content[60:]}, barrier: &barrier}
+	sources := []*rangeSource{
+		{replica: &model.Replica{Provider: model.ProviderGoogle, NativeID: "g1"}, client: google},
+		{replica: &model.Replica{Provider: model.ProviderTelegram, Fragmented: true, Fragments: []*model.ReplicaFragment{
+			{FragmentNumber: 1, FragmentsTotal: 2, NativeFragmentID: "f1", Size: 60},
+			{FragmentNumber: 2, FragmentsTotal: 2, NativeFragmentID: "f2", Size: 40},
+		}}, client: telegram},
+	}
+
+	got, err := downloadMultiSourceString(t, file, sources)
+	if err != nil || got != content {
+		t.Fatalf("expected the reassembled file, got %q (%v)", got, err)
+	}
+	if google.reads.Load() == 0 || telegram.reads.Load() == 0 {
+		t.Fatalf("expected both sources to serve ranges, got %d and %d reads", google.reads.Load(), telegram.reads.Load())
+	}
+}
+
+func TestDownloadMultiSourceSurvivesBadSources(t *testing.T) {
+	content := strings.Repeat("abcdefghij", 10)
+	file := multiSourceFile(content)
+
+	stall := make(chan struct{})
+	defer close(stall)
+	healthy := &flakyRangeClient{content: map[string]string{"g1": content}}
+	sources := []*rangeSource{
+		{replica: &model.Replica{Provider: model.ProviderMicrosoft, NativeID: "m1"}, client: &flakyRangeClient{failErr: errors.New("connection reset")}},
+		{replica: &model.Replica{Provider: model.ProviderMicrosoft, NativeID: "m2"}, client: &flakyRangeClient{stall: stall}},
+		{replica: &model.Replica{Provider: model.ProviderGoogle, NativeID: "g1"}, client: healthy},
+	}
+
+	got, err := downloadMultiSourceString(t, file, sources)
+	if err != nil || got != content {
+		t.Fatalf("expected the healthy source to finish the download, got %q (%v)", got, err)
+	}
+
+	// A source serving different bytes fails the checksum.
+	corrupt := &flakyRangeClient{content: map[string]string{"g1": strings.Repeat("x", len(content))}}
+	sources = []*rangeSource{{replica: &model.Replica{Provider: model.ProviderGoogle, NativeID: "g1"}, client: corrupt}}
+	if _, err := downloadMultiSourceString(t, file, sources); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+
+	// With every source failing, the download reports the failure.
+	sources = []*rangeSource{{replica: &model.Replica{Provider: model.ProviderGoogle, NativeID: "g1"}, client: &flakyRangeClient{failErr: errors.New("gone")}}}
+	if _, err := downloadMultiSourceString(t, file, sources); err == nil || !strings.Contains(err.Error(), "gone") {
+		t.Fatalf("expected the source error, got %v", err)
+	}
+}
+
+func TestStreamMultiSource(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	file := multiSourceFile(content)
+
+	stall := make(chan struct{})
+	defer close(stall)
+	sources := []*rangeSource{
+		{replica: &model.Replica{Provider: model.ProviderMicrosoft, NativeID: "m1"}, client: &flakyRangeClient{failErr: errors.New("connection reset")}},
+		{replica: &model.Replica{Provider: model.ProviderMicrosoft, NativeID: "m2"}, client: &flakyRangeClient{stall: stall}},
+		{replica: &model.Replica{Provider: model.ProviderGoogle, NativeID: "g1"}, client: &flakyRangeClient{content: map[string]string{"g1": content}}},
+	}
+
+	var out strings.Builder
+	if err := streamMultiSource(file, sources, 0, file.Size, &out, 4); err != nil || out.String() != content {
+		t.Fatalf("expected the file in order, got %q (%v)", out.String(), err)
+	}
+
+	out.Reset()
+	if err := streamMultiSource(file, sources, 13, 50, &out, 4); err != nil || out.String() != content[13:63] {
+		t.Fatalf("expected bytes 13-62, got %q (%v)", out.String(), err)
+	}
+
+	corrupt := &flakyRangeClient{content: map[string]string{"g1": strings.Repeat("x", len(content))}}
+	sources = []*rangeSource{{replica: &model.Replica{Provider: model.ProviderGoogle, NativeID: "g1"}, client: corrupt}}
+	if err := streamMultiSource(file, sources, 0, file.Size, io.Discard, 4); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+
+	sources = []*rangeSource{{replica: &model.Replica{Provider: model.ProviderGoogle, NativeID: "g1"}, client: &flakyRangeClient{failErr: errors.New("gone")}}}
+	if err := streamMultiSource(file, sources, 0, file.Size, io.Discard, 4); err == nil || !strings.Contains(err.Error(), "gone") {
+		t.Fatalf("expected the source error, got %v", err)
+	}
+}
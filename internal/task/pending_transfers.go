@@ -0,0 +1,64 @@
+package task
+
+import (
+	"errors"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// pendingTransferTTL is how long an ownership transfer may wait for acceptance before the file is
+// moved by copy and delete instead. Consumer Google accounts can leave a transfer pending for days.
+const pendingTransferTTL = 7 * 24 * time.Hour
+
+var (
+	// errTransferStillPending means the target account has not accepted the ownership transfer
+	// yet; acceptance is retried on the next run.
+	errTransferStillPending = errors.New("ownership transfer still pending")
+	// errTransferExpired means an ownership transfer stayed pending for longer than
+	// pendingTransferTTL; callers move the file by copy and delete instead.
+	errTransferExpired = errors.New("pending ownership transfer expired")
+)
+
+// pendingTransfer returns the recorded pending ownership transfer of nativeID, or nil.
+func (r *Runner) pendingTransfer(provider model.Provider, nativeID string) *model.PendingTransfer {
+	if r.db == nil {
+		return nil
+	}
+	transfer, err := r.db.GetPendingTransfer(provider, nativeID)
+	if err != nil {
+		logger.Warning("Failed to load pending transfer native_id=%s: %v", nativeID, err)
+		return nil
+	}
+	return transfer
+}
+
+// recordPendingTransfer remembers that the transfer of file to targetAccount awaits acceptance.
+func (r *Runner) recordPendingTransfer(provider model.Provider, file *model.File, nativeID, sourceAccount, targetAccount string) {
+	if r.db == nil {
+		return
+	}
+	transfer := &model.PendingTransfer{
+		Provider:      provider,
+		NativeID:      nativeID,
+		FileID:        file.ID,
+		SourceAccount: sourceAccount,
+		TargetAccount: targetAccount,
+		RequestedAt:   time.Now(),
+	}
+	if err := r.db.RecordPendingTransfer(transfer); err != nil {
+		logger.Warning("Failed to record pending transfer path=%q native_id=%s: %v", file.Path, nativeID, err)
+	}
+}
+
+// clearPendingTransfer forgets the pending transfer of nativeID once it was accepted or the file
+// was moved by copy and delete.
+func (r *Runner) clearPendingTransfer(provider model.Provider, nativeID string) {
+	if r.db == nil {
+		return
+	}
+	if err := r.db.DeletePendingTransfer(provider, nativeID); err != nil {
+		logger.Warning("Failed to clear pending transfer native_id=%s: %v", nativeID, err)
+	}
+}
@@ -0,0 +1,94 @@
+package task
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/database"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// transferSourceClient leaves every ownership transfer pending; other methods are not used.
+type transferSourceClient struct {
+	api.CloudClient
+	transfers int
+}
+
+func (c *transferSourceClient) TransferOwnership(fileID, newOwnerEmail string) error {
+	c.transfers++
+	return api.ErrOwnershipTransferPending
+}
+
+func (c *transferSourceClient) GetUserIdentifier() string { return "main@example.com" }
+
+// transferTargetClient accepts ownership once acceptErr is cleared; other methods are not used.
+type transferTargetClient struct {
+	api.CloudClient
+	acceptErr error
+	accepts   int
+}
+
+func (c *transferTargetClient) AcceptOwnership(fileID string) (string, error) {
+	c.accepts++
+	return fileID, c.acceptErr
+}
+
+func (c *transferTargetClient) GetSyncFolderID() (string, error) { return "sync-folder", nil }
+
+func (c *transferTargetClient) MoveFile(fileID, newParentID string) error { return nil }
+
+func TestPendingTransferRetriedAcrossRuns(t *testing.T) {
+	db, err := database.OpenPath(filepath.Join(t.TempDir(), "transfers.db"), "pendingTransfers!23")
+	if err != nil {
+		t.Fatalf("OpenPath: %v", err)
+	}
+	defer db.Close()
+	if err := db.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	r := NewRunner(&model.Config{}, db, false)
+	source := &transferSourceClient{}
+	targetClient := &transferTargetClient{acceptErr: errors.New("pending owner not visible yet")}
+	target := &AccountStatus{User: model.User{Provider: model.ProviderGoogle, Email: "backup@example.com"}, Client: targetClient}
+	file := &model.File{ID: "file-1", Path: "/a.txt", Name: "a.txt"}
+
+	if _, err := r.transferOwnershipWithFallback(source, targetClient, target, file, "native-1", nil); !errors.Is(err, errTransferStillPending) {
+		t.Fatalf("expected the transfer to stay pending, got %v", err)
+	}
+	pending, err := db.GetPendingTransfer(model.ProviderGoogle, "native-1")
+	if err != nil || pending == nil || pending.SourceAccount != "main@example.com" || pending.TargetAccount != "backup@example.com" {
+		t.Fatalf("expected a recorded pending transfer, got %+v (%v)", pending, err)
+	}
+
+	// The next run retries the acceptance without requesting the transfer again.
+	targetClient.acceptErr = nil
+	nativeID, err := r.transferOwnershipWithFallback(source, targetClient, target, file, "native-1", nil)
+	if err != nil || nativeID != "native-1" {
+		t.Fatalf("expected the pending transfer to be accepted, got %q (%v)", nativeID, err)
+	}
+	if source.transfers != 1 || targetClient.accepts != 2 {
+		t.Fatalf("expected 1 transfer request and 2 acceptances, got %d and %d", source.transfers, targetClient.accepts)
+	}
+	if pending, err := db.GetPendingTransfer(model.ProviderGoogle, "native-1"); err != nil || pending != nil {
+		t.Fatalf("expected the accepted transfer to be cleared, got %+v (%v)", pending, err)
+	}
+
+	// A transfer pending for longer than the TTL expires into the copy path.
+	if err := db.RecordPendingTransfer(&model.PendingTransfer{
+		Provider: model.ProviderGoogle, NativeID: "native-2", FileID: "file-2",
+		SourceAccount: "main@example.com", TargetAccount: "backup@example.com",
+		RequestedAt: time.Now().Add(-pendingTransferTTL - time.Hour),
+	}); err != nil {
+		t.Fatalf("RecordPendingTransfer: %v", err)
+	}
+	if _, err := r.transferOwnershipWithFallback(source, targetClient, target, file, "native-2", nil); !errors.Is(err, errTransferExpired) {
+		t.Fatalf("expected the transfer to expire, got %v", err)
+	}
+	if source.transfers != 1 || targetClient.accepts != 2 {
+		t.Fatalf("expected an expired transfer not to contact either account, got %d transfers and %d acceptances", source.transfers, targetClient.accepts)
+	}
+}
@@ -0,0 +1,248 @@
+package task
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/microsoft"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// PlaceholderReport counts the shortcut replicas of one Microsoft account after a placeholder
+// convergence pass.
+type PlaceholderReport struct {
+	AccountID string
+	// Placeholders are placeholder files still standing in for a native shortcut.
+	Placeholders int
+	// Shortcuts are native shortcuts, including those that replaced a placeholder in this pass.
+	Shortcuts int
+	// Upgraded placeholders were replaced by a native shortcut in this pass.
+	Upgraded int
+	// Removed placeholders were leftovers next to a copy or shortcut of the same file.
+	Removed int
+	// Failed placeholders could not be inspected or replaced.
+	Failed int
+}
+
+type placeholderOutcome int
+
+const (
+	placeholderRemaining placeholderOutcome = iota
+	placeholderNative
+	placeholderUpgraded
+	placeholderRemoved
+	placeholderFailed
+)
+
+type placeholderCandidate struct {
+	file    *model.File
+	replica *model.Replica
+	user    model.User
+}
+
+// UpgradePlaceholders is the convergence pass for Microsoft placeholders. CreateFakeShortcut
+// leaves a zero-byte "name.md5-<md5>.placeholder" when sharing fails; once the account holding
+// the real copy is recorded as sharing with the placeholder's account (see ShareWithMain), the
+// placeholder is replaced by a native shortcut. Shortcut replicas are checked against OneDrive,
+// since the DB records native shortcuts and placeholders alike with NativeHashShortcut.
+func (r *Runner) UpgradePlaceholders() ([]PlaceholderReport, error) {
+	users := make(map[string]model.User)
+	for _, u := range r.config.Users {
+		if u.Provider == model.ProviderMicrosoft {
+			users[u.Email] = u
+		}
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	files, err := r.db.GetAllFilesAcrossProviders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files: %w", err)
+	}
+
+	reports := make(map[string]*PlaceholderReport, len(users))
+	for email := range users {
+		reports[email] = &PlaceholderReport{AccountID: email}
+	}
+	var candidates []placeholderCandidate
+	for _, file := range files {
+		for _, replica := range file.Replicas {
+			if replica == nil || replica.Status != "active" || replica.Provider != model.ProviderMicrosoft || replica.NativeHash != model.NativeHashShortcut {
+				continue
+			}
+			user, ok := users[replica.AccountID]
+			if !ok {
+				continue
+			}
+			candidates = append(candidates, placeholderCandidate{file: file, replica: replica, user: user})
+		}
+	}
+
+	if len(candidates) > 0 {
+		logger.Info("Checking %d Microsoft shortcut replicas for placeholders...", len(candidates))
+	}
+
+	const maxWorkers = 4
+	jobChan := make(chan placeholderCandidate, maxWorkers*2)
+	go func() {
+		for _, c := range candidates {
+			jobChan <- c
+		}
+		close(jobChan)
+	}()
+
+	var mu sync.Mutex
+	var refreshTargets []shortcutRefreshTarget
+	var wg sync.WaitGroup
+	for w := 0; w < maxWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobChan {
+				outcome, target, err := r.convergePlaceholder(c)
+				if err != nil {
+					logger.ErrorTagged(c.user.LogTags(), "Placeholder convergence failed path=%q native_id=%s: %v", c.file.Path, c.replica.NativeID, err)
+				}
+
+				mu.Lock()
+				report := reports[c.user.Email]
+				switch outcome {
+				case placeholderRemaining:
+					report.Placeholders++
+				case placeholderNative:
+					report.Shortcuts++
+				case placeholderUpgraded:
+					report.Upgraded++
+					report.Shortcuts++
+				case placeholderRemoved:
+					report.Removed++
+				case placeholderFailed:
+					report.Failed++
+					report.Placeholders++
+				}
+				if target != nil {
+					refreshTargets = append(refreshTargets, *target)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(refreshTargets) > 0 {
+		if err := r.refreshShortcutTargets(refreshTargets); err != nil {
+			logger.Warning("Failed to refresh upgraded shortcut targets: %v", err)
+		}
+	}
+
+	result := make([]PlaceholderReport, 0, len(reports))
+	for _, report := range reports {
+		result = append(result, *report)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].AccountID < result[j].AccountID })
+	for _, report := range result {
+		logger.InfoTagged([]string{string(model.ProviderMicrosoft), report.AccountID},
+			"Shortcuts: %d native, %d placeholders (%d upgraded, %d leftovers removed, %d failed)",
+			report.Shortcuts, report.Placeholders, report.Upgraded, report.Removed, report.Failed)
+	}
+	return result, nil
+}
+
+// convergePlaceholder inspects one shortcut replica and, if it is a placeholder, removes it when
+// the account already holds the file some other way or replaces it with a native shortcut when
+// sharing allows.
+func (r *Runner) convergePlaceholder(c placeholderCandidate) (placeholderOutcome, *shortcutRefreshTarget, error) {
+	client, err := r.GetOrCreateClient(&c.user)
+	if err != nil {
+		return placeholderFailed, nil, fmt.Errorf("failed to get client: %w", err)
+	}
+	msClient, ok := api.Unwrap(client).(*microsoft.Client)
+	if !ok {
+		return placeholderFailed, nil, fmt.Errorf("not a Microsoft client")
+	}
+	isPlaceholder, err := api.WithRetryT(func() (bool, error) {
+		return msClient.IsFakeShortcut(c.replica.NativeID)
+	})
+	if err != nil {
+		return placeholderFailed, nil, fmt.Errorf("failed to inspect replica: %w", err)
+	}
+	if !isPlaceholder {
+		return placeholderNative, nil, nil
+	}
+
+	if hasOtherActiveMicrosoftReplicaAtPath(c.file, c.replica) {
+		if r.safeMode {
+			logger.DryRunTagged(c.user.LogTags(), "Would remove leftover placeholder path=%q native_id=%s", c.file.Path, c.replica.NativeID)
+			return placeholderRemaining, nil, nil
+		}
+		if err := api.WithRetry(func() error { return client.DeleteFile(c.replica.NativeID) }); err != nil {
+			return placeholderFailed, nil, fmt.Errorf("failed to delete leftover placeholder: %w", err)
+		}
+		c.replica.Status = "deleted"
+		c.replica.ModTime = time.Now()
+		if err := r.db.UpdateReplica(c.replica); err != nil {
+			return placeholderRemoved, nil, fmt.Errorf("failed to mark leftover placeholder deleted: %w", err)
+		}
+		logger.InfoTagged(c.user.LogTags(), "Removed leftover placeholder path=%q native_id=%s", c.file.Path, c.replica.NativeID)
+		return placeholderRemoved, nil, nil
+	}
+
+	if r.upgradablePlaceholder(c.file, c.user.Email, c.file.Path) != c.replica {
+		return placeholderRemaining, nil, nil
+	}
+	if r.safeMode {
+		logger.DryRunTagged(c.user.LogTags(), "Would replace placeholder path=%q with a native shortcut", c.file.Path)
+		return placeholderRemaining, nil, nil
+	}
+
+	var target *shortcutRefreshTarget
+	err = api.WithRetry(func() error {
+		var err error
+		target, err = r.createShortcut(c.file, &c.user, 0, c.replica)
+		return err
+	})
+	if err != nil {
+		return placeholderFailed, nil, err
+	}
+	return placeholderUpgraded, target, nil
+}
+
+// hasOtherActiveMicrosoftReplicaAtPath reports whether the placeholder's account holds the file
+// at the same path through another replica: a copy, or a native shortcut already recorded with
+// the remote file's hash.
+func hasOtherActiveMicrosoftReplicaAtPath(file *model.File, placeholder *model.Replica) bool {
+	path := model.NormalizePath(placeholder.Path)
+	for _, replica := range file.Replicas {
+		if replica == nil || replica == placeholder || replica.Status != "active" || replica.Provider != model.ProviderMicrosoft || replica.AccountID != placeholder.AccountID {
+			continue
+		}
+		if replica.NativeHash != model.NativeHashShortcut && model.NormalizePath(replica.Path) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// replacePlaceholder retires a placeholder once the native shortcut replacing it exists: the
+// placeholder is deleted from OneDrive, then the shortcut and the retirement are recorded in one
+// transaction. If the delete fails only the shortcut is recorded; a later pass removes the
+// leftover placeholder once a scan has recorded the shortcut with the remote file's hash.
+func (r *Runner) replacePlaceholder(client api.CloudClient, placeholder, shortcut *model.Replica) error {
+	now := time.Now()
+	if err := api.WithRetry(func() error { return client.DeleteFile(placeholder.NativeID) }); err != nil {
+		logger.Warning("Failed to delete replaced placeholder path=%q native_id=%s: %v", placeholder.Path, placeholder.NativeID, err)
+		return r.db.UpsertReplicaByNativeID(shortcut, now.Unix())
+	}
+	if err := r.db.ReplacePlaceholderReplica(placeholder, shortcut, now.Unix()); err != nil {
+		return err
+	}
+	placeholder.Status = "deleted"
+	placeholder.ModTime = now
+	logger.InfoTagged(shortcut.LogTags(), "Replaced placeholder path=%q with native shortcut native_id=%s", shortcut.Path, shortcut.NativeID)
+	return nil
+}
@@ -0,0 +1,344 @@
+package task
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/database"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// PoolProviders is the order providers are reported in by the browsing commands.
+var PoolProviders = []model.Provider{model.ProviderGoogle, model.ProviderMicrosoft, model.ProviderTelegram}
+
+// PoolEntry is one file or folder of the pool as shown by ls and find. For a file, Coverage
+// counts its active replicas per provider; for a folder, it counts the files beneath it that
+// have at least one active replica on that provider.
+type PoolEntry struct {
+	Path           string                 `json:"path"`
+	Name           string                 `json:"name"`
+	IsDir          bool                   `json:"is_dir"`
+	Size           int64                  `json:"size"`
+	Files          int                    `json:"files,omitempty"`
+	ModTime        time.Time              `json:"mod_time"`
+	Status         string                 `json:"status"`
+	GoogleDriveMD5 string                 `json:"google_drive_md5,omitempty"`
+	Coverage       map[model.Provider]int `json:"coverage"`
+}
+
+// CleanPoolPath turns a user-supplied logical path into the "/a/b" form used in the DB.
+func CleanPoolPath(p string) string {
+	p = strings.Trim(model.NormalizePath(p), "/")
+	if p == "" || p == "." {
+		return "/"
+	}
+	return path.Clean("/" + p)
+}
+
+func fileEntry(f *database.FileSummary) *PoolEntry {
+	e := &PoolEntry{
+		Path:           f.Path,
+		Name:           f.Name,
+		Size:           f.Size,
+		ModTime:        f.ModTime,
+		Status:         f.Status,
+		GoogleDriveMD5: f.GoogleDriveMD5,
+		Coverage:       make(map[model.Provider]int),
+	}
+	for p, c := range f.Coverage {
+		e.Coverage[p] = c.Count
+	}
+	return e
+}
+
+// ListPoolDir lists the files and folders directly inside dir. Only active entries are listed
+// unless all is set. When dir names a file, that file is returned on its own.
+func ListPoolDir(db *database.DB, dir string, all bool) ([]*PoolEntry, error) {
+	dir = CleanPoolPath(dir)
+	files, err := db.GetFileSummaries(dir)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := db.GetAllLogicalFolders()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	dirs := make(map[string]*PoolEntry)
+	var entries []*PoolEntry
+	found := dir == "/"
+
+	for _, lf := range folders {
+		if lf.Path == dir {
+			found = true
+		}
+		if path.Dir(lf.Path) != dir || (!all && lf.Status != "active") {
+			continue
+		}
+		dirs[lf.Name] = &PoolEntry{Path: lf.Path, Name: lf.Name, IsDir: true, Status: lf.Status, Coverage: make(map[model.Provider]int)}
+	}
+
+	for _, f := range files {
+		found = true
+		if !all && f.Status != "active" {
+			continue
+		}
+		rel := strings.TrimPrefix(f.Path, prefix)
+		name, _, nested := strings.Cut(rel, "/")
+		if !nested {
+			entries = append(entries, fileEntry(f))
+			continue
+		}
+		d := dirs[name]
+		if d == nil {
+			d = &PoolEntry{Path: prefix + name, Name: name, IsDir: true, Status: "active", Coverage: make(map[model.Provider]int)}
+			dirs[name] = d
+		}
+		d.Files++
+		d.Size += f.Size
+		if f.ModTime.After(d.ModTime) {
+			d.ModTime = f.ModTime
+		}
+		for p, c := range f.Coverage {
+			if c.Count > 0 {
+				d.Coverage[p]++
+			}
+		}
+	}
+
+	if !found {
+		file, err := db.GetFileByPath(dir)
+		if err != nil {
+			return nil, err
+		}
+		if file == nil {
+			return nil, fmt.Errorf("%s: no such file or folder in the pool", dir)
+		}
+		summaries, err := db.GetFileSummaries(path.Dir(dir))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range summaries {
+			if f.ID == file.ID {
+				return []*PoolEntry{fileEntry(f)}, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: no such file or folder in the pool", dir)
+	}
+
+	for _, d := range dirs {
+		entries = append(entries, d)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// FindOptions filters FindPool results. Zero values do not filter.
+type FindOptions struct {
+	Root    string
+	Name    string // glob matched against the file name
+	MinSize int64
+	MaxSize int64 // 0 means no limit
+	Newer   time.Time
+	Older   time.Time
+	Status  string // "" means active, "any" disables the filter
+}
+
+// FindPool returns the logical files below opts.Root matching every filter, ordered by path.
+func FindPool(db *database.DB, opts FindOptions) ([]*PoolEntry, error) {
+	if opts.Name != "" {
+		if _, err := path.Match(opts.Name, ""); err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q: %w", opts.Name, err)
+		}
+	}
+	status := opts.Status
+	if status == "" {
+		status = "active"
+	}
+
+	files, err := db.GetFileSummaries(CleanPoolPath(opts.Root))
+	if err != nil {
+		return nil, err
+	}
+	var entries []*PoolEntry
+	for _, f := range files {
+		if status != "any" && f.Status != status {
+			continue
+		}
+		if opts.Name != "" {
+			if ok, _ := path.Match(opts.Name, f.Name); !ok {
+				continue
+			}
+		}
+		if f.Size < opts.MinSize || (opts.MaxSize > 0 && f.Size > opts.MaxSize) {
+			continue
+		}
+		if (!opts.Newer.IsZero() && !f.ModTime.After(opts.Newer)) || (!opts.Older.IsZero() && !f.ModTime.Before(opts.Older)) {
+			continue
+		}
+		entries = append(entries, fileEntry(f))
+	}
+	return entries, nil
+}
+
+// PoolUsage is the space used by the active files below one folder. Providers holds the bytes
+// stored by active replicas on each provider, so it counts every copy.
+type PoolUsage struct {
+	Path      string                   `json:"path"`
+	Files     int                      `json:"files"`
+	Size      int64                    `json:"size"`
+	Providers map[model.Provider]int64 `json:"providers"`
+}
+
+// PoolDiskUsage reports usage for root and every folder up to depth levels below it, ordered by
+// path.
+func PoolDiskUsage(db *database.DB, root string, depth int) ([]*PoolUsage, error) {
+	root = CleanPoolPath(root)
+	files, err := db.GetFileSummaries(root)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimSuffix(root, "/") + "/"
+	usage := map[string]*PoolUsage{}
+	add := func(p string, f *database.FileSummary) {
+		u := usage[p]
+		if u == nil {
+			u = &PoolUsage{Path: p, Providers: make(map[model.Provider]int64)}
+			usage[p] = u
+		}
+		u.Files++
+		u.Size += f.Size
+		for provider, c := range f.Coverage {
+			u.Providers[provider] += c.Size
+		}
+	}
+
+	for _, f := range files {
+		if f.Status != "active" {
+			continue
+		}
+		add(root, f)
+		parts := strings.Split(strings.TrimPrefix(f.Path, prefix), "/")
+		current := strings.TrimSuffix(prefix, "/")
+		for i := 0; i < len(parts)-1 && i < depth; i++ {
+			current += "/" + parts[i]
+			add(current, f)
+		}
+	}
+	if usage[root] == nil {
+		usage[root] = &PoolUsage{Path: root, Providers: make(map[model.Provider]int64)}
+	}
+
+	rows := make([]*PoolUsage, 0, len(usage))
+	for _, u := range usage {
+		rows = append(rows, u)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Path < rows[j].Path })
+	return rows, nil
+}
+
+// ReplicaStat is one physical copy of a file as shown by stat.
+type ReplicaStat struct {
+	*model.Replica
+	Fragments []*model.ReplicaFragment `json:"fragments,omitempty"`
+}
+
+// ShardStat is one shard of an erasure-coded file as shown by stat.
+type ShardStat struct {
+	*model.Shard
+	Fragments []*model.ReplicaFragment `json:"fragments,omitempty"`
+}
+
+// FileStat is the full record of a logical file.
+type FileStat struct {
+	ID             string         `json:"id"`
+	Path           string         `json:"path"`
+	Name           string         `json:"name"`
+	Size           int64          `json:"size"`
+	GoogleDriveMD5 string         `json:"google_drive_md5"`
+	ModTime        time.Time      `json:"mod_time"`
+	Status         string         `json:"status"`
+	Replicas       []*ReplicaStat `json:"replicas"`
+	Shards         []*ShardStat   `json:"shards,omitempty"`
+}
+
+// FolderStat is the full record of a logical folder. ID is empty for a folder that only exists
+// implicitly through the paths of its files (e.g. on Telegram).
+type FolderStat struct {
+	ID       string                 `json:"id,omitempty"`
+	Path     string                 `json:"path"`
+	Name     string                 `json:"name"`
+	Status   string                 `json:"status"`
+	Replicas []*model.FolderReplica `json:"replicas"`
+}
+
+// PoolStat describes whatever is at a logical path.
+type PoolStat struct {
+	File   *FileStat   `json:"file,omitempty"`
+	Folder *FolderStat `json:"folder,omitempty"`
+}
+
+// StatPool returns every replica, shard, fragment, owner and last_seen_at recorded for p.
+func StatPool(db *database.DB, p string) (*PoolStat, error) {
+	p = CleanPoolPath(p)
+
+	file, err := db.GetFileByPath(p)
+	if err != nil {
+		return nil, err
+	}
+	if file != nil {
+		fs := &FileStat{
+			ID:             file.ID,
+			Path:           file.Path,
+			Name:           file.Name,
+			Size:           file.Size,
+			GoogleDriveMD5: file.GoogleDriveMD5,
+			ModTime:        file.ModTime,
+			Status:         file.Status,
+		}
+		for _, r := range file.Replicas {
+			fs.Replicas = append(fs.Replicas, &ReplicaStat{Replica: r, Fragments: r.Fragments})
+		}
+		shards, err := db.GetFileShards(file.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range shards {
+			fs.Shards = append(fs.Shards, &ShardStat{Shard: s, Fragments: s.Fragments})
+		}
+		return &PoolStat{File: fs}, nil
+	}
+
+	lf, err := db.GetLogicalFolderByPath(p)
+	if err != nil {
+		return nil, err
+	}
+	if lf != nil {
+		replicas, err := db.GetFolderReplicas(lf.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &PoolStat{Folder: &FolderStat{ID: lf.ID, Path: lf.Path, Name: lf.Name, Status: lf.Status, Replicas: replicas}}, nil
+	}
+
+	if p != "/" {
+		files, err := db.GetFileSummaries(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("%s: no such file or folder in the pool", p)
+		}
+	}
+	return &PoolStat{Folder: &FolderStat{Path: p, Name: path.Base(p), Status: "active"}}, nil
+}
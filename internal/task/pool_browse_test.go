@@ -0,0 +1,158 @@
+package task
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/database"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+func openBrowseTestDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := database.OpenPath(filepath.Join(t.TempDir(), "browse.db"), "poolBrowsePass!23")
+	if err != nil {
+		t.Fatalf("OpenPath: %v", err)
+	}
+	if err := db.Initialize(); err != nil {
+		db.Close()
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	files := []*model.File{
+		{
+			ID: "f-a", Path: "/docs/a.txt", Name: "a.txt", Size: 100, ModTime: modTime, Status: "active",
+			Replicas: []*model.Replica{
+				{Path: "/docs/a.txt", Name: "a.txt", Size: 100, Provider: model.ProviderGoogle, AccountID: "main@example.com", NativeID: "g-a", ModTime: modTime, Status: "active"},
+				{Path: "/docs/a.txt", Name: "a.txt", Size: 100, Provider: model.ProviderTelegram, AccountID: "+100", NativeID: "t-a", ModTime: modTime, Status: "active"},
+			},
+		},
+		{
+			ID: "f-b", Path: "/docs/sub/b.bin", Name: "b.bin", Size: 4000, ModTime: modTime.Add(time.Hour), Status: "active",
+			Replicas: []*model.Replica{
+				{Path: "/docs/sub/b.bin", Name: "b.bin", Size: 4000, Provider: model.ProviderMicrosoft, AccountID: "ms@example.com", NativeID: "m-b", ModTime: modTime, Status: "active"},
+			},
+		},
+		{
+			ID: "f-top", Path: "/top.txt", Name: "top.txt", Size: 5, ModTime: modTime, Status: "soft-deleted",
+		},
+	}
+	for _, f := range files {
+		if err := db.InsertFile(f); err != nil {
+			db.Close()
+			t.Fatalf("InsertFile(%s): %v", f.Path, err)
+		}
+	}
+	return db
+}
+
+func TestListPoolDir(t *testing.T) {
+	db := openBrowseTestDB(t)
+	defer db.Close()
+
+	entries, err := ListPoolDir(db, "/", false)
+	if err != nil {
+		t.Fatalf("ListPoolDir: %v", err)
+	}
+	if len(entries) != 1 || !entries[0].IsDir || entries[0].Path != "/docs" {
+		t.Fatalf("expected only /docs, got %+v", entries)
+	}
+	docs := entries[0]
+	if docs.Files != 2 || docs.Size != 4100 {
+		t.Fatalf("expected 2 files / 4100 bytes under /docs, got %d / %d", docs.Files, docs.Size)
+	}
+	if docs.Coverage[model.ProviderGoogle] != 1 || docs.Coverage[model.ProviderMicrosoft] != 1 || docs.Coverage[model.ProviderTelegram] != 1 {
+		t.Fatalf("unexpected /docs coverage %v", docs.Coverage)
+	}
+
+	entries, err = ListPoolDir(db, "/", true)
+	if err != nil {
+		t.Fatalf("ListPoolDir(all): %v", err)
+	}
+	if len(entries) != 2 || entries[1].Path != "/top.txt" {
+		t.Fatalf("expected /docs and /top.txt with --all, got %+v", entries)
+	}
+
+	entries, err = ListPoolDir(db, "docs/a.txt", false)
+	if err != nil {
+		t.Fatalf("ListPoolDir(file): %v", err)
+	}
+	if len(entries) != 1 || entries[0].Coverage[model.ProviderGoogle] != 1 || entries[0].Coverage[model.ProviderTelegram] != 1 {
+		t.Fatalf("expected the single file entry, got %+v", entries)
+	}
+
+	if _, err := ListPoolDir(db, "/missing", false); err == nil {
+		t.Fatalf("expected an error for a missing path")
+	}
+}
+
+func TestFindPool(t *testing.T) {
+	db := openBrowseTestDB(t)
+	defer db.Close()
+
+	entries, err := FindPool(db, FindOptions{Root: "/", Name: "*.txt"})
+	if err != nil {
+		t.Fatalf("FindPool: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != "/docs/a.txt" {
+		t.Fatalf("expected /docs/a.txt, got %+v", entries)
+	}
+
+	entries, err = FindPool(db, FindOptions{Root: "/", Name: "*.txt", Status: "any"})
+	if err != nil {
+		t.Fatalf("FindPool(any): %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 matches with any status, got %d", len(entries))
+	}
+
+	entries, err = FindPool(db, FindOptions{Root: "/docs", MinSize: 1000})
+	if err != nil {
+		t.Fatalf("FindPool(size): %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != "/docs/sub/b.bin" {
+		t.Fatalf("expected /docs/sub/b.bin, got %+v", entries)
+	}
+
+	entries, err = FindPool(db, FindOptions{Newer: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("FindPool(newer): %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "b.bin" {
+		t.Fatalf("expected b.bin to be the only newer file, got %+v", entries)
+	}
+}
+
+func TestPoolDiskUsageAndStat(t *testing.T) {
+	db := openBrowseTestDB(t)
+	defer db.Close()
+
+	rows, err := PoolDiskUsage(db, "/", 1)
+	if err != nil {
+		t.Fatalf("PoolDiskUsage: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Path != "/" || rows[1].Path != "/docs" {
+		t.Fatalf("expected rows for / and /docs, got %+v", rows)
+	}
+	if rows[0].Size != 4100 || rows[0].Providers[model.ProviderTelegram] != 100 || rows[0].Providers[model.ProviderMicrosoft] != 4000 {
+		t.Fatalf("unexpected root usage %+v", rows[0])
+	}
+
+	st, err := StatPool(db, "/docs/a.txt")
+	if err != nil {
+		t.Fatalf("StatPool: %v", err)
+	}
+	if st.File == nil || len(st.File.Replicas) != 2 {
+		t.Fatalf("expected file stat with 2 replicas, got %+v", st)
+	}
+
+	st, err = StatPool(db, "/docs/sub")
+	if err != nil {
+		t.Fatalf("StatPool(folder): %v", err)
+	}
+	if st.Folder == nil || st.Folder.Path != "/docs/sub" {
+		t.Fatalf("expected implicit folder stat, got %+v", st)
+	}
+}
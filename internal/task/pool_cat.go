@@ -0,0 +1,185 @@
+package task
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// CatFromPool writes the logical file at logicalPath to w. rangeSpec selects part of it, as
+// parsed by ParseByteRange; empty means the whole file. Replicas are tried in download order;
+// when one fails part-way, the next continues from where it stopped.
+func (r *Runner) CatFromPool(logicalPath, rangeSpec string, w io.Writer) error {
+	logicalPath = CleanPoolPath(logicalPath)
+	file, err := r.db.GetFileByPath(logicalPath)
+	if err != nil {
+		return err
+	}
+	if file == nil || file.Status != "active" {
+		return fmt.Errorf("%s: no such active file in the pool", logicalPath)
+	}
+	offset, length := int64(0), int64(-1)
+	if rangeSpec != "" {
+		if offset, length, err = ParseByteRange(rangeSpec, file.Size); err != nil {
+			return err
+		}
+	}
+	return r.ReadFileRange(file, offset, length, w)
+}
+
+// ParseByteRange parses an inclusive byte range in the form of an HTTP Range header without its
+// "bytes=" prefix: "start-end", "start-" (to the end) or "-n" (the last n bytes). It returns the
+// offset and length within a file of the given size.
+func ParseByteRange(spec string, size int64) (int64, int64, error) {
+	startStr, endStr, ok := strings.Cut(strings.TrimPrefix(strings.TrimSpace(spec), "bytes="), "-")
+	if !ok || (startStr == "" && endStr == "") {
+		return 0, 0, fmt.Errorf("invalid range %q (use start-end, start- or -n)", spec)
+	}
+	parse := func(s string) (int64, error) {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid range %q", spec)
+		}
+		return v, nil
+	}
+
+	if startStr == "" {
+		n, err := parse(endStr)
+		if err != nil {
+			return 0, 0, err
+		}
+		n = min(n, size)
+		return size - n, n, nil
+	}
+	start, err := parse(startStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start > size || (start == size && size > 0) {
+		return 0, 0, fmt.Errorf("range %q starts beyond the end of the file (size %d)", spec, size)
+	}
+	if endStr == "" {
+		return start, size - start, nil
+	}
+	end, err := parse(endStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("invalid range %q: end before start", spec)
+	}
+	return start, min(end+1, size) - start, nil
+}
+
+// ReadFileRange writes length bytes of file starting at offset to w (to the end when length is
+// negative). Only the bytes in the range are fetched where the provider supports it, and only
+// the Telegram fragments and encrypted chunks that overlap the range are read. Large ranges are
+// fetched from all replicas at once, falling back to one replica at a time from where that
+// stopped. An erasure-coded file is read from its data shards.
+func (r *Runner) ReadFileRange(file *model.File, offset, length int64, w io.Writer) error {
+	if offset < 0 || offset > file.Size {
+		return fmt.Errorf("offset %d is outside the file (size %d)", offset, file.Size)
+	}
+	if length < 0 || offset+length > file.Size {
+		length = file.Size - offset
+	}
+	if length == 0 {
+		return nil
+	}
+
+	candidates := r.downloadCandidates(file)
+	if len(candidates) == 0 {
+		shards, err := r.db.GetFileShards(file.ID)
+		if err != nil {
+			return err
+		}
+		if len(shards) == 0 {
+			return fmt.Errorf("file has no downloadable replicas")
+		}
+		return r.readShardedRange(file, shards, offset, length, w)
+	}
+
+	cw := &countingWriter{w: w}
+	if length >= multiSourceMinSize {
+		if sources := r.rangeSources(file, candidates); useMultiSource(length, sources) {
+			logger.Info("Reading path=%q from %d source(s) in parallel...", file.Path, len(sources))
+			err := streamMultiSource(file, sources, offset, length, cw, multiSourceStreamChunkSize)
+			if err == nil || cw.n == length {
+				return err
+			}
+			logger.Warning("Multi-source read failed path=%q at offset %d, reading from one replica at a time: %v", file.Path, offset+cw.n, err)
+		}
+	}
+
+	var lastErr error
+	for _, rep := range candidates {
+		user := r.getUser(rep.Provider, rep.AccountID)
+		if user == nil {
+			lastErr = fmt.Errorf("user not found for replica %s", rep.AccountID)
+			continue
+		}
+		client, err := r.GetOrCreateClient(user)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to get client for %s: %w", rep.AccountID, err)
+			continue
+		}
+
+		done := cw.n
+		err = readPlaintextRange(client, rep, r.contentKey, offset+done, length-done, cw)
+		if err == nil && cw.n != length {
+			err = fmt.Errorf("short read: got %d of %d bytes", cw.n, length)
+		}
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		logger.WarningTagged(user.LogTags(), "Read failed path=%q native_id=%s: %v", file.Path, rep.NativeID, err)
+	}
+	return lastErr
+}
+
+// readReplicaRange writes length bytes of a replica starting at offset to w.
+func readReplicaRange(client api.CloudClient, rep *model.Replica, offset, length int64, w io.Writer) error {
+	if !rep.Fragmented {
+		return readObjectRange(client, rep.NativeID, offset, length, w)
+	}
+	if len(rep.Fragments) == 0 {
+		return fmt.Errorf("replica is fragmented but has no fragments")
+	}
+
+	var start int64
+	for _, frag := range rep.Fragments {
+		end := start + frag.Size
+		if end > offset && start < offset+length {
+			from := max(offset, start) - start
+			to := min(offset+length, end) - start
+			if err := readObjectRange(client, frag.NativeFragmentID, from, to-from, w); err != nil {
+				return fmt.Errorf("(fragment %d) %w", frag.FragmentNumber, err)
+			}
+		}
+		start = end
+		if start >= offset+length {
+			break
+		}
+	}
+	return nil
+}
+
+// readObjectRange reads part of one provider object, falling back to a full download that is
+// trimmed to the range when the client cannot read ranges.
+func readObjectRange(client api.CloudClient, nativeID string, offset, length int64, w io.Writer) error {
+	if rd, ok := api.Unwrap(client).(api.RangeDownloader); ok {
+		return rd.DownloadFileRange(nativeID, offset, length, w)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(client.DownloadFile(nativeID, pw))
+	}()
+	defer pr.Close()
+	return api.CopyRange(w, pr, offset, length)
+}
@@ -0,0 +1,89 @@
+package task
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// rangeClient records which objects were read through DownloadFileRange.
+type rangeClient struct {
+	contentClient
+	reads []string
+}
+
+func (c *rangeClient) DownloadFileRange(fileID string, offset, length int64, w io.Writer) error {
+	c.reads = append(c.reads, fileID)
+	data := c.content[fileID][offset:]
+	if length >= 0 {
+		data = data[:length]
+	}
+	_, err := io.WriteString(w, data)
+	return err
+}
+
+func TestReadReplicaRangeFetchesOnlyNeededFragments(t *testing.T) {
+	client := &rangeClient{contentClient: contentClient{content: map[string]string{
+		"f1": "0123456789",
+		"f2": "abcdefghij",
+		"f3": "ABCDEFGHIJ",
+	}}}
+	rep := &model.Replica{Fragmented: true, Fragments: []*model.ReplicaFragment{
+		{FragmentNumber: 1, Size: 10, NativeFragmentID: "f1"},
+		{FragmentNumber: 2, Size: 10, NativeFragmentID: "f2"},
+		{FragmentNumber: 3, Size: 10, NativeFragmentID: "f3"},
+	}}
+
+	var buf bytes.Buffer
+	if err := readReplicaRange(client, rep, 15, 10, &buf); err != nil {
+		t.Fatalf("readReplicaRange: %v", err)
+	}
+	if buf.String() != "fghijABCDE" {
+		t.Fatalf("expected fghijABCDE, got %q", buf.String())
+	}
+	if len(client.reads) != 2 || client.reads[0] != "f2" || client.reads[1] != "f3" {
+		t.Fatalf("expected only f2 and f3 to be read, got %v", client.reads)
+	}
+}
+
+func TestReadReplicaRangeFallsBackToFullDownload(t *testing.T) {
+	client := &contentClient{content: map[string]string{"obj": "hello world"}}
+	var buf bytes.Buffer
+	if err := readReplicaRange(client, &model.Replica{NativeID: "obj"}, 6, 3, &buf); err != nil {
+		t.Fatalf("readReplicaRange: %v", err)
+	}
+	if buf.String() != "wor" {
+		t.Fatalf("expected wor, got %q", buf.String())
+	}
+}
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		spec           string
+		offset, length int64
+		wantErr        bool
+	}{
+		{spec: "0-99", offset: 0, length: 100},
+		{spec: "bytes=100-199", offset: 100, length: 100},
+		{spec: "900-", offset: 900, length: 100},
+		{spec: "-10", offset: 990, length: 10},
+		{spec: "950-2000", offset: 950, length: 50},
+		{spec: "1000-", wantErr: true},
+		{spec: "20-10", wantErr: true},
+		{spec: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		offset, length, err := ParseByteRange(tt.spec, 1000)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseByteRange(%q): expected an error", tt.spec)
+			}
+			continue
+		}
+		if err != nil || offset != tt.offset || length != tt.length {
+			t.Errorf("ParseByteRange(%q) = %d, %d, %v; want %d, %d", tt.spec, offset, length, err, tt.offset, tt.length)
+		}
+	}
+}
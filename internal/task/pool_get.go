@@ -0,0 +1,312 @@
+package task
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// partSuffix marks a download in progress. The file is renamed into place once verified.
+const partSuffix = ".cds-part"
+
+// GetResult summarizes a GetFromPool run.
+type GetResult struct {
+	Downloaded int
+	Skipped    int
+	Failed     int
+	Bytes      int64
+}
+
+// GetFromPool downloads the logical file or folder at logicalPath to dest. A file is written to
+// dest, or into dest when it is an existing directory; a folder's contents are written below
+// dest, recreating its empty subfolders. Empty dest means the base name in the working directory.
+//
+// Files already present at the destination with the logical size and modification time are
+// skipped, so re-running the same command resumes an interrupted download.
+func (r *Runner) GetFromPool(logicalPath, dest string) (*GetResult, error) {
+	logicalPath = CleanPoolPath(logicalPath)
+
+	file, err := r.db.GetFileByPath(logicalPath)
+	if err != nil {
+		return nil, err
+	}
+	if file != nil && file.Status == "active" {
+		if dest == "" {
+			dest = "."
+		}
+		if info, err := os.Stat(dest); dest == "." || (err == nil && info.IsDir()) {
+			if dest, err = containedPath(dest, file.Name); err != nil {
+				return nil, err
+			}
+		}
+		res := &GetResult{}
+		r.getPoolFile(file, dest, res)
+		if res.Failed > 0 {
+			return res, fmt.Errorf("failed to download %s", logicalPath)
+		}
+		return res, nil
+	}
+
+	files, err := r.db.GetFileSummaries(logicalPath)
+	if err != nil {
+		return nil, err
+	}
+	folders, err := r.db.GetAllLogicalFolders()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimSuffix(logicalPath, "/") + "/"
+	var dirs []string
+	found := logicalPath == "/"
+	for _, lf := range folders {
+		if lf.Status != "active" {
+			continue
+		}
+		if lf.Path == logicalPath {
+			found = true
+		} else if strings.HasPrefix(lf.Path, prefix) {
+			dirs = append(dirs, strings.TrimPrefix(lf.Path, prefix))
+		}
+	}
+	var active []string
+	for _, f := range files {
+		if f.Status == "active" {
+			active = append(active, f.ID)
+		}
+	}
+	if !found && len(active) == 0 {
+		return nil, fmt.Errorf("%s: no such active file or folder in the pool", logicalPath)
+	}
+
+	if dest == "" {
+		dest = path.Base(logicalPath)
+		if logicalPath == "/" {
+			dest = "cloud-drives-sync-root"
+		}
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+	res := &GetResult{}
+	for _, d := range dirs {
+		target, err := containedPath(dest, d)
+		if err != nil {
+			logger.Error("Skipping folder: %v", err)
+			res.Failed++
+			continue
+		}
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create folder %s: %w", d, err)
+		}
+	}
+
+	for i, id := range active {
+		f, err := r.db.GetFileByID(id)
+		if err != nil {
+			return res, err
+		}
+		logger.Info("[%d/%d] %s", i+1, len(active), f.Path)
+		target, err := containedPath(dest, strings.TrimPrefix(f.Path, prefix))
+		if err != nil {
+			logger.Error("Skipping path=%q: %v", f.Path, err)
+			res.Failed++
+			continue
+		}
+		r.getPoolFile(f, target, res)
+	}
+	if res.Failed > 0 {
+		return res, fmt.Errorf("%d of %d entries could not be downloaded", res.Failed, len(dirs)+len(active))
+	}
+	return res, nil
+}
+
+// containedPath returns dir joined with the slash-separated path rel. Names come from provider
+// listings and from DBs written by other hosts, so a rel that would leave dir through ".."
+// elements is refused.
+func containedPath(dir, rel string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(rel))
+	r, err := filepath.Rel(dir, target)
+	if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q would be written outside %s", rel, dir)
+	}
+	return target, nil
+}
+
+// getPoolFile downloads one logical file to target and records the outcome in res.
+func (r *Runner) getPoolFile(file *model.File, target string, res *GetResult) {
+	if info, err := os.Stat(target); err == nil && !info.IsDir() &&
+		info.Size() == file.Size && info.ModTime().Unix() == file.ModTime.Unix() {
+		res.Skipped++
+		return
+	}
+	if err := r.downloadLogicalFile(file, target); err != nil {
+		logger.Error("Failed to download path=%q: %v", file.Path, err)
+		res.Failed++
+		return
+	}
+	res.Downloaded++
+	res.Bytes += file.Size
+}
+
+// downloadCandidates returns the replicas file can be downloaded from, best first: the replica
+// chooseCanonicalReplica would pick (Google, then OneDrive, then Telegram), followed by the rest
+// in the same order.
+func (r *Runner) downloadCandidates(file *model.File) []*model.Replica {
+	var candidates []*model.Replica
+	for _, rep := range file.Replicas {
+		if rep != nil && rep.Status == "active" && rep.NativeHash != model.NativeHashShortcut {
+			candidates = append(candidates, rep)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		pi, pj := r.canonicalReplicaPriority(candidates[i]), r.canonicalReplicaPriority(candidates[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return candidates[i].ModTime.After(candidates[j].ModTime)
+	})
+	return candidates
+}
+
+// downloadLogicalFile writes the content of file to target, trying each replica in turn until
+// one yields the expected size and Google Drive MD5, or rebuilding it from its shards when it is
+// erasure-coded. The modification time is restored.
+func (r *Runner) downloadLogicalFile(file *model.File, target string) error {
+	shards, err := r.db.GetFileShards(file.ID)
+	if err != nil {
+		return err
+	}
+	candidates := r.downloadCandidates(file)
+	if len(candidates) == 0 && len(shards) == 0 {
+		return fmt.Errorf("file has no downloadable replicas")
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	partPath := target + partSuffix
+	finish := func() error {
+		if err := os.Rename(partPath, target); err != nil {
+			os.Remove(partPath)
+			return fmt.Errorf("failed to move download into place: %w", err)
+		}
+		if err := os.Chtimes(target, file.ModTime, file.ModTime); err != nil {
+			logger.Warning("Failed to restore modification time of %s: %v", target, err)
+		}
+		return nil
+	}
+
+	if len(candidates) == 0 {
+		if err := r.downloadShardedFile(file, shards, partPath); err != nil {
+			os.Remove(partPath)
+			return err
+		}
+		return finish()
+	}
+
+	// Large files are fetched from all replicas at once, falling back to one at a time
+	if sources := r.rangeSources(file, candidates); useMultiSource(file.Size, sources) {
+		logger.Info("Downloading path=%q from %d source(s) in parallel...", file.Path, len(sources))
+		err := downloadMultiSourceTo(file, sources, partPath)
+		if err == nil {
+			return finish()
+		}
+		logger.Warning("Multi-source download failed path=%q, downloading from one replica at a time: %v", file.Path, err)
+	}
+
+	var lastErr error
+	for _, rep := range candidates {
+		user := r.getUser(rep.Provider, rep.AccountID)
+		if user == nil {
+			lastErr = fmt.Errorf("user not found for replica %s", rep.AccountID)
+			continue
+		}
+		client, err := r.GetOrCreateClient(user)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to get client for %s: %w", rep.AccountID, err)
+			continue
+		}
+
+		if err := downloadVerified(client, file, rep, r.contentKey, partPath); err != nil {
+			lastErr = err
+			logger.WarningTagged(user.LogTags(), "Download failed path=%q native_id=%s: %v", file.Path, rep.NativeID, err)
+			continue
+		}
+		return finish()
+	}
+	os.Remove(partPath)
+	return lastErr
+}
+
+// downloadMultiSourceTo downloads file from sources into a new file at partPath.
+func downloadMultiSourceTo(file *model.File, sources []*rangeSource, partPath string) error {
+	out, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := downloadMultiSource(file, sources, out, multiSourceChunkSize); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// downloadVerified downloads rep into partPath, decrypting it with key when it is encrypted, and
+// checks it against the logical file.
+func downloadVerified(client api.CloudClient, file *model.File, rep *model.Replica, key []byte, partPath string) error {
+	out, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	h := md5.New()
+	var written int64
+	err = api.WithRetry(func() error {
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := out.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		h.Reset()
+		cw := &countingWriter{w: io.MultiWriter(out, h)}
+		err := downloadPlaintext(client, rep, key, cw)
+		written = cw.n
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if written != file.Size {
+		return fmt.Errorf("size mismatch: expected %d bytes, got %d", file.Size, written)
+	}
+	if file.GoogleDriveMD5 != "" {
+		if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, file.GoogleDriveMD5) {
+			return fmt.Errorf("checksum mismatch: expected md5 %s, got %s", file.GoogleDriveMD5, sum)
+		}
+	}
+	return out.Close()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,94 @@
+package task
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// contentClient serves DownloadFile from an in-memory map; other methods are not used.
+type contentClient struct {
+	api.CloudClient
+	content map[string]string
+}
+
+func (c *contentClient) DownloadFile(fileID string, w io.Writer) error {
+	data, ok := c.content[fileID]
+	if !ok {
+		return fmt.Errorf("file %s not found", fileID)
+	}
+	_, err := io.WriteString(w, data)
+	return err
+}
+
+func TestDownloadCandidatesOrder(t *testing.T) {
+	r := NewRunner(&model.Config{Users: []model.User{
+		{Provider: model.ProviderGoogle, Email: "main@example.com", IsMain: true},
+		{Provider: model.ProviderGoogle, Email: "backup@example.com"},
+	}}, nil, true)
+
+	file := &model.File{Replicas: []*model.Replica{
+		{Provider: model.ProviderTelegram, AccountID: "+100", NativeID: "t", Status: "active"},
+		{Provider: model.ProviderMicrosoft, AccountID: "ms@example.com", NativeID: "m", Status: "active"},
+		{Provider: model.ProviderMicrosoft, AccountID: "ms@example.com", NativeID: "short", Status: "active", NativeHash: model.NativeHashShortcut},
+		{Provider: model.ProviderGoogle, AccountID: "backup@example.com", NativeID: "gb", Status: "active"},
+		{Provider: model.ProviderGoogle, AccountID: "main@example.com", NativeID: "gm", Status: "deleted"},
+	}}
+
+	var got []string
+	for _, rep := range r.downloadCandidates(file) {
+		got = append(got, rep.NativeID)
+	}
+	if want := "gb,m,t"; strings.Join(got, ",") != want {
+		t.Fatalf("expected candidates %s, got %s", want, strings.Join(got, ","))
+	}
+}
+
+func TestDownloadVerifiedReassemblesAndChecksMD5(t *testing.T) {
+	client := &contentClient{content: map[string]string{"f1": "hello ", "f2": "world"}}
+	sum := md5.Sum([]byte("hello world"))
+	file := &model.File{Path: "/a.txt", Size: 11, GoogleDriveMD5: hex.EncodeToString(sum[:])}
+	rep := &model.Replica{Provider: model.ProviderTelegram, Fragmented: true, Fragments: []*model.ReplicaFragment{
+		{FragmentNumber: 1, FragmentsTotal: 2, NativeFragmentID: "f1"},
+		{FragmentNumber: 2, FragmentsTotal: 2, NativeFragmentID: "f2"},
+	}}
+
+	part := filepath.Join(t.TempDir(), "a.txt"+partSuffix)
+	if err := downloadVerified(client, file, rep, nil, part); err != nil {
+		t.Fatalf("downloadVerified: %v", err)
+	}
+	data, err := os.ReadFile(part)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(data) != "hello world" {
+		t.Fatalf("expected reassembled content, got %q", data)
+	}
+
+	client.content["f2"] = "WORLD"
+	if err := downloadVerified(client, file, rep, nil, part); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestContainedPathRejectsEscapes(t *testing.T) {
+	dest := t.TempDir()
+	for _, rel := range []string{"a.txt", "sub/a.txt", "sub/../a.txt", "..foo"} {
+		if _, err := containedPath(dest, rel); err != nil {
+			t.Errorf("containedPath(%q): %v", rel, err)
+		}
+	}
+	for _, rel := range []string{"..", "../x", "sub/../../x", "a/../../../etc/passwd"} {
+		if target, err := containedPath(dest, rel); err == nil {
+			t.Errorf("containedPath(%q) = %s, expected an error", rel, target)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package task
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/FranLegon/cloud-drives-sync/internal/telegram"
+)
+
+// The operations below change the pool one logical path at a time, the way sync would after
+// the same change had been made by hand on Google Drive. They back the write side of the
+// servers; the next sync reconciles anything they could not finish.
+
+// StorePoolFile uploads one local file to exactly logicalPath, as put does.
+func (r *Runner) StorePoolFile(localPath, logicalPath string) error {
+	providers := r.putProviders()
+	if len(providers) == 0 {
+		return fmt.Errorf("no backup accounts configured")
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	item := putItem{localPath: localPath, logicalPath: CleanPoolPath(logicalPath), size: info.Size()}
+	return r.putFile(item, providers, &PutResult{})
+}
+
+// MakePoolFolder creates a logical folder on every Google and Microsoft account.
+func (r *Runner) MakePoolFolder(p string) error {
+	p = CleanPoolPath(p)
+	if p == "/" {
+		return nil
+	}
+	if r.safeMode {
+		logger.DryRun("Would create folder %s", p)
+		return nil
+	}
+	r.ensureFoldersOnAllAccounts([]string{p})
+	if err := r.db.UpdateLogicalFolderStatus(); err != nil {
+		return err
+	}
+	lf, err := r.db.GetLogicalFolderByPath(p)
+	if err != nil {
+		return err
+	}
+	if lf == nil || lf.Status != "active" {
+		return fmt.Errorf("failed to create folder %s on any account", p)
+	}
+	return nil
+}
+
+// activePoolFile returns the active logical file at p, or an error wrapping os.ErrNotExist.
+func (r *Runner) activePoolFile(p string) (*model.File, error) {
+	file, err := r.db.GetFileByPath(p)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil || file.Status != "active" {
+		return nil, fmt.Errorf("%s: %w", p, os.ErrNotExist)
+	}
+	return file, nil
+}
+
+// replicaClient returns the client that may modify a replica. Google files can only be moved
+// by their owner.
+func (r *Runner) replicaClient(rep *model.Replica) (api.CloudClient, *model.User, error) {
+	accountID := rep.AccountID
+	if rep.Provider == model.ProviderGoogle && rep.Owner != "" {
+		accountID = rep.Owner
+	}
+	user := r.getUser(rep.Provider, accountID)
+	if user == nil {
+		return nil, nil, fmt.Errorf("account %s not configured", accountID)
+	}
+	client, err := r.GetOrCreateClient(user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, user, nil
+}
+
+// SoftDeletePoolFile moves a file into the aux soft-deleted folder on every provider and marks
+// it soft-deleted, as sync does when the file was moved there on Google Drive. Telegram copies
+// are marked deleted in their captions.
+func (r *Runner) SoftDeletePoolFile(p string) error {
+	p = CleanPoolPath(p)
+	file, err := r.activePoolFile(p)
+	if err != nil {
+		return err
+	}
+	if r.safeMode {
+		logger.DryRun("Would soft-delete %s", p)
+		return nil
+	}
+
+	softDeletedPath := AuxFolder + "/" + SoftDeletedFolder
+	newPath := "/" + softDeletedPath + "/" + file.Name
+	err = r.relocateReplicas(file, func(client api.CloudClient, rep *model.Replica) error {
+		if rep.Provider == model.ProviderTelegram {
+			tgClient, ok := api.Unwrap(client).(*telegram.Client)
+			if !ok {
+				return fmt.Errorf("client is not a Telegram client")
+			}
+			if err := tgClient.UpdateFileStatus(rep, "deleted"); err != nil {
+				return err
+			}
+			rep.Status = "deleted"
+			return nil
+		}
+		destID, err := r.ensureFolderStructure(client, softDeletedPath, rep.Provider)
+		if err != nil {
+			return fmt.Errorf("failed to ensure soft-deleted folder: %w", err)
+		}
+		if err := client.MoveFile(rep.NativeID, destID); err != nil {
+			return err
+		}
+		rep.Path = newPath
+		return nil
+	}, func(rep *model.Replica) { rep.Path = newPath })
+	if err != nil {
+		return err
+	}
+
+	file.Status = "soft-deleted"
+	file.Path = newPath
+	logger.Info("Soft-deleted %s", p)
+	return r.db.UpdateFile(file)
+}
+
+// MovePoolFile moves or renames a file on every provider. The destination must not hold an
+// active file.
+func (r *Runner) MovePoolFile(oldPath, newPath string) error {
+	oldPath, newPath = CleanPoolPath(oldPath), CleanPoolPath(newPath)
+	file, err := r.activePoolFile(oldPath)
+	if err != nil {
+		return err
+	}
+	if existing, err := r.db.GetFileByPath(newPath); err != nil {
+		return err
+	} else if existing != nil && existing.Status == "active" {
+		return fmt.Errorf("%s: %w", newPath, os.ErrExist)
+	}
+	if r.safeMode {
+		logger.DryRun("Would move %s to %s", oldPath, newPath)
+		return nil
+	}
+
+	newDir, newName := path.Dir(newPath), path.Base(newPath)
+	err = r.relocateReplicas(file, func(client api.CloudClient, rep *model.Replica) error {
+		if rep.Provider == model.ProviderTelegram {
+			tgClient, ok := api.Unwrap(client).(*telegram.Client)
+			if !ok {
+				return fmt.Errorf("client is not a Telegram client")
+			}
+			moved := *rep
+			moved.Path, moved.Name = newPath, newName
+			if err := tgClient.UpdateFileStatus(&moved, rep.Status); err != nil {
+				return err
+			}
+			rep.Path, rep.Name = newPath, newName
+			return nil
+		}
+		if path.Dir(model.NormalizePath(rep.Path)) != newDir {
+			destID, err := r.ensureFolderStructure(client, newDir, rep.Provider)
+			if err != nil {
+				return fmt.Errorf("failed to ensure folder structure: %w", err)
+			}
+			if err := client.MoveFile(rep.NativeID, destID); err != nil {
+				return err
+			}
+		}
+		if rep.Name != newName {
+			renamer, ok := api.Unwrap(client).(api.Renamer)
+			if !ok {
+				return fmt.Errorf("%s does not support renaming", rep.Provider)
+			}
+			if err := renamer.RenameFile(rep.NativeID, newName); err != nil {
+				return err
+			}
+		}
+		rep.Path, rep.Name = newPath, newName
+		return nil
+	}, func(rep *model.Replica) { rep.Path, rep.Name = newPath, newName })
+	if err != nil {
+		return err
+	}
+
+	file.Path, file.Name = newPath, newName
+	logger.Info("Moved %s to %s", oldPath, newPath)
+	return r.db.UpdateFile(file)
+}
+
+// relocateReplicas applies change to every active replica, Google first. A Google object seen
+// by several accounts is changed once through its owner and the other rows get follow applied.
+// A Google failure aborts before other providers are touched, since Google decides the file's
+// state on the next sync; failures elsewhere are logged and left for sync to converge.
+func (r *Runner) relocateReplicas(file *model.File, change func(api.CloudClient, *model.Replica) error, follow func(*model.Replica)) error {
+	replicas := slices.Clone(file.Replicas)
+	slices.SortStableFunc(replicas, func(a, b *model.Replica) int {
+		return cmp.Compare(r.canonicalReplicaPriority(a), r.canonicalReplicaPriority(b))
+	})
+
+	done := make(map[string]bool)
+	for _, rep := range replicas {
+		if rep.Status != "active" {
+			continue
+		}
+		key := string(rep.Provider) + "\x00" + rep.NativeID
+		if rep.Provider == model.ProviderGoogle && done[key] {
+			follow(rep)
+		} else {
+			client, user, err := r.replicaClient(rep)
+			if err == nil {
+				err = change(client, rep)
+			}
+			if err != nil {
+				if rep.Provider == model.ProviderGoogle {
+					return fmt.Errorf("failed to update Google copy of %s: %w", file.Path, err)
+				}
+				tags := []string{string(rep.Provider), rep.AccountID}
+				if user != nil {
+					tags = user.LogTags()
+				}
+				logger.WarningTagged(tags, "Failed to update copy of %s, leaving it for sync: %v", file.Path, err)
+				continue
+			}
+			done[key] = true
+		}
+		if err := r.db.UpdateReplica(rep); err != nil {
+			logger.Warning("Failed to update replica %d: %v", rep.ID, err)
+		}
+	}
+	return nil
+}
+
+// MovePoolFolder moves a folder by moving every file below it, recreating its empty subfolders
+// at the destination and removing the emptied source folders.
+func (r *Runner) MovePoolFolder(oldPath, newPath string) error {
+	oldPath, newPath = CleanPoolPath(oldPath), CleanPoolPath(newPath)
+	if oldPath == "/" || strings.HasPrefix(newPath+"/", oldPath+"/") {
+		return fmt.Errorf("cannot move %s into itself", oldPath)
+	}
+	return r.rewriteFolder(oldPath, "moved", func(f string) error {
+		return r.MovePoolFile(f, newPath+strings.TrimPrefix(f, oldPath))
+	}, func(dirs []string) []string {
+		created := []string{newPath}
+		for _, d := range dirs {
+			created = append(created, newPath+strings.TrimPrefix(d, oldPath))
+		}
+		return created
+	})
+}
+
+// SoftDeletePoolFolder soft-deletes every file below a folder and removes the emptied folders.
+func (r *Runner) SoftDeletePoolFolder(p string) error {
+	p = CleanPoolPath(p)
+	if p == "/" {
+		return fmt.Errorf("cannot delete the pool root")
+	}
+	return r.rewriteFolder(p, "soft-deleted", r.SoftDeletePoolFile, nil)
+}
+
+// rewriteFolder applies fileOp to every active file below dir, then creates the folders returned
+// by mkdirs (given the active subfolders of dir) and removes the now-empty folders of dir,
+// deepest first.
+func (r *Runner) rewriteFolder(dir, reason string, fileOp func(string) error, mkdirs func([]string) []string) error {
+	files, err := r.db.GetFileSummaries(dir)
+	if err != nil {
+		return err
+	}
+	folders, err := r.db.GetAllLogicalFolders()
+	if err != nil {
+		return err
+	}
+	var sub []*model.LogicalFolder
+	var subPaths []string
+	for _, lf := range folders {
+		if lf.Status == "active" && (lf.Path == dir || strings.HasPrefix(lf.Path, dir+"/")) {
+			sub = append(sub, lf)
+			if lf.Path != dir {
+				subPaths = append(subPaths, lf.Path)
+			}
+		}
+	}
+	if len(sub) == 0 && len(files) == 0 {
+		return fmt.Errorf("%s: %w", dir, os.ErrNotExist)
+	}
+	if r.safeMode {
+		logger.DryRun("Would apply %s to folder %s", reason, dir)
+		return nil
+	}
+
+	var failed int
+	for _, f := range files {
+		if f.Status != "active" {
+			continue
+		}
+		if err := fileOp(f.Path); err != nil {
+			logger.Error("Failed to process %s: %v", f.Path, err)
+			failed++
+		}
+	}
+	if mkdirs != nil {
+		r.ensureFoldersOnAllAccounts(mkdirs(subPaths))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d file(s) below %s could not be %s", failed, dir, reason)
+	}
+
+	slices.SortFunc(sub, func(a, b *model.LogicalFolder) int {
+		return cmp.Compare(strings.Count(b.Path, "/"), strings.Count(a.Path, "/"))
+	})
+	for _, lf := range sub {
+		replicas, err := r.db.GetFolderReplicas(lf.ID)
+		if err != nil {
+			return err
+		}
+		for _, rep := range replicas {
+			if rep.Status == "active" {
+				r.removeEmptyFolderReplica(lf, rep, reason)
+			}
+		}
+	}
+	return r.db.UpdateLogicalFolderStatus()
+}
@@ -0,0 +1,414 @@
+package task
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/google/uuid"
+)
+
+// PutResult summarizes a PutToPool run. Incomplete counts files that reached the pool but not
+// every provider; the next sync mirrors them.
+type PutResult struct {
+	Uploaded   int
+	Updated    int
+	Skipped    int
+	Incomplete int
+	Failed     int
+	Bytes      int64
+}
+
+// putItem is one local file and the logical path it is stored under.
+type putItem struct {
+	localPath   string
+	logicalPath string
+	size        int64
+}
+
+// collectPutItems lists the regular files to upload from localPath. A single file is stored at
+// logicalPath, or inside it when intoDir is set; a directory's contents are stored below
+// logicalPath. Anything that is not a regular file or directory is skipped with a warning.
+func collectPutItems(localPath, logicalPath string, intoDir bool) ([]putItem, error) {
+	logicalPath = CleanPoolPath(logicalPath)
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a regular file", localPath)
+		}
+		if intoDir {
+			logicalPath = path.Join(logicalPath, filepath.Base(localPath))
+		}
+		if logicalPath == "/" {
+			return nil, fmt.Errorf("a file cannot be stored at the pool root itself")
+		}
+		return []putItem{{localPath: localPath, logicalPath: logicalPath, size: info.Size()}}, nil
+	}
+
+	var items []putItem
+	err = filepath.WalkDir(localPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			logger.Warning("Skipping %s: not a regular file", p)
+			return nil
+		}
+		rel, err := filepath.Rel(localPath, p)
+		if err != nil {
+			return err
+		}
+		items = append(items, putItem{localPath: p, logicalPath: path.Join(logicalPath, filepath.ToSlash(rel)), size: fi.Size()})
+		return nil
+	})
+	return items, err
+}
+
+// localMD5 returns the hex MD5 of a local file, which is what Google Drive reports for it.
+func localMD5(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// putProviders returns the providers that have a backup account to upload to, in placement
+// order (Google first so it becomes the canonical replica).
+func (r *Runner) putProviders() []model.Provider {
+	var providers []model.Provider
+	for _, p := range PoolProviders {
+		for _, u := range r.config.Users {
+			if u.Provider == p && !u.IsMain {
+				providers = append(providers, p)
+				break
+			}
+		}
+	}
+	return providers
+}
+
+// PutToPool uploads a local file or directory into the pool at logicalPath. Files go straight to
+// the backup account placement picks for each provider (the one with the most free quota), so
+// nothing passes through the main account. Files whose content already matches the pool are
+// skipped; changed files are uploaded again and their previous replicas removed. When
+// logicalPath is an existing pool folder, a single file is stored inside it.
+func (r *Runner) PutToPool(localPath, logicalPath string) (*PutResult, error) {
+	providers := r.putProviders()
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no backup accounts configured")
+	}
+
+	intoDir := strings.HasSuffix(logicalPath, "/")
+	if !intoDir {
+		lf, err := r.db.GetLogicalFolderByPath(CleanPoolPath(logicalPath))
+		if err != nil {
+			return nil, err
+		}
+		intoDir = lf != nil && lf.Status == "active"
+	}
+	items, err := collectPutItems(localPath, logicalPath, intoDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", localPath, err)
+	}
+
+	res := &PutResult{}
+	for i, item := range items {
+		if err := r.checkRunLock(); err != nil {
+			return res, err
+		}
+		logger.Info("[%d/%d] %s -> %s", i+1, len(items), item.localPath, item.logicalPath)
+		if err := r.putFile(item, providers, res); err != nil {
+			logger.Error("Failed to upload %s: %v", item.localPath, err)
+			res.Failed++
+		}
+	}
+	if res.Failed > 0 {
+		return res, fmt.Errorf("%d of %d files could not be uploaded", res.Failed, len(items))
+	}
+	return res, nil
+}
+
+// putFile uploads one local file to every provider and records it in the DB.
+func (r *Runner) putFile(item putItem, providers []model.Provider, res *PutResult) error {
+	sum, err := localMD5(item.localPath)
+	if err != nil {
+		return err
+	}
+
+	existing, err := r.db.GetFileByPath(item.logicalPath)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Status != "active" {
+		existing = nil
+	}
+	if existing != nil && existing.Size == item.size && strings.EqualFold(existing.GoogleDriveMD5, sum) {
+		res.Skipped++
+		return nil
+	}
+
+	if r.erasure != nil && item.size > 0 {
+		return r.putShardedFile(item, sum, existing, *r.erasure, res)
+	}
+
+	if r.safeMode {
+		if existing != nil {
+			logger.DryRun("Would replace %s (%d bytes) on %v", item.logicalPath, item.size, providers)
+		} else {
+			logger.DryRun("Would upload %s (%d bytes) to %v", item.logicalPath, item.size, providers)
+		}
+		return nil
+	}
+
+	var replicas []*model.Replica
+	for _, provider := range providers {
+		rep, err := r.uploadLocalReplica(item, provider)
+		if err != nil {
+			logger.Warning("Upload to %s failed path=%q: %v", provider, item.logicalPath, err)
+			continue
+		}
+		if rep.Provider == model.ProviderGoogle && rep.NativeHash != "" && !strings.EqualFold(rep.NativeHash, sum) {
+			logger.Warning("Google reports md5 %s for %s, expected %s", rep.NativeHash, item.logicalPath, sum)
+		}
+		replicas = append(replicas, rep)
+	}
+	if len(replicas) == 0 {
+		return fmt.Errorf("no provider accepted the upload")
+	}
+
+	file := &model.File{
+		ID:             uuid.New().String(),
+		Path:           item.logicalPath,
+		Name:           path.Base(item.logicalPath),
+		Size:           item.size,
+		GoogleDriveMD5: sum,
+		ModTime:        replicas[0].ModTime,
+		Status:         "active",
+	}
+	if existing != nil {
+		file.ID = existing.ID
+		if err := r.db.UpdateFile(file); err != nil {
+			return err
+		}
+		r.retireReplicas(existing)
+		r.retireShards(existing.ID)
+	} else if err := r.db.InsertFile(file); err != nil {
+		return err
+	}
+	for _, rep := range replicas {
+		rep.FileID = file.ID
+		if err := r.db.InsertReplica(rep); err != nil {
+			return fmt.Errorf("failed to record %s replica: %w", rep.Provider, err)
+		}
+	}
+
+	if existing != nil {
+		res.Updated++
+	} else {
+		res.Uploaded++
+	}
+	res.Bytes += item.size
+	if len(replicas) < len(providers) {
+		logger.Warning("%s is on %d of %d providers; the next sync will mirror it", item.logicalPath, len(replicas), len(providers))
+		res.Incomplete++
+	}
+	return nil
+}
+
+// putShardedFile stores one local file as erasure-coded shards spread over the backup accounts
+// and records it in the DB. A previous version is removed once the shards are uploaded.
+func (r *Runner) putShardedFile(item putItem, sum string, existing *model.File, scheme ErasureScheme, res *PutResult) error {
+	if r.safeMode {
+		if existing != nil {
+			logger.DryRun("Would replace %s (%d bytes) with %s shards", item.logicalPath, item.size, scheme)
+		} else {
+			logger.DryRun("Would upload %s (%d bytes) as %s shards", item.logicalPath, item.size, scheme)
+		}
+		return nil
+	}
+
+	file := &model.File{
+		ID:             uuid.New().String(),
+		Path:           item.logicalPath,
+		Name:           path.Base(item.logicalPath),
+		Size:           item.size,
+		GoogleDriveMD5: sum,
+		ModTime:        time.Now(),
+		Status:         "active",
+	}
+	if existing != nil {
+		file.ID = existing.ID
+	}
+	var oldShards []*model.Shard
+	if existing != nil {
+		var err error
+		if oldShards, err = r.db.GetFileShards(existing.ID); err != nil {
+			return err
+		}
+	}
+
+	shards, err := r.storeShards(item, file.ID, scheme)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if err := r.db.UpdateFile(file); err != nil {
+			return err
+		}
+		r.retireReplicas(existing)
+	} else if err := r.db.InsertFile(file); err != nil {
+		return err
+	}
+	if err := r.db.ReplaceFileShards(file.ID, shards); err != nil {
+		return fmt.Errorf("failed to record shards: %w", err)
+	}
+	for _, s := range oldShards {
+		if s.Status == "active" {
+			r.deleteShard(s)
+		}
+	}
+
+	if existing != nil {
+		res.Updated++
+	} else {
+		res.Uploaded++
+	}
+	res.Bytes += item.size
+	return nil
+}
+
+// uploadLocalReplica uploads a local file to the placement-chosen backup account of provider,
+// encrypted when the provider stores encrypted replicas, and returns the replica to record. Quota reserved for the upload is released if it fails.
+func (r *Runner) uploadLocalReplica(item putItem, provider model.Provider) (*model.Replica, error) {
+	client, user, err := r.getDestinationClient(provider, item.size)
+	if err != nil {
+		return nil, err
+	}
+	parentID, err := r.ensureFolderStructure(client, path.Dir(item.logicalPath), provider)
+	if err != nil {
+		r.updateQuotaUsed(user, -item.size)
+		return nil, fmt.Errorf("failed to ensure folder structure: %w", err)
+	}
+
+	f, err := os.Open(item.localPath)
+	if err != nil {
+		r.updateQuotaUsed(user, -item.size)
+		return nil, err
+	}
+	defer f.Close()
+
+	body, size, seal, err := r.sealUpload(provider, f, item.size)
+	if err != nil {
+		r.updateQuotaUsed(user, -item.size)
+		return nil, err
+	}
+	logger.InfoTagged(user.LogTags(), "Uploading path=%q (%d bytes)...", item.logicalPath, item.size)
+	uploaded, err := client.UploadFile(parentID, path.Base(item.logicalPath), body, size)
+	if err != nil {
+		r.updateQuotaUsed(user, -item.size)
+		return nil, err
+	}
+
+	accountID := user.GetAccountID()
+	rep := &model.Replica{
+		Path:      item.logicalPath,
+		Name:      uploaded.Name,
+		Size:      uploaded.Size,
+		Provider:  provider,
+		AccountID: accountID,
+		NativeID:  uploaded.ID,
+		ModTime:   time.Now(),
+		Status:    "active",
+		Owner:     accountID,
+	}
+	if !uploaded.ModTime.IsZero() {
+		rep.ModTime = uploaded.ModTime
+	}
+	if len(uploaded.Replicas) > 0 {
+		up := uploaded.Replicas[0]
+		if up.NativeID != "" {
+			rep.NativeID = up.NativeID
+		}
+		if !up.ModTime.IsZero() {
+			rep.ModTime = up.ModTime
+		}
+		rep.NativeHash = up.NativeHash
+		rep.Fragmented = up.Fragmented
+		rep.Fragments = up.Fragments
+	}
+	seal.apply(rep)
+	return rep, nil
+}
+
+// retireReplicas deletes the provider objects behind the previous version of a replaced file
+// and marks their replicas deleted. Failures are logged; the sync that follows reconciles them.
+func (r *Runner) retireReplicas(old *model.File) {
+	for _, rep := range old.Replicas {
+		if rep.Status != "active" {
+			continue
+		}
+		// Google files can only be deleted by their owner.
+		accountID := rep.AccountID
+		if rep.Provider == model.ProviderGoogle && rep.Owner != "" {
+			accountID = rep.Owner
+		}
+		user := r.getUser(rep.Provider, accountID)
+		if user == nil {
+			logger.Warning("Cannot remove previous version of %s: account %s not configured", old.Path, accountID)
+			continue
+		}
+		client, err := r.GetOrCreateClient(user)
+		if err != nil {
+			logger.Warning("Cannot remove previous version of %s: %v", old.Path, err)
+			continue
+		}
+
+		ids := []string{rep.NativeID}
+		if rep.Fragmented {
+			ids = ids[:0]
+			for _, frag := range rep.Fragments {
+				ids = append(ids, frag.NativeFragmentID)
+			}
+		}
+		failed := false
+		for _, id := range ids {
+			if err := client.DeleteFile(id); err != nil {
+				logger.WarningTagged(user.LogTags(), "Failed to remove previous version of %s (native_id=%s): %v", old.Path, id, err)
+				failed = true
+			}
+		}
+		if failed {
+			continue
+		}
+		rep.Status = "deleted"
+		if err := r.db.UpdateReplica(rep); err != nil {
+			logger.Warning("Failed to mark replica %d deleted: %v", rep.ID, err)
+		}
+	}
+}
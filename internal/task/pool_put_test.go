@@ -0,0 +1,55 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectPutItems(t *testing.T) {
+	root := t.TempDir()
+	mustWrite := func(rel, data string) {
+		t.Helper()
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustWrite("photos/a.jpg", "aaa")
+	mustWrite("photos/2024/b.jpg", "bb")
+
+	items, err := collectPutItems(filepath.Join(root, "photos"), "backup/photos", false)
+	if err != nil {
+		t.Fatalf("collectPutItems(dir): %v", err)
+	}
+	got := map[string]int64{}
+	for _, it := range items {
+		got[it.logicalPath] = it.size
+	}
+	if len(items) != 2 || got["/backup/photos/a.jpg"] != 3 || got["/backup/photos/2024/b.jpg"] != 2 {
+		t.Fatalf("unexpected items %v", got)
+	}
+
+	items, err = collectPutItems(filepath.Join(root, "photos", "a.jpg"), "/docs", true)
+	if err != nil {
+		t.Fatalf("collectPutItems(file into dir): %v", err)
+	}
+	if len(items) != 1 || items[0].logicalPath != "/docs/a.jpg" {
+		t.Fatalf("expected /docs/a.jpg, got %+v", items)
+	}
+
+	items, err = collectPutItems(filepath.Join(root, "photos", "a.jpg"), "/docs/renamed.jpg", false)
+	if err != nil {
+		t.Fatalf("collectPutItems(file): %v", err)
+	}
+	if len(items) != 1 || items[0].logicalPath != "/docs/renamed.jpg" {
+		t.Fatalf("expected /docs/renamed.jpg, got %+v", items)
+	}
+
+	if _, err := collectPutItems(filepath.Join(root, "photos", "a.jpg"), "/", false); err == nil {
+		t.Fatalf("expected an error when storing a file at the pool root")
+	}
+}
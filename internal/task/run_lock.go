@@ -0,0 +1,350 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/config"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+const (
+	// RunLockFileName is the lease object kept in the main account's aux folder while a
+	// mutating command runs.
+	RunLockFileName = "cloud-drives-sync.lock.json"
+
+	// DefaultRunLockLease is how long a lock stays valid without renewal. A crashed run
+	// therefore blocks other hosts for at most this long.
+	DefaultRunLockLease = 10 * time.Minute
+
+	// runLockSettleDelay gives a concurrent writer time to land its own lock object before we
+	// re-read the folder to confirm we won.
+	runLockSettleDelay = 2 * time.Second
+
+	// runLockRetryDelay is how long a failed renewal waits before trying again.
+	runLockRetryDelay = 30 * time.Second
+)
+
+// ErrRunLockHeld is returned when another live process holds the run lock.
+var ErrRunLockHeld = errors.New("run lock is held by another process")
+
+// errRunLockGone is returned when renewing finds our lock object removed, e.g. broken with
+// --break-lock by another host after the lease expired.
+var errRunLockGone = errors.New("run lock was removed by another process")
+
+// RunLockInfo is the content of the lock object.
+type RunLockInfo struct {
+	HostID    string    `json:"host_id"`
+	Hostname  string    `json:"hostname"`
+	PID       int       `json:"pid"`
+	Command   string    `json:"command"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (i *RunLockInfo) expired(now time.Time) bool {
+	return !now.Before(i.ExpiresAt)
+}
+
+func (i *RunLockInfo) sameHolder(o *RunLockInfo) bool {
+	return i.HostID == o.HostID && i.PID == o.PID && i.StartedAt.Equal(o.StartedAt)
+}
+
+// String names the holder for error messages.
+func (i *RunLockInfo) String() string {
+	return fmt.Sprintf("%s (host ID %s, PID %d) running %q since %s, lease expires %s",
+		i.Hostname, i.HostID, i.PID, i.Command,
+		i.StartedAt.Local().Format(time.RFC3339), i.ExpiresAt.Local().Format(time.RFC3339))
+}
+
+type runLockEntry struct {
+	fileID string
+	info   *RunLockInfo
+}
+
+// RunLock is a lease-based lock shared by every host working on the same pool. It is held
+// for the duration of a mutating command and renewed in the background until Release.
+type RunLock struct {
+	client api.CloudClient
+	user   *model.User
+	auxID  string
+	fileID string
+	info   RunLockInfo
+	lease  time.Duration
+
+	mu      sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+	lost    chan struct{} // closed when the lease is lost
+	lostErr error
+}
+
+// AcquireRunLock takes the run lock on the main account. When another live process holds it,
+// ErrRunLockHeld is returned naming the holder, unless breakLock is set, in which case the
+// existing lock is removed first.
+func AcquireRunLock(cfg *model.Config, dbPath, command string, breakLock bool) (*RunLock, error) {
+	mainUser := config.GetMainAccount(cfg, model.ProviderGoogle)
+	if mainUser == nil {
+		return nil, fmt.Errorf("no main Google account configured")
+	}
+
+	client, auxID, err := openAuxFolder(cfg, mainUser, true)
+	if err != nil {
+		return nil, err
+	}
+
+	hostID, hostname := HostIdentity(dbPath)
+	now := time.Now().UTC()
+	l := &RunLock{
+		client: client,
+		user:   mainUser,
+		auxID:  auxID,
+		lease:  DefaultRunLockLease,
+		info: RunLockInfo{
+			HostID:    hostID,
+			Hostname:  hostname,
+			PID:       os.Getpid(),
+			Command:   command,
+			StartedAt: now,
+			ExpiresAt: now.Add(DefaultRunLockLease),
+		},
+	}
+
+	entries, err := l.list()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run lock: %w", err)
+	}
+	for _, e := range entries {
+		if !e.info.expired(now) && !breakLock {
+			return nil, fmt.Errorf("%w: held by %s; use --break-lock if that run is no longer alive", ErrRunLockHeld, e.info)
+		}
+	}
+	for _, e := range entries {
+		if e.info.expired(now) {
+			logger.Info("Removing expired run lock held by %s", e.info)
+		} else {
+			logger.Warning("Breaking run lock held by %s", e.info)
+		}
+		if err := l.client.DeleteFile(e.fileID); err != nil {
+			return nil, fmt.Errorf("failed to remove previous run lock: %w", err)
+		}
+	}
+
+	if err := l.write(); err != nil {
+		return nil, fmt.Errorf("failed to write run lock: %w", err)
+	}
+
+	// Another host may have raced us between listing and writing. The oldest live lock wins.
+	time.Sleep(runLockSettleDelay)
+	entries, err = l.list()
+	if err != nil {
+		l.Release()
+		return nil, fmt.Errorf("failed to confirm run lock: %w", err)
+	}
+	if holder := oldestLiveLock(entries, time.Now()); holder != nil && !holder.info.sameHolder(&l.info) {
+		_ = l.client.DeleteFile(l.fileID)
+		return nil, fmt.Errorf("%w: held by %s", ErrRunLockHeld, holder.info)
+	}
+
+	logger.Info("Acquired run lock (lease %s)", l.lease)
+	l.startRenewal()
+	return l, nil
+}
+
+// Lost returns a channel that is closed when the lock is lost: renewals kept failing until the
+// lease expired, or another process removed it. The holder must stop changing the pool once it
+// is closed. It is nil for a nil lock, so it never fires.
+func (l *RunLock) Lost() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	return l.lost
+}
+
+// Err returns why the lock was lost, or nil while it is held.
+func (l *RunLock) Err() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lostErr
+}
+
+func (l *RunLock) startRenewal() {
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	l.lost = make(chan struct{})
+	go l.renewLoop()
+}
+
+// oldestLiveLock returns the unexpired lock that was started first, or nil.
+func oldestLiveLock(entries []runLockEntry, now time.Time) *runLockEntry {
+	var live []runLockEntry
+	for _, e := range entries {
+		if !e.info.expired(now) {
+			live = append(live, e)
+		}
+	}
+	if len(live) == 0 {
+		return nil
+	}
+	sort.SliceStable(live, func(i, j int) bool {
+		if !live[i].info.StartedAt.Equal(live[j].info.StartedAt) {
+			return live[i].info.StartedAt.Before(live[j].info.StartedAt)
+		}
+		return live[i].info.HostID < live[j].info.HostID
+	})
+	return &live[0]
+}
+
+// list returns every lock object in the aux folder. Unreadable objects are treated as expired
+// so that a corrupt lock never blocks the pool forever.
+func (l *RunLock) list() ([]runLockEntry, error) {
+	var files []*model.File
+	err := api.WithRetry(func() error {
+		var err error
+		files, err = l.client.ListFiles(l.auxID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []runLockEntry
+	for _, f := range files {
+		if f.Name != RunLockFileName {
+			continue
+		}
+		var buf strings.Builder
+		info := &RunLockInfo{}
+		err := api.WithRetry(func() error {
+			buf.Reset()
+			return l.client.DownloadFile(f.ID, &buf)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(buf.String()), info); err != nil {
+			logger.Warning("Ignoring unreadable run lock %s: %v", f.ID, err)
+			info = &RunLockInfo{Hostname: "unknown", Command: "unknown"}
+		}
+		entries = append(entries, runLockEntry{fileID: f.ID, info: info})
+	}
+	return entries, nil
+}
+
+// write uploads the lock object, creating it on the first call and updating it afterwards.
+func (l *RunLock) write() error {
+	data, err := json.MarshalIndent(l.info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return api.WithRetry(func() error {
+		id, err := replaceNamedFile(l.client, l.user, l.auxID, l.fileID, RunLockFileName, bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return err
+		}
+		l.fileID = id
+		return nil
+	})
+}
+
+// renewLoop extends the lease every third of its length until Release is called. A failed
+// renewal is retried until the lease has expired; only then, or as soon as another process
+// removed our lock object, is the lock marked lost and no longer renewed.
+func (l *RunLock) renewLoop() {
+	defer close(l.done)
+	wait := l.lease / 3
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-l.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		l.mu.Lock()
+		err := l.renew()
+		expires := l.info.ExpiresAt
+		if err != nil && !errors.Is(err, errRunLockGone) {
+			if !l.info.expired(time.Now()) {
+				l.mu.Unlock()
+				logger.Warning("Failed to renew run lock, retrying until the lease expires at %s: %v", expires.Local().Format(time.RFC3339), err)
+				wait = min(runLockRetryDelay, time.Until(expires))
+				continue
+			}
+			err = fmt.Errorf("lease expired at %s: %w", expires.Local().Format(time.RFC3339), err)
+		}
+		l.lostErr = err
+		l.mu.Unlock()
+		if err != nil {
+			logger.Error("Lost run lock: %v", err)
+			close(l.lost)
+			return
+		}
+		wait = l.lease / 3
+	}
+}
+
+// renew extends the lease, after checking that our lock object is still there. A lock removed by
+// another process is not written again, since that process may be running by now. When writing
+// fails, ExpiresAt keeps the lease last written.
+func (l *RunLock) renew() error {
+	entries, err := l.list()
+	if err != nil {
+		return fmt.Errorf("failed to read run lock: %w", err)
+	}
+	held := false
+	for _, e := range entries {
+		if e.info.sameHolder(&l.info) {
+			held = true
+			break
+		}
+	}
+	if !held {
+		return errRunLockGone
+	}
+	expires := l.info.ExpiresAt
+	l.info.ExpiresAt = time.Now().UTC().Add(l.lease)
+	if err := l.write(); err != nil {
+		l.info.ExpiresAt = expires
+		return fmt.Errorf("failed to renew run lock: %w", err)
+	}
+	return nil
+}
+
+// Release stops renewal and removes the lock object. It is safe to call on a nil lock and more
+// than once.
+func (l *RunLock) Release() {
+	if l == nil {
+		return
+	}
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		l.stop = nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fileID == "" {
+		return
+	}
+	if err := api.WithRetry(func() error { return l.client.DeleteFile(l.fileID) }); err != nil {
+		logger.Error("Failed to release run lock: %v", err)
+		return
+	}
+	l.fileID = ""
+	logger.Info("Released run lock")
+}
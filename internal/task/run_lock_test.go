@@ -0,0 +1,161 @@
+package task
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// lockFolderClient keeps the files of an aux folder in memory; other methods are not used.
+type lockFolderClient struct {
+	api.CloudClient
+	files     map[string][]byte
+	nextID    int
+	updateErr error
+}
+
+func (c *lockFolderClient) ListFiles(folderID string) ([]*model.File, error) {
+	var files []*model.File
+	for id := range c.files {
+		files = append(files, &model.File{ID: id, Name: RunLockFileName})
+	}
+	return files, nil
+}
+
+func (c *lockFolderClient) DownloadFile(fileID string, w io.Writer) error {
+	_, err := w.Write(c.files[fileID])
+	return err
+}
+
+func (c *lockFolderClient) UploadFile(folderID, name string, reader io.Reader, size int64) (*model.File, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	c.nextID++
+	id := fmt.Sprint(c.nextID)
+	c.files[id] = data
+	return &model.File{ID: id, Name: name}, nil
+}
+
+func (c *lockFolderClient) DeleteFile(fileID string) error {
+	delete(c.files, fileID)
+	return nil
+}
+
+func (c *lockFolderClient) UpdateFile(fileID string, reader io.Reader, size int64) error {
+	if c.updateErr != nil {
+		return c.updateErr
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, reader); err != nil {
+		return err
+	}
+	c.files[fileID] = buf.Bytes()
+	return nil
+}
+
+func TestOldestLiveLockIgnoresExpiredLocks(t *testing.T) {
+	now := time.Now()
+	expired := &RunLockInfo{HostID: "a", StartedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)}
+	first := &RunLockInfo{HostID: "b", StartedAt: now.Add(-2 * time.Minute), ExpiresAt: now.Add(time.Minute)}
+	second := &RunLockInfo{HostID: "c", StartedAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Minute)}
+
+	holder := oldestLiveLock([]runLockEntry{{"3", second}, {"1", expired}, {"2", first}}, now)
+	if holder == nil || holder.fileID != "2" {
+		t.Fatalf("expected oldest live lock 2, got %+v", holder)
+	}
+
+	if holder := oldestLiveLock([]runLockEntry{{"1", expired}}, now); holder != nil {
+		t.Fatalf("expected no live lock, got %+v", holder)
+	}
+}
+
+func TestRunLockRenewDetectsRemovedLock(t *testing.T) {
+	client := &lockFolderClient{files: make(map[string][]byte)}
+	now := time.Now().UTC()
+	l := &RunLock{
+		client: client,
+		user:   &model.User{Provider: model.ProviderGoogle, Email: "main@example.com"},
+		auxID:  "aux",
+		lease:  time.Minute,
+		info:   RunLockInfo{HostID: "a", PID: 1, StartedAt: now, ExpiresAt: now.Add(time.Minute)},
+	}
+	if err := l.write(); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	expires := l.info.ExpiresAt
+	if err := l.renew(); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+	if !l.info.ExpiresAt.After(expires) {
+		t.Fatal("expected renewing to extend the lease")
+	}
+
+	// Another host broke the lock and took it over
+	client.DeleteFile(l.fileID)
+	other := &RunLock{client: client, user: l.user, auxID: "aux", info: RunLockInfo{HostID: "b", PID: 2, StartedAt: now}}
+	if err := other.write(); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := l.renew(); err != errRunLockGone {
+		t.Fatalf("expected errRunLockGone, got %v", err)
+	}
+	if len(client.files) != 1 {
+		t.Fatalf("expected the removed lock not to be written again, got %d lock objects", len(client.files))
+	}
+}
+
+func TestRunLockLostOnlyOnceLeaseExpires(t *testing.T) {
+	client := &lockFolderClient{files: make(map[string][]byte)}
+	now := time.Now().UTC()
+	expires := now.Add(300 * time.Millisecond)
+	l := &RunLock{
+		client: client,
+		user:   &model.User{Provider: model.ProviderGoogle, Email: "main@example.com"},
+		auxID:  "aux",
+		lease:  30 * time.Millisecond,
+		info:   RunLockInfo{HostID: "a", PID: 1, StartedAt: now, ExpiresAt: expires},
+	}
+	if err := l.write(); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	client.updateErr = fmt.Errorf("quota exceeded")
+	l.startRenewal()
+	defer l.Release()
+
+	select {
+	case <-l.Lost():
+		if time.Now().Before(expires) {
+			t.Fatal("expected failed renewals to be retried until the lease expired")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lock to be lost once the lease expired")
+	}
+	if err := l.Err(); err == nil || !strings.Contains(err.Error(), "lease expired") {
+		t.Fatalf("expected Err to report the expired lease, got %v", err)
+	}
+}
+
+func TestRunnerStopsOnceRunLockIsLost(t *testing.T) {
+	r := NewRunner(&model.Config{}, nil, false)
+	if err := r.checkRunLock(); err != nil {
+		t.Fatalf("expected no error without a run lock, got %v", err)
+	}
+	r.SetRunLock(&RunLock{})
+	if err := r.checkRunLock(); err != nil {
+		t.Fatalf("expected no error while the lock is held, got %v", err)
+	}
+	r.SetRunLock(&RunLock{lostErr: errRunLockGone})
+	if err := r.checkRunLock(); !errors.Is(err, errRunLockGone) {
+		t.Fatalf("expected the lost lock to stop the runner, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+)
+
+// copierClient copies server-side unless copyErr is set; other methods are not used.
+type copierClient struct {
+	api.CloudClient
+	copyErr error
+	copies  int
+}
+
+func (c *copierClient) CopyFrom(source api.CloudClient, replica *model.Replica, folderID, name string) (*model.File, error) {
+	c.copies++
+	if c.copyErr != nil {
+		return nil, c.copyErr
+	}
+	return &model.File{Name: name, Replicas: []*model.Replica{{Name: name, NativeID: "copy-of-" + replica.NativeID}}}, nil
+}
+
+func (c *copierClient) GetUserIdentifier() string { return "backup@example.com" }
+
+func TestServerCopy(t *testing.T) {
+	r := NewRunner(&model.Config{}, nil, false)
+	replica := &model.Replica{Path: "/a.txt", Provider: model.ProviderGoogle, AccountID: "main@example.com", NativeID: "g1"}
+
+	dest := &copierClient{}
+	file, ok := r.serverCopy(dest, nil, replica, model.ProviderGoogle, "folder", "a.txt")
+	if !ok || file.Replicas[0].NativeID != "copy-of-g1" {
+		t.Fatalf("expected a server-side copy, got %+v (%v)", file, ok)
+	}
+
+	if _, ok := r.serverCopy(dest, nil, replica, model.ProviderMicrosoft, "folder", "a.txt"); ok || dest.copies != 1 {
+		t.Fatalf("expected a copy to another provider to be streamed without asking the client, got %v after %d copies", ok, dest.copies)
+	}
+
+	dest.copyErr = api.ErrServerCopyUnsupported
+	if _, ok := r.serverCopy(dest, nil, replica, model.ProviderGoogle, "folder", "a.txt"); ok {
+		t.Fatal("expected an unsupported server-side copy to fall back to streaming")
+	}
+
+	if _, ok := r.serverCopy(&contentClient{}, nil, replica, model.ProviderGoogle, "folder", "a.txt"); ok {
+		t.Fatal("expected a client without server-side copy to stream")
+	}
+}
@@ -1,6 +1,7 @@
 package task
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -15,13 +16,21 @@ import (
 	"github.com/google/uuid"
 )
 
-func logicalFolderIDForPath(path string) string {
-	path = model.NormalizePath(path)
-	path = strings.Trim(path, "/")
-	if path == "" {
-		return ""
+// folderRecord describes a provider folder at path for recording in logical_folders/folder_replicas.
+func folderRecord(provider model.Provider, accountID, nativeID, path, owner string) *model.Folder {
+	folder := &model.Folder{
+		ID:         nativeID,
+		Name:       filepath.Base(path),
+		Path:       path,
+		Provider:   provider,
+		UserEmail:  accountID,
+		OwnerEmail: owner,
+	}
+	if provider == model.ProviderTelegram {
+		folder.UserEmail = ""
+		folder.UserPhone = accountID
 	}
-	return "lf:path:/" + path
+	return folder
 }
 
 func (r *Runner) resolveCurrentFolderPath(provider model.Provider, accountID, path string) string {
@@ -34,8 +43,8 @@ func (r *Runner) resolveCurrentFolderPath(provider model.Provider, accountID, pa
 	}
 
 	for current := path; current != "/" && current != ""; current = model.NormalizePath(filepath.Dir(current)) {
-		folder, err := r.db.GetFolderByPathAndAccount(current, provider, accountID)
-		if err == nil && folder != nil && folder.ID != "" {
+		replica, err := r.db.GetFolderReplicaByPath(current, provider, accountID)
+		if err == nil && replica != nil {
 			return current
 		}
 	}
@@ -104,42 +113,60 @@ func (r *Runner) getDestinationClient(provider model.Provider, size int64) (api.
 }
 
 // transferOwnershipWithFallback transfers ownership and handles the pending state, moving the file to the sync folder if necessary.
+// A transfer the target cannot accept yet is recorded in pending_transfers and acceptance is retried on later runs; it returns
+// errTransferStillPending meanwhile, and errTransferExpired once the transfer has waited longer than pendingTransferTTL.
 func (r *Runner) transferOwnershipWithFallback(sourceClient api.CloudClient, targetClient api.CloudClient, target *AccountStatus, file *model.File, nativeID string, sourceLogTags []string) (string, error) {
+	provider := target.User.Provider
 	finalNativeID := nativeID
-	err := sourceClient.TransferOwnership(nativeID, target.User.Email)
-	if err == api.ErrOwnershipTransferPending {
-		logger.InfoTagged(sourceLogTags, "Ownership transfer pending, accepting as %s...", target.User.Email)
-		acceptedNativeID, acceptErr := targetClient.AcceptOwnership(nativeID)
-		if acceptErr != nil {
-			logger.Error("Failed to accept ownership: %v", acceptErr)
-			return finalNativeID, fmt.Errorf("acceptance failed: %w", acceptErr)
-		}
-		if acceptedNativeID != "" {
-			finalNativeID = acceptedNativeID
-		}
-		err = nil // Clear error as acceptance succeeded
 
-		// Move file back into its logical parent path.
-		targetDir := model.NormalizePath(filepath.Dir(file.Path))
-		if targetDir == "." || targetDir == "" {
-			targetDir = "/"
+	pending := r.pendingTransfer(provider, nativeID)
+	if pending != nil && time.Since(pending.RequestedAt) > pendingTransferTTL {
+		logger.WarningTagged(sourceLogTags, "Ownership transfer of path=%q to %s pending since %s, giving up", file.Path, pending.TargetAccount, pending.RequestedAt.Format(time.RFC3339))
+		return finalNativeID, fmt.Errorf("%w: requested at %s", errTransferExpired, pending.RequestedAt.Format(time.RFC3339))
+	}
+
+	if pending != nil && strings.EqualFold(pending.TargetAccount, target.User.Email) {
+		logger.InfoTagged(sourceLogTags, "Ownership transfer pending since %s, retrying acceptance as %s...", pending.RequestedAt.Format(time.RFC3339), target.User.Email)
+	} else {
+		err := sourceClient.TransferOwnership(nativeID, target.User.Email)
+		if err != api.ErrOwnershipTransferPending {
+			if err == nil && pending != nil {
+				r.clearPendingTransfer(provider, nativeID)
+			}
+			return finalNativeID, err
 		}
-		targetFolderID, folderErr := r.resolveTransferTargetFolder(targetClient, target.User.Provider, targetDir)
-		if folderErr != nil {
-			logger.Warning("Failed to resolve target sync folder for %s at %s: %v", file.Name, targetDir, folderErr)
+		logger.InfoTagged(sourceLogTags, "Ownership transfer pending, accepting as %s...", target.User.Email)
+	}
+
+	acceptedNativeID, acceptErr := targetClient.AcceptOwnership(nativeID)
+	if acceptErr != nil {
+		logger.WarningTagged(sourceLogTags, "Failed to accept ownership of path=%q as %s, retrying next run: %v", file.Path, target.User.Email, acceptErr)
+		r.recordPendingTransfer(provider, file, nativeID, sourceClient.GetUserIdentifier(), target.User.Email)
+		return finalNativeID, fmt.Errorf("%w: acceptance failed: %v", errTransferStillPending, acceptErr)
+	}
+	if pending != nil {
+		r.clearPendingTransfer(provider, nativeID)
+	}
+	if acceptedNativeID != "" {
+		finalNativeID = acceptedNativeID
+	}
+
+	// Move file back into its logical parent path.
+	targetDir := model.NormalizePath(filepath.Dir(file.Path))
+	if targetDir == "." || targetDir == "" {
+		targetDir = "/"
+	}
+	targetFolderID, folderErr := r.resolveTransferTargetFolder(targetClient, target.User.Provider, targetDir)
+	if folderErr != nil {
+		logger.Warning("Failed to resolve target sync folder for %s at %s: %v", file.Name, targetDir, folderErr)
+	} else {
+		if mvErr := targetClient.MoveFile(finalNativeID, targetFolderID); mvErr != nil {
+			logger.Warning("Failed to move transferred file %s to sync folder %s: %v", file.Name, targetDir, mvErr)
 		} else {
-			moveNativeID := finalNativeID
-			if moveNativeID == "" {
-				moveNativeID = nativeID
-			}
-			if mvErr := targetClient.MoveFile(moveNativeID, targetFolderID); mvErr != nil {
-				logger.Warning("Failed to move transferred file %s to sync folder %s: %v", file.Name, targetDir, mvErr)
-			} else {
-				logger.InfoTagged([]string{string(target.User.Provider), target.User.Email}, "Moved %s to sync folder %s", file.Name, targetDir)
-			}
+			logger.InfoTagged([]string{string(target.User.Provider), target.User.Email}, "Moved %s to sync folder %s", file.Name, targetDir)
 		}
 	}
-	return finalNativeID, err
+	return finalNativeID, nil
 }
 
 func (r *Runner) resolveTransferTargetFolder(client api.CloudClient, provider model.Provider, path string) (string, error) {
@@ -249,27 +276,11 @@ func (r *Runner) ensureFolderStructure(client api.CloudClient, path string, prov
 			}
 		}
 
-		logicalFolderID := logicalFolderIDForPath("/" + currentPath)
-		parentLogicalFolderID := logicalFolderIDForPath("/" + parentPath)
 		owner := client.GetUserIdentifier()
 
 		if foundID != "" {
 			currentID = foundID
-			_ = r.db.InsertLogicalFolder(&model.LogicalFolder{
-				ID:                    logicalFolderID,
-				Path:                  "/" + currentPath,
-				Name:                  part,
-				ParentLogicalFolderID: parentLogicalFolderID,
-				Status:                "active",
-			})
-			_ = r.db.InsertFolderReplica(&model.FolderReplica{
-				LogicalFolderID: logicalFolderID,
-				Provider:        provider,
-				AccountID:       accountID,
-				NativeFolderID:  foundID,
-				Owner:           owner,
-				LastSeenAt:      time.Now().Unix(),
-			})
+			_ = r.db.UpsertFolder(folderRecord(provider, accountID, foundID, "/"+currentPath, owner), time.Now().Unix())
 		} else {
 			// Create folder
 			if r.safeMode {
@@ -283,21 +294,7 @@ func (r *Runner) ensureFolderStructure(client api.CloudClient, path string, prov
 			}
 			currentID = folder.ID
 
-			_ = r.db.InsertLogicalFolder(&model.LogicalFolder{
-				ID:                    logicalFolderID,
-				Path:                  "/" + currentPath,
-				Name:                  part,
-				ParentLogicalFolderID: parentLogicalFolderID,
-				Status:                "active",
-			})
-			_ = r.db.InsertFolderReplica(&model.FolderReplica{
-				LogicalFolderID: logicalFolderID,
-				Provider:        provider,
-				AccountID:       accountID,
-				NativeFolderID:  currentID,
-				Owner:           owner,
-				LastSeenAt:      time.Now().Unix(),
-			})
+			_ = r.db.UpsertFolder(folderRecord(provider, accountID, currentID, "/"+currentPath, owner), time.Now().Unix())
 			r.folderCache.Store(partCacheKey, currentID)
 		}
 	}
@@ -306,17 +303,21 @@ func (r *Runner) ensureFolderStructure(client api.CloudClient, path string, prov
 	return currentID, nil
 }
 
-func handleDownloadError(err error, errChan chan error, contextStr string) {
-	if err != io.ErrClosedPipe && !strings.Contains(err.Error(), "closed pipe") {
-		if strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "notFound") {
-			logger.Info("Download source skipped (404 Not Found) %s: %v", contextStr, err)
-		} else {
-			logger.Warning("Download error in pipe %s: %v", contextStr, err)
+// downloadReplicaContent writes the content of replica to w, reassembling Telegram fragments in
+// order.
+func downloadReplicaContent(client api.CloudClient, replica *model.Replica, w io.Writer) error {
+	if !replica.Fragmented {
+		return client.DownloadFile(replica.NativeID, w)
+	}
+	if len(replica.Fragments) == 0 {
+		return fmt.Errorf("replica is fragmented but has no fragments")
+	}
+	for _, frag := range replica.Fragments {
+		if err := client.DownloadFile(frag.NativeFragmentID, w); err != nil {
+			return fmt.Errorf("(fragment %d) %w", frag.FragmentNumber, err)
 		}
-		errChan <- err
-	} else {
-		errChan <- nil // Signal completion to prevent deadlock
 	}
+	return nil
 }
 
 func (r *Runner) ensureGoogleDriveMD5(sourceFile *model.File, sourceReplica *model.Replica) (string, error) {
@@ -354,7 +355,7 @@ func (r *Runner) ensureGoogleDriveMD5(sourceFile *model.File, sourceReplica *mod
 	errChan := make(chan error, 1)
 	go func() {
 		defer close(errChan)
-		if err := sourceClient.DownloadFile(sourceReplica.NativeID, pw); err != nil {
+		if err := downloadPlaintext(sourceClient, sourceReplica, r.contentKey, pw); err != nil {
 			_ = pw.CloseWithError(err)
 			errChan <- err
 			return
@@ -390,326 +391,233 @@ func (r *Runner) ensureGoogleDriveMD5(sourceFile *model.File, sourceReplica *mod
 	return uploadedFile.GoogleDriveMD5, nil
 }
 
-// copyFile copies a file from one provider to another.
-// syncRunID is used to checkpoint the copy for crash recovery; pass 0 to disable.
-func (r *Runner) copyFile(masterFile *model.File, targetProvider model.Provider, targetName string, syncRunID int64) error {
-	// 1. Get source replica to determine which client to use
-	if len(masterFile.Replicas) == 0 {
-		return fmt.Errorf("file has no replicas")
-	}
-
-	// Filter viable replicas (ignore shortcuts and deleted replicas)
-	var viableReplicas []*model.Replica
-	for _, rep := range masterFile.Replicas {
-		if rep.NativeHash != model.NativeHashShortcut && rep.Status == "active" {
-			viableReplicas = append(viableReplicas, rep)
-		}
+// serverCopy copies sourceReplica into folderID of destClient's account server-side when the
+// provider supports it between the two accounts. It returns false when the content has to be
+// streamed instead.
+func (r *Runner) serverCopy(destClient, sourceClient api.CloudClient, sourceReplica *model.Replica, targetProvider model.Provider, folderID, name string) (*model.File, bool) {
+	if sourceReplica.Provider != targetProvider {
+		return nil, false
 	}
-
-	if len(viableReplicas) == 0 {
-		return fmt.Errorf("file has no viable replicas (only shortcuts found)")
+	copier, ok := api.Unwrap(destClient).(api.ServerCopier)
+	if !ok {
+		return nil, false
 	}
-
-	// 2. Get destination client
-	destClient, destUser, err := r.getDestinationClient(targetProvider, masterFile.Size)
+	file, err := copier.CopyFrom(sourceClient, sourceReplica, folderID, name)
 	if err != nil {
-		return fmt.Errorf("failed to get destination client: %w", err)
+		if errors.Is(err, api.ErrServerCopyUnsupported) {
+			logger.Debug("Server-side copy unavailable path=%q provider=%s account=%s, streaming", sourceReplica.Path, targetProvider, sourceReplica.AccountID)
+		} else {
+			logger.Warning("Server-side copy failed path=%q provider=%s account=%s, streaming instead: %v", sourceReplica.Path, targetProvider, sourceReplica.AccountID, err)
+		}
+		return nil, false
 	}
-
-	finalName := masterFile.Name
-	if targetName != "" {
-		finalName = targetName
+	if file == nil || len(file.Replicas) == 0 {
+		logger.Warning("Server-side copy returned no replica path=%q provider=%s, streaming instead", sourceReplica.Path, targetProvider)
+		return nil, false
 	}
+	logger.InfoTagged([]string{string(targetProvider), destClient.GetUserIdentifier()}, "Copied path=%q server-side from account=%s", sourceReplica.Path, sourceReplica.AccountID)
+	return file, true
+}
 
-	// 3. Ensure folder structure
-	dir := model.NormalizePath(filepath.Dir(masterFile.Path))
-
-	parentID, err := r.ensureFolderStructure(destClient, dir, targetProvider)
-	if err != nil {
-		return fmt.Errorf("failed to ensure folder structure: %w", err)
+// recordCopy adds a finished file copy to the sync run's copy stats.
+func (r *Runner) recordCopy(syncRunID int64, serverSide bool, size int64, elapsed time.Duration) {
+	if syncRunID <= 0 || r.db == nil {
+		return
 	}
+	if err := r.db.AddSyncRunCopy(syncRunID, serverSide, size, elapsed); err != nil {
+		logger.Warning("Failed to record copy stats for sync run #%d: %v", syncRunID, err)
+	}
+}
 
-	// 4. Transfer file (Try all viable replicas)
-	var lastErr error
-	for i, sourceReplica := range viableReplicas {
-		logger.InfoTagged(destUser.LogTags(), "Copying path=%q (as %s) from_provider=%s native_id=%s (Replica %d/%d)...", masterFile.Path, finalName, sourceReplica.Provider, sourceReplica.NativeID, i+1, len(viableReplicas))
-
-		// Get source client
-		sourceUser := r.getUser(sourceReplica.Provider, sourceReplica.AccountID)
-		if sourceUser == nil {
-			lastErr = fmt.Errorf("user not found for replica %s", sourceReplica.AccountID)
-			logger.Warning("Copy failed (user not found) path=%q provider=%s account=%s: %v", masterFile.Path, sourceReplica.Provider, sourceReplica.AccountID, lastErr)
-			continue
-		}
-
-		sourceClient, err := r.GetOrCreateClient(sourceUser)
-		if err != nil {
-			lastErr = fmt.Errorf("failed to get source client for replica %s: %w", sourceReplica.AccountID, err)
-			logger.Warning("Copy failed (client init) path=%q provider=%s account=%s: %v", masterFile.Path, sourceReplica.Provider, sourceReplica.AccountID, lastErr)
-			continue
+// recordCopiedReplica records the replica uploadedFile created in destUser's account for a copy
+// of masterFile, reusing a deleted replica row of that account where there is one. A conflict copy
+// (finalName differs from the file's name) gets its own logical file.
+func (r *Runner) recordCopiedReplica(masterFile *model.File, targetProvider model.Provider, destUser *model.User, finalName string, uploadedFile *model.File, syncRunID int64) {
+	accountID := destUser.GetAccountID()
+
+	// Determine NativeID from uploaded result
+	nativeID := uploadedFile.ID
+	if len(uploadedFile.Replicas) > 0 && uploadedFile.Replicas[0].NativeID != "" {
+		nativeID = uploadedFile.Replicas[0].NativeID
+	}
+
+	// Determine ModTime: prefer the server-recorded time from the upload result
+	// over time.Now() to avoid a 1-second drift causing spurious replica updates.
+	modTime := time.Now()
+	if len(uploadedFile.Replicas) > 0 && !uploadedFile.Replicas[0].ModTime.IsZero() {
+		modTime = uploadedFile.Replicas[0].ModTime
+	} else if !uploadedFile.ModTime.IsZero() {
+		modTime = uploadedFile.ModTime
+	}
+
+	// Use the actual native hash reported by the provider (empty if provider doesn't supply one).
+	nativeHash := ""
+	if len(uploadedFile.Replicas) > 0 {
+		nativeHash = uploadedFile.Replicas[0].NativeHash
+	}
+
+	googleDriveMD5 := masterFile.GoogleDriveMD5
+	if googleDriveMD5 == "" && uploadedFile.GoogleDriveMD5 != "" {
+		googleDriveMD5 = uploadedFile.GoogleDriveMD5
+	}
+
+	// For conflict copies (targetName != masterFile.Name), create a new logical file so
+	// the conflict version is tracked independently and can be synced to all providers.
+	fileID := masterFile.ID
+	conflictPath := masterFile.Path
+	if finalName != masterFile.Name {
+		// This is a conflict-renamed copy. Give it its own logical file record so
+		// subsequent syncs treat it as a separate file that needs to be distributed.
+		dir := filepath.Dir(masterFile.Path)
+		if dir == "." {
+			dir = ""
+		}
+		conflictPath = model.NormalizePath(dir + "/" + finalName)
+		conflictFile := &model.File{
+			ID:             uuid.New().String(),
+			Path:           conflictPath,
+			Name:           finalName,
+			Size:           masterFile.Size,
+			GoogleDriveMD5: googleDriveMD5,
+			ModTime:        modTime,
+			Status:         "active",
+		}
+		if dbErr := r.db.InsertFile(conflictFile); dbErr != nil {
+			logger.Warning("Failed to create logical file for conflict copy %s: %v", finalName, dbErr)
+		} else {
+			fileID = conflictFile.ID
 		}
+	}
 
-		pr, pw := io.Pipe()
-		defer pr.Close() // Ensure reader is closed to prevent goroutine leaks if upload fails early
-		errChan := make(chan error, 1)
-
-		go func() {
-			var dlErr error
-			defer func() {
-				if r := recover(); r != nil {
-					logger.Error("Panic in download goroutine path=%q provider=%s native_id=%s: %v", masterFile.Path, sourceReplica.Provider, sourceReplica.NativeID, r)
-					pw.CloseWithError(fmt.Errorf("panic: %v", r))
-				} else if dlErr != nil {
-					pw.CloseWithError(dlErr)
-				} else {
-					pw.Close()
-				}
-			}()
-
-			if sourceReplica.Fragmented {
-				// Fragment logic...
-				if len(sourceReplica.Fragments) == 0 {
-					dlErr = fmt.Errorf("replica is fragmented but has no fragments")
-					errChan <- dlErr
-					return
-				}
-				for _, frag := range sourceReplica.Fragments {
-					if err := sourceClient.DownloadFile(frag.NativeFragmentID, pw); err != nil {
-						dlErr = err
-						handleDownloadError(err, errChan, fmt.Sprintf("(fragment %d)", frag.FragmentNumber))
-						return
-					}
-				}
-			} else {
-				if err := sourceClient.DownloadFile(sourceReplica.NativeID, pw); err != nil {
-					dlErr = err
-					handleDownloadError(err, errChan, "")
-					return // Return early on error
+	newReplica := &model.Replica{
+		FileID:     fileID,
+		Path:       conflictPath,
+		Name:       uploadedFile.Name,
+		Size:       uploadedFile.Size,
+		Status:     "active",
+		Provider:   targetProvider,
+		AccountID:  accountID,
+		NativeID:   nativeID,
+		NativeHash: nativeHash,
+		ModTime:    modTime,
+		Fragmented: false,
+		Owner:      accountID,
+	}
+
+	if len(uploadedFile.Replicas) > 0 {
+		newReplica.Fragmented = uploadedFile.Replicas[0].Fragmented
+		newReplica.Fragments = uploadedFile.Replicas[0].Fragments
+		newReplica.Encrypted = uploadedFile.Replicas[0].Encrypted
+		newReplica.CiphertextSHA256 = uploadedFile.Replicas[0].CiphertextSHA256
+	}
+
+	reusedReplica := false
+	if finalName == masterFile.Name {
+		replicas, repErr := r.db.GetReplicas(fileID)
+		if repErr != nil {
+			logger.Warning("Failed to load replicas for reuse path=%q provider=%s: %v", masterFile.Path, targetProvider, repErr)
+		} else {
+			for _, existingReplica := range replicas {
+				if existingReplica.Provider != targetProvider || existingReplica.AccountID != accountID || existingReplica.Status != "deleted" {
+					continue
 				}
-			}
-			errChan <- nil // Signal success
-			close(errChan)
-		}()
-
-		uploadedFile, uploadErr := destClient.UploadFile(parentID, finalName, pr, masterFile.Size)
-		// Close the reader to ensure the writer stops if it's still writing
-		_ = pr.Close()
-
-		// Check download error
-		var downloadErr error
-		select {
-		case downloadErr = <-errChan:
-		default:
-			// If channel is empty, it means goroutine hasn't finished or panic
-			// But since pr.Close() is called, download should error out or finish
-			// Actually best to wait for it.
-			downloadErr = <-errChan
-		}
-
-		if uploadErr != nil {
-			lastErr = fmt.Errorf("upload failed: %w", uploadErr)
-			logger.Warning("Copy upload failed path=%q provider=%s native_id=%s: %v", masterFile.Path, targetProvider, sourceReplica.NativeID, lastErr)
-			continue
-		}
-
-		if downloadErr != nil {
-			lastErr = fmt.Errorf("download failed: %w", downloadErr)
-			logger.Warning("Copy download failed path=%q provider=%s native_id=%s: %v", masterFile.Path, sourceReplica.Provider, sourceReplica.NativeID, lastErr)
-			// Ensure we rollback the upload if possible?
-			// destClient.DeleteFile(uploadedFile.ID) // Optional but good practice
-			continue
-		}
-
-		// Success! Update Database with new replica
-		accountID := destUser.GetAccountID()
-
-		// Determine NativeID from uploaded result
-		nativeID := uploadedFile.ID
-		if len(uploadedFile.Replicas) > 0 && uploadedFile.Replicas[0].NativeID != "" {
-			nativeID = uploadedFile.Replicas[0].NativeID
-		}
-
-		// Determine ModTime: prefer the server-recorded time from the upload result
-		// over time.Now() to avoid a 1-second drift causing spurious replica updates.
-		modTime := time.Now()
-		if len(uploadedFile.Replicas) > 0 && !uploadedFile.Replicas[0].ModTime.IsZero() {
-			modTime = uploadedFile.Replicas[0].ModTime
-		} else if !uploadedFile.ModTime.IsZero() {
-			modTime = uploadedFile.ModTime
-		}
-
-		// Use the actual native hash reported by the provider (empty if provider doesn't supply one).
-		nativeHash := ""
-		if len(uploadedFile.Replicas) > 0 {
-			nativeHash = uploadedFile.Replicas[0].NativeHash
-		}
-
-		googleDriveMD5 := masterFile.GoogleDriveMD5
-		if googleDriveMD5 == "" && uploadedFile.GoogleDriveMD5 != "" {
-			googleDriveMD5 = uploadedFile.GoogleDriveMD5
-		}
-
-		// For conflict copies (targetName != masterFile.Name), create a new logical file so
-		// the conflict version is tracked independently and can be synced to all providers.
-		fileID := masterFile.ID
-		conflictPath := masterFile.Path
-		if finalName != masterFile.Name {
-			// This is a conflict-renamed copy. Give it its own logical file record so
-			// subsequent syncs treat it as a separate file that needs to be distributed.
-			dir := filepath.Dir(masterFile.Path)
-			if dir == "." {
-				dir = ""
-			}
-			conflictPath = model.NormalizePath(dir + "/" + finalName)
-			conflictFile := &model.File{
-				ID:             uuid.New().String(),
-				Path:           conflictPath,
-				Name:           finalName,
-				Size:           uploadedFile.Size,
-				GoogleDriveMD5: googleDriveMD5,
-				ModTime:        modTime,
-				Status:         "active",
-			}
-			if dbErr := r.db.InsertFile(conflictFile); dbErr != nil {
-				logger.Warning("Failed to create logical file for conflict copy %s: %v", finalName, dbErr)
-			} else {
-				fileID = conflictFile.ID
-			}
-		}
-
-		newReplica := &model.Replica{
-			FileID:     fileID,
-			Path:       conflictPath,
-			Name:       uploadedFile.Name,
-			Size:       uploadedFile.Size,
-			Status:     "active",
-			Provider:   targetProvider,
-			AccountID:  accountID,
-			NativeID:   nativeID,
-			NativeHash: nativeHash,
-			ModTime:    modTime,
-			Fragmented: false,
-			Owner:      accountID,
-		}
-
-		if len(uploadedFile.Replicas) > 0 {
-			newReplica.Fragmented = uploadedFile.Replicas[0].Fragmented
-			newReplica.Fragments = uploadedFile.Replicas[0].Fragments
-		}
 
-		reusedReplica := false
-		if finalName == masterFile.Name {
-			replicas, repErr := r.db.GetReplicas(fileID)
-			if repErr != nil {
-				logger.Warning("Failed to load replicas for reuse path=%q provider=%s: %v", masterFile.Path, targetProvider, repErr)
-			} else {
-				for _, existingReplica := range replicas {
-					if existingReplica.Provider != targetProvider || existingReplica.AccountID != accountID || existingReplica.Status != "deleted" {
-						continue
-					}
-
-					// Recreated provider objects can receive a new native ID after delete+reupload,
-					// ownership transfer, or other replacement flows. Reusing the old DB row is fine,
-					// but only if the row already using the new native_id belongs to this same
-					// destination account. Other accounts may legitimately reference the same
-					// provider-native object ID.
-					if currentReplica, lookupErr := r.db.GetReplicaByNativeID(targetProvider, nativeID); lookupErr == nil && currentReplica != nil && currentReplica.AccountID == accountID {
-						if currentReplica.ID == existingReplica.ID {
-							currentReplica.Path = conflictPath
-							currentReplica.Name = uploadedFile.Name
-							currentReplica.Size = uploadedFile.Size
-							currentReplica.Status = "active"
-							currentReplica.NativeHash = nativeHash
-							currentReplica.ModTime = modTime
-							currentReplica.Fragmented = newReplica.Fragmented
-							currentReplica.Fragments = newReplica.Fragments
-							currentReplica.Owner = accountID
-							if err := r.db.UpdateReplica(currentReplica); err != nil {
-								logger.Warning("Failed to refresh reused replica path=%q provider=%s account=%s native_id=%s: %v", masterFile.Path, targetProvider, accountID, nativeID, err)
-							} else {
-								for i, rep := range masterFile.Replicas {
-									if rep.ID == currentReplica.ID {
-										masterFile.Replicas[i] = currentReplica
-										break
-									}
+				// Recreated provider objects can receive a new native ID after delete+reupload,
+				// ownership transfer, or other replacement flows. Reusing the old DB row is fine,
+				// but only if the row already using the new native_id belongs to this same
+				// destination account. Other accounts may legitimately reference the same
+				// provider-native object ID.
+				if currentReplica, lookupErr := r.db.GetReplicaByNativeID(targetProvider, nativeID); lookupErr == nil && currentReplica != nil && currentReplica.AccountID == accountID {
+					if currentReplica.ID == existingReplica.ID {
+						currentReplica.Path = conflictPath
+						currentReplica.Name = uploadedFile.Name
+						currentReplica.Size = uploadedFile.Size
+						currentReplica.Status = "active"
+						currentReplica.NativeHash = nativeHash
+						currentReplica.ModTime = modTime
+						currentReplica.Fragmented = newReplica.Fragmented
+						currentReplica.Fragments = newReplica.Fragments
+						currentReplica.Encrypted = newReplica.Encrypted
+						currentReplica.CiphertextSHA256 = newReplica.CiphertextSHA256
+						currentReplica.Owner = accountID
+						if err := r.db.UpdateReplica(currentReplica); err != nil {
+							logger.Warning("Failed to refresh reused replica path=%q provider=%s account=%s native_id=%s: %v", masterFile.Path, targetProvider, accountID, nativeID, err)
+						} else {
+							for i, rep := range masterFile.Replicas {
+								if rep.ID == currentReplica.ID {
+									masterFile.Replicas[i] = currentReplica
+									break
 								}
-								reusedReplica = true
-								break
 							}
+							reusedReplica = true
+							break
 						}
-
-						existingReplica.Status = "deleted"
-						existingReplica.ModTime = modTime
-						if err := r.db.UpdateReplica(existingReplica); err != nil {
-							logger.Warning("Failed to retire stale deleted replica path=%q provider=%s account=%s old_native_id=%s: %v", masterFile.Path, targetProvider, accountID, existingReplica.NativeID, err)
-						}
-						continue
 					}
 
-					existingReplica.Path = conflictPath
-					existingReplica.Name = uploadedFile.Name
-					existingReplica.Size = uploadedFile.Size
-					existingReplica.Status = "active"
-					existingReplica.NativeID = nativeID
-					existingReplica.NativeHash = nativeHash
+					existingReplica.Status = "deleted"
 					existingReplica.ModTime = modTime
-					existingReplica.Fragmented = newReplica.Fragmented
-					existingReplica.Fragments = newReplica.Fragments
-					existingReplica.Owner = accountID
 					if err := r.db.UpdateReplica(existingReplica); err != nil {
-						logger.Warning("Failed to reuse deleted replica path=%q provider=%s native_id=%s: %v", masterFile.Path, targetProvider, nativeID, err)
-					} else {
-						for i, rep := range masterFile.Replicas {
-							if rep.ID == existingReplica.ID {
-								masterFile.Replicas[i] = existingReplica
-								break
-							}
+						logger.Warning("Failed to retire stale deleted replica path=%q provider=%s account=%s old_native_id=%s: %v", masterFile.Path, targetProvider, accountID, existingReplica.NativeID, err)
+					}
+					continue
+				}
+
+				existingReplica.Path = conflictPath
+				existingReplica.Name = uploadedFile.Name
+				existingReplica.Size = uploadedFile.Size
+				existingReplica.Status = "active"
+				existingReplica.NativeID = nativeID
+				existingReplica.NativeHash = nativeHash
+				existingReplica.ModTime = modTime
+				existingReplica.Fragmented = newReplica.Fragmented
+				existingReplica.Fragments = newReplica.Fragments
+				existingReplica.Encrypted = newReplica.Encrypted
+				existingReplica.CiphertextSHA256 = newReplica.CiphertextSHA256
+				existingReplica.Owner = accountID
+				if err := r.db.UpdateReplica(existingReplica); err != nil {
+					logger.Warning("Failed to reuse deleted replica path=%q provider=%s native_id=%s: %v", masterFile.Path, targetProvider, nativeID, err)
+				} else {
+					for i, rep := range masterFile.Replicas {
+						if rep.ID == existingReplica.ID {
+							masterFile.Replicas[i] = existingReplica
+							break
 						}
-						reusedReplica = true
-						break
 					}
+					reusedReplica = true
+					break
 				}
 			}
 		}
+	}
 
-		if !reusedReplica {
-			if err := r.db.InsertReplica(newReplica); err != nil {
-				logger.Error("Failed to insert new replica to DB path=%q provider=%s native_id=%s: %v", masterFile.Path, targetProvider, nativeID, err)
-			} else {
-				// Update in-memory masterFile to include new replica
-				masterFile.Replicas = append(masterFile.Replicas, newReplica)
-			}
+	if !reusedReplica {
+		if err := r.db.InsertReplica(newReplica); err != nil {
+			logger.Error("Failed to insert new replica to DB path=%q provider=%s native_id=%s: %v", masterFile.Path, targetProvider, nativeID, err)
+		} else {
+			// Update in-memory masterFile to include new replica
+			masterFile.Replicas = append(masterFile.Replicas, newReplica)
 		}
+	}
 
-		if reusedReplica || newReplica.ID != 0 {
-			// Checkpoint successful copy for crash recovery
-			if syncRunID > 0 {
-				if err := r.db.LogSyncCopy(syncRunID, masterFile.ID, string(targetProvider)); err != nil {
-					logger.Warning("Failed to log sync copy checkpoint path=%q provider=%s native_id=%s: %v", masterFile.Path, targetProvider, nativeID, err)
-				}
+	if reusedReplica || newReplica.ID != 0 {
+		// Checkpoint successful copy for crash recovery
+		if syncRunID > 0 {
+			if err := r.db.LogSyncCopy(syncRunID, masterFile.ID, string(targetProvider)); err != nil {
+				logger.Warning("Failed to log sync copy checkpoint path=%q provider=%s native_id=%s: %v", masterFile.Path, targetProvider, nativeID, err)
 			}
 		}
-
-		return nil
 	}
-
-	return fmt.Errorf("failed to copy file %s after %d attempts. Last error: %v", masterFile.Name, len(viableReplicas), lastErr)
 }
 
-// createShortcut shares the source file and creates a shortcut in the target account
-func (r *Runner) createShortcut(sourceFile *model.File, targetUser *model.User, syncRunID int64) (*shortcutRefreshTarget, error) {
+// createShortcut shares the source file and creates a shortcut in the target account. When
+// placeholder is set, the shortcut replaces that placeholder instead of falling back to a new one.
+func (r *Runner) createShortcut(sourceFile *model.File, targetUser *model.User, syncRunID int64, placeholder *model.Replica) (*shortcutRefreshTarget, error) {
 	// 1. Find a compatible source replica
 	if len(sourceFile.Replicas) == 0 {
 		return nil, fmt.Errorf("file has no replicas")
 	}
 
-	var sourceReplica *model.Replica
-	for _, replica := range sourceFile.Replicas {
-		if replica.Provider == targetUser.Provider && replica.Status == "active" {
-			sourceReplica = replica
-			break
-		}
-	}
+	sourceReplica := shortcutSourceReplica(sourceFile, targetUser.Provider, targetUser.GetAccountID())
 
 	if sourceReplica == nil {
 		// Fallback: Use first replica (might work for some providers or if cross-linking supported later)
@@ -735,29 +643,21 @@ func (r *Runner) createShortcut(sourceFile *model.File, targetUser *model.User,
 		return nil, fmt.Errorf("failed to get source client: %w", err)
 	}
 
-	// 2. Share Source File with Target User (with cache check for Microsoft)
+	// 2. Share Source File with Target User (skipped for Microsoft while sharing is recorded as failing)
 	shareSkipped := false
-	if targetUser.Provider == model.ProviderMicrosoft {
-		cacheKey := fmt.Sprintf("%s:%s", sourceReplica.AccountID, targetUser.Email)
-		r.msShareFailureCacheMu.RLock()
-		if r.msShareFailureCache[cacheKey] {
-			logger.InfoTagged(sourceReplica.LogTags(), "Skipping share path=%q with target=%s (cached failure)", sourceFile.Path, targetUser.Email)
-			shareSkipped = true
-		}
-		r.msShareFailureCacheMu.RUnlock()
+	if targetUser.Provider == model.ProviderMicrosoft && r.msShareStatus(sourceReplica.AccountID, targetUser.Email) == model.ShareStatusFailed {
+		logger.InfoTagged(sourceReplica.LogTags(), "Skipping share path=%q with target=%s (sharing failed before; sync --share-with-main repairs it)", sourceFile.Path, targetUser.Email)
+		shareSkipped = true
 	}
 
 	if !shareSkipped {
 		logger.InfoTagged(sourceReplica.LogTags(), "Sharing path=%q with target=%s native_id=%s...", sourceFile.Path, targetUser.Email, sourceReplica.NativeID)
 		if err := sourceClient.ShareFolder(sourceReplica.NativeID, targetUser.Email, "reader"); err != nil {
 			logger.Warning("Share failed (attempting shortcut anyway) path=%q target=%s native_id=%s: %v", sourceFile.Path, targetUser.Email, sourceReplica.NativeID, err)
-			// Cache the failure for Microsoft accounts to avoid retrying
+			// Record the failure for Microsoft accounts to avoid retrying until sharing is repaired
 			if targetUser.Provider == model.ProviderMicrosoft && strings.Contains(err.Error(), "There was a problem sharing") {
-				cacheKey := fmt.Sprintf("%s:%s", sourceReplica.AccountID, targetUser.Email)
-				r.msShareFailureCacheMu.Lock()
-				r.msShareFailureCache[cacheKey] = true
-				r.msShareFailureCacheMu.Unlock()
-				logger.InfoTagged(sourceReplica.LogTags(), "Cached sharing failure path=%q account=%s target=%s", sourceFile.Path, sourceReplica.AccountID, targetUser.Email)
+				r.recordMSShare(sourceReplica.AccountID, targetUser.Email, model.ShareStatusFailed, err)
+				logger.InfoTagged(sourceReplica.LogTags(), "Recorded sharing failure path=%q account=%s target=%s", sourceFile.Path, sourceReplica.AccountID, targetUser.Email)
 			}
 		}
 	}
@@ -814,7 +714,7 @@ func (r *Runner) createShortcut(sourceFile *model.File, targetUser *model.User,
 		// Attempt to resolve cross-tenant/shared item reference issues for Microsoft
 		resolved := false
 		if targetUser.Provider == model.ProviderMicrosoft && (strings.Contains(err.Error(), "Invalid request") || strings.Contains(err.Error(), "invalidRequest")) {
-			if msClient, ok := targetClient.(*microsoft.Client); ok {
+			if msClient, ok := api.Unwrap(targetClient).(*microsoft.Client); ok {
 				logger.Info("Shortcut failed. Searching for item in 'Shared with me' to retry (waiting for propagation)...")
 
 				var foundID, foundDriveID string
@@ -841,6 +741,9 @@ func (r *Runner) createShortcut(sourceFile *model.File, targetUser *model.User,
 		}
 
 		if !resolved {
+			if placeholder != nil {
+				return nil, fmt.Errorf("failed to create shortcut to replace placeholder: %w", err)
+			}
 			if targetUser.Provider == model.ProviderMicrosoft {
 				if strings.Contains(err.Error(), "Invalid request") || strings.Contains(err.Error(), "invalidRequest") {
 					logger.Warning("Shortcut creation failed path=%q native_id=%s (likely unsupported cross-account operation): %v. Falling back to placeholder creation.", sourceFile.Path, sourceReplica.NativeID, err)
@@ -851,7 +754,7 @@ func (r *Runner) createShortcut(sourceFile *model.File, targetUser *model.User,
 				if md5Err != nil {
 					return nil, fmt.Errorf("failed to resolve GoogleDriveMD5 for fake shortcut: %w", md5Err)
 				}
-				if msClient, ok := targetClient.(*microsoft.Client); ok {
+				if msClient, ok := api.Unwrap(targetClient).(*microsoft.Client); ok {
 					shortcut, err = msClient.CreateFakeShortcut(parentID, sourceFile.Name, sourceFile.Size, googleDriveMD5)
 					if err != nil {
 						return nil, fmt.Errorf("failed to create fake shortcut: %w", err)
@@ -889,8 +792,14 @@ func (r *Runner) createShortcut(sourceFile *model.File, targetUser *model.User,
 		newReplica.NativeHash = shortcut.Replicas[0].NativeHash
 	}
 
-	if err := r.db.UpsertReplicaByNativeID(newReplica, time.Now().Unix()); err != nil {
-		logger.Error("DB upsert shortcut replica failed path=%q provider=%s account=%s native_id=%s: %v", sourceFile.Path, targetUser.Provider, accountID, newReplica.NativeID, err)
+	var upsertErr error
+	if placeholder != nil {
+		upsertErr = r.replacePlaceholder(targetClient, placeholder, newReplica)
+	} else {
+		upsertErr = r.db.UpsertReplicaByNativeID(newReplica, time.Now().Unix())
+	}
+	if upsertErr != nil {
+		logger.Error("DB upsert shortcut replica failed path=%q provider=%s account=%s native_id=%s: %v", sourceFile.Path, targetUser.Provider, accountID, newReplica.NativeID, upsertErr)
 	} else {
 		if syncRunID > 0 {
 			targetProviderKey := fmt.Sprintf("shortcut:%s", targetUser.Email)
@@ -2,8 +2,8 @@ package task
 
 import (
 	"cmp"
+	"errors"
 	"fmt"
-	"io"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -14,8 +14,11 @@ import (
 	"github.com/FranLegon/cloud-drives-sync/internal/config"
 	"github.com/FranLegon/cloud-drives-sync/internal/database"
 	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/metrics"
 	"github.com/FranLegon/cloud-drives-sync/internal/model"
 	"github.com/FranLegon/cloud-drives-sync/internal/telegram"
+	"github.com/FranLegon/cloud-drives-sync/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // AccountStatus tracks the state of an account during storage operations
@@ -35,29 +38,37 @@ type accountQuota struct {
 
 // Runner handles task orchestration
 type Runner struct {
-	config                *model.Config
-	db                    *database.DB
-	safeMode              bool
-	stopOnError           bool
-	clients               map[string]api.CloudClient
-	clientsMu             sync.RWMutex
-	folderLocks           sync.Map        // protects ensureFolderStructure per account from concurrent creates
-	msShareFailureCache   map[string]bool // Cache of failed Microsoft sharing attempts (sourceAccount:targetAccount)
-	msShareFailureCacheMu sync.RWMutex
-	accountQuotas         map[string]*accountQuota
-	accountQuotasMu       sync.Mutex
-	folderCache           sync.Map // Cache of resolved folder IDs (path+account -> ID)
+	config          *model.Config
+	db              *database.DB
+	safeMode        bool
+	stopOnError     bool
+	clients         map[string]api.CloudClient
+	clientsMu       sync.RWMutex
+	folderLocks     sync.Map          // protects ensureFolderStructure per account from concurrent creates
+	msShares        map[string]string // Recorded Microsoft sharing state (sourceAccount:targetAccount -> status)
+	msSharesLoaded  bool
+	msSharesMu      sync.Mutex
+	accountQuotas   map[string]*accountQuota
+	accountQuotasMu sync.Mutex
+	folderCache     sync.Map // Cache of resolved folder IDs (path+account -> ID)
+	spoolDir        string   // Directory staging fan-out downloads; empty disables the spool
+	spoolMax        int64
+	spoolUsed       int64
+	spoolMu         sync.Mutex
+	erasure         *ErasureScheme // Shards new uploads instead of replicating them; nil stores full replicas
+	contentKey      []byte         // Wraps the per-file keys of encrypted replicas; nil when not set
+	runLock         *RunLock       // Long operations stop once it is lost; nil when not held
 }
 
 // NewRunner creates a new task runner
 func NewRunner(config *model.Config, db *database.DB, safeMode bool) *Runner {
 	r := &Runner{
-		config:              config,
-		db:                  db,
-		safeMode:            safeMode,
-		clients:             make(map[string]api.CloudClient),
-		msShareFailureCache: make(map[string]bool),
-		accountQuotas:       make(map[string]*accountQuota),
+		config:        config,
+		db:            db,
+		safeMode:      safeMode,
+		clients:       make(map[string]api.CloudClient),
+		msShares:      make(map[string]string),
+		accountQuotas: make(map[string]*accountQuota),
 	}
 	r.PreloadFolderCache()
 	return r
@@ -221,6 +232,7 @@ func (r *Runner) getQuota(user *model.User, client api.CloudClient) (*api.QuotaI
 	r.accountQuotasMu.Lock()
 	r.accountQuotas[key] = &accountQuota{Total: quota.Total, Used: quota.Used}
 	r.accountQuotasMu.Unlock()
+	metrics.SetQuota(string(user.Provider), user.GetAccountID(), quota.Total, quota.Used)
 
 	return &api.QuotaInfo{
 		Total: quota.Total,
@@ -235,6 +247,7 @@ func (r *Runner) updateQuotaUsed(user *model.User, sizeDelta int64) {
 	r.accountQuotasMu.Lock()
 	if q, ok := r.accountQuotas[key]; ok {
 		q.Used += sizeDelta
+		metrics.SetQuota(string(user.Provider), user.GetAccountID(), q.Total, q.Used)
 	}
 	r.accountQuotasMu.Unlock()
 }
@@ -243,6 +256,20 @@ func (r *Runner) SetStopOnError(stop bool) {
 	r.stopOnError = stop
 }
 
+// SetRunLock makes long operations stop between files once lock is lost.
+func (r *Runner) SetRunLock(lock *RunLock) {
+	r.runLock = lock
+}
+
+// checkRunLock returns an error once the run lock has been lost, so that work stops changing
+// the pool another host may hold by now.
+func (r *Runner) checkRunLock() error {
+	if err := r.runLock.Err(); err != nil {
+		return fmt.Errorf("stopping: %w", err)
+	}
+	return nil
+}
+
 // getAccountFolderLock returns a mutex for the given provider and account to serialize folder creation
 func (r *Runner) getAccountFolderLock(provider model.Provider, accountID string) *sync.Mutex {
 	key := model.GenerateCacheKey(provider, accountID)
@@ -276,6 +303,7 @@ func (r *Runner) GetOrCreateClient(user *model.User) (api.CloudClient, error) {
 	if err != nil {
 		return nil, err
 	}
+	client = tracing.WrapClient(client, user.Provider, user.GetAccountID())
 
 	r.clients[key] = client
 	return client, nil
@@ -481,6 +509,11 @@ func (r *Runner) GetMetadata() error {
 }
 
 func (r *Runner) runMetadataPostProcessing(startTime time.Time) error {
+	logger.Info("Marking missing folder replicas as deleted...")
+	if err := r.db.MarkDeletedFolderReplicas(startTime); err != nil {
+		return fmt.Errorf("failed to mark deleted folder replicas: %w", err)
+	}
+
 	logger.Info("Converging duplicate sibling folders...")
 	if err := r.mergeDuplicateSiblingFolders(); err != nil {
 		return fmt.Errorf("failed to merge duplicate sibling folders: %w", err)
@@ -521,16 +554,16 @@ func (r *Runner) runMetadataPostProcessing(startTime time.Time) error {
 		logger.Error("Failed to process hard deletes: %v", err)
 	}
 
+	logger.Info("Updating logical folder status...")
+	if err := r.db.UpdateLogicalFolderStatus(); err != nil {
+		return fmt.Errorf("failed to update logical folder status: %w", err)
+	}
+
 	logger.Info("Processing hard-deleted folder...")
 	if err := r.ProcessHardDeletedFolder(); err != nil {
 		logger.Error("Failed to process hard-deleted folder: %v", err)
 	}
 
-	logger.Info("Projecting discovered folders into logical folder replicas...")
-	if err := r.db.SyncLogicalFoldersFromFolders(); err != nil {
-		return fmt.Errorf("failed to sync logical folders from discovered folders: %w", err)
-	}
-
 	return nil
 }
 
@@ -551,7 +584,7 @@ func (r *Runner) dbWriter(fileChan <-chan *model.File, folderChan <-chan *model.
 
 	flushFolders := func() {
 		if len(folderBuffer) > 0 {
-			if err := r.db.BatchInsertFolders(folderBuffer); err != nil {
+			if err := r.db.BatchUpsertFolders(folderBuffer, time.Now().Unix()); err != nil {
 				logger.Error("Failed to batch insert folders: %v", err)
 			}
 			folderBuffer = folderBuffer[:0]
@@ -598,7 +631,7 @@ func (r *Runner) scanFolder(client api.CloudClient, user *model.User, folderID,
 	}
 
 	for _, file := range files {
-		if file.Name == MetadataFileName {
+		if isHousekeepingFile(file.Name) {
 			continue
 		}
 		file.Path = pathPrefix + "/" + file.Name
@@ -624,6 +657,9 @@ func (r *Runner) scanFolder(client api.CloudClient, user *model.User, folderID,
 	errCh := make(chan error, len(folders))
 
 	for _, folder := range folders {
+		if pathPrefix == "/"+AuxFolder && (folder.Name == MetadataSnapshotsFolder || folder.Name == ShardsFolder) {
+			continue
+		}
 		folder.Path = pathPrefix + "/" + folder.Name
 		folderChan <- folder
 
@@ -720,8 +756,8 @@ func (r *Runner) ShareWithMain() error {
 		}
 	}
 
-	// For Microsoft: ensure backup folders are shared with main
-	// Implementation would be similar
+	// For Microsoft: ensure every account's sync folder is shared with the other accounts
+	r.repairMicrosoftShares()
 
 	logger.Info("Share permissions verified")
 	return nil
@@ -918,17 +954,26 @@ func (r *Runner) BalanceStorage(syncRunID int64) error {
 					targetAccountID := target.User.GetAccountID()
 					logger.InfoTagged(source.User.LogTags(), "Transferring path=%q (%d bytes) to target=%s", file.Path, file.Size, targetAccountID)
 					finalNativeID, err := r.transferOwnershipWithFallback(source.Client, target.Client, target, file, sourceReplica.NativeID, source.User.LogTags())
-					if err != nil {
+					switch {
+					case errors.Is(err, errTransferExpired):
+						if fallbackErr := r.fallbackCopyDelete(source.Client, target, file, sourceReplica.NativeID, source.User.Email, sourceReplica, syncRunID); fallbackErr != nil {
+							logger.Error("Fallback transfer failed: %v", fallbackErr)
+							continue
+						}
+					case errors.Is(err, errTransferStillPending):
+						logger.InfoTagged(source.User.LogTags(), "Skipping path=%q until %s accepts the ownership transfer", file.Path, target.User.Email)
+						continue
+					case err != nil:
 						logger.Error("Failed to transfer ownership: %v", err)
 						continue
-					}
-
-					// Update database to reflect ownership change
-					if finalNativeID != sourceReplica.NativeID {
-						sourceReplica.NativeID = finalNativeID
-					}
-					if err := r.db.UpdateReplicaOwner(string(provider), sourceAccountID, sourceReplica.NativeID, targetAccountID); err != nil {
-						logger.Warning("DB update owner failed path=%q provider=%s account=%s native_id=%s: %v", file.Path, provider, sourceAccountID, sourceReplica.NativeID, err)
+					default:
+						// Update database to reflect ownership change
+						if finalNativeID != sourceReplica.NativeID {
+							sourceReplica.NativeID = finalNativeID
+						}
+						if err := r.db.UpdateReplicaOwner(string(provider), sourceAccountID, sourceReplica.NativeID, targetAccountID); err != nil {
+							logger.Warning("DB update owner failed path=%q provider=%s account=%s native_id=%s: %v", file.Path, provider, sourceAccountID, sourceReplica.NativeID, err)
+						}
 					}
 				} else {
 					logger.DryRunTagged(source.User.LogTags(), "Would transfer path=%q (%d bytes) to target=%s", file.Path, file.Size, target.User.Email)
@@ -1120,14 +1165,18 @@ func (r *Runner) FreeMain(syncRunID int64) (bool, error) {
 
 			if err != nil {
 				// Check for consent error Consumer to Consumer transfer restriction
-				if strings.Contains(err.Error(), "Consent is required") || strings.Contains(err.Error(), "consentRequiredForOwnershipTransfer") || strings.Contains(err.Error(), "transferOwnership parameter must be enabled") {
+				// or a transfer that stayed pending for too long
+				if errors.Is(err, errTransferExpired) || strings.Contains(err.Error(), "Consent is required") || strings.Contains(err.Error(), "consentRequiredForOwnershipTransfer") || strings.Contains(err.Error(), "transferOwnership parameter must be enabled") {
 					fallbackUsed = true
-					if fallbackErr := r.fallbackCopyDelete(mainClient, target, file, mainReplica.NativeID, mainUser.Email, mainReplica); fallbackErr != nil {
+					if fallbackErr := r.fallbackCopyDelete(mainClient, target, file, mainReplica.NativeID, mainUser.Email, mainReplica, syncRunID); fallbackErr != nil {
 						logger.Error("Fallback transfer failed: %v", fallbackErr)
 						continue
 					}
 					filesMoved = true
 					err = nil // Cleared
+				} else if errors.Is(err, errTransferStillPending) {
+					logger.InfoTagged([]string{"Google", mainUser.Email}, "Skipping path=%q until %s accepts the ownership transfer", file.Path, target.User.Email)
+					continue
 				} else {
 					logger.Error("Failed to transfer ownership: %v", err)
 					continue
@@ -1178,9 +1227,9 @@ func (r *Runner) FreeMain(syncRunID int64) (bool, error) {
 	return filesMoved, nil
 }
 
-// fallbackCopyDelete performs a download+upload+delete transfer when ownership transfer is not supported
-func (r *Runner) fallbackCopyDelete(mainClient api.CloudClient, target *AccountStatus, file *model.File, nativeID string, mainEmail string, oldReplicaDB *model.Replica) error {
-	logger.InfoTagged([]string{"Google", mainEmail}, "Transfer via ownership not supported (consent required). Falling back to Copy+Delete...")
+// fallbackCopyDelete performs a copy+delete transfer when ownership transfer is not supported
+func (r *Runner) fallbackCopyDelete(mainClient api.CloudClient, target *AccountStatus, file *model.File, nativeID string, mainEmail string, oldReplicaDB *model.Replica, syncRunID int64) error {
+	logger.InfoTagged([]string{"Google", mainEmail}, "Transfer via ownership not available (consent required or acceptance expired). Falling back to Copy+Delete...")
 
 	// 1. Ensure destination folder exists before starting stream
 	dir := model.NormalizePath(filepath.Dir(file.Path))
@@ -1191,41 +1240,19 @@ func (r *Runner) fallbackCopyDelete(mainClient api.CloudClient, target *AccountS
 		return fmt.Errorf("failed to ensure destination folder: %w", folderErr)
 	}
 
-	// 2. Download
-	pr, pw := io.Pipe()
-	defer pr.Close() // Ensure reader is closed to prevent goroutine leaks if upload fails early
-	downloadErrChan := make(chan error, 1)
-
-	go func() {
-		var dlErr error
-		defer func() {
-			if dlErr != nil {
-				pw.CloseWithError(dlErr)
-			} else {
-				pw.Close()
-			}
-		}()
-		logger.Info("Downloading %s for fallback transfer...", file.Name)
-		if err := mainClient.DownloadFile(nativeID, pw); err != nil {
-			dlErr = err
-			downloadErrChan <- err
-		} else {
-			downloadErrChan <- nil
+	// 2. Copy, server-side when the provider allows it, else download and upload
+	start := time.Now()
+	sourceReplica := &model.Replica{Path: file.Path, Name: file.Name, Size: file.Size, Provider: target.User.Provider, AccountID: mainEmail, NativeID: nativeID}
+	uploadedFile, serverSide := r.serverCopy(target.Client, mainClient, sourceReplica, target.User.Provider, targetFolderID, file.Name)
+	if !serverSide {
+		dest := &copyTarget{provider: target.User.Provider, user: &target.User, client: target.Client, parentID: targetFolderID}
+		result := r.fanOutReplica(mainClient, sourceReplica, file, []*copyTarget{dest}, file.Name)[dest]
+		if result.err != nil {
+			return result.err
 		}
-		close(downloadErrChan)
-	}()
-
-	// 3. Upload
-	logger.Info("Uploading %s to target...", file.Name)
-	uploadedFile, uploadErr := target.Client.UploadFile(targetFolderID, file.Name, pr, file.Size)
-	_ = pr.Close() // Ensure writer stops blocking if upload failed or finished early
-
-	if dlErr := <-downloadErrChan; dlErr != nil {
-		return fmt.Errorf("download failed: %w", dlErr)
-	}
-	if uploadErr != nil {
-		return fmt.Errorf("upload failed: %w", uploadErr)
+		uploadedFile = result.file
 	}
+	r.recordCopy(syncRunID, serverSide, file.Size, time.Since(start))
 
 	logger.InfoTagged([]string{"Google", mainEmail}, "Fallback: Copy successful, deleting original...")
 
@@ -1238,6 +1265,7 @@ func (r *Runner) fallbackCopyDelete(mainClient api.CloudClient, target *AccountS
 
 	// 4. Update DB
 	r.reconcileFallbackDB(uploadedFile, oldReplicaDB, target, file, mainEmail, deleteSucceeded)
+	r.clearPendingTransfer(model.ProviderGoogle, nativeID)
 
 	return nil
 }
@@ -1703,7 +1731,7 @@ func (r *Runner) markTelegramReplicaDeleted(replica *model.Replica, fileName str
 		logger.Error("Failed to get telegram client for %s: %v", replica.AccountID, err)
 		return
 	}
-	if tgClient, ok := client.(*telegram.Client); ok {
+	if tgClient, ok := api.Unwrap(client).(*telegram.Client); ok {
 		if r.safeMode {
 			logger.DryRun("Would mark soft-deleted file on Telegram: %s", fileName)
 			return
@@ -1722,6 +1750,10 @@ func (r *Runner) markTelegramReplicaDeleted(replica *model.Replica, fileName str
 
 // moveReplicaToPath moves a replica to the given target path
 func (r *Runner) moveReplicaToPath(replica *model.Replica, fileName, targetPath string) {
+	ctx, span := tracing.Start(nil, "moveReplicaToPath", attribute.String("path", replica.Path), attribute.String("target_path", targetPath),
+		attribute.String("provider", string(replica.Provider)), attribute.String("account", replica.AccountID))
+	defer span.End()
+
 	user := r.getUser(replica.Provider, replica.AccountID)
 	if user == nil {
 		logger.Error("User not found for replica %s on %s", replica.AccountID, replica.Provider)
@@ -1733,6 +1765,7 @@ func (r *Runner) moveReplicaToPath(replica *model.Replica, fileName, targetPath
 		logger.Error("Failed to get client for %s: %v", replica.AccountID, err)
 		return
 	}
+	client = tracing.Bind(client, ctx)
 
 	targetDir := model.NormalizePath(filepath.Dir(targetPath))
 
@@ -1796,16 +1829,17 @@ func (r *Runner) invalidateFolderCache(provider model.Provider, accountID, path
 }
 
 type duplicateFolderGroup struct {
-	provider       model.Provider
-	accountID      string
-	parentFolderID string
-	parentPath     string
-	name           string
-	folders        []*model.Folder
+	provider   model.Provider
+	accountID  string
+	parentPath string
+	name       string
+	folders    []*model.Folder
 }
 
+// mergeDuplicateSiblingFolders merges same-named sibling folders on one account. Such siblings
+// share a path, so they show up as several active replicas of one logical_folder on that account.
 func (r *Runner) mergeDuplicateSiblingFolders() error {
-	allFolders, err := r.db.GetAllFolders()
+	allFolders, err := r.db.GetAllFolderReplicaViews()
 	if err != nil {
 		return err
 	}
@@ -1826,13 +1860,20 @@ func (r *Runner) mergeDuplicateSiblingFolders() error {
 		if parentPath == "." {
 			parentPath = "/"
 		}
-		key := string(folder.Provider) + "|" + accountID + "|" + folder.ParentFolderID + "|" + folder.Name
+		// Google folders are shared, so every Google account sees the same native folders; they
+		// are merged once through the main account.
+		key := string(folder.Provider) + "|" + accountID + "|" + folder.Path
+		if folder.Provider == model.ProviderGoogle {
+			key = string(folder.Provider) + "|" + folder.Path
+		}
 		group := groups[key]
 		if group == nil {
-			group = &duplicateFolderGroup{provider: folder.Provider, accountID: accountID, parentFolderID: folder.ParentFolderID, parentPath: parentPath, name: folder.Name}
+			group = &duplicateFolderGroup{provider: folder.Provider, accountID: accountID, parentPath: parentPath, name: folder.Name}
 			groups[key] = group
 		}
-		group.folders = append(group.folders, folder)
+		if !slices.ContainsFunc(group.folders, func(f *model.Folder) bool { return f.ID == folder.ID }) {
+			group.folders = append(group.folders, folder)
+		}
 	}
 
 	for _, group := range groups {
@@ -1951,35 +1992,13 @@ func (r *Runner) mergeFolderInto(client api.CloudClient, user *model.User, canon
 	r.invalidateFolderCache(user.Provider, user.GetAccountID(), canonical.Path)
 	r.invalidateFolderCache(user.Provider, user.GetAccountID(), duplicate.Path)
 	if !r.safeMode {
-		if err := r.db.DeleteFolder(duplicate.ID); err != nil {
-			logger.Warning("Failed to delete duplicate folder %s from DB: %v", duplicate.Path, err)
-		}
-		if logicalFolderID := logicalFolderIDForPath(duplicate.Path); logicalFolderID != "" {
-			if err := r.db.InsertLogicalFolder(&model.LogicalFolder{
-				ID:                    logicalFolderID,
-				Path:                  duplicate.Path,
-				Name:                  duplicate.Name,
-				ParentLogicalFolderID: logicalFolderIDForPath(strings.TrimSuffix(duplicate.Path, "/"+duplicate.Name)),
-				Status:                "deleted",
-			}); err != nil {
-				logger.Warning("Failed to mark duplicate logical folder %s deleted: %v", duplicate.Path, err)
-			}
-		}
-		if canonicalLogicalFolderID := logicalFolderIDForPath(canonical.Path); canonicalLogicalFolderID != "" {
-			if err := r.db.InsertFolderReplica(&model.FolderReplica{
-				LogicalFolderID: canonicalLogicalFolderID,
-				Provider:        user.Provider,
-				AccountID:       user.GetAccountID(),
-				NativeFolderID:  canonical.ID,
-				Owner:           canonical.OwnerEmail,
-				LastSeenAt:      time.Now().Unix(),
-			}); err != nil {
-				logger.Warning("Failed to refresh canonical folder replica %s: %v", canonical.Path, err)
-			}
-			cachePrefix := model.GenerateCacheKey(user.Provider, user.GetAccountID()) + ":"
-			trimmedCanonicalPath := strings.Trim(canonical.Path, "/\\")
-			r.folderCache.Store(cachePrefix+trimmedCanonicalPath, canonical.ID)
+		r.markFolderReplicasDeleted(user.Provider, duplicate.ID, duplicate.Path)
+		if err := r.db.UpsertFolder(folderRecord(user.Provider, user.GetAccountID(), canonical.ID, canonical.Path, canonical.OwnerEmail), time.Now().Unix()); err != nil {
+			logger.Warning("Failed to refresh canonical folder replica %s: %v", canonical.Path, err)
 		}
+		cachePrefix := model.GenerateCacheKey(user.Provider, user.GetAccountID()) + ":"
+		trimmedCanonicalPath := strings.Trim(canonical.Path, "/\\")
+		r.folderCache.Store(cachePrefix+trimmedCanonicalPath, canonical.ID)
 	}
 	return nil
 }
@@ -2034,23 +2053,10 @@ func (r *Runner) ensureGoogleFolderOwnedByMain(client api.CloudClient, folder *m
 	folder.OwnerEmail = googleMain.Email
 	folder.UserEmail = googleMain.Email
 	folder.UserPhone = ""
-	if err := r.db.InsertFolder(folder); err != nil {
+	if err := r.db.UpsertFolder(folder, time.Now().Unix()); err != nil {
 		logger.Warning("Failed to update folder owner for %s: %v", folder.Path, err)
 	}
 	if folder.ID != "" {
-		logicalFolderID := logicalFolderIDForPath(folder.Path)
-		if logicalFolderID != "" {
-			if err := r.db.InsertFolderReplica(&model.FolderReplica{
-				LogicalFolderID: logicalFolderID,
-				Provider:        model.ProviderGoogle,
-				AccountID:       googleMain.Email,
-				NativeFolderID:  folder.ID,
-				Owner:           googleMain.Email,
-				LastSeenAt:      time.Now().Unix(),
-			}); err != nil {
-				logger.Warning("Failed to update folder replica owner for %s: %v", folder.Path, err)
-			}
-		}
 		targetDir := strings.Trim(model.NormalizePath(filepath.Dir(folder.Path)), "/")
 		if destID, moveErr := r.ensureFolderStructure(mainClient, targetDir, model.ProviderGoogle); moveErr != nil {
 			logger.Warning("Failed to resolve target folder for duplicate folder %s after ownership acceptance: %v", folder.Path, moveErr)
@@ -2065,12 +2071,33 @@ func (r *Runner) ensureGoogleFolderOwnedByMain(client api.CloudClient, folder *m
 // copyJob represents a file copy operation to be executed by a worker
 type copyJob struct {
 	masterFile *model.File
-	provider   model.Provider
+	providers  []model.Provider
 	targetName string // empty for normal copy, non-empty for conflict resolution
 	path       string // for error reporting
 	syncRunID  int64  // for copy checkpointing (0 to disable)
 }
 
+// mergeCopyJobs merges the jobs copying the same file under the same name to several providers
+// into one, so the file is downloaded once for all of them.
+func mergeCopyJobs(jobs []copyJob) []copyJob {
+	type jobKey struct {
+		masterFile *model.File
+		targetName string
+	}
+	merged := make([]copyJob, 0, len(jobs))
+	index := make(map[jobKey]int)
+	for _, job := range jobs {
+		key := jobKey{job.masterFile, job.targetName}
+		if i, ok := index[key]; ok {
+			merged[i].providers = append(merged[i].providers, job.providers...)
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, job)
+	}
+	return merged
+}
+
 func hasActiveMicrosoftReplicaForOtherAccount(file *model.File, targetAccountID string) bool {
 	if file == nil {
 		return false
@@ -2242,7 +2269,7 @@ func (r *Runner) syncMissingAndConflicts(filesByPath map[string]map[model.Provid
 							scheduledJobs[jobKey] = struct{}{}
 							jobs = append(jobs, copyJob{
 								masterFile: sourceFile,
-								provider:   provider,
+								providers:  []model.Provider{provider},
 								targetName: "",
 								path:       sourceFile.Path,
 								syncRunID:  syncRunID,
@@ -2278,7 +2305,7 @@ func (r *Runner) syncMissingAndConflicts(filesByPath map[string]map[model.Provid
 						scheduledJobs[jobKey] = struct{}{}
 						jobs = append(jobs, copyJob{
 							masterFile: sourceFile,
-							provider:   provider,
+							providers:  []model.Provider{provider},
 							targetName: conflictName,
 							path:       sourceFile.Path,
 							syncRunID:  syncRunID,
@@ -2293,6 +2320,7 @@ func (r *Runner) syncMissingAndConflicts(filesByPath map[string]map[model.Provid
 	if len(jobs) == 0 {
 		return nil
 	}
+	jobs = mergeCopyJobs(jobs)
 
 	// Phase 3: Execute copy jobs in parallel
 	const maxWorkers = 4
@@ -2314,13 +2342,32 @@ func (r *Runner) syncMissingAndConflicts(filesByPath map[string]map[model.Provid
 		go func() {
 			defer copyWg.Done()
 			for job := range jobChan {
+				if err := r.checkRunLock(); err != nil {
+					errChan <- err
+					return
+				}
+				// Retry only the providers that have no copy yet
+				pending := job.providers
+				var errs map[model.Provider]error
 				err := api.WithRetry(func() error {
-					return r.copyFile(job.masterFile, job.provider, job.targetName, job.syncRunID)
+					errs = r.copyFileToProviders(job.masterFile, pending, job.targetName, job.syncRunID)
+					var failed []model.Provider
+					var joined []error
+					for _, provider := range pending {
+						if err := errs[provider]; err != nil {
+							failed = append(failed, provider)
+							joined = append(joined, err)
+						}
+					}
+					pending = failed
+					return errors.Join(joined...)
 				})
 				if err != nil {
-					logger.Error("Copy failed path=%q provider=%s: %v", job.path, job.provider, err)
+					for _, provider := range pending {
+						logger.Error("Copy failed path=%q provider=%s: %v", job.path, provider, errs[provider])
+					}
 					if r.stopOnError {
-						errChan <- fmt.Errorf("failed to copy file %s to %s: %w", job.path, job.provider, err)
+						errChan <- fmt.Errorf("failed to copy file %s to %s: %w", job.path, pending[0], errs[pending[0]])
 						return
 					}
 				}
@@ -2331,7 +2378,7 @@ func (r *Runner) syncMissingAndConflicts(filesByPath map[string]map[model.Provid
 	copyWg.Wait()
 	close(errChan)
 
-	// Return first error if stopOnError was set
+	// Return the first error: a lost run lock, or a failed copy if stopOnError was set
 	if err, ok := <-errChan; ok {
 		return err
 	}
@@ -2362,7 +2409,7 @@ func (r *Runner) enforceSoftDeletedPlacement(masterFile *model.File, softDeleted
 
 		if replica.Provider == model.ProviderTelegram {
 			logger.Info("Marking soft-deleted file on Telegram: %s", masterFile.Name)
-			if tgClient, ok := client.(*telegram.Client); ok {
+			if tgClient, ok := api.Unwrap(client).(*telegram.Client); ok {
 				if err := tgClient.UpdateFileStatus(replica, "deleted"); err != nil {
 					logger.Error("Failed to update file status on Telegram: %v", err)
 				} else {
@@ -2429,6 +2476,13 @@ func (r *Runner) distributeShortcuts(filesByPath map[string]map[model.Provider][
 		}
 	}
 
+	// Replace placeholders with native shortcuts wherever sharing now allows it
+	if len(msUsers) >= 2 {
+		if _, err := r.UpgradePlaceholders(); err != nil {
+			logger.Error("Failed to upgrade placeholders: %v", err)
+		}
+	}
+
 	// Distribute Folders (for empty folders)
 	if err := r.syncFolderStructures(); err != nil {
 		logger.Error("Failed to sync folder structures: %v", err)
@@ -2521,7 +2575,7 @@ func (r *Runner) distributeShortcutsAcrossMSAccounts(msUsers []model.User, files
 				var refreshTarget *shortcutRefreshTarget
 				err := api.WithRetry(func() error {
 					var err error
-					refreshTarget, err = r.createShortcut(job.sourceFile, &job.user, job.syncRunID)
+					refreshTarget, err = r.createShortcut(job.sourceFile, &job.user, job.syncRunID, nil)
 					return err
 				})
 				if err != nil {
@@ -2625,14 +2679,21 @@ func (r *Runner) refreshShortcutTargets(targets []shortcutRefreshTarget) error {
 // syncFolderStructures ensures empty folder structures are replicated across providers
 func (r *Runner) syncFolderStructures() error {
 	logger.Info("Syncing folder structures...")
-	allFolders, err := r.db.GetAllFolderReplicaViews()
+	allFolders, err := r.db.GetAllLogicalFolders()
 	if err != nil {
 		return fmt.Errorf("failed to get folders from DB: %w", err)
 	}
 
+	if err := r.propagateFolderDeletions(allFolders); err != nil {
+		logger.Error("Failed to propagate folder deletions: %v", err)
+	}
+
 	paths := make([]string, 0, len(allFolders))
 	seen := make(map[string]bool, len(allFolders))
 	for _, f := range allFolders {
+		if f.Status != "active" {
+			continue
+		}
 		if f.Name == MetadataFileName || f.Name == AuxFolder || f.Name == SoftDeletedFolder || strings.Contains(f.Path, AuxFolder) {
 			continue
 		}
@@ -2642,8 +2703,18 @@ func (r *Runner) syncFolderStructures() error {
 		}
 	}
 
-	// Process main accounts first so they create (and own) the folders
-	// before backup accounts attempt to access them.
+	r.ensureFoldersOnAllAccounts(paths)
+
+	// Transfer ownership of Google folders not owned by the main account
+	r.claimGoogleFolderOwnership()
+
+	return nil
+}
+
+// ensureFoldersOnAllAccounts creates the given logical folder paths on every Google and
+// Microsoft account. Main accounts go first so they create (and own) the folders before backup
+// accounts attempt to access them.
+func (r *Runner) ensureFoldersOnAllAccounts(paths []string) {
 	var mainUsers, backupUsers []*model.User
 	for i := range r.config.Users {
 		u := &r.config.Users[i]
@@ -2671,11 +2742,6 @@ func (r *Runner) syncFolderStructures() error {
 			}
 		}
 	}
-
-	// Transfer ownership of Google folders not owned by the main account
-	r.claimGoogleFolderOwnership()
-
-	return nil
 }
 
 // claimGoogleFolderOwnership transfers ownership of Google folders to the main account.
@@ -2693,16 +2759,19 @@ func (r *Runner) claimGoogleFolderOwnership() {
 		return
 	}
 
-	allFolders, err := r.db.GetAllFolders()
+	allFolders, err := r.db.GetAllFolderReplicaViews()
 	if err != nil {
 		logger.Warning("Failed to get folders for ownership check: %v", err)
 		return
 	}
 
+	// Every Google account records the shared folders it sees; claim each native folder once.
+	claimed := make(map[string]bool)
 	for _, folder := range allFolders {
-		if folder.Provider != model.ProviderGoogle {
+		if folder.Provider != model.ProviderGoogle || claimed[folder.ID] {
 			continue
 		}
+		claimed[folder.ID] = true
 		// Skip folders already owned by main or with unknown owner
 		if folder.OwnerEmail == "" || folder.OwnerEmail == googleMain.Email {
 			continue
@@ -2749,7 +2818,7 @@ func (r *Runner) claimGoogleFolderOwnership() {
 			if strings.Contains(errStr, "404") || strings.Contains(errStr, "notFound") {
 				// Folder no longer exists — remove stale DB entry
 				logger.Info("Removing stale folder entry %q (no longer exists)", folder.Path)
-				r.db.DeleteFolder(folder.ID)
+				r.db.MarkFolderReplicaDeleted(model.ProviderGoogle, folder.UserEmail, folder.ID)
 				continue
 			}
 			if strings.Contains(errStr, "ONLY_PENDING_OWNER_CAN_BECOME_NEW_OWNER") {
@@ -2771,8 +2840,108 @@ func (r *Runner) claimGoogleFolderOwnership() {
 
 		// Update DB
 		folder.OwnerEmail = googleMain.Email
-		r.db.InsertFolder(folder)
+		r.db.UpsertFolder(folder, time.Now().Unix())
+	}
+}
+
+// propagateFolderDeletions removes the leftover copies of folders that were soft-deleted or deleted
+// elsewhere, deepest first. Only empty copies are removed: their files are moved or deleted by the
+// file sync, so a copy that still holds something is left for a later run.
+func (r *Runner) propagateFolderDeletions(folders []*model.LogicalFolder) error {
+	var gone []*model.LogicalFolder
+	for _, f := range folders {
+		if f.Status == "active" || strings.HasPrefix(f.Path, "/"+AuxFolder+"/") || f.Path == "/"+AuxFolder {
+			continue
+		}
+		gone = append(gone, f)
+	}
+	slices.SortFunc(gone, func(a, b *model.LogicalFolder) int {
+		return cmp.Compare(strings.Count(b.Path, "/"), strings.Count(a.Path, "/"))
+	})
+
+	for _, f := range gone {
+		replicas, err := r.db.GetFolderReplicas(f.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get folder replicas for %s: %w", f.Path, err)
+		}
+		for _, rep := range replicas {
+			if rep.Status != "active" {
+				continue
+			}
+			r.removeEmptyFolderReplica(f, rep, f.Status)
+		}
+	}
+	return nil
+}
+
+// removeEmptyFolderReplica deletes one native folder copy if it is empty and marks it deleted.
+// reason names why the folder goes away in log messages.
+func (r *Runner) removeEmptyFolderReplica(f *model.LogicalFolder, rep *model.FolderReplica, reason string) {
+	accountID := rep.AccountID
+	if rep.Provider == model.ProviderGoogle && strings.TrimSpace(rep.Owner) != "" {
+		accountID = rep.Owner
+	}
+	user := r.getUser(rep.Provider, accountID)
+	if user == nil {
+		return
+	}
+	client, err := r.GetOrCreateClient(user)
+	if err != nil {
+		logger.WarningTagged(user.LogTags(), "Failed to get client to remove folder %s: %v", f.Path, err)
+		return
+	}
+
+	empty, err := folderIsEmpty(client, rep.NativeFolderID)
+	if err != nil {
+		logger.WarningTagged(user.LogTags(), "Failed to inspect %s folder %s: %v", reason, f.Path, err)
+		return
+	}
+	if !empty {
+		logger.InfoTagged(user.LogTags(), "Folder %s is %s but its copy is not empty yet; leaving it for a later run", f.Path, reason)
+		return
+	}
+
+	if r.safeMode {
+		logger.DryRunTagged(user.LogTags(), "Would remove empty %s folder %s", reason, f.Path)
+		return
+	}
+	logger.InfoTagged(user.LogTags(), "Removing empty %s folder %s", reason, f.Path)
+	if err := client.DeleteFolder(rep.NativeFolderID); err != nil {
+		errStr := err.Error()
+		if !strings.Contains(errStr, "404") && !strings.Contains(errStr, "notFound") {
+			logger.WarningTagged(user.LogTags(), "Failed to remove folder %s: %v", f.Path, err)
+			return
+		}
+	}
+	r.markFolderReplicasDeleted(rep.Provider, rep.NativeFolderID, f.Path)
+}
+
+// markFolderReplicasDeleted records that a native folder is gone on every account of its provider
+// (shared Google folders are recorded once per account that sees them).
+func (r *Runner) markFolderReplicasDeleted(provider model.Provider, nativeFolderID, path string) {
+	for i := range r.config.Users {
+		u := &r.config.Users[i]
+		if u.Provider != provider {
+			continue
+		}
+		if err := r.db.MarkFolderReplicaDeleted(provider, u.GetAccountID(), nativeFolderID); err != nil {
+			logger.Warning("Failed to mark folder %s deleted in DB: %v", path, err)
+		}
+		r.invalidateFolderCache(provider, u.GetAccountID(), path)
+	}
+}
+
+// folderIsEmpty reports whether a native folder holds no files and no subfolders.
+func folderIsEmpty(client api.CloudClient, folderID string) (bool, error) {
+	files, err := client.ListFiles(folderID)
+	if err != nil || len(files) > 0 {
+		return false, err
+	}
+	folders, err := client.ListFolders(folderID)
+	if err != nil {
+		return false, err
 	}
+	return len(folders) == 0, nil
 }
 
 // DeleteUnsyncedFiles deletes files in backup accounts that are not in the sync folder
@@ -2973,14 +3142,21 @@ func (r *Runner) ProcessHardDeletes() error {
 		if identity == "" {
 			identity = file.Path
 		}
-		// DEBUG: Log file state for hard delete analysis
-		logger.Info("[DEBUG-HD] File ID=%s, Path=%s, Identity=%s, Status=%s, Replicas=%d",
+		logger.Debug("hard delete check: file_id=%s path=%q identity=%s status=%s replicas=%d",
 			file.ID, file.Path, identity, file.Status, len(file.Replicas))
 		for _, rep := range file.Replicas {
-			logger.Info("[DEBUG-HD]   Replica ID=%d, Provider=%s, Account=%s, NativeID=%s, Status=%s, Path=%s, FileID=%s",
+			logger.Debug("hard delete check: replica_id=%d provider=%s account=%s native_id=%s status=%s path=%q file_id=%s",
 				rep.ID, rep.Provider, rep.AccountID, rep.NativeID, rep.Status, rep.Path, rep.FileID)
 		}
 
+		// Erasure-coded files have no Google copy whose absence would signal a hard delete
+		if shards, err := r.db.GetFileShards(file.ID); err != nil {
+			logger.Error("Failed to load shards for %s: %v", file.Path, err)
+			continue
+		} else if len(shards) > 0 {
+			continue
+		}
+
 		// Check if file is still present in any Google account (active)
 		hasGoogleReplica := false
 		for _, rep := range file.Replicas {
@@ -2990,7 +3166,7 @@ func (r *Runner) ProcessHardDeletes() error {
 			}
 		}
 
-		logger.Info("[DEBUG-HD] hasGoogleReplica=%v for %s", hasGoogleReplica, file.Path)
+		logger.Debug("hard delete check: has_google_replica=%v path=%q", hasGoogleReplica, file.Path)
 
 		if !hasGoogleReplica {
 			logger.Info("Detected Hard Delete for %s (Identity: %s). Propagating...", file.Path, identity)
@@ -3051,7 +3227,7 @@ func (r *Runner) ProcessHardDeletes() error {
 						continue
 					}
 
-					if tgClient, ok := client.(*telegram.Client); ok {
+					if tgClient, ok := api.Unwrap(client).(*telegram.Client); ok {
 						if r.safeMode {
 							logger.DryRun("Would update Telegram caption to 'deleted' for %s", rep.NativeID)
 							continue
@@ -3099,7 +3275,7 @@ func (r *Runner) ProcessHardDeletedFolder() error {
 	}
 
 	if len(filesByID) == 0 {
-		return nil
+		return r.processHardDeletedFolders()
 	}
 
 	files := make([]*model.File, 0, len(filesByID))
@@ -3208,6 +3384,39 @@ func (r *Runner) ProcessHardDeletedFolder() error {
 			logger.Error("[ProcessHardDeletedFolder] Failed to mark file as hard-deleted: %v", err)
 		}
 	}
+	return r.processHardDeletedFolders()
+}
+
+// processHardDeletedFolders removes the folders left inside the hard-deleted folder once their
+// files are gone, deepest first.
+func (r *Runner) processHardDeletedFolders() error {
+	hardDeletedPrefix := "/" + AuxFolder + "/" + HardDeletedFolder + "/"
+
+	allFolders, err := r.db.GetAllLogicalFolders()
+	if err != nil {
+		return fmt.Errorf("failed to get folders for hard-deleted scan: %w", err)
+	}
+	var folders []*model.LogicalFolder
+	for _, f := range allFolders {
+		if f.Status != "deleted" && strings.HasPrefix(f.Path, hardDeletedPrefix) {
+			folders = append(folders, f)
+		}
+	}
+	slices.SortFunc(folders, func(a, b *model.LogicalFolder) int {
+		return cmp.Compare(strings.Count(b.Path, "/"), strings.Count(a.Path, "/"))
+	})
+
+	for _, f := range folders {
+		replicas, err := r.db.GetFolderReplicas(f.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get folder replicas for %s: %w", f.Path, err)
+		}
+		for _, rep := range replicas {
+			if rep.Status == "active" {
+				r.removeEmptyFolderReplica(f, rep, "hard-deleted")
+			}
+		}
+	}
 	return nil
 }
 
@@ -3318,7 +3527,7 @@ func (r *Runner) checkSoftDeletedConsistency(filesByPath map[string]map[model.Pr
 						if syncRunID > 0 && doneCopies != nil && doneCopies[file.ID+"\x00soft-del-cons-"+string(provider)] {
 							continue
 						}
-						if tgClient, ok := client.(*telegram.Client); ok {
+						if tgClient, ok := api.Unwrap(client).(*telegram.Client); ok {
 							logger.Info("Marking file as deleted on Telegram: %s", file.Name)
 							if err := tgClient.UpdateFileStatus(targetReplica, "deleted"); err != nil {
 								logger.Error("Failed to update file status on Telegram: %v", err)
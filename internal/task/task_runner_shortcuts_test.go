@@ -68,3 +68,89 @@ func TestDistributeShortcutsAcrossMSAccountsSchedulesCanonicalPathRepair(t *test
 		t.Fatalf("expected safe mode to avoid creating shortcuts, got %d refresh targets", len(refreshTargets))
 	}
 }
+
+func TestUpgradablePlaceholderRequiresRecordedShare(t *testing.T) {
+	r := NewRunner(&model.Config{}, nil, false)
+	file := &model.File{
+		ID:   "file-1",
+		Path: "/folder/file.txt",
+		Replicas: []*model.Replica{
+			{
+				Provider:   model.ProviderMicrosoft,
+				AccountID:  "b@example.com",
+				NativeID:   "placeholder",
+				NativeHash: model.NativeHashShortcut,
+				Path:       "/folder/file.txt",
+				Status:     "active",
+			},
+			{
+				Provider:   model.ProviderMicrosoft,
+				AccountID:  "a@example.com",
+				NativeID:   "real",
+				NativeHash: "sha1",
+				Path:       "/folder/file.txt",
+				Status:     "active",
+			},
+		},
+	}
+
+	if source := shortcutSourceReplica(file, model.ProviderMicrosoft, "b@example.com"); source == nil || source.NativeID != "real" {
+		t.Fatalf("expected the real copy in another account as shortcut source, got %+v", source)
+	}
+	if p := r.upgradablePlaceholder(file, "b@example.com", "/folder/file.txt"); p != nil {
+		t.Fatalf("expected no upgrade while sharing is unknown, got %+v", p)
+	}
+
+	r.recordMSShare("a@example.com", "b@example.com", model.ShareStatusFailed, nil)
+	if p := r.upgradablePlaceholder(file, "b@example.com", "/folder/file.txt"); p != nil {
+		t.Fatalf("expected no upgrade while sharing fails, got %+v", p)
+	}
+
+	r.recordMSShare("a@example.com", "b@example.com", model.ShareStatusOK, nil)
+	if p := r.upgradablePlaceholder(file, "b@example.com", "/folder/file.txt"); p == nil || p.NativeID != "placeholder" {
+		t.Fatalf("expected the placeholder to be upgradable once shared, got %+v", p)
+	}
+	if p := r.upgradablePlaceholder(file, "a@example.com", "/folder/file.txt"); p != nil {
+		t.Fatalf("expected the real copy not to be treated as a placeholder, got %+v", p)
+	}
+}
+
+func TestHasOtherActiveMicrosoftReplicaAtPath(t *testing.T) {
+	placeholder := &model.Replica{
+		Provider:   model.ProviderMicrosoft,
+		AccountID:  "b@example.com",
+		NativeID:   "placeholder",
+		NativeHash: model.NativeHashShortcut,
+		Path:       "/folder/file.txt",
+		Status:     "active",
+	}
+	file := &model.File{
+		Path: "/folder/file.txt",
+		Replicas: []*model.Replica{
+			placeholder,
+			{
+				Provider:   model.ProviderMicrosoft,
+				AccountID:  "a@example.com",
+				NativeID:   "real",
+				NativeHash: "sha1",
+				Path:       "/folder/file.txt",
+				Status:     "active",
+			},
+		},
+	}
+	if hasOtherActiveMicrosoftReplicaAtPath(file, placeholder) {
+		t.Fatalf("expected a copy in another account not to make the placeholder a leftover")
+	}
+
+	file.Replicas = append(file.Replicas, &model.Replica{
+		Provider:   model.ProviderMicrosoft,
+		AccountID:  "b@example.com",
+		NativeID:   "shortcut",
+		NativeHash: "sha1",
+		Path:       "\\folder\\file.txt",
+		Status:     "active",
+	})
+	if !hasOtherActiveMicrosoftReplicaAtPath(file, placeholder) {
+		t.Fatalf("expected a shortcut in the same account at the same path to make the placeholder a leftover")
+	}
+}
@@ -0,0 +1,400 @@
+package telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/crypto"
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	// captionEnvelopePrefix starts an encrypted caption; the rest is the AES-GCM sealed JSON
+	// metadata in base64. The number is the envelope version.
+	captionEnvelopePrefix = "cds:1:"
+
+	// captionOverflowPrefix starts the caption of a document whose metadata does not fit in a
+	// caption; the rest is the ID of the reply to the document holding the metadata instead.
+	captionOverflowPrefix = "cds:ref:"
+
+	// compactCaptionVersion marks compact caption metadata (see compactCaption).
+	compactCaptionVersion = 2
+
+	maxCaptionLength = 1024 // Telegram's limit on media captions, in UTF-16 code units
+	maxMessageLength = 4096 // Telegram's limit on text messages, in UTF-16 code units
+)
+
+var captionKey []byte
+
+// errNoCaptionKey is returned when an encrypted caption is read without a caption key.
+var errNoCaptionKey = errors.New("caption is encrypted but no caption key is set")
+
+// SetCaptionKey sets the key encrypting caption metadata (see config.CaptionKey). Without it,
+// captions are written as plaintext JSON and encrypted captions cannot be read.
+func SetCaptionKey(key []byte) {
+	captionKey = key
+}
+
+// compactCaption is the caption metadata of a document under short keys, holding only what
+// ListFiles needs to rebuild the replica: the account, native IDs and fragment sizes come from
+// the channel and the messages themselves.
+type compactCaption struct {
+	Version          int    `json:"v"`
+	FileID           string `json:"i"`
+	Path             string `json:"p"`
+	Name             string `json:"n,omitempty"` // omitted when it is the last element of Path
+	Size             int64  `json:"s"`
+	ModTime          int64  `json:"m,omitempty"`  // Unix seconds
+	Status           string `json:"st,omitempty"` // omitted when active
+	Fragmented       bool   `json:"fr,omitempty"`
+	FragmentNumber   int    `json:"fn,omitempty"`
+	FragmentsTotal   int    `json:"ft,omitempty"`
+	Encrypted        bool   `json:"e,omitempty"`
+	CiphertextSHA256 string `json:"h,omitempty"`
+}
+
+func newCompactCaption(meta CaptionMetadata) compactCaption {
+	rep := meta.Replica
+	cc := compactCaption{
+		Version:          compactCaptionVersion,
+		FileID:           rep.FileID,
+		Path:             rep.Path,
+		Size:             rep.Size,
+		Fragmented:       rep.Fragmented,
+		Encrypted:        rep.Encrypted,
+		CiphertextSHA256: rep.CiphertextSHA256,
+	}
+	if rep.Name != path.Base(rep.Path) {
+		cc.Name = rep.Name
+	}
+	if !rep.ModTime.IsZero() {
+		cc.ModTime = rep.ModTime.Unix()
+	}
+	if rep.Status != "active" {
+		cc.Status = rep.Status
+	}
+	if frag := meta.ReplicaFragment; frag != nil {
+		cc.FragmentNumber = frag.FragmentNumber
+		cc.FragmentsTotal = frag.FragmentsTotal
+	}
+	return cc
+}
+
+func (cc compactCaption) metadata() *CaptionMetadata {
+	rep := &model.Replica{
+		FileID:           cc.FileID,
+		Path:             cc.Path,
+		Name:             cc.Name,
+		Size:             cc.Size,
+		Status:           cc.Status,
+		Fragmented:       cc.Fragmented,
+		Encrypted:        cc.Encrypted,
+		CiphertextSHA256: cc.CiphertextSHA256,
+	}
+	if rep.Name == "" {
+		rep.Name = path.Base(cc.Path)
+	}
+	if cc.ModTime != 0 {
+		rep.ModTime = time.Unix(cc.ModTime, 0)
+	}
+	if rep.Status == "" {
+		rep.Status = "active"
+	}
+	meta := &CaptionMetadata{Replica: rep}
+	if cc.FragmentNumber != 0 {
+		meta.ReplicaFragment = &model.ReplicaFragment{FragmentNumber: cc.FragmentNumber, FragmentsTotal: cc.FragmentsTotal}
+	}
+	return meta
+}
+
+// encodeCaption returns the caption holding meta in the compact form, encrypted when a caption
+// key is set. It may be too long for a caption; see overflows.
+func encodeCaption(meta CaptionMetadata) (string, error) {
+	data, err := json.Marshal(newCompactCaption(meta))
+	if err != nil {
+		return "", err
+	}
+	if captionKey == nil {
+		return string(data), nil
+	}
+	sealed, err := crypto.Encrypt(data, captionKey)
+	if err != nil {
+		return "", err
+	}
+	return captionEnvelopePrefix + sealed, nil
+}
+
+// decodeCaption returns the metadata held by a caption and whether it was encrypted. Captions
+// written before the compact form hold the whole replica as plaintext JSON and are still read.
+func decodeCaption(caption string) (*CaptionMetadata, bool, error) {
+	data := []byte(caption)
+	sealed, encrypted := strings.CutPrefix(caption, captionEnvelopePrefix)
+	if encrypted {
+		if captionKey == nil {
+			return nil, true, errNoCaptionKey
+		}
+		var err error
+		if data, err = crypto.Decrypt(sealed, captionKey); err != nil {
+			return nil, true, fmt.Errorf("failed to decrypt caption: %w", err)
+		}
+	}
+
+	var probe struct {
+		Version int `json:"v"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, encrypted, fmt.Errorf("caption holds no metadata: %w", err)
+	}
+	if probe.Version == compactCaptionVersion {
+		var cc compactCaption
+		if err := json.Unmarshal(data, &cc); err != nil {
+			return nil, encrypted, fmt.Errorf("caption holds no metadata: %w", err)
+		}
+		return cc.metadata(), encrypted, nil
+	}
+
+	var meta CaptionMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, encrypted, fmt.Errorf("caption holds no metadata: %w", err)
+	}
+	if meta.Replica == nil {
+		return nil, encrypted, errors.New("caption holds no replica")
+	}
+	return &meta, encrypted, nil
+}
+
+// captionLength returns the length of text as Telegram counts it.
+func captionLength(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// overflows reports whether caption is too long for a document caption and must be written to an
+// overflow reply instead. It fails when caption is too long even for a message.
+func overflows(caption string) (bool, error) {
+	n := captionLength(caption)
+	if n > maxMessageLength {
+		return false, fmt.Errorf("caption metadata is too long for Telegram (%d characters)", n)
+	}
+	return n > maxCaptionLength, nil
+}
+
+// overflowRef returns the ID of the overflow reply a caption points at.
+func overflowRef(caption string) (int, bool) {
+	rest, ok := strings.CutPrefix(caption, captionOverflowPrefix)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.Atoi(rest)
+	return id, err == nil
+}
+
+// isReplyTo reports whether msg is a reply to message msgID.
+func isReplyTo(msg *tg.Message, msgID int) bool {
+	header, ok := msg.ReplyTo.(*tg.MessageReplyHeader)
+	return ok && header.ReplyToMsgID == msgID
+}
+
+// messageMetadata returns the metadata of document message msg, read from its caption or, when
+// the caption points at an overflow reply, from that reply. replies holds the channel's
+// messages without media by ID.
+func messageMetadata(msg *tg.Message, replies map[int]*tg.Message) (*CaptionMetadata, error) {
+	caption := msg.Message
+	if ref, ok := overflowRef(caption); ok {
+		reply, found := replies[ref]
+		if !found || !isReplyTo(reply, msg.ID) {
+			return nil, fmt.Errorf("overflow reply %d not found", ref)
+		}
+		caption = reply.Message
+	}
+	meta, _, err := decodeCaption(caption)
+	return meta, err
+}
+
+// documentName returns the file name given to the document of a part of replica. When captions
+// are encrypted the name would leak what the caption hides, so the file ID is used instead.
+func documentName(name string, replica *model.Replica) string {
+	if captionKey == nil {
+		return name
+	}
+	return replica.FileID
+}
+
+// setCaption sets the caption of document message msgID to meta. Metadata too long for a caption
+// is written to a reply to the document instead, and the caption points at the reply; a reply
+// the caption already points at is edited in place.
+func (c *Client) setCaption(msgID int, meta CaptionMetadata) error {
+	caption, err := encodeCaption(meta)
+	if err != nil {
+		return err
+	}
+	overflow, err := overflows(caption)
+	if err != nil {
+		return err
+	}
+	if !overflow {
+		return c.updateMessageCaption(msgID, caption)
+	}
+	replyID, err := c.overflowReply(msgID)
+	if err != nil {
+		return err
+	}
+	return c.writeOverflow(msgID, replyID, caption)
+}
+
+// writeOverflow writes caption, too long for document message msgID, to its overflow reply
+// replyID. When replyID is 0 a new reply is sent and the document's caption points at it.
+func (c *Client) writeOverflow(msgID, replyID int, caption string) error {
+	if replyID != 0 {
+		return c.updateMessageCaption(replyID, caption)
+	}
+	updates, err := api.WithRetryT(func() (tg.UpdatesClass, error) {
+		return c.client.API().MessagesSendMessage(c.ctx, &tg.MessagesSendMessageRequest{
+			Peer:     &tg.InputPeerChannel{ChannelID: c.channelID, AccessHash: c.accessHash},
+			ReplyTo:  &tg.InputReplyToMessage{ReplyToMsgID: msgID},
+			Message:  caption,
+			RandomID: newRandomID(),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send caption overflow: %w", err)
+	}
+	replyID = sentMessageID(updates)
+	if replyID == 0 {
+		return fmt.Errorf("failed to get caption overflow message ID")
+	}
+	return c.updateMessageCaption(msgID, captionOverflowPrefix+strconv.Itoa(replyID))
+}
+
+// overflowReply returns the ID of the overflow reply the caption of document message msgID points
+// at, or 0 when it has none. A pointer to a message that is not a reply to the document, as left
+// by forwarding it from another channel, does not count.
+func (c *Client) overflowReply(msgID int) (int, error) {
+	msg, err := c.getMessage(msgID)
+	if err != nil {
+		return 0, err
+	}
+	ref, ok := overflowRef(msg.Message)
+	if !ok {
+		return 0, nil
+	}
+	reply, err := c.getMessage(ref)
+	if err != nil || !isReplyTo(reply, msgID) {
+		return 0, nil
+	}
+	return ref, nil
+}
+
+// forEachMessage calls fn for every message of the sync channel, newest first, stopping at the
+// first error.
+func (c *Client) forEachMessage(fn func(msg *tg.Message) error) error {
+	offsetID := 0
+	limit := 100
+
+	for {
+		history, err := api.WithRetryT(func() (tg.MessagesMessagesClass, error) {
+			return c.client.API().MessagesGetHistory(c.ctx, &tg.MessagesGetHistoryRequest{
+				Peer: &tg.InputPeerChannel{
+					ChannelID:  c.channelID,
+					AccessHash: c.accessHash,
+				},
+				OffsetID: offsetID,
+				Limit:    limit,
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get history: %w", err)
+		}
+
+		var messages []tg.MessageClass
+		switch h := history.(type) {
+		case *tg.MessagesChannelMessages:
+			messages = h.Messages
+		case *tg.MessagesMessages:
+			messages = h.Messages
+		case *tg.MessagesMessagesSlice:
+			messages = h.Messages
+		default:
+			return fmt.Errorf("unexpected history type")
+		}
+
+		if len(messages) == 0 {
+			return nil
+		}
+
+		for _, msgClass := range messages {
+			// Update offset for next page BEFORE any continue
+			if id := msgClass.GetID(); id < offsetID || offsetID == 0 {
+				offsetID = id
+			}
+			msg, ok := msgClass.(*tg.Message)
+			if !ok {
+				continue // Skip service messages
+			}
+			if err := fn(msg); err != nil {
+				return err
+			}
+		}
+
+		if len(messages) < limit {
+			return nil
+		}
+	}
+}
+
+// EncryptCaptions rewrites every plaintext metadata caption of the sync channel with the caption
+// key, including those of soft-deleted files, and returns the number of captions rewritten. Already
+// encrypted captions, overflow pointers and messages without metadata are left alone; the overflow
+// replies they point at are rewritten in place. Document file names cannot be changed without
+// uploading the document again, so they stay as they were.
+func (c *Client) EncryptCaptions() (int, error) {
+	if c.channelID == 0 {
+		return 0, fmt.Errorf("channel not initialized")
+	}
+	if captionKey == nil {
+		return 0, errNoCaptionKey
+	}
+
+	migrated := 0
+	err := c.forEachMessage(func(msg *tg.Message) error {
+		if msg.Message == "" {
+			return nil
+		}
+		meta, encrypted, err := decodeCaption(msg.Message)
+		if err != nil || encrypted {
+			return nil
+		}
+		if msg.Media != nil {
+			err = c.setCaption(msg.ID, *meta)
+		} else {
+			err = c.rewriteOverflow(msg.ID, *meta)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update caption of message %d: %w", msg.ID, err)
+		}
+		migrated++
+		logger.Debug("Encrypted caption of message %d", msg.ID)
+		return nil
+	})
+	return migrated, err
+}
+
+// rewriteOverflow rewrites overflow reply msgID with meta.
+func (c *Client) rewriteOverflow(msgID int, meta CaptionMetadata) error {
+	caption, err := encodeCaption(meta)
+	if err != nil {
+		return err
+	}
+	if _, err := overflows(caption); err != nil {
+		return err
+	}
+	return c.updateMessageCaption(msgID, caption)
+}
@@ -0,0 +1,119 @@
+package telegram
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/crypto"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"github.com/gotd/td/tg"
+)
+
+func testCaptionMetadata(path string) CaptionMetadata {
+	return CaptionMetadata{
+		Replica: &model.Replica{
+			FileID: "f1", Path: path, Name: path[strings.LastIndex(path, "/")+1:], Size: 42, AccountID: "+123",
+			ModTime: time.Unix(1700000000, 0), Status: "active", Fragmented: true, Encrypted: true, CiphertextSHA256: "abc",
+		},
+		ReplicaFragment: &model.ReplicaFragment{FragmentNumber: 2, FragmentsTotal: 3},
+	}
+}
+
+func TestCaptionEnvelopeAndLegacyFallback(t *testing.T) {
+	defer SetCaptionKey(nil)
+	meta := testCaptionMetadata("/secret/plans.txt")
+
+	legacy, err := json.Marshal(meta)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	SetCaptionKey(nil)
+	compact, err := encodeCaption(meta)
+	if err != nil {
+		t.Fatalf("encodeCaption: %v", err)
+	}
+	if len(compact) >= len(legacy)/2 || strings.Contains(compact, "+123") {
+		t.Fatalf("expected a compact caption without the account, got %q", compact)
+	}
+
+	SetCaptionKey(crypto.SubKey(make([]byte, 32), "telegram-caption"))
+	sealed, err := encodeCaption(meta)
+	if err != nil {
+		t.Fatalf("encodeCaption: %v", err)
+	}
+	if !strings.HasPrefix(sealed, captionEnvelopePrefix) || strings.Contains(sealed, "plans") {
+		t.Fatalf("expected an opaque envelope, got %q", sealed)
+	}
+
+	for _, caption := range []string{string(legacy), compact, sealed} {
+		got, encrypted, err := decodeCaption(caption)
+		if err != nil {
+			t.Fatalf("decodeCaption(%q): %v", caption, err)
+		}
+		rep := got.Replica
+		if encrypted != (caption == sealed) || rep.Path != "/secret/plans.txt" || rep.Name != "plans.txt" || rep.Size != 42 ||
+			!rep.ModTime.Equal(meta.Replica.ModTime) || rep.Status != "active" || !rep.Fragmented || !rep.Encrypted ||
+			rep.CiphertextSHA256 != "abc" || got.ReplicaFragment.FragmentNumber != 2 || got.ReplicaFragment.FragmentsTotal != 3 {
+			t.Fatalf("unexpected decode of %q: %+v %+v encrypted=%v", caption, rep, got.ReplicaFragment, encrypted)
+		}
+	}
+
+	SetCaptionKey(crypto.SubKey(make([]byte, 32), "other"))
+	if _, _, err := decodeCaption(sealed); err == nil {
+		t.Fatal("expected a caption sealed with another key to fail")
+	}
+	SetCaptionKey(nil)
+	if _, _, err := decodeCaption(sealed); err != errNoCaptionKey {
+		t.Fatalf("expected errNoCaptionKey, got %v", err)
+	}
+	if _, _, err := decodeCaption("just a note"); err == nil {
+		t.Fatal("expected a caption without metadata to fail")
+	}
+}
+
+func TestCaptionOverflowReply(t *testing.T) {
+	defer SetCaptionKey(nil)
+	SetCaptionKey(crypto.SubKey(make([]byte, 32), "telegram-caption"))
+
+	deep := strings.Repeat("/a-rather-long-folder-name", 40) + "/file.bin"
+	caption, err := encodeCaption(testCaptionMetadata(deep))
+	if err != nil {
+		t.Fatalf("encodeCaption: %v", err)
+	}
+	if overflow, err := overflows(caption); err != nil || !overflow {
+		t.Fatalf("expected %d characters to overflow a caption, got %v (%v)", captionLength(caption), overflow, err)
+	}
+	if _, err := overflows(strings.Repeat("x", maxMessageLength+1)); err == nil {
+		t.Fatal("expected metadata longer than a message to fail")
+	}
+
+	doc := &tg.Message{ID: 10, Message: captionOverflowPrefix + "11", Media: &tg.MessageMediaDocument{}}
+	reply := &tg.Message{ID: 11, Message: caption, ReplyTo: &tg.MessageReplyHeader{ReplyToMsgID: 10}}
+	got, err := messageMetadata(doc, map[int]*tg.Message{11: reply})
+	if err != nil {
+		t.Fatalf("messageMetadata: %v", err)
+	}
+	if got.Replica.Path != deep || got.Replica.Name != "file.bin" {
+		t.Fatalf("expected the metadata of the overflow reply, got %+v", got.Replica)
+	}
+
+	// A pointer to a message that does not reply to the document is not followed
+	other := &tg.Message{ID: 11, Message: caption, ReplyTo: &tg.MessageReplyHeader{ReplyToMsgID: 9}}
+	if _, err := messageMetadata(doc, map[int]*tg.Message{11: other}); err == nil {
+		t.Fatal("expected a pointer to an unrelated message to fail")
+	}
+	if _, err := messageMetadata(doc, nil); err == nil {
+		t.Fatal("expected a missing overflow reply to fail")
+	}
+
+	short, err := encodeCaption(testCaptionMetadata("/short.txt"))
+	if err != nil {
+		t.Fatalf("encodeCaption: %v", err)
+	}
+	inline := &tg.Message{ID: 12, Message: short, Media: &tg.MessageMediaDocument{}}
+	if got, err := messageMetadata(inline, nil); err != nil || got.Replica.Path != "/short.txt" {
+		t.Fatalf("expected the inline caption to be read, got %+v (%v)", got, err)
+	}
+}
@@ -4,17 +4,18 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/binary"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/FranLegon/cloud-drives-sync/internal/api"
 	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"github.com/FranLegon/cloud-drives-sync/internal/metrics"
 	"github.com/FranLegon/cloud-drives-sync/internal/model"
 	"github.com/google/uuid"
 	"github.com/gotd/td/telegram"
@@ -23,6 +24,7 @@ import (
 	"github.com/gotd/td/telegram/message"
 	"github.com/gotd/td/telegram/uploader"
 	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
 )
 
 var syncChannelName = "cloud-drives-sync-root"
@@ -67,17 +69,13 @@ func (c *Client) UpdateFileStatus(replica *model.Replica, newStatus string) erro
 		meta := CaptionMetadata{
 			Replica: &repCopy,
 		}
-		caption, err := json.Marshal(meta)
-		if err != nil {
-			return err
-		}
 
 		msgID, err := strconv.Atoi(repCopy.NativeID)
 		if err != nil {
 			return fmt.Errorf("invalid message ID: %w", err)
 		}
 
-		return c.updateMessageCaption(msgID, string(caption))
+		return c.setCaption(msgID, meta)
 	}
 
 	// Fragmented
@@ -86,10 +84,6 @@ func (c *Client) UpdateFileStatus(replica *model.Replica, newStatus string) erro
 			Replica:         &repCopy,
 			ReplicaFragment: frag,
 		}
-		caption, err := json.Marshal(meta)
-		if err != nil {
-			return err
-		}
 
 		msgID, err := strconv.Atoi(frag.NativeFragmentID)
 		if err != nil {
@@ -97,7 +91,7 @@ func (c *Client) UpdateFileStatus(replica *model.Replica, newStatus string) erro
 			continue
 		}
 
-		if err := c.updateMessageCaption(msgID, string(caption)); err != nil {
+		if err := c.setCaption(msgID, meta); err != nil {
 			return fmt.Errorf("failed to update fragment %d: %w", frag.FragmentNumber, err)
 		}
 	}
@@ -105,7 +99,8 @@ func (c *Client) UpdateFileStatus(replica *model.Replica, newStatus string) erro
 	return nil
 }
 
-// updateMessageCaption updates the caption of a message
+// updateMessageCaption updates the caption of a message. Setting the caption it already has is
+// not an error.
 func (c *Client) updateMessageCaption(msgID int, caption string) error {
 	inputPeer := &tg.InputPeerChannel{
 		ChannelID:  c.channelID,
@@ -119,6 +114,9 @@ func (c *Client) updateMessageCaption(msgID int, caption string) error {
 			Message: caption,
 		})
 	})
+	if tgerr.Is(err, "MESSAGE_NOT_MODIFIED") {
+		return nil
+	}
 	return err
 }
 
@@ -397,141 +395,106 @@ func (c *Client) ListFiles(folderID string) ([]*model.File, error) {
 
 	fileMap := make(map[string]*model.File)
 	replicaFragmentMap := make(map[string][]*model.ReplicaFragment) // key is file path
-	offsetID := 0
-	limit := 100
-
-	for {
-		history, err := api.WithRetryT(func() (tg.MessagesMessagesClass, error) {
-			return c.client.API().MessagesGetHistory(c.ctx, &tg.MessagesGetHistoryRequest{
-				Peer: &tg.InputPeerChannel{
-					ChannelID:  c.channelID,
-					AccessHash: c.accessHash,
-				},
-				OffsetID: offsetID,
-				Limit:    limit,
-			})
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to get history: %w", err)
+	// Documents are read once the whole channel is, since the overflow reply holding a
+	// document's metadata may come after it.
+	var documents []*tg.Message
+	replies := make(map[int]*tg.Message)
+	err := c.forEachMessage(func(msg *tg.Message) error {
+		if msg.Message == "" {
+			return nil
 		}
-
-		var messages []tg.MessageClass
-
-		switch h := history.(type) {
-		case *tg.MessagesChannelMessages:
-			messages = h.Messages
-		case *tg.MessagesMessages:
-			messages = h.Messages
-		case *tg.MessagesMessagesSlice:
-			messages = h.Messages
-		default:
-			return nil, fmt.Errorf("unexpected history type")
+		if msg.Media == nil {
+			replies[msg.ID] = msg
+		} else {
+			documents = append(documents, msg)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		if len(messages) == 0 {
-			break
+	for _, msg := range documents {
+		// Parse caption for metadata
+		meta, err := messageMetadata(msg, replies)
+		if err != nil {
+			logger.Debug("Skipping message %d: %v", msg.ID, err)
+			continue
 		}
 
-		for _, msgClass := range messages {
-			// Update offset for next page BEFORE any continue
-			msgClassID := msgClass.GetID()
-			if msgClassID < offsetID || offsetID == 0 {
-				offsetID = msgClassID
-			}
+		fullPath := meta.Replica.Path
 
-			msg, ok := msgClass.(*tg.Message)
-			if !ok {
-				continue // Skip service messages
-			}
-
-			// Parse caption for metadata
-			if msg.Message == "" {
-				continue
-			}
-
-			// Try to parse JSON from caption
-			var meta CaptionMetadata
-			if err := json.Unmarshal([]byte(msg.Message), &meta); err != nil {
-				continue
-			}
-
-			if meta.Replica == nil {
-				continue
+		// Get file size from media
+		var partSize int64
+		if media, ok := msg.Media.(*tg.MessageMediaDocument); ok {
+			if doc, ok := media.Document.(*tg.Document); ok {
+				partSize = doc.Size
 			}
+		}
 
-			fullPath := meta.Replica.Path
+		modTime := time.Unix(int64(msg.Date), 0)
+		msgID := strconv.Itoa(msg.ID)
 
-			// Get file size from media
-			var partSize int64
-			if media, ok := msg.Media.(*tg.MessageMediaDocument); ok {
-				if doc, ok := media.Document.(*tg.Document); ok {
-					partSize = doc.Size
-				}
-			}
-
-			modTime := time.Unix(int64(msg.Date), 0)
-			msgID := strconv.Itoa(msg.ID)
+		// Update Replica struct with current message context
+		meta.Replica.NativeID = msgID
+		// Use caption-stored ModTime if available (keeps it stable across scans).
+		// Fall back to msg.Date for older messages that have no ModTime in caption.
+		if meta.Replica.ModTime.IsZero() {
+			meta.Replica.ModTime = modTime
+		}
+		meta.Replica.Provider = model.ProviderTelegram
+		meta.Replica.AccountID = c.user.Phone
+		meta.Replica.Owner = c.user.Phone
 
-			// Update Replica struct with current message context
-			meta.Replica.NativeID = msgID
-			// Use caption-stored ModTime if available (keeps it stable across scans).
-			// Fall back to msg.Date for older messages that have no ModTime in caption.
-			if meta.Replica.ModTime.IsZero() {
-				meta.Replica.ModTime = modTime
-			}
-			meta.Replica.Provider = model.ProviderTelegram
-			meta.Replica.AccountID = c.user.Phone
-			meta.Replica.Owner = c.user.Phone
+		// Filter out soft-deleted files
+		if meta.Replica.Status == "deleted" || meta.Replica.Status == "soft-deleted" {
+			continue
+		}
 
-			// Filter out soft-deleted files
-			if meta.Replica.Status == "deleted" || meta.Replica.Status == "soft-deleted" {
+		if !meta.Replica.Fragmented {
+			// Single file - create File with Replica
+			// Messages come newest first; keep the latest copy of a path, as a file replaced
+			// by uploading it again is only deleted once the new copy is in place
+			if _, exists := fileMap[fullPath]; exists {
 				continue
 			}
 
-			if !meta.Replica.Fragmented {
-				// Single file - create File with Replica
+			file := &model.File{
+				ID:             meta.Replica.FileID,
+				Name:           meta.Replica.Name,
+				Path:           fullPath,
+				Size:           meta.Replica.Size,
+				GoogleDriveMD5: "",
+				ModTime:        meta.Replica.ModTime,
+				Status:         meta.Replica.Status,
+			}
 
-				file := &model.File{
+			file.Replicas = []*model.Replica{meta.Replica}
+			fileMap[fullPath] = file
+		} else {
+			// Split file - accumulate fragments
+			if _, exists := fileMap[fullPath]; !exists {
+				// Create file structure
+				fileMap[fullPath] = &model.File{
 					ID:             meta.Replica.FileID,
 					Name:           meta.Replica.Name,
 					Path:           fullPath,
-					Size:           meta.Replica.Size,
+					Size:           meta.Replica.Size, // Total size
 					GoogleDriveMD5: "",
 					ModTime:        meta.Replica.ModTime,
 					Status:         meta.Replica.Status,
 				}
+				replicaFragmentMap[fullPath] = []*model.ReplicaFragment{}
+			}
 
-				file.Replicas = []*model.Replica{meta.Replica}
-				fileMap[fullPath] = file
-			} else {
-				// Split file - accumulate fragments
-				if _, exists := fileMap[fullPath]; !exists {
-					// Create file structure
-					fileMap[fullPath] = &model.File{
-						ID:             meta.Replica.FileID,
-						Name:           meta.Replica.Name,
-						Path:           fullPath,
-						Size:           meta.Replica.Size, // Total size
-						GoogleDriveMD5: "",
-						ModTime:        meta.Replica.ModTime,
-						Status:         meta.Replica.Status,
-					}
-					replicaFragmentMap[fullPath] = []*model.ReplicaFragment{}
-				}
-
-				if meta.ReplicaFragment != nil {
-					// Update Fragment context
-					meta.ReplicaFragment.NativeFragmentID = msgID
-					meta.ReplicaFragment.Size = partSize // Ensure size matches actual part
+			if meta.ReplicaFragment != nil {
+				// Update Fragment context
+				meta.ReplicaFragment.NativeFragmentID = msgID
+				meta.ReplicaFragment.Size = partSize // Ensure size matches actual part
 
-					replicaFragmentMap[fullPath] = append(replicaFragmentMap[fullPath], meta.ReplicaFragment)
-				}
+				replicaFragmentMap[fullPath] = append(replicaFragmentMap[fullPath], meta.ReplicaFragment)
 			}
 		}
-
-		if len(messages) < limit {
-			break
-		}
 	}
 
 	// Finalize split files with replicas and fragments
@@ -592,6 +555,7 @@ func (c *Client) ListFiles(folderID string) ([]*model.File, error) {
 
 // UploadFile uploads a file to the sync channel
 func (c *Client) UploadFile(folderID, name string, reader io.Reader, size int64) (*model.File, error) {
+	reader = metrics.CountingReader(reader, string(model.ProviderTelegram), c.user.Phone)
 	if c.channelID == 0 {
 		return nil, fmt.Errorf("channel not initialized")
 	}
@@ -710,9 +674,18 @@ func (c *Client) uploadPart(folderID, name string, reader io.Reader, replica *mo
 		ReplicaFragment: fragment,
 	}
 
-	caption, err := json.Marshal(meta)
+	caption, err := encodeCaption(meta)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal metadata: %w", err)
+		return "", fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	// Metadata too long for a caption goes to a reply once the message is sent
+	overflow, err := overflows(caption)
+	if err != nil {
+		return "", err
+	}
+	sentCaption := caption
+	if overflow {
+		sentCaption = ""
 	}
 
 	// Wrap reader with progress logger
@@ -736,7 +709,7 @@ func (c *Client) uploadPart(folderID, name string, reader io.Reader, replica *mo
 	logger.Info("Starting upload of %s (Part %d, Size: %d)", name, partNum, totalSize)
 
 	// Upload file
-	f, err := c.uploader.FromReader(c.ctx, name, pr)
+	f, err := c.uploader.FromReader(c.ctx, documentName(name, replica), pr)
 	if err != nil {
 		return "", fmt.Errorf("failed to upload file: %w", err)
 	}
@@ -751,21 +724,17 @@ func (c *Client) uploadPart(folderID, name string, reader io.Reader, replica *mo
 		File:     f,
 		MimeType: "application/octet-stream",
 		Attributes: []tg.DocumentAttributeClass{
-			&tg.DocumentAttributeFilename{FileName: name},
+			&tg.DocumentAttributeFilename{FileName: documentName(name, replica)},
 		},
 	}
 
-	// Generate a secure random ID for Telegram
-	var randomID int64
-	if err := binary.Read(rand.Reader, binary.LittleEndian, &randomID); err != nil {
-		randomID = time.Now().UnixNano() // Fallback
-	}
+	randomID := newRandomID()
 
 	updates, err := api.WithRetryT(func() (tg.UpdatesClass, error) {
 		return c.client.API().MessagesSendMedia(c.ctx, &tg.MessagesSendMediaRequest{
 			Peer:     inputChannel,
 			Media:    inputMedia,
-			Message:  string(caption),
+			Message:  sentCaption,
 			RandomID: randomID,
 		})
 	})
@@ -773,29 +742,7 @@ func (c *Client) uploadPart(folderID, name string, reader io.Reader, replica *mo
 		return "", fmt.Errorf("failed to send message: %w", err)
 	}
 
-	// Extract MsgID
-	var msgID int
-	switch u := updates.(type) {
-	case *tg.Updates:
-		for _, m := range u.Updates {
-			if msg, ok := m.(*tg.UpdateNewChannelMessage); ok {
-				msgID = msg.Message.GetID()
-				break
-			}
-			if msg, ok := m.(*tg.UpdateNewMessage); ok {
-				msgID = msg.Message.GetID()
-				break
-			}
-		}
-	case *tg.UpdatesCombined:
-		for _, m := range u.Updates {
-			if msg, ok := m.(*tg.UpdateNewChannelMessage); ok {
-				msgID = msg.Message.GetID()
-				break
-			}
-		}
-	}
-
+	msgID := sentMessageID(updates)
 	if msgID == 0 {
 		return "", fmt.Errorf("failed to get message ID")
 	}
@@ -805,95 +752,305 @@ func (c *Client) uploadPart(folderID, name string, reader io.Reader, replica *mo
 	// Update metadata with the new ID
 	// If this is the first part (or single file), update Replica.NativeID
 	// If it's a fragment, update NativeFragmentID
-
-	needsUpdate := false
+	// Captions do not hold native IDs, so the caption sent stays valid
 	if !replica.Fragmented || (fragment != nil && fragment.FragmentNumber == 1) {
-		if replica.NativeID != msgIDStr {
-			replica.NativeID = msgIDStr
-			needsUpdate = true
-		}
+		replica.NativeID = msgIDStr
 	}
-
 	if fragment != nil {
-		if fragment.NativeFragmentID != msgIDStr {
-			fragment.NativeFragmentID = msgIDStr
-			needsUpdate = true
-		}
+		fragment.NativeFragmentID = msgIDStr
 	}
 
-	if needsUpdate {
-		newCaption, err := json.Marshal(meta)
-		if err == nil {
-			// Update the caption on Telegram
-			// We trust this works, if it fails, we have an inconsistency but the file is there.
-			// Ideally we retry or fail.
-			if err := c.updateMessageCaption(msgID, string(newCaption)); err != nil {
-				return msgIDStr, fmt.Errorf("uploaded but failed to update caption: %w", err)
-			}
+	if overflow {
+		if err := c.writeOverflow(msgID, 0, caption); err != nil {
+			return msgIDStr, fmt.Errorf("uploaded but failed to write caption: %w", err)
 		}
 	}
 
 	return msgIDStr, nil
 }
 
-// DownloadFile downloads a file from Telegram
-func (c *Client) DownloadFile(fileID string, writer io.Writer) error {
+// sentMessageID returns the ID of the message created by a send request, or 0 if updates holds
+// none.
+func sentMessageID(updates tg.UpdatesClass) int {
+	var list []tg.UpdateClass
+	switch u := updates.(type) {
+	case *tg.Updates:
+		list = u.Updates
+	case *tg.UpdatesCombined:
+		list = u.Updates
+	}
+	for _, m := range list {
+		switch msg := m.(type) {
+		case *tg.UpdateNewChannelMessage:
+			return msg.Message.GetID()
+		case *tg.UpdateNewMessage:
+			return msg.Message.GetID()
+		}
+	}
+	return 0
+}
+
+// newRandomID returns the random ID Telegram uses to deduplicate sent messages.
+func newRandomID() int64 {
+	var randomID int64
+	if err := binary.Read(rand.Reader, binary.LittleEndian, &randomID); err != nil {
+		randomID = time.Now().UnixNano() // Fallback
+	}
+	return randomID
+}
+
+// CopyFrom forwards the messages of a replica from another account's sync channel into this
+// account's channel, so the documents are not downloaded and uploaded again, then rewrites their
+// captions for this account. This account must be a member of the other sync channel.
+func (c *Client) CopyFrom(source api.CloudClient, replica *model.Replica, folderID, name string) (*model.File, error) {
+	src, ok := api.Unwrap(source).(*Client)
+	if !ok || src.channelID == 0 {
+		return nil, api.ErrServerCopyUnsupported
+	}
 	if c.channelID == 0 {
-		return fmt.Errorf("channel not initialized")
+		return nil, fmt.Errorf("channel not initialized")
+	}
+	fromPeer, err := c.channelPeer(src.channelID)
+	if err != nil {
+		return nil, err
 	}
 
-	msgID, err := strconv.Atoi(fileID)
+	// Collect the messages in fragment order.
+	var msgIDs []int
+	var fragments []*model.ReplicaFragment
+	if replica.Fragmented {
+		fragments = append(fragments, replica.Fragments...)
+		sort.Slice(fragments, func(i, j int) bool { return fragments[i].FragmentNumber < fragments[j].FragmentNumber })
+		for _, frag := range fragments {
+			id, err := strconv.Atoi(frag.NativeFragmentID)
+			if err != nil {
+				return nil, fmt.Errorf("invalid fragment ID %q: %w", frag.NativeFragmentID, err)
+			}
+			msgIDs = append(msgIDs, id)
+		}
+		if len(msgIDs) == 0 {
+			return nil, fmt.Errorf("replica is fragmented but has no fragments")
+		}
+	} else {
+		id, err := strconv.Atoi(replica.NativeID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file ID: %w", err)
+		}
+		msgIDs = []int{id}
+	}
+
+	randomIDs := make([]int64, len(msgIDs))
+	for i := range randomIDs {
+		randomIDs[i] = newRandomID()
+	}
+	updates, err := api.WithRetryT(func() (tg.UpdatesClass, error) {
+		return c.client.API().MessagesForwardMessages(c.ctx, &tg.MessagesForwardMessagesRequest{
+			FromPeer:   fromPeer,
+			ID:         msgIDs,
+			RandomID:   randomIDs,
+			ToPeer:     &tg.InputPeerChannel{ChannelID: c.channelID, AccessHash: c.accessHash},
+			DropAuthor: true,
+		})
+	})
 	if err != nil {
-		return fmt.Errorf("invalid file ID: %w", err)
+		return nil, fmt.Errorf("failed to forward messages: %w", err)
 	}
 
-	// Get message to find the document
-	msgs, err := api.WithRetryT(func() (tg.MessagesMessagesClass, error) {
-		return c.client.API().ChannelsGetMessages(c.ctx, &tg.ChannelsGetMessagesRequest{
-			Channel: &tg.InputChannel{
-				ChannelID:  c.channelID,
-				AccessHash: c.accessHash,
-			},
-			ID: []tg.InputMessageClass{&tg.InputMessageID{ID: msgID}},
+	// Map each forwarded message to its new ID through the random IDs sent with it.
+	newIDs := make(map[int64]int)
+	if u, ok := updates.(*tg.Updates); ok {
+		for _, update := range u.Updates {
+			if m, ok := update.(*tg.UpdateMessageID); ok {
+				newIDs[m.RandomID] = m.ID
+			}
+		}
+	}
+
+	modTime := time.Now()
+	copied := &model.Replica{
+		FileID:     uuid.New().String(),
+		Path:       folderID + "/" + name,
+		Name:       name,
+		Size:       replica.Size,
+		Provider:   model.ProviderTelegram,
+		AccountID:  c.user.Phone,
+		ModTime:    modTime,
+		Status:     "active",
+		Fragmented: replica.Fragmented,
+	}
+	for i, randomID := range randomIDs {
+		newID, ok := newIDs[randomID]
+		if !ok {
+			return nil, fmt.Errorf("failed to get forwarded message ID")
+		}
+		msgID := strconv.Itoa(newID)
+		if i == 0 {
+			copied.NativeID = msgID
+		}
+		if replica.Fragmented {
+			copied.Fragments = append(copied.Fragments, &model.ReplicaFragment{
+				FragmentNumber:   i + 1,
+				FragmentsTotal:   len(randomIDs),
+				Size:             fragments[i].Size,
+				NativeFragmentID: msgID,
+			})
+		}
+	}
+
+	for i, randomID := range randomIDs {
+		meta := CaptionMetadata{Replica: copied}
+		if copied.Fragmented {
+			meta.ReplicaFragment = copied.Fragments[i]
+		}
+		if err := c.setCaption(newIDs[randomID], meta); err != nil {
+			return nil, fmt.Errorf("forwarded but failed to update caption: %w", err)
+		}
+	}
+
+	return &model.File{
+		ID:       copied.FileID,
+		Name:     name,
+		Path:     copied.Path,
+		Size:     replica.Size,
+		ModTime:  modTime,
+		Status:   "active",
+		Replicas: []*model.Replica{copied},
+	}, nil
+}
+
+// channelPeer returns the input peer of a channel this account is a member of, or
+// api.ErrServerCopyUnsupported if it is not.
+func (c *Client) channelPeer(channelID int64) (tg.InputPeerClass, error) {
+	if channelID == c.channelID {
+		return &tg.InputPeerChannel{ChannelID: c.channelID, AccessHash: c.accessHash}, nil
+	}
+	dialogs, err := api.WithRetryT(func() (tg.MessagesDialogsClass, error) {
+		return c.client.API().MessagesGetDialogs(c.ctx, &tg.MessagesGetDialogsRequest{
+			OffsetPeer: &tg.InputPeerEmpty{},
+			Limit:      100,
 		})
 	})
 	if err != nil {
-		return fmt.Errorf("failed to get message: %w", err)
+		return nil, fmt.Errorf("failed to list dialogs: %w", err)
+	}
+	var chats []tg.ChatClass
+	switch d := dialogs.(type) {
+	case *tg.MessagesDialogs:
+		chats = d.Chats
+	case *tg.MessagesDialogsSlice:
+		chats = d.Chats
+	}
+	for _, chat := range chats {
+		if channel, ok := chat.(*tg.Channel); ok && channel.ID == channelID && !channel.Left {
+			return &tg.InputPeerChannel{ChannelID: channel.ID, AccessHash: channel.AccessHash}, nil
+		}
+	}
+	return nil, api.ErrServerCopyUnsupported
+}
+
+// DownloadFile downloads a file from Telegram
+func (c *Client) DownloadFile(fileID string, writer io.Writer) error {
+	writer = metrics.CountingWriter(writer, string(model.ProviderTelegram), c.user.Phone)
+	loc, err := c.documentLocation(fileID)
+	if err != nil {
+		return err
+	}
+
+	// Download
+	_, err = c.downloader.Download(c.client.API(), loc).Stream(c.ctx, writer)
+	return err
+}
+
+// downloadChunkSize is the part size used for range reads. Telegram requires parts of at most
+// 1 MiB that do not cross a 1 MiB boundary, so aligned 1 MiB parts always qualify.
+const downloadChunkSize = 1024 * 1024
+
+// DownloadFileRange writes length bytes of a document starting at offset (to the end when length
+// is negative), fetching only the parts that cover the range.
+func (c *Client) DownloadFileRange(fileID string, offset, length int64, writer io.Writer) error {
+	writer = metrics.CountingWriter(writer, string(model.ProviderTelegram), c.user.Phone)
+	loc, err := c.documentLocation(fileID)
+	if err != nil {
+		return err
 	}
 
-	var msg *tg.Message
-	switch m := msgs.(type) {
-	case *tg.MessagesChannelMessages:
-		if len(m.Messages) > 0 {
-			if mm, ok := m.Messages[0].(*tg.Message); ok {
-				msg = mm
+	pos := offset - offset%downloadChunkSize
+	skip := offset - pos
+	remaining := length
+	for remaining != 0 {
+		res, err := api.WithRetryT(func() (tg.UploadFileClass, error) {
+			return c.client.API().UploadGetFile(c.ctx, &tg.UploadGetFileRequest{
+				Location: loc,
+				Offset:   pos,
+				Limit:    downloadChunkSize,
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to download part at %d: %w", pos, err)
+		}
+		part, ok := res.(*tg.UploadFile)
+		if !ok {
+			return fmt.Errorf("unexpected response %T for part at %d", res, pos)
+		}
+
+		data := part.Bytes
+		if skip > 0 {
+			if skip >= int64(len(data)) {
+				return io.ErrUnexpectedEOF
 			}
+			data = data[skip:]
+			skip = 0
+		}
+		if remaining > 0 && int64(len(data)) > remaining {
+			data = data[:remaining]
 		}
+		if _, err := writer.Write(data); err != nil {
+			return err
+		}
+		if remaining > 0 {
+			remaining -= int64(len(data))
+		}
+
+		if len(part.Bytes) < downloadChunkSize {
+			// Last part of the document.
+			if remaining > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		pos += downloadChunkSize
+	}
+	return nil
+}
+
+// documentLocation resolves the file location of the document attached to a channel message.
+func (c *Client) documentLocation(fileID string) (tg.InputFileLocationClass, error) {
+	if c.channelID == 0 {
+		return nil, fmt.Errorf("channel not initialized")
 	}
 
-	if msg == nil {
-		return fmt.Errorf("message not found")
+	msgID, err := strconv.Atoi(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file ID: %w", err)
+	}
+
+	// Get message to find the document
+	msg, err := c.getMessage(msgID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Extract document location
-	var loc tg.InputFileLocationClass
 	if media, ok := msg.Media.(*tg.MessageMediaDocument); ok {
 		if doc, ok := media.Document.(*tg.Document); ok {
-			loc = &tg.InputDocumentFileLocation{
+			return &tg.InputDocumentFileLocation{
 				ID:            doc.ID,
 				AccessHash:    doc.AccessHash,
 				FileReference: doc.FileReference,
-			}
+			}, nil
 		}
 	}
-
-	if loc == nil {
-		return fmt.Errorf("no document found in message")
-	}
-
-	// Download
-	_, err = c.downloader.Download(c.client.API(), loc).Stream(c.ctx, writer)
-	return err
+	return nil, fmt.Errorf("no document found in message")
 }
 
 // UpdateFile updates file content (Deletes and re-uploads for Telegram)
@@ -936,19 +1093,48 @@ func (c *Client) DeleteFile(fileID string) error {
 		return fmt.Errorf("invalid file ID: %w", err)
 	}
 
+	// Delete the overflow reply holding the metadata along with the document
+	ids := []int{msgID}
+	if replyID, err := c.overflowReply(msgID); err == nil && replyID != 0 {
+		ids = append(ids, replyID)
+	}
+
 	_, err = api.WithRetryT(func() (*tg.MessagesAffectedMessages, error) {
 		return c.client.API().ChannelsDeleteMessages(c.ctx, &tg.ChannelsDeleteMessagesRequest{
 			Channel: &tg.InputChannel{
 				ChannelID:  c.channelID,
 				AccessHash: c.accessHash,
 			},
-			ID: []int{msgID},
+			ID: ids,
 		})
 	})
 
 	return err
 }
 
+// getMessage returns message msgID of the sync channel
+func (c *Client) getMessage(msgID int) (*tg.Message, error) {
+	msgs, err := api.WithRetryT(func() (tg.MessagesMessagesClass, error) {
+		return c.client.API().ChannelsGetMessages(c.ctx, &tg.ChannelsGetMessagesRequest{
+			Channel: &tg.InputChannel{
+				ChannelID:  c.channelID,
+				AccessHash: c.accessHash,
+			},
+			ID: []tg.InputMessageClass{&tg.InputMessageID{ID: msgID}},
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	if m, ok := msgs.(*tg.MessagesChannelMessages); ok && len(m.Messages) > 0 {
+		if msg, ok := m.Messages[0].(*tg.Message); ok {
+			return msg, nil
+		}
+	}
+	return nil, fmt.Errorf("message not found")
+}
+
 // Unused methods for Telegram (no folders)
 
 func (c *Client) MoveFile(fileID, targetFolderID string) error {
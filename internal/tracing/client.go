@@ -0,0 +1,159 @@
+package tracing
+
+import (
+	"context"
+	"io"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedClient records a span for every CloudClient call. A nil parent means Current.
+type tracedClient struct {
+	api.CloudClient
+	parent context.Context
+	attrs  []attribute.KeyValue
+}
+
+// WrapClient returns client with a span for every call when tracing is enabled, and client
+// itself otherwise. Use api.Unwrap before asserting provider-specific types.
+func WrapClient(client api.CloudClient, provider model.Provider, account string) api.CloudClient {
+	if !enabled {
+		return client
+	}
+	return &tracedClient{
+		CloudClient: client,
+		attrs:       []attribute.KeyValue{attribute.String("provider", string(provider)), attribute.String("account", account)},
+	}
+}
+
+// Bind returns client with its call spans parented to ctx instead of Current. Clients that are
+// not traced are returned as is.
+func Bind(client api.CloudClient, ctx context.Context) api.CloudClient {
+	t, ok := client.(*tracedClient)
+	if !ok {
+		return client
+	}
+	bound := *t
+	bound.parent = ctx
+	return &bound
+}
+
+func (c *tracedClient) Unwrap() api.CloudClient {
+	return c.CloudClient
+}
+
+func (c *tracedClient) start(method string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := Start(c.parent, "CloudClient."+method, append(attrs, c.attrs...)...)
+	return span
+}
+
+func (c *tracedClient) PreFlightCheck() (err error) {
+	span := c.start("PreFlightCheck")
+	defer func() { End(span, err) }()
+	return c.CloudClient.PreFlightCheck()
+}
+
+func (c *tracedClient) ListFiles(folderID string) (files []*model.File, err error) {
+	span := c.start("ListFiles", attribute.String("folder_id", folderID))
+	defer func() {
+		span.SetAttributes(attribute.Int("files", len(files)))
+		End(span, err)
+	}()
+	return c.CloudClient.ListFiles(folderID)
+}
+
+func (c *tracedClient) DownloadFile(fileID string, writer io.Writer) (err error) {
+	span := c.start("DownloadFile", attribute.String("file_id", fileID))
+	defer func() { End(span, err) }()
+	return c.CloudClient.DownloadFile(fileID, writer)
+}
+
+func (c *tracedClient) UploadFile(folderID, name string, reader io.Reader, size int64) (file *model.File, err error) {
+	span := c.start("UploadFile", attribute.String("folder_id", folderID), attribute.String("name", name), attribute.Int64("size", size))
+	defer func() { End(span, err) }()
+	return c.CloudClient.UploadFile(folderID, name, reader, size)
+}
+
+func (c *tracedClient) UpdateFile(fileID string, reader io.Reader, size int64) (err error) {
+	span := c.start("UpdateFile", attribute.String("file_id", fileID), attribute.Int64("size", size))
+	defer func() { End(span, err) }()
+	return c.CloudClient.UpdateFile(fileID, reader, size)
+}
+
+func (c *tracedClient) DeleteFile(fileID string) (err error) {
+	span := c.start("DeleteFile", attribute.String("file_id", fileID))
+	defer func() { End(span, err) }()
+	return c.CloudClient.DeleteFile(fileID)
+}
+
+func (c *tracedClient) MoveFile(fileID, targetFolderID string) (err error) {
+	span := c.start("MoveFile", attribute.String("file_id", fileID), attribute.String("folder_id", targetFolderID))
+	defer func() { End(span, err) }()
+	return c.CloudClient.MoveFile(fileID, targetFolderID)
+}
+
+func (c *tracedClient) ListFolders(parentID string) (folders []*model.Folder, err error) {
+	span := c.start("ListFolders", attribute.String("folder_id", parentID))
+	defer func() {
+		span.SetAttributes(attribute.Int("folders", len(folders)))
+		End(span, err)
+	}()
+	return c.CloudClient.ListFolders(parentID)
+}
+
+func (c *tracedClient) CreateFolder(parentID, name string) (folder *model.Folder, err error) {
+	span := c.start("CreateFolder", attribute.String("folder_id", parentID), attribute.String("name", name))
+	defer func() { End(span, err) }()
+	return c.CloudClient.CreateFolder(parentID, name)
+}
+
+func (c *tracedClient) DeleteFolder(folderID string) (err error) {
+	span := c.start("DeleteFolder", attribute.String("folder_id", folderID))
+	defer func() { End(span, err) }()
+	return c.CloudClient.DeleteFolder(folderID)
+}
+
+func (c *tracedClient) CreateShortcut(parentID, name, targetID, targetDriveID string) (file *model.File, err error) {
+	span := c.start("CreateShortcut", attribute.String("folder_id", parentID), attribute.String("name", name), attribute.String("file_id", targetID))
+	defer func() { End(span, err) }()
+	return c.CloudClient.CreateShortcut(parentID, name, targetID, targetDriveID)
+}
+
+func (c *tracedClient) ShareFolder(folderID, email string, role string) (err error) {
+	span := c.start("ShareFolder", attribute.String("folder_id", folderID), attribute.String("email", email), attribute.String("role", role))
+	defer func() { End(span, err) }()
+	return c.CloudClient.ShareFolder(folderID, email, role)
+}
+
+func (c *tracedClient) VerifyPermissions() (err error) {
+	span := c.start("VerifyPermissions")
+	defer func() { End(span, err) }()
+	return c.CloudClient.VerifyPermissions()
+}
+
+func (c *tracedClient) GetQuota() (quota *api.QuotaInfo, err error) {
+	span := c.start("GetQuota")
+	defer func() { End(span, err) }()
+	return c.CloudClient.GetQuota()
+}
+
+func (c *tracedClient) GetFileMetadata(fileID string) (file *model.File, err error) {
+	span := c.start("GetFileMetadata", attribute.String("file_id", fileID))
+	defer func() { End(span, err) }()
+	return c.CloudClient.GetFileMetadata(fileID)
+}
+
+func (c *tracedClient) TransferOwnership(fileID, newOwnerEmail string) (err error) {
+	span := c.start("TransferOwnership", attribute.String("file_id", fileID), attribute.String("email", newOwnerEmail))
+	defer func() { End(span, err) }()
+	return c.CloudClient.TransferOwnership(fileID, newOwnerEmail)
+}
+
+func (c *tracedClient) AcceptOwnership(fileID string) (newID string, err error) {
+	span := c.start("AcceptOwnership", attribute.String("file_id", fileID))
+	defer func() { End(span, err) }()
+	return c.CloudClient.AcceptOwnership(fileID)
+}
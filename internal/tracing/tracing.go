@@ -0,0 +1,108 @@
+// Package tracing exports OpenTelemetry spans for sync steps, replica operations and provider
+// calls over OTLP.
+//
+// The runner does not thread a context.Context through its operations, so spans find their
+// parent in two ways: the current sync step is held process-wide (SetCurrent), which is sound
+// because a process runs one sync at a time, and operations that run concurrently inside a step
+// bind their clients to their own span (Bind) so provider calls nest under them.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "cloud-drives-sync"
+
+var (
+	tracer = otel.Tracer("github.com/FranLegon/cloud-drives-sync")
+
+	enabled   bool
+	current   = context.Background()
+	currentMu sync.RWMutex
+)
+
+// Setup exports spans over OTLP/HTTP to endpoint (e.g. http://localhost:4318); an http://
+// endpoint is sent without TLS. With an empty endpoint, the standard OTEL_EXPORTER_OTLP_*
+// environment variables are used. Call the returned function before exiting to flush spans.
+func Setup(endpoint string) (shutdown func(context.Context) error, err error) {
+	var opts []otlptracehttp.Option
+	if endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	enabled = true
+	logger.SetTraceIDFunc(CurrentTraceID)
+	return provider.Shutdown, nil
+}
+
+// Enabled reports whether Setup installed an exporter.
+func Enabled() bool {
+	return enabled
+}
+
+// Current returns the context of the running sync step, or of the enclosing run or job.
+func Current() context.Context {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+	return current
+}
+
+// SetCurrent makes ctx the parent of new spans that have no other parent, until restore is
+// called.
+func SetCurrent(ctx context.Context) (restore func()) {
+	currentMu.Lock()
+	prev := current
+	current = ctx
+	currentMu.Unlock()
+	return func() {
+		currentMu.Lock()
+		current = prev
+		currentMu.Unlock()
+	}
+}
+
+// CurrentTraceID returns the trace ID of the current span, or "" outside of a trace.
+func CurrentTraceID() string {
+	sc := trace.SpanContextFromContext(Current())
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// Start starts a span under parent, or under Current when parent is nil.
+func Start(parent context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if parent == nil {
+		parent = Current()
+	}
+	return tracer.Start(parent, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/FranLegon/cloud-drives-sync/internal/api"
+	"github.com/FranLegon/cloud-drives-sync/internal/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type fakeClient struct {
+	api.CloudClient
+}
+
+func (fakeClient) ListFiles(folderID string) ([]*model.File, error) {
+	return []*model.File{{ID: "a"}}, nil
+}
+
+func (fakeClient) DeleteFile(fileID string) error {
+	return errors.New("gone")
+}
+
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	enabled = true
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		enabled = false
+	})
+	return exporter
+}
+
+func TestTracedClientNestsUnderBoundSpan(t *testing.T) {
+	exporter := recordSpans(t)
+
+	stepCtx, step := Start(nil, "step")
+	restore := SetCurrent(stepCtx)
+	if CurrentTraceID() != step.SpanContext().TraceID().String() {
+		t.Fatalf("expected the current trace ID to be the step's")
+	}
+
+	client := WrapClient(fakeClient{}, model.ProviderGoogle, "a@example.com")
+	if _, ok := api.Unwrap(client).(fakeClient); !ok {
+		t.Fatalf("expected Unwrap to return the provider client")
+	}
+	if _, err := client.ListFiles("root"); err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+
+	opCtx, op := Start(nil, "copyFile")
+	if err := Bind(client, opCtx).DeleteFile("x"); err == nil {
+		t.Fatal("expected DeleteFile error")
+	}
+	op.End()
+	restore()
+	step.End()
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+	}
+	stepID := spans["step"].SpanContext.SpanID()
+	if spans["CloudClient.ListFiles"].Parent.SpanID() != stepID {
+		t.Fatalf("expected ListFiles under the current step")
+	}
+	if spans["copyFile"].Parent.SpanID() != stepID {
+		t.Fatalf("expected copyFile under the current step")
+	}
+	del := spans["CloudClient.DeleteFile"]
+	if del.Parent.SpanID() != spans["copyFile"].SpanContext.SpanID() {
+		t.Fatalf("expected DeleteFile under the bound copyFile span")
+	}
+	if del.Status.Code != codes.Error || del.Status.Description != "gone" {
+		t.Fatalf("expected DeleteFile to record its error, got %+v", del.Status)
+	}
+	found := false
+	for _, a := range del.Attributes {
+		if a.Key == "account" && a.Value.AsString() == "a@example.com" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected account attribute, got %v", del.Attributes)
+	}
+	if CurrentTraceID() != "" {
+		t.Fatalf("expected no trace after restoring the current context")
+	}
+}
+
+func TestWrapClientDisabled(t *testing.T) {
+	c := fakeClient{}
+	if got := WrapClient(c, model.ProviderGoogle, "a@example.com"); got != api.CloudClient(c) {
+		t.Fatalf("expected the client to be returned unwrapped when tracing is disabled")
+	}
+}